@@ -0,0 +1,90 @@
+// Command gopper-dictgen builds a target's data dictionary on the host and
+// writes it as a Go source file, so the firmware can serve the compressed
+// dictionary from flash instead of building it at boot.
+//
+// It is run by go generate from each target package:
+//
+//	//go:generate go run ../../cmd/gopper-dictgen -target rp2040
+//
+// The generated file declares dictionaryBlob and dictionaryHash, which the
+// target passes to core.Dictionary.SetPrecompressed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+
+	"gopper/core"
+	"gopper/targets/chip"
+)
+
+var (
+	target = flag.String("target", "", "MCU to generate the dictionary for (rp2040, rp2350)")
+	output = flag.String("o", "dictionary_gen.go", "output file (- for stdout)")
+)
+
+func main() {
+	flag.Parse()
+
+	src, err := generate(*target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gopper-dictgen:", err)
+		os.Exit(1)
+	}
+
+	if *output == "-" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "gopper-dictgen:", err)
+		os.Exit(1)
+	}
+}
+
+// generate registers everything the target firmware registers and renders
+// the resulting dictionary. It uses the global registry, so it can only be
+// called once per process.
+func generate(mcu string) ([]byte, error) {
+	info, ok := chip.Lookup(mcu)
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q", mcu)
+	}
+
+	// Same registration as the target's main()
+	info.Register()
+	core.RegisterFirmwareCommands()
+
+	dict := core.GetGlobalDictionary()
+	dict.BuildDictionary()
+	return render(mcu, dict.Generate(), dict.Fingerprint())
+}
+
+// render writes the generated Go file
+func render(mcu string, blob []byte, hash uint32) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gopper-dictgen -target %s; DO NOT EDIT.\n\n", mcu)
+	fmt.Fprintf(&b, "//go:build %s\n\n", mcu)
+	fmt.Fprintf(&b, "package main\n\n")
+	fmt.Fprintf(&b, "// dictionaryBlob is the zlib-compressed data dictionary (%d bytes)\n", len(blob))
+	fmt.Fprintf(&b, "// As a string constant it stays in flash.\n")
+	fmt.Fprintf(&b, "const dictionaryBlob = \"\" +\n")
+	for i := 0; i < len(blob); i += 32 {
+		end := min(i+32, len(blob))
+		b.WriteString("\t\"")
+		for _, c := range blob[i:end] {
+			fmt.Fprintf(&b, "\\x%02x", c)
+		}
+		b.WriteString("\"")
+		if end < len(blob) {
+			b.WriteString(" +")
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n// dictionaryHash is the fingerprint of the registry the blob was built from\n")
+	fmt.Fprintf(&b, "const dictionaryHash = 0x%08x\n", hash)
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// The generator uses the global registry, so each target is generated in a
+// fresh process: the test binary re-runs itself with this variable set.
+const targetEnv = "GOPPER_DICTGEN_TARGET"
+
+func TestMain(m *testing.M) {
+	if mcu := os.Getenv(targetEnv); mcu != "" {
+		src, err := generate(mcu)
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		os.Stdout.Write(src)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// TestGeneratedDictionariesUpToDate fails when a committed dictionary_gen.go
+// no longer matches the registry (run make dictionaries)
+func TestGeneratedDictionariesUpToDate(t *testing.T) {
+	for _, mcu := range []string{"rp2040", "rp2350"} {
+		cmd := exec.Command(os.Args[0])
+		cmd.Env = append(os.Environ(), targetEnv+"="+mcu)
+		got, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: generate failed: %v", mcu, err)
+		}
+
+		path := filepath.Join("..", "..", "targets", mcu, "dictionary_gen.go")
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", mcu, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is stale, regenerate it with make dictionaries", path)
+		}
+	}
+}
+
+func TestGenerateUnknownTarget(t *testing.T) {
+	if _, err := generate("esp32"); err == nil {
+		t.Error("Expected error for unknown target")
+	}
+}
@@ -0,0 +1,260 @@
+// Command gopper-replay replays a protocol capture (see protocol.Capture)
+// against a Transport backed by the real command registry and the simulated
+// drivers from targets/sim/fake. The received bytes are fed back exactly as
+// they arrived, corrupt frames included, and every frame the replay produces
+// is compared with the frame the simulator sent, so a failing session can be
+// reproduced deterministically.
+//
+// Only the simulator records captures (gopper-sim -capture); the hardware
+// targets do not install one.
+//
+//	gopper-sim -capture /tmp/mcu.gcap
+//	gopper-replay /tmp/mcu.gcap
+//
+// The exit status is 1 when any replayed frame differs from the capture.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopper/core"
+	"gopper/protocol"
+	"gopper/protocol/host"
+	"gopper/targets/chip"
+	"gopper/targets/sim/fake"
+)
+
+var verbose = flag.Bool("v", false, "print every frame, not just mismatches")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gopper-replay [flags] capture-file")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gopper-replay:", err)
+		os.Exit(1)
+	}
+	records, err := protocol.ParseCapture(data)
+	if err != nil {
+		if records == nil {
+			fmt.Fprintln(os.Stderr, "gopper-replay:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "gopper-replay: %v (replaying %d records)\n", err, len(records))
+	}
+
+	r, err := newReplayer(os.Stdout, *verbose)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gopper-replay:", err)
+		os.Exit(1)
+	}
+	res := r.run(records)
+	fmt.Printf("%d received, %d sent, %d mismatched, %d extra\n",
+		res.rx, res.tx, res.mismatched, res.extra)
+	if res.mismatched > 0 || res.extra > 0 {
+		os.Exit(1)
+	}
+}
+
+// result summarizes a replay
+type result struct {
+	rx, tx     int // Captured records in each direction
+	mismatched int // Sent frames the replay did not reproduce
+	extra      int // Replayed frames with no captured counterpart
+}
+
+// replayer feeds captured host bytes to a Transport and checks its output
+type replayer struct {
+	transport *protocol.Transport
+	output    *protocol.ScratchOutput
+	input     []byte   // Received bytes the transport has not consumed yet
+	pending   [][]byte // Replayed frames not yet matched against the capture
+	dict      *host.Dictionary
+	rxTrace   *host.Tracer
+	log       io.Writer
+	verbose   bool
+}
+
+// newReplayer registers everything the simulator registers. It uses the
+// global registry, so it can only be called once per process.
+func newReplayer(log io.Writer, verbose bool) (*replayer, error) {
+	// Same registration order as the simulator's main()
+	core.TimerInit()
+	core.RegisterFirmwareCommands()
+	chip.Sim.Register()
+	fake.NewBoard(uint32(chip.Sim.NumGPIO)).Install()
+
+	gd := core.GetGlobalDictionary()
+	gd.BuildDictionary()
+	dict, err := host.ParseDictionary(gd.Generate())
+	if err != nil {
+		return nil, fmt.Errorf("dictionary: %v", err)
+	}
+
+	r := &replayer{
+		output:  protocol.NewScratchOutput(),
+		dict:    dict,
+		rxTrace: host.NewTracer(dict, host.ToMCU),
+		log:     log,
+		verbose: verbose,
+	}
+	r.transport = protocol.NewTransport(r.output, core.DispatchCommand)
+	r.transport.SetFlushCallback(r.collect)
+	core.SetGlobalTransport(r.transport)
+	return r, nil
+}
+
+// run replays the records in order
+func (r *replayer) run(records []protocol.CaptureRecord) result {
+	var res result
+	for _, rec := range records {
+		// The capture clock is the core time the MCU saw, so handlers that
+		// report the clock reproduce the captured values
+		core.SetTime(rec.Clock)
+
+		switch rec.Kind {
+		case protocol.CaptureRx:
+			res.rx++
+			r.logInput(rec)
+			// The transport sees the bytes it left last time followed by
+			// the new ones, as it did in the simulator's FIFO
+			r.input = append(r.input, rec.Frame...)
+			in := protocol.NewSliceInputBuffer(r.input)
+			r.transport.Receive(in)
+			r.input = append(r.input[:0], in.Data()...)
+			r.collect()
+		case protocol.CaptureTx:
+			res.tx++
+			// Load statistics depend on real main loop timing
+			if r.isStats(rec.Frame) {
+				r.logFrame(rec, false)
+				continue
+			}
+			// Responses sent from timers and tasks
+			core.ProcessTimers()
+			core.RunTasks()
+			r.collect()
+
+			if len(r.pending) == 0 {
+				res.mismatched++
+				r.logFrame(rec, true)
+				fmt.Fprintln(r.log, "    replay: (nothing sent)")
+				continue
+			}
+			got := r.pending[0]
+			r.pending = r.pending[1:]
+			if !bytes.Equal(got, rec.Frame) {
+				res.mismatched++
+				r.logFrame(rec, true)
+				fmt.Fprintf(r.log, "    replay: %s\n", r.describe(got))
+				continue
+			}
+			r.logFrame(rec, false)
+		}
+	}
+
+	core.ProcessTimers()
+	core.RunTasks()
+	r.collect()
+	for _, f := range r.pending {
+		res.extra++
+		fmt.Fprintf(r.log, "extra tx: %s\n", r.describe(f))
+	}
+	return res
+}
+
+// collect moves frames written to the output buffer to the pending list
+func (r *replayer) collect() {
+	data := r.output.Result()
+	for len(data) > 0 {
+		n := int(data[protocol.MessagePositionLen])
+		if n < protocol.MessageLengthMin || n > len(data) {
+			n = len(data)
+		}
+		r.pending = append(r.pending, append([]byte(nil), data[:n]...))
+		data = data[n:]
+	}
+	r.output.Reset()
+}
+
+// logInput prints the messages in received bytes in verbose mode, and
+// always the corrupt frames and resyncs among them
+func (r *replayer) logInput(rec protocol.CaptureRecord) {
+	for _, line := range r.rxTrace.Feed(rec.Frame) {
+		mark := " "
+		if rest, ok := strings.CutPrefix(line, "! "); ok {
+			mark, line = "!", rest
+		} else if !r.verbose {
+			continue
+		}
+		fmt.Fprintf(r.log, "%s rx clock=%d %s\n", mark, rec.Clock, line)
+	}
+}
+
+// logFrame prints a sent frame (always for mismatches, otherwise only in
+// verbose mode)
+func (r *replayer) logFrame(rec protocol.CaptureRecord, mismatch bool) {
+	if !mismatch && !r.verbose {
+		return
+	}
+	mark := " "
+	if mismatch {
+		mark = "!"
+	}
+	fmt.Fprintf(r.log, "%s tx clock=%d seq=%d %s\n", mark, rec.Clock, rec.Seq, r.describe(rec.Frame))
+}
+
+// isStats reports whether a sent frame holds only stats responses
+func (r *replayer) isStats(frame []byte) bool {
+	if len(frame) <= protocol.MessageLengthMin {
+		return false
+	}
+	payload := frame[protocol.MessageHeaderSize : len(frame)-protocol.MessageTrailerSize]
+	msgs, err := r.dict.DecodeResponses(payload)
+	if err != nil {
+		return false
+	}
+	for _, m := range msgs {
+		if m.Name != "stats" {
+			return false
+		}
+	}
+	return true
+}
+
+// describe decodes a frame's messages, falling back to hex
+func (r *replayer) describe(frame []byte) string {
+	if len(frame) < protocol.MessageLengthMin {
+		return fmt.Sprintf("% x", frame)
+	}
+	payload := frame[protocol.MessageHeaderSize : len(frame)-protocol.MessageTrailerSize]
+	if len(payload) == 0 {
+		return fmt.Sprintf("ack seq=%d", frame[protocol.MessagePositionSeq]&protocol.MessageSeqMask)
+	}
+
+	msgs, err := r.dict.DecodeResponses(payload)
+	if err != nil {
+		return fmt.Sprintf("% x (%v)", frame, err)
+	}
+	var b bytes.Buffer
+	for i, m := range msgs {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(m.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"gopper/core"
+	"gopper/protocol"
+	"gopper/protocol/host"
+)
+
+// recordSession runs commands through the replayer's transport with a
+// capture attached, like the simulator does with -capture
+func recordSession(t *testing.T, r *replayer, commands []string) []protocol.CaptureRecord {
+	t.Helper()
+	c := protocol.NewCapture(4096, core.GetTime)
+	r.transport.SetCapture(c)
+	defer r.transport.SetCapture(nil)
+
+	// Line noise ahead of the first frame, which the transport skips
+	r.transport.Receive(protocol.NewSliceInputBuffer([]byte{0x01, 0, 0, 0, 0, protocol.MessageValueSync}))
+
+	for i, name := range commands {
+		payload, err := r.dict.EncodeCommand(name, nil)
+		if err != nil {
+			t.Fatalf("encode %s: %v", name, err)
+		}
+		core.SetTime(uint32(1000 * (i + 1)))
+		r.transport.Receive(protocol.NewSliceInputBuffer(host.EncodeFrame(uint8(i), payload)))
+	}
+	r.output.Reset()
+	r.pending = nil
+
+	records, err := protocol.ParseCapture(c.AppendSnapshot(nil))
+	if err != nil {
+		t.Fatalf("ParseCapture: %v", err)
+	}
+	return records
+}
+
+func TestReplay(t *testing.T) {
+	var log bytes.Buffer
+	r, err := newReplayer(&log, false)
+	if err != nil {
+		t.Fatalf("newReplayer: %v", err)
+	}
+
+	records := recordSession(t, r, []string{"get_clock", "get_uptime", "get_config"})
+	if len(records) != 11 {
+		t.Fatalf("expected the noise with its NAK and 3 commands with ACK and response each, got %d records", len(records))
+	}
+
+	r.transport.Reset()
+	res := r.run(records)
+	if res.rx != 4 || res.tx != 7 || res.mismatched != 0 || res.extra != 0 {
+		t.Fatalf("replay result %+v, log:\n%s", res, log.String())
+	}
+	if !bytes.Contains(log.Bytes(), []byte("! rx ")) {
+		t.Errorf("log does not show the line noise:\n%s", log.String())
+	}
+
+	// A corrupted response must be reported (the config response precedes
+	// the final ACK)
+	resp := &records[len(records)-2]
+	resp.Frame = append(append([]byte(nil), resp.Frame[:len(resp.Frame)-1]...), 0)
+	log.Reset()
+	r.transport.Reset()
+	res = r.run(records)
+	if res.mismatched != 1 {
+		t.Errorf("expected 1 mismatch, got %+v", res)
+	}
+	if !bytes.Contains(log.Bytes(), []byte("config ")) {
+		t.Errorf("mismatch log does not decode the response:\n%s", log.String())
+	}
+}
@@ -0,0 +1,156 @@
+// Command gopper-trace decodes Klipper protocol traffic using a data
+// dictionary and prints one line per message:
+//
+//	seq=3 queue_step oid=3 interval=1200 count=40 add=-2
+//
+// Input is either a raw serial byte dump (one direction, chosen with -dir)
+// or a capture file written by the simulator (protocol.Capture), which
+// holds both directions. CRC failures, resyncs, NAKs and retransmits are marked with
+// "!". The dictionary comes from a file (zlib or JSON, e.g. saved from
+// identify), from a live MCU via -port, or is generated in-process for a
+// known target with -target.
+//
+//	gopper-trace -dict mcu.dict -dir mcu dump.bin
+//	gopper-trace -target linux-sim capture.gcap
+//	gopper-trace -port /dev/ttyACM0 -dir host - < dump.bin
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopper/core"
+	"gopper/protocol"
+	"gopper/protocol/host"
+	"gopper/targets/chip"
+)
+
+var (
+	dictPath = flag.String("dict", "", "dictionary file (zlib-compressed or JSON)")
+	target   = flag.String("target", "", "generate the dictionary for this MCU (rp2040, rp2350, linux-sim)")
+	port     = flag.String("port", "", "fetch the dictionary from the MCU on this serial port")
+	dir      = flag.String("dir", "mcu", "direction of a raw dump: mcu (sent by the MCU) or host (sent by the host)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gopper-trace [flags] file|-")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "gopper-trace:", err)
+		os.Exit(1)
+	}
+}
+
+// run loads the dictionary and input and prints the trace
+func run(path string, w io.Writer) error {
+	dict, err := loadDictionary()
+	if err != nil {
+		return fmt.Errorf("dictionary: %v", err)
+	}
+
+	var data []byte
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if bytes.HasPrefix(data, []byte("GCAP")) {
+		records, err := protocol.ParseCapture(data)
+		traceCapture(w, dict, records)
+		return err
+	}
+
+	var d host.Direction
+	switch *dir {
+	case "mcu":
+		d = host.FromMCU
+	case "host":
+		d = host.ToMCU
+	default:
+		return fmt.Errorf("unknown direction %q", *dir)
+	}
+	traceRaw(w, dict, d, data)
+	return nil
+}
+
+// loadDictionary gets the dictionary from exactly one of -dict, -target
+// and -port
+func loadDictionary() (*host.Dictionary, error) {
+	set := 0
+	for _, s := range []string{*dictPath, *target, *port} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("specify exactly one of -dict, -target and -port")
+	}
+
+	switch {
+	case *dictPath != "":
+		data, err := os.ReadFile(*dictPath)
+		if err != nil {
+			return nil, err
+		}
+		return host.ParseDictionary(data)
+
+	case *target != "":
+		info, ok := chip.Lookup(*target)
+		if !ok {
+			return nil, fmt.Errorf("unknown target %q", *target)
+		}
+		// Same registration as gopper-dictgen
+		info.Register()
+		core.RegisterFirmwareCommands()
+		dict := core.GetGlobalDictionary()
+		dict.BuildDictionary()
+		return host.ParseDictionary(dict.Generate())
+
+	default:
+		c, err := host.Open(*port)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		return c.Identify()
+	}
+}
+
+// traceRaw prints a one-direction byte dump
+func traceRaw(w io.Writer, dict *host.Dictionary, d host.Direction, data []byte) {
+	for _, line := range host.NewTracer(dict, d).Feed(data) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// traceCapture prints both directions of a capture, prefixing each line
+// with the MCU clock and ">" (to the MCU) or "<" (from the MCU)
+func traceCapture(w io.Writer, dict *host.Dictionary, records []protocol.CaptureRecord) {
+	rx := host.NewTracer(dict, host.ToMCU)
+	tx := host.NewTracer(dict, host.FromMCU)
+	for _, rec := range records {
+		tr, arrow := tx, "<"
+		if rec.Kind == protocol.CaptureRx {
+			tr, arrow = rx, ">"
+		}
+		for _, line := range tr.Feed(rec.Frame) {
+			fmt.Fprintf(w, "clock=%d %s %s\n", rec.Clock, arrow, line)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopper/protocol"
+	"gopper/protocol/host"
+)
+
+const testDictionary = `{"version":"test","config":{"MCU":"test"},` +
+	`"commands":{"identify offset=%u count=%c":1,"get_clock":2},` +
+	`"responses":{"identify_response offset=%u data=%.*s":0,"clock clock=%u":3}}`
+
+func TestTraceCapture(t *testing.T) {
+	dir := t.TempDir()
+	*dictPath = filepath.Join(dir, "mcu.dict")
+	if err := os.WriteFile(*dictPath, []byte(testDictionary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { *dictPath = "" }()
+
+	clock := uint32(500)
+	c := protocol.NewCapture(1024, func() uint32 { return clock })
+	c.Record(protocol.CaptureRx, 0, host.EncodeFrame(0, []byte{2}))
+	clock = 510
+	c.Record(protocol.CaptureTx, 1, host.EncodeFrame(1, []byte{3, 0x83, 0x7A}))
+	c.Record(protocol.CaptureTx, 1, host.EncodeFrame(1, nil))
+	path := filepath.Join(dir, "trace.gcap")
+	if err := os.WriteFile(path, c.AppendSnapshot(nil), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run(path, &out); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := strings.Join([]string{
+		"clock=500 > seq=0 get_clock",
+		"clock=510 < seq=1 clock clock=506",
+		"clock=510 < seq=1 ack",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestLoadDictionaryNeedsOneSource(t *testing.T) {
+	if _, err := loadDictionary(); err == nil {
+		t.Error("Expected error without a dictionary source")
+	}
+}
@@ -1,11 +1,10 @@
-//go:build tinygo
-
 // ADC (Analog to Digital Converter) support
 // Implements Klipper's analog_in protocol for reading analog sensors
 package core
 
 import (
 	"gopper/protocol"
+	"unsafe"
 )
 
 // ADC states
@@ -52,16 +51,24 @@ type AnalogIn struct {
 var analogInputs = make(map[uint8]*AnalogIn)
 
 // GetADC retrieves an analog input by OID
+// The MCU shuts down if the OID is not an analog input.
 func GetADC(oid uint8) (*AnalogIn, bool) {
+	if LookupOID(oid, OIDAnalogIn) != nil {
+		return nil, false
+	}
 	adc, exists := analogInputs[oid]
 	return adc, exists
 }
 
 // Wake flag for analog-in task
-var analogInWake bool
+var analogInWake TaskWake
 
 // InitADCCommands registers ADC-related commands with the command registry
 func InitADCCommands() {
+	RegisterShutdown(ShutdownAllAnalogIn)
+	RegisterConfigReset(releaseAllAnalogIn)
+	RegisterTask("analog_in", AnalogInTask)
+
 	// Command to configure an analog input pin
 	RegisterCommand("config_analog_in", "oid=%c pin=%u", handleConfigAnalogIn)
 
@@ -78,14 +85,10 @@ func InitADCCommands() {
 }
 
 // handleConfigAnalogIn configures a pin for analog input sampling
-func handleConfigAnalogIn(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigAnalogIn(args *Args) error {
+	oid := args.Uint(0)
+	pin := args.Uint(1)
+	if err := AllocOID(uint8(oid), OIDAnalogIn); err != nil {
 		return err
 	}
 
@@ -94,11 +97,13 @@ func handleConfigAnalogIn(data *[]byte) error {
 		OID:   uint8(oid),
 		Pin:   pin,
 		State: ADCStateReady,
+		Timer: Timer{Owner: TimerOwnerAnalogIn},
 	}
 
 	// Initialize the ADC hardware for this pin via HAL
 	// We treat the Klipper "pin" value as a logical ADCChannelID understood by the target.
 	if err := MustADC().ConfigureChannel(ADCChannelID(pin)); err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -109,54 +114,26 @@ func handleConfigAnalogIn(data *[]byte) error {
 }
 
 // handleQueryAnalogIn starts periodic analog sampling
-func handleQueryAnalogIn(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleCount, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	restTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	minValue, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	maxValue, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	rangeCheckCount, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleQueryAnalogIn(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
+	sampleTicks := args.Uint(2)
+	sampleCount := args.Uint(3)
+	restTicks := args.Uint(4)
+	minValue := args.Uint(5)
+	maxValue := args.Uint(6)
+	rangeCheckCount := args.Uint(7)
 
 	// Get the analog input object
-	ain, exists := analogInputs[uint8(oid)]
+	ain, exists := GetADC(uint8(oid))
 	if !exists {
-		// Invalid OID - analog input not configured
-		return nil
+		return errInvalidOID
 	}
 
+	// The timer may be pending, so update it with interrupts disabled
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
 	// Configure sampling parameters
 	ain.SampleTime = sampleTicks
 	ain.SampleCount = uint8(sampleCount)
@@ -174,8 +151,8 @@ func handleQueryAnalogIn(data *[]byte) error {
 	// If sample count is zero, match Klipper semantics: do not schedule sampling.
 	if ain.SampleCount == 0 {
 		ain.State = ADCStateReady
-		// Optionally ensure the timer is not queued anymore
-		ain.Timer.Next = nil
+		// Make sure the timer is not queued anymore
+		CancelTimer(&ain.Timer)
 		return nil
 	}
 
@@ -183,8 +160,6 @@ func handleQueryAnalogIn(data *[]byte) error {
 	ain.State = ADCStateSampling
 
 	// Schedule first sample
-	// IMPORTANT: Clear Next pointer to avoid issues if timer was previously scheduled
-	ain.Timer.Next = nil
 	ain.Timer.WakeTime = clock
 	ain.Timer.Handler = analogInTimerHandler
 	ScheduleTimer(&ain.Timer)
@@ -192,25 +167,13 @@ func handleQueryAnalogIn(data *[]byte) error {
 	return nil
 }
 
-// wakeAnalogInTask marks the analog-in task as needing to run.
-func wakeAnalogInTask() {
-	state := disableInterrupts()
-	analogInWake = true
-	restoreInterrupts(state)
-}
-
 // AnalogInTask mirrors Klipper's analog_in_task:
 // it runs in task context, sends analog_in_state messages for any
 // AnalogIn that has completed a sample cycle, and advances its state.
 func AnalogInTask() {
-	// Fast check with interrupt protection to avoid races with the timer.
-	state := disableInterrupts()
-	if !analogInWake {
-		restoreInterrupts(state)
+	if !analogInWake.Check() {
 		return
 	}
-	analogInWake = false
-	restoreInterrupts(state)
 
 	// Iterate all configured analog inputs and send any pending reports.
 	for oid, ain := range analogInputs {
@@ -224,7 +187,7 @@ func AnalogInTask() {
 		}
 
 		// Take a snapshot of the fields that the timer may also touch.
-		state = disableInterrupts()
+		state := disableInterrupts()
 		if ain.State != ADCStateReportPending {
 			// State changed while we were waiting; skip.
 			restoreInterrupts(state)
@@ -250,35 +213,31 @@ func AnalogInTask() {
 
 // analogInTimerHandler is the timer callback for ADC sampling
 func analogInTimerHandler(t *Timer) uint8 {
-	// Find the AnalogIn instance that owns this timer
-	// Note: analogInputs is map[uint8]*AnalogIn, so we need to compare timer addresses correctly
-	var ain *AnalogIn
-	for _, aPtr := range analogInputs {
-		if aPtr != nil && &aPtr.Timer == t {
-			ain = aPtr
-			break
-		}
-	}
+	ain := timerContainer[AnalogIn](t, unsafe.Offsetof(AnalogIn{}.Timer))
 
-	if ain == nil {
-		// Timer fired but no AnalogIn found - should not happen
-		// Return SF_DONE to remove timer from schedule
-		return SF_DONE
+	state := disableInterrupts()
+	sampling := ain.State == ADCStateSampling
+	if sampling && ain.SampleCount == 0 {
+		// If sample count is zero, match Klipper semantics: do not sample
+		// or report and return to the ready state.
+		ain.State = ADCStateReady
+		sampling = false
 	}
-
-	if ain.State != ADCStateSampling {
+	restoreInterrupts(state)
+	if !sampling {
 		return SF_DONE
 	}
 
-	// If sample count is zero, match Klipper semantics: do not sample or report
-	// and return to the ready state.
-	if ain.SampleCount == 0 {
-		ain.State = ADCStateReady
+	// Read ADC sample synchronously via HAL, outside the critical section
+	// as the conversion waits on the ADC
+	value, err := MustADC().ReadRaw(ADCChannelID(ain.Pin))
+
+	state = disableInterrupts()
+	defer restoreInterrupts(state)
+	if ain.State != ADCStateSampling || t.Pending() {
+		// query_analog_in started over meanwhile
 		return SF_DONE
 	}
-
-	// Read ADC sample synchronously via HAL
-	value, err := MustADC().ReadRaw(ADCChannelID(ain.Pin))
 	if err != nil {
 		// On read failure, stop sampling this input
 		ain.State = ADCStateReady
@@ -326,7 +285,7 @@ func analogInTimerHandler(t *Timer) uint8 {
 		t.WakeTime = ain.NextBeginTime
 
 		// Wake the analog-in task to send the report from task context
-		wakeAnalogInTask()
+		analogInWake.Wake()
 
 		return SF_RESCHEDULE
 	}
@@ -344,7 +303,7 @@ func ShutdownAnalogIn(ain *AnalogIn) {
 	}
 	ain.PendingValue = 0
 	// Ensure its timer is no longer scheduled
-	ain.Timer.Next = nil
+	CancelTimer(&ain.Timer)
 }
 
 // ShutdownAllAnalogIn stops sampling on all configured analog inputs.
@@ -356,3 +315,8 @@ func ShutdownAllAnalogIn() {
 		}
 	}
 }
+
+// releaseAllAnalogIn forgets every analog input (called on config reset)
+func releaseAllAnalogIn() {
+	clear(analogInputs)
+}
@@ -1,22 +1,9 @@
-//go:build tinygo
-
 package core
 
-import "machine"
-
-// ADCPin identifies an ADC pin.
-type ADCPin machine.ADC
-
-// ADCChannelID identifies a logical ADC channel.
-type ADCChannelID machine.ADCChannel
-
 // ADCValue is the "raw" ADC reading as seen by the rest of the firmware.
 // Convention here: 16-bit value, even if underlying hardware is 12 bits.
 type ADCValue uint16
 
-// ADCConfig is the high-level config the core cares about.
-type ADCConfig machine.ADCConfig
-
 // ADCDriver is the abstract ADC interface that core code uses.
 type ADCDriver interface {
 	// Init powers up and configures the ADC peripheral.
@@ -0,0 +1,14 @@
+//go:build !tinygo
+
+package core
+
+// ADCChannelID identifies a logical ADC channel (regular Go implementation)
+type ADCChannelID uint8
+
+// ADCConfig mirrors machine.ADCConfig for regular Go builds
+type ADCConfig struct {
+	Reference  uint32 // analog reference voltage (AREF) in millivolts
+	Resolution uint32 // number of bits for a single conversion
+	Samples    uint32 // number of samples for a single conversion
+	SampleTime uint32 // sample time in microseconds
+}
@@ -0,0 +1,14 @@
+//go:build tinygo
+
+package core
+
+import "machine"
+
+// ADCPin identifies an ADC pin.
+type ADCPin machine.ADC
+
+// ADCChannelID identifies a logical ADC channel.
+type ADCChannelID machine.ADCChannel
+
+// ADCConfig is the high-level config the core cares about.
+type ADCConfig machine.ADCConfig
@@ -0,0 +1,65 @@
+package core
+
+import "gopper/protocol"
+
+// MaxCommandArgs is the maximum number of parameters a command format may declare
+const MaxCommandArgs = 12
+
+// Args holds the decoded arguments of one command, indexed in format order
+// (e.g. for "oid=%c interval=%u count=%hu add=%hi", add is index 3).
+//
+// Handlers read each argument with the accessor matching its format type:
+//
+//	%c %hu %u     -> Uint
+//	%hi %i        -> Int
+//	%s %*s %.*s   -> Bytes
+//
+// Accessors are not checked at runtime; TestCommandHandlerArgs verifies
+// every handler against its registered format.
+type Args struct {
+	vals [MaxCommandArgs]uint32
+	bufs [MaxCommandArgs][]byte
+	n    uint8
+}
+
+// decode fills args from a command's encoded parameters
+// Buffers alias the frame data and are only valid during the handler call
+func (a *Args) decode(cmd *Command, data *[]byte) error {
+	for i, p := range cmd.Params {
+		if p.Type.IsBuffer() {
+			buf, err := protocol.DecodeVLQBytes(data)
+			if err != nil {
+				return err
+			}
+			a.bufs[i] = buf
+			continue
+		}
+		v, err := protocol.DecodeVLQInt(data)
+		if err != nil {
+			return err
+		}
+		a.vals[i] = uint32(v)
+	}
+	a.n = uint8(len(cmd.Params))
+	return nil
+}
+
+// Len returns the number of decoded arguments
+func (a *Args) Len() int {
+	return int(a.n)
+}
+
+// Uint returns an unsigned integer argument (%c, %hu, %u)
+func (a *Args) Uint(i int) uint32 {
+	return a.vals[i]
+}
+
+// Int returns a signed integer argument (%hi, %i)
+func (a *Args) Int(i int) int32 {
+	return int32(a.vals[i])
+}
+
+// Bytes returns a buffer argument (%s, %*s, %.*s)
+func (a *Args) Bytes(i int) []byte {
+	return a.bufs[i]
+}
@@ -2,18 +2,21 @@ package core
 
 import (
 	"errors"
+	"gopper/protocol"
 	"sync"
 )
 
-// CommandHandler is a function that handles a command with raw frame data
-// The handler is responsible for decoding its own arguments from the data pointer
-type CommandHandler func(data *[]byte) error
+// CommandHandler is a function that handles a command
+// Arguments are decoded by the registry according to the command's format
+// string and passed in format order (see Args)
+type CommandHandler func(args *Args) error
 
 // Command represents a Klipper command
 type Command struct {
 	ID      uint16
 	Name    string
-	Format  string // Format string for dictionary (e.g., "oid=%c pin=%u")
+	Format  string           // Format string for dictionary (e.g., "oid=%c pin=%u")
+	Params  []protocol.Param // Parameters parsed from Format at registration
 	Handler CommandHandler
 }
 
@@ -53,6 +56,16 @@ func (r *CommandRegistry) Register(name string, format string, handler CommandHa
 		return id
 	}
 
+	// Parse the format up front so a bad format fails at startup,
+	// not when the host first sends the command
+	params, err := protocol.ParseFormat(format)
+	if err != nil {
+		panic("invalid format for " + name + ": " + format)
+	}
+	if len(params) > MaxCommandArgs {
+		panic("too many parameters for " + name)
+	}
+
 	id := r.nextID
 	r.nextID++
 
@@ -60,6 +73,7 @@ func (r *CommandRegistry) Register(name string, format string, handler CommandHa
 		ID:      id,
 		Name:    name,
 		Format:  format,
+		Params:  params,
 		Handler: handler,
 	}
 
@@ -87,13 +101,17 @@ func (r *CommandRegistry) Count() int {
 	return len(r.commands)
 }
 
-// Dispatch calls the appropriate command handler
+// Dispatch decodes a command's arguments and calls its handler
+// data is advanced past the command's arguments
 func (r *CommandRegistry) Dispatch(cmdID uint16, data *[]byte) error {
 	cmd, ok := r.GetCommand(cmdID)
 	if !ok {
 		DebugPrintln("[CMD] Unknown command ID: " + itoa(int(cmdID)))
 		return errors.New("unknown command ID: " + itoa(int(cmdID)))
 	}
+	if cmd.Handler == nil {
+		return errors.New("not a command: " + cmd.Name)
+	}
 	id := itoa(int(cmdID))
 	if id == "1" || id == "3" {
 		//nop
@@ -101,7 +119,11 @@ func (r *CommandRegistry) Dispatch(cmdID uint16, data *[]byte) error {
 		DebugPrintln("[CMD] Dispatch: ID=" + itoa(int(cmdID)) + " name=" + cmd.Name)
 	}
 
-	return cmd.Handler(data)
+	var args Args
+	if err := args.decode(cmd, data); err != nil {
+		return err
+	}
+	return cmd.Handler(&args)
 }
 
 // GetDictionary returns the command dictionary string
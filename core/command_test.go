@@ -0,0 +1,280 @@
+package core
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopper/protocol"
+)
+
+func TestRegisterInvalidFormatPanics(t *testing.T) {
+	r := NewCommandRegistry()
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for invalid format")
+		}
+	}()
+	r.Register("bad_command", "oid=%c value=%q", func(args *Args) error { return nil })
+}
+
+func TestDispatchDecodesArgs(t *testing.T) {
+	r := NewCommandRegistry()
+	var got Args
+	id := r.Register("test_command", "oid=%c interval=%u add=%hi data=%*s", func(args *Args) error {
+		got = *args
+		return nil
+	})
+
+	out := protocol.NewScratchOutput()
+	protocol.EncodeVLQUint(out, 3)
+	protocol.EncodeVLQUint(out, 1200)
+	protocol.EncodeVLQInt(out, -2)
+	protocol.EncodeVLQBytes(out, []byte{0xAA, 0x55})
+	protocol.EncodeVLQUint(out, 7) // Next command in the frame
+	data := out.Result()
+
+	if err := r.Dispatch(id, &data); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if got.Len() != 4 {
+		t.Errorf("Expected 4 args, got %d", got.Len())
+	}
+	if got.Uint(0) != 3 || got.Uint(1) != 1200 || got.Int(2) != -2 {
+		t.Errorf("Expected 3 1200 -2, got %d %d %d", got.Uint(0), got.Uint(1), got.Int(2))
+	}
+	if string(got.Bytes(3)) != "\xaa\x55" {
+		t.Errorf("Expected buffer aa55, got %x", got.Bytes(3))
+	}
+	if len(data) != 1 || data[0] != 7 {
+		t.Errorf("Expected data advanced to next command, got %x", data)
+	}
+
+	truncated := []byte{3}
+	if err := r.Dispatch(id, &truncated); err == nil {
+		t.Error("Expected error for truncated arguments")
+	}
+}
+
+// TestCommandHandlerArgs checks every RegisterCommand call in the module:
+// each args accessor used by the handler must name an argument that exists
+// in the format and have the matching type, and every argument in the
+// format must be read.
+func TestCommandHandlerArgs(t *testing.T) {
+	fset := token.NewFileSet()
+	files := parseModule(t, fset)
+
+	// Top-level funcs by package directory, relative to the module root
+	funcs := make(map[string]map[string]*ast.FuncDecl)
+	for f, dir := range files {
+		if funcs[dir] == nil {
+			funcs[dir] = make(map[string]*ast.FuncDecl)
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				funcs[dir][fn.Name.Name] = fn
+			}
+		}
+	}
+
+	checked := 0
+	for f, dir := range files {
+		imports := fileImports(f)
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 3 {
+				return true
+			}
+			switch fun := call.Fun.(type) {
+			case *ast.Ident:
+				if fun.Name != "RegisterCommand" || dir != "core" {
+					return true
+				}
+			case *ast.SelectorExpr:
+				if fun.Sel.Name != "RegisterCommand" || !isIdent(fun.X, "core") {
+					return true
+				}
+			default:
+				return true
+			}
+			name, ok1 := stringLit(call.Args[0])
+			format, ok2 := stringLit(call.Args[1])
+			if !ok1 || !ok2 {
+				t.Errorf("%s: RegisterCommand needs literal name and format", fset.Position(call.Pos()))
+				return true
+			}
+			var fnType *ast.FuncType
+			var body *ast.BlockStmt
+			switch h := call.Args[2].(type) {
+			case *ast.Ident:
+				if h.Name == "nil" {
+					return true
+				}
+				fn, ok := funcs[dir][h.Name]
+				if !ok {
+					t.Errorf("%s: handler %s not found", name, h.Name)
+					return true
+				}
+				fnType, body = fn.Type, fn.Body
+			case *ast.SelectorExpr:
+				pkg, _ := h.X.(*ast.Ident)
+				fn, ok := (*ast.FuncDecl)(nil), false
+				if pkg != nil {
+					fn, ok = funcs[imports[pkg.Name]][h.Sel.Name]
+				}
+				if !ok {
+					t.Errorf("%s: handler not found", name)
+					return true
+				}
+				fnType, body = fn.Type, fn.Body
+			case *ast.FuncLit:
+				fnType, body = h.Type, h.Body
+			default:
+				t.Errorf("%s: handler must be a function or function literal", name)
+				return true
+			}
+			params, err := protocol.ParseFormat(format)
+			if err != nil {
+				t.Errorf("%s: invalid format %q: %v", name, format, err)
+				return true
+			}
+			checkHandlerArgs(t, fset, name, fnType, body, params)
+			checked++
+			return true
+		})
+	}
+	if checked == 0 {
+		t.Error("Expected to find registered command handlers")
+	}
+}
+
+// parseModule parses every non-test Go file in the module, skipping testdata
+// and hidden directories, and returns each file with its package directory
+// relative to the module root
+func parseModule(t *testing.T, fset *token.FileSet) map[*ast.File]string {
+	t.Helper()
+	files := make(map[*ast.File]string)
+	root := ".."
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "testdata" || strings.HasPrefix(d.Name(), ".") && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		dir, _ := filepath.Rel(root, filepath.Dir(path))
+		files[f] = filepath.ToSlash(dir)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// fileImports maps the names a file imports module packages under to their
+// directories relative to the module root
+func fileImports(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, imp := range f.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		dir, ok := strings.CutPrefix(p, "gopper/")
+		if !ok {
+			continue
+		}
+		name := path.Base(dir)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imports[name] = dir
+	}
+	return imports
+}
+
+// checkHandlerArgs verifies the accessor calls on a handler's args parameter
+func checkHandlerArgs(t *testing.T, fset *token.FileSet, name string, fnType *ast.FuncType, body *ast.BlockStmt, params []protocol.Param) {
+	read := make([]bool, len(params))
+	if names := fnType.Params.List[0].Names; len(names) > 0 && names[0].Name != "_" {
+		argsParam := names[0].Name
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				sel, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok || !isIdent(sel.X, argsParam) {
+					// args may only be used through its accessors
+					for _, a := range n.Args {
+						if isIdent(a, argsParam) {
+							t.Errorf("%s: %s passes args on; decode it in the handler", fset.Position(n.Pos()), name)
+						}
+					}
+					return true
+				}
+				if sel.Sel.Name == "Len" {
+					return false
+				}
+				lit, ok := n.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.INT {
+					t.Errorf("%s: %s uses a non-constant argument index", fset.Position(n.Pos()), name)
+					return false
+				}
+				i, _ := strconv.Atoi(lit.Value)
+				if i >= len(params) {
+					t.Errorf("%s: %s reads argument %d but format has %d", fset.Position(n.Pos()), name, i, len(params))
+					return false
+				}
+				read[i] = true
+				p := params[i]
+				var want string
+				switch {
+				case p.Type.IsBuffer():
+					want = "Bytes"
+				case p.Type.IsSigned():
+					want = "Int"
+				default:
+					want = "Uint"
+				}
+				if sel.Sel.Name != want {
+					t.Errorf("%s: %s reads %s (%s) with %s, expected %s",
+						fset.Position(n.Pos()), name, p.Name, p.Type, sel.Sel.Name, want)
+				}
+				return false
+			}
+			return true
+		})
+	}
+	for i, p := range params {
+		if !read[i] {
+			t.Errorf("%s: %s never reads argument %d (%s)", fset.Position(body.Pos()), name, i, p.Name)
+		}
+	}
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+func stringLit(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
@@ -1,23 +1,18 @@
-//go:build tinygo
-
 package core
 
 import (
 	"gopper/protocol"
 	"sync/atomic"
-	"unsafe"
 )
 
 // FirmwareState holds the global firmware state
 type FirmwareState struct {
 	configCRC  uint32 // atomic
 	isShutdown uint32 // atomic bool
-	moveCount  uint16
+	moveCount  uint16 // Size of the move pool, set by finalize_config
 }
 
-var globalState = &FirmwareState{
-	moveCount: 16, // Command queue size - minimum for Klipper
-}
+var globalState = &FirmwareState{}
 
 // InitCoreCommands registers all core protocol commands
 // IMPORTANT: Command registration order matters!
@@ -26,6 +21,10 @@ var globalState = &FirmwareState{
 //	identify_response = ID 0
 //	identify = ID 1
 func InitCoreCommands() {
+	// The reset runs once the ACK and any pending responses are written
+	RegisterTask("reset", CheckPendingReset)
+	RegisterTask("shutdown", ShutdownTask)
+
 	// Bootstrap messages - MUST be first to match Klipper's DefaultMessages
 	RegisterCommand("identify_response", "offset=%u data=%*s", nil)   // ID 0
 	RegisterCommand("identify", "offset=%u count=%c", handleIdentify) // ID 1
@@ -46,6 +45,8 @@ func InitCoreCommands() {
 	RegisterCommand("debug_result", "val=%u", nil)
 	RegisterCommand("debug_nop", "", handleDebugNop) // For command dispatch benchmark
 	RegisterCommand("set_debug", "enable=%c", handleSetDebug)
+	RegisterCommand("get_task_stats", "", handleGetTaskStats)
+	RegisterCommand("get_timer_stats", "reset=%c", handleGetTimerStats)
 
 	// Response messages (MCU → Host)
 	RegisterCommand("clock", "clock=%u", nil)
@@ -53,33 +54,46 @@ func InitCoreCommands() {
 	RegisterCommand("config", "is_config=%c crc=%u is_shutdown=%c move_count=%hu", nil)
 	RegisterCommand("shutdown", "clock=%u static_string_id=%hu", nil)
 	RegisterCommand("is_shutdown", "static_string_id=%hu", nil)
+	RegisterCommand("stats", "count=%u sum=%u sumsq=%u", nil)
+	RegisterCommand("task_stats", "index=%c name=%*s runs=%u sum=%u max=%u", nil)
+	RegisterCommand("timer_stats", "timer_owner=%c count=%u max=%u too_close=%u b0=%u b1=%u b2=%u b3=%u b4=%u b5=%u b6=%u b7=%u", nil)
+	RegisterCommand("core_lock_stats", "core=%c count=%u contended=%u sum=%u max=%u", nil)
+	RegisterCommand("timer_stats_end", "past_errors=%u loop_max=%u", nil)
 
 	// Register common constants
 	// Note: MCU and CLOCK_FREQ are platform-specific and registered in target/*/clock.go
-	RegisterConstant("STATS_SUMSQ_BASE", uint32(256))
+	RegisterConstant("STATS_SUMSQ_BASE", uint32(StatsSumsqBase))
+	RegisterEnumeration("timer_owner", timerOwnerNames[:])
 
-	// Register common shutdown reason strings
+	// Register every shutdown reason string
 	// These must be registered before BuildDictionary() so they appear in the dictionary
-	RegisterStaticString("Rescheduled timer in the past")
-	RegisterStaticString("ADC out of range")
-	RegisterStaticString("Emergency stop")
-	RegisterStaticString("I2C write error")
-	RegisterStaticString("I2C read error")
+	for _, reason := range shutdownReasons {
+		RegisterStaticString(reason)
+	}
 }
 
-// handleIdentify returns chunks of the data dictionary
-func handleIdentify(data *[]byte) error {
-	// Decode arguments: offset (uint32), count (uint8)
-	offset, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+// RegisterFirmwareCommands registers every command set shared by the
+// targets, in a fixed order so command IDs match between a target's firmware
+// and the dictionary generated for it at build time (cmd/gopper-dictgen)
+func RegisterFirmwareCommands() {
+	InitCoreCommands()
+	InitADCCommands()
+	InitGPIOCommands()
+	InitPWMCommands()
+	InitSPICommands()
+	InitTriggerSyncCommands() // Needed before endstops
+	InitI2CCommands()
+	InitEndstopCommands()
+	InitAnalogEndstopCommands()
+	InitI2CEndstopCommands()
+	RegisterStepperCommands()
+	InitDriverCommands()
+}
 
-	count8, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-	count := uint8(count8)
+// handleIdentify returns chunks of the data dictionary
+func handleIdentify(args *Args) error {
+	offset := args.Uint(0)
+	count := uint8(args.Uint(1))
 
 	// Get dictionary chunk
 	chunk := GetGlobalDictionary().GetChunk(offset, count)
@@ -94,7 +108,7 @@ func handleIdentify(data *[]byte) error {
 }
 
 // handleGetUptime returns the system uptime
-func handleGetUptime(data *[]byte) error {
+func handleGetUptime(args *Args) error {
 	// Get 64-bit uptime
 	uptime := GetUptime()
 	high := uint32(uptime >> 32)
@@ -109,7 +123,7 @@ func handleGetUptime(data *[]byte) error {
 }
 
 // handleGetClock returns the current clock value
-func handleGetClock(data *[]byte) error {
+func handleGetClock(args *Args) error {
 	clock := GetTime()
 
 	SendResponse("clock", func(output protocol.OutputBuffer) {
@@ -120,7 +134,7 @@ func handleGetClock(data *[]byte) error {
 }
 
 // handleGetConfig returns the configuration state
-func handleGetConfig(data *[]byte) error {
+func handleGetConfig(args *Args) error {
 	crc := atomic.LoadUint32(&globalState.configCRC)
 	isShutdown := atomic.LoadUint32(&globalState.isShutdown) != 0
 	isConfig := crc != 0
@@ -147,89 +161,135 @@ func handleGetConfig(data *[]byte) error {
 	return nil
 }
 
-// handleConfigReset resets the configuration state
-func handleConfigReset(data *[]byte) error {
-	atomic.StoreUint32(&globalState.configCRC, 0)
+// handleConfigReset discards every configured object so the host can send
+// a new configuration. As in Klipper it is only accepted after a shutdown;
+// a running MCU shuts down instead and keeps its configuration.
+func handleConfigReset(args *Args) error {
+	if !IsShutdown() {
+		TryShutdown(configResetReason)
+		return nil
+	}
+	ResetFirmwareState()
 	return nil
 }
 
-// handleFinalizeConfig finalizes the configuration with a CRC
-func handleFinalizeConfig(data *[]byte) error {
-	crc, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
+// handleFinalizeConfig finalizes the configuration with a CRC and gives the
+// memory left over to the move pool
+func handleFinalizeConfig(args *Args) error {
+	crc := args.Uint(0)
 	atomic.StoreUint32(&globalState.configCRC, crc)
+	allocMovePool()
 	return nil
 }
 
-// handleAllocateOids allocates object IDs (currently a no-op)
-func handleAllocateOids(data *[]byte) error {
-	count, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-	_ = count // Currently unused
-	return nil
+// handleAllocateOids sizes the OID table for the coming configuration
+func handleAllocateOids(args *Args) error {
+	return AllocateOIDs(uint8(args.Uint(0)))
 }
 
-// handleEmergencyStop triggers an emergency stop
-func handleEmergencyStop(data *[]byte) error {
-	atomic.StoreUint32(&globalState.isShutdown, 1)
-	// Stop ADC sampling and other safety‑critical activity.
-	ShutdownAllAnalogIn()
-	// Return all GPIO pins to default state
-	ShutdownAllDigitalOut()
-	// Stop all I2C operations
-	ShutdownAllI2C()
-	// Send shutdown messages to SPI devices
-	ShutdownSPI()
-	// TODO: Implement additional emergency stop behavior:
-	// - Stop all timers
-	// - Disable all outputs
-	// - Set steppers to idle
+// handleEmergencyStop triggers an emergency stop, a shutdown like any other
+// so the host is told the reason
+func handleEmergencyStop(args *Args) error {
+	TryShutdown("Emergency stop")
 	return nil
 }
 
 // handleClearShutdown clears the shutdown state
 // This allows the MCU to resume operation after a shutdown (e.g., for benchmarking)
-func handleClearShutdown(data *[]byte) error {
+func handleClearShutdown(args *Args) error {
 	atomic.StoreUint32(&globalState.isShutdown, 0)
+	shutdownHooksDue, shutdownReport = false, false
 	ResetTimerPastErrors()
 	return nil
 }
 
 // Shutdown reason IDs (must match static_strings in dictionary)
 var (
+	shutdownReason   string // Reason given to TryShutdown
 	shutdownReasonID uint16 // Current shutdown reason string ID
+	shutdownClock    uint32 // Time of the shutdown, for the report
+	shutdownHooksDue bool   // The hooks are waiting for ShutdownTask
+	shutdownReport   bool   // The shutdown message is waiting for ShutdownTask
+	shutdownWake     TaskWake
 )
 
 // TryShutdown triggers a firmware shutdown with a reason message
-// This is used by safety mechanisms like ADC range checking
+// This is used by safety mechanisms like ADC range checking. Called from a
+// timer handler, in the alarm interrupt or on core 1 of a dual-core build,
+// it only purges the timers and stops the steppers; the hooks, which may
+// allocate or use a bus, and the message to the host run in ShutdownTask.
 func TryShutdown(reason string) {
 	// Only shutdown once
+	state := disableInterrupts()
 	if atomic.LoadUint32(&globalState.isShutdown) != 0 {
+		restoreInterrupts(state)
 		return
 	}
 	atomic.StoreUint32(&globalState.isShutdown, 1)
+	shutdownReason = reason
+	shutdownClock = GetTime()
+	shutdownHooksDue = true
+	inTimer := inTimerContext()
+	restoreInterrupts(state)
+
+	if inTimer {
+		PurgeTimers()
+		ShutdownAllSteppers()
+		shutdownWake.Wake()
+		return
+	}
+	finishShutdown()
+}
+
+// finishShutdown has the shutdown message sent and runs every hook, once
+// per shutdown. It runs in task context on core 0.
+func finishShutdown() {
+	state := disableInterrupts()
+	due, reason := shutdownHooksDue, shutdownReason
+	shutdownHooksDue = false
+	restoreInterrupts(state)
+	if !due {
+		return
+	}
 
-	// Get string ID for this reason (registers if new)
-	shutdownReasonID = GetStaticStringID(reason)
+	// Get string ID for this reason; the dictionary the host has cannot
+	// gain new strings, so an unlisted reason is reported as unknown
+	id, ok := GetStaticStringID(reason)
+	if !ok {
+		DebugPrintln("[SHUTDOWN] Unregistered reason: " + reason)
+		id, _ = GetStaticStringID(unknownShutdownReason)
+	}
+
+	// Have the shutdown message sent to the host
+	state = disableInterrupts()
+	shutdownReasonID = id
+	shutdownReport = true
+	restoreInterrupts(state)
+
+	// Stop all timers and return every subsystem to a safe state
+	runShutdownHooks()
+}
+
+// ShutdownTask finishes a shutdown raised on the timer core and sends the
+// shutdown message from task context
+func ShutdownTask() {
+	if shutdownWake.Check() {
+		finishShutdown()
+	}
+
+	state := disableInterrupts()
+	if !shutdownReport {
+		restoreInterrupts(state)
+		return
+	}
+	shutdownReport = false
+	clock, id := shutdownClock, shutdownReasonID
+	restoreInterrupts(state)
 
-	// Send shutdown message to host
-	clock := GetTime()
 	SendResponse("shutdown", func(output protocol.OutputBuffer) {
 		protocol.EncodeVLQUint(output, clock)
-		protocol.EncodeVLQUint(output, uint32(shutdownReasonID))
+		protocol.EncodeVLQUint(output, uint32(id))
 	})
-
-	// Stop ADC sampling to prevent further activity after shutdown.
-	ShutdownAllAnalogIn()
-	// Return all GPIO pins to default state
-	ShutdownAllDigitalOut()
-	// Stop all I2C operations
-	ShutdownAllI2C()
 }
 
 // IsShutdown returns true if the firmware is in shutdown state
@@ -238,11 +298,15 @@ func IsShutdown() bool {
 }
 
 // ResetFirmwareState resets the firmware state for reconnection
-// This is called when USB reconnects or firmware restart is requested
+// This is called when USB reconnects or config_reset is received, never on
+// a guess from the transport sequence. Every configured object is shut down
+// and released, leaving the MCU unconfigured.
 func ResetFirmwareState() {
+	resetConfig()
 	atomic.StoreUint32(&globalState.configCRC, 0)
 	atomic.StoreUint32(&globalState.isShutdown, 0)
-	// moveCount is not reset - it's a firmware constant
+	shutdownHooksDue, shutdownReport = false, false
+	ResetTimerPastErrors()
 }
 
 // SendResponse sends a response message using the global transport
@@ -298,31 +362,12 @@ func SetResetHandler(handler func()) {
 //	addr: memory address to read from
 //
 // Response: debug_result val=%u
-func handleDebugRead(data *[]byte) error {
-	// Decode arguments: order (uint8), addr (uint32)
-	order, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	addr, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDebugRead(args *Args) error {
+	order := args.Uint(0)
+	addr := args.Uint(1)
 
 	// Read value from memory address based on order
-	var val uint32
-	switch order {
-	case 1: // 16-bit read
-		ptr := (*uint16)(unsafe.Pointer(uintptr(addr)))
-		val = uint32(*ptr)
-	case 2: // 32-bit read
-		ptr := (*uint32)(unsafe.Pointer(uintptr(addr)))
-		val = *ptr
-	default:
-		// Unknown order, return 0
-		val = 0
-	}
+	val := readMemory(order, addr)
 
 	// Send debug_result response
 	SendResponse("debug_result", func(output protocol.OutputBuffer) {
@@ -335,7 +380,7 @@ func handleDebugRead(data *[]byte) error {
 // handleReset triggers a hardware reset of the MCU
 // This is used by Klipper's FIRMWARE_RESTART command
 // NOTE: The actual reset is deferred until after the ACK is sent to the host
-func handleReset(_ *[]byte) error {
+func handleReset(_ *Args) error {
 	// Set flag to trigger reset in main loop
 	// Don't reset immediately - we need to send ACK first!
 	atomic.StoreUint32(&resetPending, 1)
@@ -343,7 +388,7 @@ func handleReset(_ *[]byte) error {
 }
 
 // CheckPendingReset checks if a reset was requested and executes it
-// This should be called from the main loop after all pending messages are sent
+// It runs as a task, after the main loop has sent all pending messages.
 func CheckPendingReset() {
 	if atomic.LoadUint32(&resetPending) != 0 {
 		// Trigger the reset immediately
@@ -357,18 +402,15 @@ func CheckPendingReset() {
 
 // handleDebugNop is a no-op command used for command dispatch benchmarks
 // This measures the raw command processing speed without any actual work
-func handleDebugNop(_ *[]byte) error {
+func handleDebugNop(_ *Args) error {
 	return nil
 }
 
 // handleSetDebug enables or disables debug output
 // Useful for running benchmarks without debug overhead
 // Format: set_debug enable=%c (0 = disable, 1 = enable)
-func handleSetDebug(data *[]byte) error {
-	enable, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleSetDebug(args *Args) error {
+	enable := args.Uint(0)
 	SetDebugEnabled(enable != 0)
 	return nil
 }
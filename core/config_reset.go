@@ -0,0 +1,27 @@
+package core
+
+// Config reset hooks: every subsystem that keeps objects created by config_*
+// commands registers a function at init that forgets them. config_reset
+// (accepted only after a shutdown) and a USB reconnect first run the
+// shutdown hooks, which cancel every timer and drive outputs to their
+// default values, and then run every reset hook, so the host can configure
+// the MCU again with the same OIDs without a power cycle.
+
+var configResetHooks []func()
+
+// RegisterConfigReset adds a hook run when the configuration is discarded
+// Hooks run after the shutdown hooks, so the objects they release are
+// already stopped.
+func RegisterConfigReset(hook func()) {
+	configResetHooks = append(configResetHooks, hook)
+}
+
+// resetConfig shuts every subsystem down and releases all configured objects
+func resetConfig() {
+	runShutdownHooks()
+	for _, hook := range configResetHooks {
+		runShutdownHook(hook)
+	}
+	resetOIDs()
+	resetMovePool()
+}
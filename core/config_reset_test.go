@@ -0,0 +1,130 @@
+package core
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"gopper/protocol"
+)
+
+// testGPIO records pin levels for tests that configure digital outputs
+type testGPIO struct {
+	pins map[GPIOPin]bool
+}
+
+func (g *testGPIO) ConfigureOutput(pin GPIOPin) error        { return nil }
+func (g *testGPIO) ConfigureInputPullUp(pin GPIOPin) error   { return nil }
+func (g *testGPIO) ConfigureInputPullDown(pin GPIOPin) error { return nil }
+func (g *testGPIO) SetPin(pin GPIOPin, value bool) error     { g.pins[pin] = value; return nil }
+func (g *testGPIO) GetPin(pin GPIOPin) (bool, error)         { return g.pins[pin], nil }
+func (g *testGPIO) ReadPin(pin GPIOPin) bool                 { return g.pins[pin] }
+
+func TestConfigResetReleasesObjects(t *testing.T) {
+	savedShutdown, savedReset, savedGPIO := shutdownHooks, configResetHooks, gpioDriver
+	defer func() {
+		shutdownHooks, configResetHooks, gpioDriver = savedShutdown, savedReset, savedGPIO
+		clear(digitalOutputs)
+		resetOIDs()
+		resetMovePool()
+	}()
+	shutdownHooks = []func(){ShutdownAllDigitalOut}
+	configResetHooks = []func(){releaseAllDigitalOut}
+	gpio := &testGPIO{pins: make(map[GPIOPin]bool)}
+	gpioDriver = gpio
+
+	r := NewCommandRegistry()
+	configID := r.Register("config_digital_out", "oid=%c pin=%u value=%c default_value=%c max_duration=%u", handleConfigDigitalOut)
+	queueID := r.Register("queue_digital_out", "oid=%c clock=%u on_ticks=%u", handleQueueDigitalOut)
+	resetID := r.Register("config_reset", "", handleConfigReset)
+	allocID := r.Register("allocate_oids", "count=%c", handleAllocateOids)
+	send := func(id uint16, args ...uint32) {
+		out := protocol.NewScratchOutput()
+		for _, a := range args {
+			protocol.EncodeVLQUint(out, a)
+		}
+		data := out.Result()
+		if err := r.Dispatch(id, &data); err != nil {
+			t.Fatalf("command %d: %v", id, err)
+		}
+	}
+
+	// Configure a pin that is on, with a pending change, then shut down
+	send(allocID, 8)
+	send(configID, 4, 25, 1, 0, 0)
+	atomic.StoreUint32(&globalState.configCRC, 0x1234)
+	allocMovePool()
+	send(queueID, 4, GetTime()+100000, 0)
+	if err := handleEmergencyStop(nil); err != nil {
+		t.Fatalf("emergency_stop: %v", err)
+	}
+	if len(timerHeap) != 0 {
+		t.Fatal("timer heap not purged by shutdown")
+	}
+	send(queueID, 4, GetTime()+100000, 0)
+
+	send(resetID)
+	if len(digitalOutputs) != 0 || oidTypes != nil {
+		t.Errorf("%d digital outputs survived config_reset", len(digitalOutputs))
+	}
+	if len(timerHeap) != 0 {
+		t.Error("timer heap not purged by config_reset")
+	}
+	if gpio.pins[25] {
+		t.Error("pin not returned to its default value")
+	}
+	if IsShutdown() || atomic.LoadUint32(&globalState.configCRC) != 0 {
+		t.Error("config_reset left the shutdown flag or config CRC set")
+	}
+
+	// The same OID can be configured again with different settings
+	send(allocID, 8)
+	send(configID, 4, 26, 0, 1, 0)
+	if dout := digitalOutputs[4]; dout == nil || dout.Pin != 26 {
+		t.Errorf("reconfigured digital output %+v", digitalOutputs[4])
+	}
+}
+
+func TestConfigResetHookOrder(t *testing.T) {
+	savedShutdown, savedReset := shutdownHooks, configResetHooks
+	defer func() { shutdownHooks, configResetHooks = savedShutdown, savedReset }()
+
+	var ran []string
+	shutdownHooks = nil
+	configResetHooks = nil
+	RegisterConfigReset(func() { ran = append(ran, "release") })
+	RegisterConfigReset(func() { panic("broken subsystem") })
+	RegisterConfigReset(func() { ran = append(ran, "release2") })
+	RegisterShutdown(func() { ran = append(ran, "shutdown") })
+
+	ResetFirmwareState()
+	if len(ran) != 3 || ran[0] != "shutdown" || ran[1] != "release" || ran[2] != "release2" {
+		t.Errorf("hooks run: %v, want [shutdown release release2]", ran)
+	}
+}
+
+func TestConfigResetRequiresShutdown(t *testing.T) {
+	saved := shutdownHooks
+	defer func() {
+		shutdownHooks = saved
+		handleClearShutdown(nil)
+		resetOIDs()
+		atomic.StoreUint32(&globalState.configCRC, 0)
+	}()
+	shutdownHooks = nil
+	handleClearShutdown(nil)
+	reasonID := RegisterStaticString(configResetReason)
+
+	if err := AllocateOIDs(4); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreUint32(&globalState.configCRC, 0x1234)
+	if err := handleConfigReset(nil); err != nil {
+		t.Fatalf("config_reset: %v", err)
+	}
+	if !IsShutdown() || shutdownReasonID != reasonID {
+		t.Error("config_reset on a running MCU did not shut it down with its reason")
+	}
+	if oidTypes == nil || atomic.LoadUint32(&globalState.configCRC) != 0x1234 {
+		t.Error("config_reset on a running MCU discarded the configuration")
+	}
+}
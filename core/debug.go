@@ -20,6 +20,8 @@ const (
 	EvtTimerFire     = 4 // Timer fired (step generated)
 	EvtTimerPast     = 5 // Timer in past detected
 	EvtResetClock    = 6 // reset_step_clock received
+	EvtTimerTooClose = 7 // Timer rescheduled too close to now (Value2 = owner)
+	EvtTrigger       = 8 // Stepper stopped by a trsync (Value1 = position)
 )
 
 const (
@@ -60,18 +62,23 @@ func IsDebugEnabled() bool {
 	return debugEnabled
 }
 
-// InitAsyncDebug starts the async debug output goroutine
+// InitAsyncDebug enables DebugAsync, whose messages a task writes out
 // Call this from main() after SetDebugWriter
 func InitAsyncDebug() {
 	debugChan = make(chan string, 16) // Buffer 16 messages
-	go debugOutputWorker()
+	RegisterTask("debug", debugOutputTask)
 }
 
-// debugOutputWorker runs in background, drains debug channel
-func debugOutputWorker() {
-	for msg := range debugChan {
-		if debugPrintln != nil {
-			debugPrintln(msg)
+// debugOutputTask drains the debug channel without blocking
+func debugOutputTask() {
+	for {
+		select {
+		case msg := <-debugChan:
+			if debugPrintln != nil {
+				debugPrintln(msg)
+			}
+		default:
+			return
 		}
 	}
 }
@@ -146,6 +153,10 @@ func DumpTimingRing() {
 			name = "TIMER_PAST!"
 		case EvtResetClock:
 			name = "RESET_CLK"
+		case EvtTimerTooClose:
+			name = "TIMER_TOO_CLOSE"
+		case EvtTrigger:
+			name = "TRIGGER"
 		default:
 			name = "UNKNOWN"
 		}
@@ -2,9 +2,8 @@ package core
 
 import (
 	"bytes"
-	"machine"
 	"sync"
-	"time"
+	"unsafe"
 
 	"gopper/tinycompress"
 )
@@ -33,6 +32,8 @@ type Dictionary struct {
 	clk_freq      uint32
 	mcu           string
 	cachedDict    []byte // Cached compressed dictionary
+	precompressed string // Dictionary generated at build time (kept in flash)
+	sealed        bool   // Set once the dictionary is built; no new static strings
 }
 
 var globalDictionary = NewDictionary(globalRegistry)
@@ -50,19 +51,6 @@ func NewDictionary(cmdReg *CommandRegistry) *Dictionary {
 	}
 }
 
-// ledBlink blinks the LED a specific number of times for diagnostics
-func ledBlink(count int) {
-	led := machine.LED
-	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	for i := 0; i < count; i++ {
-		led.High()
-		time.Sleep(20 * time.Millisecond)
-		led.Low()
-		time.Sleep(20 * time.Millisecond)
-	}
-	time.Sleep(50 * time.Millisecond) // Pause after blink sequence
-}
-
 // RegisterConstant registers a constant in the dictionary
 func RegisterConstant(name string, value interface{}) {
 	globalDictionary.AddConstant(name, value)
@@ -83,6 +71,19 @@ func (d *Dictionary) AddConstant(name string, value interface{}) {
 	}
 }
 
+// ClockFreq returns the registered CLOCK_FREQ constant (timer ticks per
+// second), or the 1MHz default if the target has not registered one
+func (d *Dictionary) ClockFreq() uint32 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if c, ok := d.constants["CLOCK_FREQ"]; ok {
+		if freq, ok := c.Value.(uint32); ok {
+			return freq
+		}
+	}
+	return d.clk_freq
+}
+
 // AddEnumeration adds an enumeration to the dictionary
 func (d *Dictionary) AddEnumeration(name string, values []string) {
 	d.mu.Lock()
@@ -101,16 +102,19 @@ func (d *Dictionary) AddEnumeration(name string, values []string) {
 }
 
 // AddStaticString adds a static string and returns its ID
-// Static strings are used for error/shutdown messages
+// Static strings are used for error/shutdown messages. Adding a new string
+// after the dictionary has been built panics: the host would receive IDs it
+// cannot decode, so this fails at startup rather than at shutdown time.
 func (d *Dictionary) AddStaticString(str string) uint16 {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	// Check if already exists
-	for i, s := range d.staticStrings {
-		if s == str {
-			return uint16(i)
-		}
+	if id, ok := d.staticStringIDLocked(str); ok {
+		return id
+	}
+	if d.sealed {
+		panic("static string registered after the dictionary was built: " + str)
 	}
 
 	// Add new string
@@ -119,9 +123,26 @@ func (d *Dictionary) AddStaticString(str string) uint16 {
 	return id
 }
 
-// GetStaticStringID returns the ID for a static string, adding it if needed
-func GetStaticStringID(str string) uint16 {
-	return globalDictionary.AddStaticString(str)
+// StaticStringID returns the ID of a registered static string
+func (d *Dictionary) StaticStringID(str string) (uint16, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.staticStringIDLocked(str)
+}
+
+func (d *Dictionary) staticStringIDLocked(str string) (uint16, bool) {
+	for i, s := range d.staticStrings {
+		if s == str {
+			return uint16(i), true
+		}
+	}
+	return 0, false
+}
+
+// GetStaticStringID returns the ID of a static string in the global
+// dictionary, or false if it was never registered
+func GetStaticStringID(str string) (uint16, bool) {
+	return globalDictionary.StaticStringID(str)
 }
 
 // RegisterStaticString registers a static string in the global dictionary
@@ -189,51 +210,151 @@ func (d *Dictionary) BuildDictionary() {
 		}
 	}
 
-	// Re-enable compression with detailed debugging
+	compressed := compressDictionary(jsonData)
+	d.cachedDict = make([]byte, len(compressed))
+	copy(d.cachedDict, compressed)
+	d.sealed = true
+	DebugPrintln("[BuildDict] Dictionary cached successfully")
+}
+
+// compressDictionary zlib-compresses the JSON dictionary for identify
+// Falls back to the plain JSON if compression fails.
+func compressDictionary(jsonData []byte) []byte {
 	DebugPrintln("[BuildDict] Starting compression...")
 	var buf bytes.Buffer
-	DebugPrintln("[BuildDict] Creating NewWriter...")
 	w := tinycompress.NewWriter(&buf)
-	DebugPrintln("[BuildDict] Calling Write...")
-	_, err := w.Write(jsonData)
-	if err != nil {
+	if _, err := w.Write(jsonData); err != nil {
 		DebugPrintln("[BuildDict] ERROR: Compression write failed: " + err.Error())
-		d.cachedDict = jsonData
-		return
+		return jsonData
 	}
-	DebugPrintln("[BuildDict] Calling Close...")
-	err = w.Close()
-	if err != nil {
+	if err := w.Close(); err != nil {
 		DebugPrintln("[BuildDict] ERROR: Compression close failed: " + err.Error())
-		d.cachedDict = jsonData
-		return
+		return jsonData
 	}
-	DebugPrintln("[BuildDict] Compression complete")
 
 	compressed := buf.Bytes()
-	DebugPrintln("[BuildDict] Compressed size: " + itoa(len(compressed)) + " bytes")
-
 	if len(compressed) == 0 {
 		DebugPrintln("[BuildDict] ERROR: Compression produced empty output")
-		d.cachedDict = jsonData
-		return
+		return jsonData
 	}
+	DebugPrintln("[BuildDict] Compressed size: " + itoa(len(compressed)) + " bytes")
+	return compressed
+}
 
-	d.cachedDict = make([]byte, len(compressed))
-	copy(d.cachedDict, compressed)
-	DebugPrintln("[BuildDict] Dictionary cached successfully")
+// SetPrecompressed serves a dictionary generated at build time by
+// cmd/gopper-dictgen instead of building one at boot. The blob is only used
+// if hash matches the fingerprint of the registered commands; otherwise the
+// dictionary is built as usual. Returns true if the blob is used.
+func (d *Dictionary) SetPrecompressed(blob string, hash uint32) bool {
+	if hash != d.Fingerprint() {
+		DebugPrintln("[BuildDict] Precompressed dictionary is stale (run go generate), building it now")
+		d.BuildDictionary()
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.precompressed = blob
+	d.cachedDict = nil
+	d.sealed = true
+	DebugPrintln("[BuildDict] Using precompressed dictionary, size: " + itoa(len(blob)) + " bytes")
+	return true
 }
 
-// Generate generates the complete dictionary in JSON format
-// Format follows Klipper's data dictionary format
+// Fingerprint hashes everything that goes into the dictionary (FNV-1a)
+// It is much cheaper than building the dictionary and is used to check
+// that a precompressed dictionary still matches the registry.
+func (d *Dictionary) Fingerprint() uint32 {
+	commands, responses := d.commandReg.GetCommandsAndResponses()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	h := fnvNew()
+	h = h.addString(d.version)
+	h = h.addString(d.buildVersions)
+
+	names := make([]string, 0, len(d.constants))
+	for name := range d.constants {
+		names = append(names, name)
+	}
+	sortStrings(names)
+	for _, name := range names {
+		h = h.addString(name)
+		h = h.addString(valueToString(d.constants[name].Value))
+	}
+
+	for _, msgs := range []map[string]int{commands, responses} {
+		formats := make([]string, 0, len(msgs))
+		for format := range msgs {
+			formats = append(formats, format)
+		}
+		sortStrings(formats)
+		h = h.addString("")
+		for _, format := range formats {
+			h = h.addString(format)
+			h = h.addString(itoa(msgs[format]))
+		}
+	}
+
+	names = names[:0]
+	for name := range d.enumerations {
+		names = append(names, name)
+	}
+	sortStrings(names)
+	for _, name := range names {
+		h = h.addString(name)
+		for _, value := range d.enumerations[name].Values {
+			h = h.addString(value)
+		}
+	}
+
+	h = h.addString("")
+	for _, str := range d.staticStrings {
+		h = h.addString(str)
+	}
+	return uint32(h)
+}
+
+// fnvHash is a 32-bit FNV-1a hash
+type fnvHash uint32
+
+func fnvNew() fnvHash {
+	return 2166136261
+}
+
+// addString hashes s followed by a zero separator
+func (h fnvHash) addString(s string) fnvHash {
+	for i := 0; i < len(s); i++ {
+		h = (h ^ fnvHash(s[i])) * 16777619
+	}
+	return h * 16777619 // Zero byte: h ^ 0 == h
+}
+
+// sortStrings sorts in place (insertion sort - no sort package on embedded)
+func sortStrings(s []string) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j-1] > s[j]; j-- {
+			s[j-1], s[j] = s[j], s[j-1]
+		}
+	}
+}
+
+// Generate returns the compressed dictionary as sent to the host
+// Format follows Klipper's data dictionary format. A precompressed
+// dictionary is returned in place, so the result must not be modified.
 func (d *Dictionary) Generate() []byte {
+	if d.precompressed != "" {
+		return flashBytes(d.precompressed)
+	}
+
 	// Return cached dictionary if available
 	if d.cachedDict != nil {
 		return d.cachedDict
 	}
 
 	// Otherwise generate on-the-fly (no lock needed for reading registry)
-	return d.generateJSON()
+	return compressDictionary(d.generateJSON())
 }
 
 // generateJSON builds the JSON dictionary (acquires read lock)
@@ -428,13 +549,31 @@ func (d *Dictionary) buildJSONLockedWithData(commands map[string]int, responses
 
 	result = append(result, '}')
 
-	// Return uncompressed for now - TinyGo's zlib may not be fully functional
-	// TODO: Implement compression once we verify it works in TinyGo
+	// Uncompressed JSON - callers compress it with compressDictionary
 	return result
 }
 
+// flashBytes views a string constant, which TinyGo keeps in flash, as bytes
+// without copying it to RAM. The bytes are read-only.
+func flashBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
 // GetChunk returns a chunk of the dictionary starting at offset
+// The chunk must not be modified.
 func (d *Dictionary) GetChunk(offset uint32, count uint8) []byte {
+	// Serve a precompressed dictionary straight from flash
+	if blob := d.precompressed; blob != "" {
+		if offset >= uint32(len(blob)) {
+			return []byte{}
+		}
+		end := offset + uint32(count)
+		if end > uint32(len(blob)) {
+			end = uint32(len(blob))
+		}
+		return flashBytes(blob[offset:end])
+	}
+
 	// Don't lock here - Generate() handles its own locking
 	// Adding a lock here causes deadlock because Generate() -> generateJSON() also locks
 	data := d.Generate()
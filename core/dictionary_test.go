@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+func newTestDictionary() *Dictionary {
+	r := NewCommandRegistry()
+	r.Register("identify_response", "offset=%u data=%*s", nil)
+	r.Register("identify", "offset=%u count=%c", func(args *Args) error { return nil })
+	d := NewDictionary(r)
+	d.AddConstant("MCU", "test")
+	d.AddEnumeration("pin", []string{"gpio0", "gpio1"})
+	return d
+}
+
+// readDictionary downloads the dictionary in identify-sized chunks
+func readDictionary(d *Dictionary) []byte {
+	var data []byte
+	for {
+		chunk := d.GetChunk(uint32(len(data)), 40)
+		if len(chunk) == 0 {
+			return data
+		}
+		data = append(data, chunk...)
+	}
+}
+
+func TestDictionaryCompressed(t *testing.T) {
+	d := newTestDictionary()
+	d.BuildDictionary()
+
+	r, err := zlib.NewReader(bytes.NewReader(readDictionary(d)))
+	if err != nil {
+		t.Fatalf("Dictionary is not zlib compressed: %v", err)
+	}
+	json, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	if !bytes.Contains(json, []byte(`"identify offset=%u count=%c":1`)) {
+		t.Errorf("Expected identify command in dictionary, got %s", json)
+	}
+}
+
+func TestDictionaryPrecompressed(t *testing.T) {
+	d := newTestDictionary()
+	hash := d.Fingerprint()
+
+	if !d.SetPrecompressed("precompressed blob", hash) {
+		t.Fatal("Expected precompressed dictionary to be used")
+	}
+	if got := readDictionary(d); string(got) != "precompressed blob" {
+		t.Errorf("Expected precompressed blob, got %q", got)
+	}
+	if n := testing.AllocsPerRun(10, func() { d.GetChunk(4, 8) }); n != 0 {
+		t.Errorf("GetChunk of a precompressed dictionary allocated %v times", n)
+	}
+
+	// A change to the registry must be detected
+	d2 := newTestDictionary()
+	d2.AddStaticString("Added later")
+	if d2.Fingerprint() == hash {
+		t.Fatal("Expected fingerprint to change")
+	}
+	if d2.SetPrecompressed("precompressed blob", hash) {
+		t.Error("Expected stale precompressed dictionary to be rejected")
+	}
+	if got := readDictionary(d2); len(got) < 2 || got[0] != 0x78 {
+		t.Errorf("Expected fallback to a built dictionary, got %q", got)
+	}
+}
+
+func TestStaticStringsSealedAfterBuild(t *testing.T) {
+	d := newTestDictionary()
+	id := d.AddStaticString("Known reason")
+	d.BuildDictionary()
+
+	if got, ok := d.StaticStringID("Known reason"); !ok || got != id {
+		t.Errorf("StaticStringID = %d, %v; want %d, true", got, ok, id)
+	}
+	if _, ok := d.StaticStringID("Never registered"); ok {
+		t.Error("Expected lookup of an unregistered string to fail")
+	}
+	if again := d.AddStaticString("Known reason"); again != id {
+		t.Errorf("Re-adding a known string returned %d, want %d", again, id)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic adding a static string after BuildDictionary")
+		}
+	}()
+	d.AddStaticString("Added after build")
+}
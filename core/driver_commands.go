@@ -1,5 +1,3 @@
-//go:build tinygo
-
 package core
 
 import (
@@ -9,6 +7,10 @@ import (
 // InitDriverCommands registers the standard driver-related Klipper commands.
 // This should be called during firmware initialization.
 func InitDriverCommands() {
+	RegisterShutdown(ShutdownAllDrivers)
+	RegisterConfigReset(releaseAllDrivers)
+	RegisterTask("driver_poll", DriverPollTask)
+
 	// Command to configure a registered driver
 	RegisterCommand("config_driver", "oid=%c", handleConfigDriver)
 
@@ -38,27 +40,25 @@ func InitDriverCommands() {
 
 // handleConfigDriver configures a registered driver
 // Format: config_driver oid=%c
-func handleConfigDriver(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigDriver(args *Args) error {
+	oid := args.Uint(0)
+	if err := AllocOID(uint8(oid), OIDDriver); err != nil {
 		return err
 	}
 
-	// Get driver instance
+	// Get driver instance; the host configured a driver this firmware lacks
 	instance, exists := GetDriver(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if driver not registered
-	}
-
-	// Skip if already configured
-	if instance.State.Configured {
-		return nil
+		freeOID(uint8(oid))
+		TryShutdown(unknownDriverReason)
+		return errInvalidOID
 	}
 
 	// Call configure function if provided
 	if instance.Config.ConfigureFunc != nil {
 		if err := instance.Config.ConfigureFunc(instance.Device, instance.Config); err != nil {
 			instance.State.LastError = err
+			freeOID(uint8(oid))
 			return err
 		}
 	}
@@ -69,16 +69,13 @@ func handleConfigDriver(data *[]byte) error {
 
 // handleDriverRead reads data from a driver
 // Format: driver_read oid=%c params=%*s
-func handleDriverRead(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDriverRead(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get driver instance
-	instance, exists := GetDriver(uint8(oid))
+	instance, exists := lookupDriver(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if driver not registered
+		return errInvalidOID
 	}
 
 	// Check if driver supports reading
@@ -86,9 +83,7 @@ func handleDriverRead(data *[]byte) error {
 		return nil // Silently ignore if read not supported
 	}
 
-	// Decode parameters (remaining bytes)
-	params := *data
-	*data = (*data)[len(*data):] // Consume all remaining bytes
+	params := args.Bytes(1)
 
 	// Read from driver
 	readData, err := instance.Config.ReadFunc(instance.Device, params)
@@ -100,9 +95,7 @@ func handleDriverRead(data *[]byte) error {
 	// Send response
 	SendResponse("driver_data", func(output protocol.OutputBuffer) {
 		protocol.EncodeVLQUint(output, uint32(oid))
-		for _, b := range readData {
-			protocol.EncodeVLQUint(output, uint32(b))
-		}
+		protocol.EncodeVLQBytes(output, readData)
 	})
 
 	return nil
@@ -110,16 +103,13 @@ func handleDriverRead(data *[]byte) error {
 
 // handleDriverWrite writes data to a driver
 // Format: driver_write oid=%c data=%*s
-func handleDriverWrite(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDriverWrite(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get driver instance
-	instance, exists := GetDriver(uint8(oid))
+	instance, exists := lookupDriver(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if driver not registered
+		return errInvalidOID
 	}
 
 	// Check if driver supports writing
@@ -127,9 +117,7 @@ func handleDriverWrite(data *[]byte) error {
 		return nil // Silently ignore if write not supported
 	}
 
-	// Decode data (remaining bytes)
-	writeData := *data
-	*data = (*data)[len(*data):] // Consume all remaining bytes
+	writeData := args.Bytes(1)
 
 	// Write to driver
 	if err := instance.Config.WriteFunc(instance.Device, writeData); err != nil {
@@ -142,21 +130,14 @@ func handleDriverWrite(data *[]byte) error {
 
 // handleDriverStartPoll starts periodic polling for a driver
 // Format: driver_start_poll oid=%c poll_ticks=%u
-func handleDriverStartPoll(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pollTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDriverStartPoll(args *Args) error {
+	oid := args.Uint(0)
+	pollTicks := args.Uint(1)
 
 	// Get driver instance
-	instance, exists := GetDriver(uint8(oid))
+	instance, exists := lookupDriver(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if driver not registered
+		return errInvalidOID
 	}
 
 	// Start polling
@@ -170,16 +151,13 @@ func handleDriverStartPoll(data *[]byte) error {
 
 // handleDriverStopPoll stops periodic polling for a driver
 // Format: driver_stop_poll oid=%c
-func handleDriverStopPoll(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDriverStopPoll(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get driver instance
-	instance, exists := GetDriver(uint8(oid))
+	instance, exists := lookupDriver(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if driver not registered
+		return errInvalidOID
 	}
 
 	// Stop polling
@@ -190,16 +168,13 @@ func handleDriverStopPoll(data *[]byte) error {
 
 // handleDriverQueryState queries the state of a driver
 // Format: driver_query_state oid=%c
-func handleDriverQueryState(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDriverQueryState(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get driver instance
-	instance, exists := GetDriver(uint8(oid))
+	instance, exists := lookupDriver(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if driver not registered
+		return errInvalidOID
 	}
 
 	// Get state
@@ -230,11 +205,8 @@ func handleDriverQueryState(data *[]byte) error {
 
 // handleDriverUnregister unregisters a driver
 // Format: driver_unregister oid=%c
-func handleDriverUnregister(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleDriverUnregister(args *Args) error {
+	oid := args.Uint(0)
 
 	// Unregister driver
 	return UnregisterDriver(uint8(oid))
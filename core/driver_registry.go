@@ -1,11 +1,9 @@
-//go:build tinygo
-
 package core
 
 import (
 	"errors"
 	"gopper/protocol"
-	"machine"
+	"unsafe"
 )
 
 // DriverType identifies the bus type for a driver
@@ -28,6 +26,8 @@ type DriverInstance struct {
 	State    DriverState
 	Timer    Timer // For polling-based drivers
 	pollFunc DriverPollFunc
+
+	pollPending bool // The timer asked DriverPollTask for a poll
 }
 
 // DriverState tracks the runtime state of a driver
@@ -83,6 +83,7 @@ type DriverPollFunc func(device interface{}) ([]byte, error)
 var (
 	registeredDrivers = make(map[uint8]*DriverInstance)
 	driversByName     = make(map[string]*DriverInstance)
+	driverPollWake    TaskWake // A driver timer is waiting for DriverPollTask
 )
 
 // RegisterDriver registers a new driver instance with the system.
@@ -117,6 +118,7 @@ func RegisterDriver(oid uint8, config *DriverConfig) error {
 			Active:     false,
 			PollRate:   config.PollRate,
 		},
+		Timer: Timer{Owner: TimerOwnerDriver},
 	}
 
 	// Initialize driver if InitFunc is provided
@@ -141,6 +143,15 @@ func GetDriver(oid uint8) (*DriverInstance, bool) {
 	return instance, exists
 }
 
+// lookupDriver retrieves a driver configured by config_driver
+// The MCU shuts down if the OID is not a configured driver.
+func lookupDriver(oid uint8) (*DriverInstance, bool) {
+	if LookupOID(oid, OIDDriver) != nil {
+		return nil, false
+	}
+	return GetDriver(oid)
+}
+
 // GetDriverByName retrieves a registered driver by name
 func GetDriverByName(name string) (*DriverInstance, bool) {
 	instance, exists := driversByName[name]
@@ -156,7 +167,7 @@ func UnregisterDriver(oid uint8) error {
 
 	// Stop polling if active
 	if instance.State.Active {
-		instance.Timer.Next = nil // Cancel timer
+		CancelTimer(&instance.Timer)
 	}
 
 	// Call close function if provided
@@ -199,42 +210,6 @@ func NewSPIDriverConfig(name string, bus SPIBusID, mode SPIMode, rate uint32, cs
 	}
 }
 
-// Helper functions to get machine.* interfaces for driver initialization
-
-// GetMachineI2C returns a configured machine.I2C instance for a bus
-func GetMachineI2C(bus I2CBusID) (*machine.I2C, error) {
-	busInterface, err := MustI2C().GetMachineBus(bus)
-	if err != nil {
-		return nil, err
-	}
-
-	i2c, ok := busInterface.(*machine.I2C)
-	if !ok {
-		return nil, errors.New("bus is not a machine.I2C instance")
-	}
-
-	return i2c, nil
-}
-
-// GetMachineSPI returns a configured machine.SPI instance for a bus handle
-func GetMachineSPI(busHandle interface{}) (*machine.SPI, error) {
-	if busHandle == nil {
-		return nil, errors.New("invalid bus handle")
-	}
-
-	spiInterface, err := MustSPI().GetMachineBus(busHandle)
-	if err != nil {
-		return nil, err
-	}
-
-	spi, ok := spiInterface.(*machine.SPI)
-	if !ok {
-		return nil, errors.New("bus is not a machine.SPI instance")
-	}
-
-	return spi, nil
-}
-
 // StartPolling starts periodic polling for a driver
 func StartPolling(instance *DriverInstance, pollRateTicks uint32) error {
 	if instance.Config.PollFunc == nil {
@@ -245,6 +220,9 @@ func StartPolling(instance *DriverInstance, pollRateTicks uint32) error {
 		return errors.New("poll rate must be greater than 0")
 	}
 
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
 	instance.State.PollRate = pollRateTicks
 	instance.State.Active = true
 	instance.pollFunc = instance.Config.PollFunc
@@ -260,45 +238,86 @@ func StartPolling(instance *DriverInstance, pollRateTicks uint32) error {
 // StopPolling stops periodic polling for a driver
 func StopPolling(instance *DriverInstance) {
 	instance.State.Active = false
-	instance.Timer.Next = nil // Cancel timer
+	CancelTimer(&instance.Timer)
 }
 
-// driverPollHandler is the timer callback for driver polling
-func driverPollHandler(t *Timer) uint8 {
-	// Find the driver instance that owns this timer
-	var instance *DriverInstance
+// ShutdownAllDrivers stops polling on every registered driver
+// (called during shutdown)
+func ShutdownAllDrivers() {
 	for _, inst := range registeredDrivers {
-		if inst != nil && &inst.Timer == t {
-			instance = inst
-			break
+		if inst != nil {
+			StopPolling(inst)
 		}
 	}
+}
 
-	if instance == nil || !instance.State.Active {
+// releaseAllDrivers returns every registered driver to the unconfigured
+// state (called on config reset). Drivers are registered by the firmware
+// rather than the host, so they stay registered and are configured again
+// by the next config_driver.
+func releaseAllDrivers() {
+	for _, inst := range registeredDrivers {
+		if inst != nil {
+			inst.State = DriverState{PollRate: inst.Config.PollRate}
+			inst.pollPending = false
+		}
+	}
+}
+
+// driverPollHandler is the timer callback for driver polling
+func driverPollHandler(t *Timer) uint8 {
+	instance := timerContainer[DriverInstance](t, unsafe.Offsetof(DriverInstance{}.Timer))
+
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	if !instance.State.Active {
 		return SF_DONE
 	}
 
-	// Call the poll function
-	if instance.pollFunc != nil {
+	// Poll from task context, as the poll function talks to the bus
+	instance.pollPending = true
+	driverPollWake.Wake()
+
+	// Reschedule
+	t.WakeTime = t.WakeTime + instance.State.PollRate
+	return SF_RESCHEDULE
+}
+
+// DriverPollTask runs the polls the driver timers asked for and sends the
+// data to the host
+func DriverPollTask() {
+	if !driverPollWake.Check() {
+		return
+	}
+
+	for _, instance := range registeredDrivers {
+		if instance == nil {
+			continue
+		}
+		state := disableInterrupts()
+		pending := instance.pollPending && instance.State.Active
+		instance.pollPending = false
+		restoreInterrupts(state)
+		if !pending || instance.pollFunc == nil {
+			continue
+		}
+
 		data, err := instance.pollFunc(instance.Device)
 		if err != nil {
 			instance.State.LastError = err
-		} else {
-			instance.State.LastError = nil
-
-			// Send data as a response if available
-			if len(data) > 0 {
-				SendResponse("driver_poll_data", func(output protocol.OutputBuffer) {
-					protocol.EncodeVLQUint(output, uint32(instance.OID))
-					for _, b := range data {
-						protocol.EncodeVLQUint(output, uint32(b))
-					}
-				})
-			}
+			continue
+		}
+		instance.State.LastError = nil
+
+		// Send data as a response if available
+		if len(data) > 0 {
+			SendResponse("driver_poll_data", func(output protocol.OutputBuffer) {
+				protocol.EncodeVLQUint(output, uint32(instance.OID))
+				for _, b := range data {
+					protocol.EncodeVLQUint(output, uint32(b))
+				}
+			})
 		}
 	}
-
-	// Reschedule
-	t.WakeTime = t.WakeTime + instance.State.PollRate
-	return SF_RESCHEDULE
 }
@@ -4,6 +4,7 @@ package core
 
 import (
 	"gopper/protocol"
+	"unsafe"
 )
 
 // Endstop flags
@@ -30,8 +31,21 @@ type Endstop struct {
 // Global registry of endstops
 var endstops = make(map[uint8]*Endstop)
 
+// lookupEndstop retrieves an endstop by OID
+// The MCU shuts down if the OID is not an endstop.
+func lookupEndstop(oid uint8) (*Endstop, bool) {
+	if LookupOID(oid, OIDEndstop) != nil {
+		return nil, false
+	}
+	es, exists := endstops[oid]
+	return es, exists
+}
+
 // InitEndstopCommands registers endstop-related commands
 func InitEndstopCommands() {
+	RegisterShutdown(ShutdownAllEndstops)
+	RegisterConfigReset(releaseAllEndstops)
+
 	// Command to configure an endstop
 	RegisterCommand("config_endstop", "oid=%c pin=%u pull_up=%c", handleConfigEndstop)
 
@@ -47,36 +61,31 @@ func InitEndstopCommands() {
 
 // handleConfigEndstop configures a GPIO endstop
 // Format: config_endstop oid=%c pin=%u pull_up=%c
-func handleConfigEndstop(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pullUp, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigEndstop(args *Args) error {
+	oid := args.Uint(0)
+	pin := args.Uint(1)
+	pullUp := args.Uint(2)
+	if err := AllocOID(uint8(oid), OIDEndstop); err != nil {
 		return err
 	}
 
 	// Create new endstop instance
 	es := &Endstop{
-		OID: uint8(oid),
-		Pin: GPIOPin(pin),
+		OID:   uint8(oid),
+		Pin:   GPIOPin(pin),
+		Timer: Timer{Owner: TimerOwnerEndstop},
 	}
 
 	// Configure GPIO pin as input via HAL
 	// Pull-up/pull-down configuration
 	if pullUp != 0 {
 		if err := MustGPIO().ConfigureInputPullUp(es.Pin); err != nil {
+			freeOID(uint8(oid))
 			return err
 		}
 	} else {
 		if err := MustGPIO().ConfigureInputPullDown(es.Pin); err != nil {
+			freeOID(uint8(oid))
 			return err
 		}
 	}
@@ -89,57 +98,24 @@ func handleConfigEndstop(data *[]byte) error {
 
 // handleEndstopHome starts homing with an endstop
 // Format: endstop_home oid=%c clock=%u sample_ticks=%u sample_count=%c rest_ticks=%u pin_value=%c trsync_oid=%c trigger_reason=%c
-func handleEndstopHome(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleCount, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	restTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pinValue, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	trsyncOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	triggerReason, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleEndstopHome(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
+	sampleTicks := args.Uint(2)
+	sampleCount := args.Uint(3)
+	restTicks := args.Uint(4)
+	pinValue := args.Uint(5)
+	trsyncOID := args.Uint(6)
+	triggerReason := args.Uint(7)
 
 	// Get endstop object
-	es, exists := endstops[uint8(oid)]
+	es, exists := lookupEndstop(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Cancel any existing timer
-	// Note: In a real implementation, we'd need sched_del_timer
-	// For now, we clear the Next pointer
-	es.Timer.Next = nil
+	CancelTimer(&es.Timer)
 
 	// If sample_count is 0, disable homing
 	if sampleCount == 0 {
@@ -151,7 +127,7 @@ func handleEndstopHome(data *[]byte) error {
 	// Get trigger sync object
 	ts, exists := GetTriggerSync(uint8(trsyncOID))
 	if !exists {
-		return nil // Silently ignore if trsync not configured
+		return errInvalidOID
 	}
 
 	// Configure homing parameters
@@ -178,16 +154,13 @@ func handleEndstopHome(data *[]byte) error {
 
 // handleEndstopQueryState queries the current endstop state
 // Format: endstop_query_state oid=%c
-func handleEndstopQueryState(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleEndstopQueryState(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get endstop object
-	es, exists := endstops[uint8(oid)]
+	es, exists := lookupEndstop(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Read current pin state
@@ -221,18 +194,10 @@ func handleEndstopQueryState(data *[]byte) error {
 // endstopEvent is the timer callback for endstop checking
 // This is the first-stage check that looks for a potential trigger
 func endstopEvent(t *Timer) uint8 {
-	// Find the Endstop instance that owns this timer
-	var es *Endstop
-	for _, esPtr := range endstops {
-		if esPtr != nil && &esPtr.Timer == t {
-			es = esPtr
-			break
-		}
-	}
+	es := timerContainer[Endstop](t, unsafe.Offsetof(Endstop{}.Timer))
 
-	if es == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Read pin state
 	pinHigh := MustGPIO().ReadPin(es.Pin)
@@ -260,18 +225,10 @@ func endstopEvent(t *Timer) uint8 {
 // endstopOversampleEvent is the timer callback for oversampling
 // This confirms the trigger by taking multiple consecutive samples
 func endstopOversampleEvent(t *Timer) uint8 {
-	// Find the Endstop instance that owns this timer
-	var es *Endstop
-	for _, esPtr := range endstops {
-		if esPtr != nil && &esPtr.Timer == t {
-			es = esPtr
-			break
-		}
-	}
+	es := timerContainer[Endstop](t, unsafe.Offsetof(Endstop{}.Timer))
 
-	if es == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Read pin state
 	pinHigh := MustGPIO().ReadPin(es.Pin)
@@ -303,3 +260,18 @@ func endstopOversampleEvent(t *Timer) uint8 {
 	t.WakeTime += es.SampleTime
 	return SF_RESCHEDULE
 }
+
+// ShutdownAllEndstops stops homing on every endstop (called during shutdown)
+func ShutdownAllEndstops() {
+	for _, es := range endstops {
+		if es != nil {
+			es.Flags &^= ESF_HOMING
+			CancelTimer(&es.Timer)
+		}
+	}
+}
+
+// releaseAllEndstops forgets every endstop (called on config reset)
+func releaseAllEndstops() {
+	clear(endstops)
+}
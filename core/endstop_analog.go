@@ -4,6 +4,7 @@ package core
 
 import (
 	"gopper/protocol"
+	"unsafe"
 )
 
 // AnalogEndstop represents a configured ADC-based endstop
@@ -29,8 +30,21 @@ type AnalogEndstop struct {
 // Global registry of analog endstops
 var analogEndstops = make(map[uint8]*AnalogEndstop)
 
+// lookupAnalogEndstop retrieves an analog endstop by OID
+// The MCU shuts down if the OID is not an analog endstop.
+func lookupAnalogEndstop(oid uint8) (*AnalogEndstop, bool) {
+	if LookupOID(oid, OIDAnalogEndstop) != nil {
+		return nil, false
+	}
+	aes, exists := analogEndstops[oid]
+	return aes, exists
+}
+
 // InitAnalogEndstopCommands registers analog endstop-related commands
 func InitAnalogEndstopCommands() {
+	RegisterShutdown(ShutdownAllAnalogEndstops)
+	RegisterConfigReset(releaseAllAnalogEndstops)
+
 	// RE-ENABLED: Testing with properly recompiled TinyGo (32KB stack)
 	RegisterCommand("config_analog_endstop", "oid=%c adc_oid=%c threshold=%u trigger_above=%c hysteresis=%u", handleConfigAnalogEndstop)
 	RegisterCommand("analog_endstop_home", "oid=%c clock=%u sample_ticks=%u sample_count=%c rest_ticks=%u trsync_oid=%c trigger_reason=%c", handleAnalogEndstopHome)
@@ -40,36 +54,21 @@ func InitAnalogEndstopCommands() {
 
 // handleConfigAnalogEndstop configures an analog endstop
 // Format: config_analog_endstop oid=%c adc_oid=%c threshold=%u trigger_above=%c hysteresis=%u
-func handleConfigAnalogEndstop(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	adcOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	threshold, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	triggerAbove, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	hysteresis, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigAnalogEndstop(args *Args) error {
+	oid := args.Uint(0)
+	adcOID := args.Uint(1)
+	threshold := args.Uint(2)
+	triggerAbove := args.Uint(3)
+	hysteresis := args.Uint(4)
+	if err := AllocOID(uint8(oid), OIDAnalogEndstop); err != nil {
 		return err
 	}
 
 	// Get ADC object
 	adc, exists := GetADC(uint8(adcOID))
 	if !exists {
-		return nil // Silently ignore if ADC not configured
+		freeOID(uint8(oid))
+		return errInvalidOID
 	}
 
 	// Create new analog endstop instance
@@ -79,6 +78,7 @@ func handleConfigAnalogEndstop(data *[]byte) error {
 		Threshold:    threshold,
 		TriggerAbove: triggerAbove != 0,
 		Hysteresis:   hysteresis,
+		Timer:        Timer{Owner: TimerOwnerEndstop},
 	}
 
 	// Register in global map
@@ -89,50 +89,23 @@ func handleConfigAnalogEndstop(data *[]byte) error {
 
 // handleAnalogEndstopHome starts homing with an analog endstop
 // Format: analog_endstop_home oid=%c clock=%u sample_ticks=%u sample_count=%c rest_ticks=%u trsync_oid=%c trigger_reason=%c
-func handleAnalogEndstopHome(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleCount, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	restTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	trsyncOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	triggerReason, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleAnalogEndstopHome(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
+	sampleTicks := args.Uint(2)
+	sampleCount := args.Uint(3)
+	restTicks := args.Uint(4)
+	trsyncOID := args.Uint(5)
+	triggerReason := args.Uint(6)
 
 	// Get analog endstop object
-	aes, exists := analogEndstops[uint8(oid)]
+	aes, exists := lookupAnalogEndstop(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Cancel any existing timer
-	aes.Timer.Next = nil
+	CancelTimer(&aes.Timer)
 
 	// If sample_count is 0, disable homing
 	if sampleCount == 0 {
@@ -144,7 +117,7 @@ func handleAnalogEndstopHome(data *[]byte) error {
 	// Get trigger sync object
 	ts, exists := GetTriggerSync(uint8(trsyncOID))
 	if !exists {
-		return nil // Silently ignore if trsync not configured
+		return errInvalidOID
 	}
 
 	// Configure homing parameters
@@ -166,16 +139,13 @@ func handleAnalogEndstopHome(data *[]byte) error {
 
 // handleAnalogEndstopQueryState queries the current analog endstop state
 // Format: analog_endstop_query_state oid=%c
-func handleAnalogEndstopQueryState(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleAnalogEndstopQueryState(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get analog endstop object
-	aes, exists := analogEndstops[uint8(oid)]
+	aes, exists := lookupAnalogEndstop(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Read current state
@@ -208,18 +178,10 @@ func handleAnalogEndstopQueryState(data *[]byte) error {
 
 // analogEndstopEvent is the timer callback for analog endstop checking
 func analogEndstopEvent(t *Timer) uint8 {
-	// Find the AnalogEndstop instance that owns this timer
-	var aes *AnalogEndstop
-	for _, aesPtr := range analogEndstops {
-		if aesPtr != nil && &aesPtr.Timer == t {
-			aes = aesPtr
-			break
-		}
-	}
+	aes := timerContainer[AnalogEndstop](t, unsafe.Offsetof(AnalogEndstop{}.Timer))
 
-	if aes == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Read ADC value
 	if aes.ADC == nil {
@@ -254,18 +216,10 @@ func analogEndstopEvent(t *Timer) uint8 {
 
 // analogEndstopOversampleEvent is the timer callback for oversampling
 func analogEndstopOversampleEvent(t *Timer) uint8 {
-	// Find the AnalogEndstop instance that owns this timer
-	var aes *AnalogEndstop
-	for _, aesPtr := range analogEndstops {
-		if aesPtr != nil && &aesPtr.Timer == t {
-			aes = aesPtr
-			break
-		}
-	}
+	aes := timerContainer[AnalogEndstop](t, unsafe.Offsetof(AnalogEndstop{}.Timer))
 
-	if aes == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Read ADC value
 	if aes.ADC == nil {
@@ -309,3 +263,18 @@ func analogEndstopOversampleEvent(t *Timer) uint8 {
 	t.WakeTime += aes.SampleTime
 	return SF_RESCHEDULE
 }
+
+// ShutdownAllAnalogEndstops stops homing on every analog endstop (called during shutdown)
+func ShutdownAllAnalogEndstops() {
+	for _, es := range analogEndstops {
+		if es != nil {
+			es.Flags &^= ESF_HOMING
+			CancelTimer(&es.Timer)
+		}
+	}
+}
+
+// releaseAllAnalogEndstops forgets every analog endstop (called on config reset)
+func releaseAllAnalogEndstops() {
+	clear(analogEndstops)
+}
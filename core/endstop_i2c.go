@@ -4,6 +4,7 @@ package core
 
 import (
 	"gopper/protocol"
+	"unsafe"
 )
 
 // I2CEndstop represents a configured I2C-based endstop
@@ -30,6 +31,11 @@ type I2CEndstop struct {
 	// Sensor state
 	LastDistance uint32 // Last measured distance (in mm)
 	Initialized  bool   // Sensor initialized flag
+
+	// The timer cannot use the bus, so I2CEndstopTask reads the sensor for
+	// it
+	readPending bool // The timer asked I2CEndstopTask for a reading
+	fresh       bool // LastDistance was read since the timer last used it
 }
 
 // I2C Endstop sensor types
@@ -40,10 +46,27 @@ const (
 )
 
 // Global registry of I2C endstops
-var i2cEndstops = make(map[uint8]*I2CEndstop)
+var (
+	i2cEndstops    = make(map[uint8]*I2CEndstop)
+	i2cEndstopWake TaskWake // An I2C endstop timer is waiting for a reading
+)
+
+// lookupI2CEndstop retrieves an I2C endstop by OID
+// The MCU shuts down if the OID is not an I2C endstop.
+func lookupI2CEndstop(oid uint8) (*I2CEndstop, bool) {
+	if LookupOID(oid, OIDI2CEndstop) != nil {
+		return nil, false
+	}
+	ies, exists := i2cEndstops[oid]
+	return ies, exists
+}
 
 // InitI2CEndstopCommands registers I2C endstop-related commands
 func InitI2CEndstopCommands() {
+	RegisterShutdown(ShutdownAllI2CEndstops)
+	RegisterConfigReset(releaseAllI2CEndstops)
+	RegisterTask("i2c_endstop", I2CEndstopTask)
+
 	// RE-ENABLED: Testing with properly recompiled TinyGo (32KB stack)
 	RegisterCommand("config_i2c_endstop", "oid=%c i2c_oid=%c addr=%c sensor_type=%c distance_threshold=%u trigger_below=%c hysteresis=%u", handleConfigI2CEndstop)
 	RegisterCommand("i2c_endstop_home", "oid=%c clock=%u sample_ticks=%u sample_count=%c rest_ticks=%u trsync_oid=%c trigger_reason=%c", handleI2CEndstopHome)
@@ -53,46 +76,23 @@ func InitI2CEndstopCommands() {
 
 // handleConfigI2CEndstop configures an I2C endstop
 // Format: config_i2c_endstop oid=%c i2c_oid=%c addr=%c sensor_type=%c distance_threshold=%u trigger_below=%c hysteresis=%u
-func handleConfigI2CEndstop(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	i2cOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	addr, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sensorType, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	distanceThreshold, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	triggerBelow, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	hysteresis, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigI2CEndstop(args *Args) error {
+	oid := args.Uint(0)
+	i2cOID := args.Uint(1)
+	addr := args.Uint(2)
+	sensorType := args.Uint(3)
+	distanceThreshold := args.Uint(4)
+	triggerBelow := args.Uint(5)
+	hysteresis := args.Uint(6)
+	if err := AllocOID(uint8(oid), OIDI2CEndstop); err != nil {
 		return err
 	}
 
 	// Get I2C object
 	i2c, exists := GetI2C(uint8(i2cOID))
 	if !exists {
-		return nil // Silently ignore if I2C not configured
+		freeOID(uint8(oid))
+		return errInvalidOID
 	}
 
 	// Create new I2C endstop instance
@@ -105,6 +105,7 @@ func handleConfigI2CEndstop(data *[]byte) error {
 		TriggerBelow:      triggerBelow != 0,
 		Hysteresis:        hysteresis,
 		Initialized:       false,
+		Timer:             Timer{Owner: TimerOwnerEndstop},
 	}
 
 	// Initialize the sensor based on type
@@ -120,50 +121,23 @@ func handleConfigI2CEndstop(data *[]byte) error {
 
 // handleI2CEndstopHome starts homing with an I2C endstop
 // Format: i2c_endstop_home oid=%c clock=%u sample_ticks=%u sample_count=%c rest_ticks=%u trsync_oid=%c trigger_reason=%c
-func handleI2CEndstopHome(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	sampleCount, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	restTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	trsyncOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	triggerReason, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleI2CEndstopHome(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
+	sampleTicks := args.Uint(2)
+	sampleCount := args.Uint(3)
+	restTicks := args.Uint(4)
+	trsyncOID := args.Uint(5)
+	triggerReason := args.Uint(6)
 
 	// Get I2C endstop object
-	ies, exists := i2cEndstops[uint8(oid)]
+	ies, exists := lookupI2CEndstop(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Cancel any existing timer
-	ies.Timer.Next = nil
+	CancelTimer(&ies.Timer)
 
 	// If sample_count is 0, disable homing
 	if sampleCount == 0 {
@@ -175,7 +149,7 @@ func handleI2CEndstopHome(data *[]byte) error {
 	// Get trigger sync object
 	ts, exists := GetTriggerSync(uint8(trsyncOID))
 	if !exists {
-		return nil // Silently ignore if trsync not configured
+		return errInvalidOID
 	}
 
 	// Ensure sensor is initialized
@@ -192,28 +166,30 @@ func handleI2CEndstopHome(data *[]byte) error {
 	ies.RestTime = restTicks
 	ies.TriggerSync = ts
 	ies.TriggerReason = uint8(triggerReason)
-	ies.Flags = ESF_HOMING
 
-	// Schedule initial timer
+	// Schedule initial timer, with a reading taken for it by then
+	state := disableInterrupts()
+	ies.Flags = ESF_HOMING
+	ies.fresh = false
+	ies.readPending = true
 	ies.Timer.WakeTime = clock
 	ies.Timer.Handler = i2cEndstopEvent
 	ScheduleTimer(&ies.Timer)
+	restoreInterrupts(state)
+	i2cEndstopWake.Wake()
 
 	return nil
 }
 
 // handleI2CEndstopQueryState queries the current I2C endstop state
 // Format: i2c_endstop_query_state oid=%c
-func handleI2CEndstopQueryState(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleI2CEndstopQueryState(args *Args) error {
+	oid := args.Uint(0)
 
 	// Get I2C endstop object
-	ies, exists := i2cEndstops[uint8(oid)]
+	ies, exists := lookupI2CEndstop(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Read current state
@@ -317,29 +293,19 @@ func readI2CDistance(ies *I2CEndstop) (uint32, error) {
 
 // i2cEndstopEvent is the timer callback for I2C endstop checking
 func i2cEndstopEvent(t *Timer) uint8 {
-	// Find the I2CEndstop instance that owns this timer
-	var ies *I2CEndstop
-	for _, iesPtr := range i2cEndstops {
-		if iesPtr != nil && &iesPtr.Timer == t {
-			ies = iesPtr
-			break
-		}
-	}
+	ies := timerContainer[I2CEndstop](t, unsafe.Offsetof(I2CEndstop{}.Timer))
 
-	if ies == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
-	// Read distance from sensor
-	distance, err := readI2CDistance(ies)
-	if err != nil {
-		// On error, reschedule and try again
+	// Take the reading made since the last event
+	distance, ok := ies.takeDistance()
+	if !ok {
+		// No reading yet, or it failed: reschedule and try again
 		t.WakeTime = t.WakeTime + ies.RestTime
 		return SF_RESCHEDULE
 	}
 
-	ies.LastDistance = distance
-
 	// Check if distance crosses threshold
 	var triggered bool
 	if ies.TriggerBelow {
@@ -358,39 +324,34 @@ func i2cEndstopEvent(t *Timer) uint8 {
 		return SF_RESCHEDULE
 	}
 
-	// Potential trigger detected - start oversampling
+	// Potential trigger detected - start oversampling, with this reading
+	// as the first sample
 	ies.NextWake = nextWake
 	t.Handler = i2cEndstopOversampleEvent
-	return i2cEndstopOversampleEvent(t)
+	return i2cEndstopOversample(t, ies, distance)
 }
 
 // i2cEndstopOversampleEvent is the timer callback for oversampling
 func i2cEndstopOversampleEvent(t *Timer) uint8 {
-	// Find the I2CEndstop instance that owns this timer
-	var ies *I2CEndstop
-	for _, iesPtr := range i2cEndstops {
-		if iesPtr != nil && &iesPtr.Timer == t {
-			ies = iesPtr
-			break
-		}
-	}
+	ies := timerContainer[I2CEndstop](t, unsafe.Offsetof(I2CEndstop{}.Timer))
 
-	if ies == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
-	// Read distance from sensor
-	distance, err := readI2CDistance(ies)
-	if err != nil {
-		// On error, go back to main event
+	// Take the reading made since the last sample
+	distance, ok := ies.takeDistance()
+	if !ok {
+		// No reading, go back to main event
 		t.Handler = i2cEndstopEvent
 		t.WakeTime = ies.NextWake
 		ies.TriggerCount = ies.SampleCount
 		return SF_RESCHEDULE
 	}
+	return i2cEndstopOversample(t, ies, distance)
+}
 
-	ies.LastDistance = distance
-
+// i2cEndstopOversample counts a reading towards the trigger
+func i2cEndstopOversample(t *Timer, ies *I2CEndstop, distance uint32) uint8 {
 	// Check if distance still crosses threshold (with hysteresis)
 	var triggered bool
 	if ies.TriggerBelow {
@@ -427,6 +388,43 @@ func i2cEndstopOversampleEvent(t *Timer) uint8 {
 	return SF_RESCHEDULE
 }
 
+// takeDistance returns the distance I2CEndstopTask read since the last
+// call, and asks it for the next one
+// Interrupts must be disabled.
+func (ies *I2CEndstop) takeDistance() (uint32, bool) {
+	fresh := ies.fresh
+	ies.fresh = false
+	ies.readPending = true
+	i2cEndstopWake.Wake()
+	return ies.LastDistance, fresh
+}
+
+// I2CEndstopTask reads the sensors the endstop timers asked for. The bus is
+// only used from task context, where the read may wait and allocate.
+func I2CEndstopTask() {
+	if !i2cEndstopWake.Check() {
+		return
+	}
+
+	for _, ies := range i2cEndstops {
+		state := disableInterrupts()
+		pending := ies.readPending && ies.Flags&ESF_HOMING != 0
+		ies.readPending = false
+		restoreInterrupts(state)
+		if !pending {
+			continue
+		}
+
+		distance, err := readI2CDistance(ies)
+		state = disableInterrupts()
+		if err == nil {
+			ies.LastDistance = distance
+		}
+		ies.fresh = err == nil
+		restoreInterrupts(state)
+	}
+}
+
 // Helper functions for I2C communication
 
 func i2cWrite(i2c *I2CDevice, addr uint8, data []byte) error {
@@ -451,3 +449,18 @@ func i2cRead(i2c *I2CDevice, addr uint8, reg uint8, buf []byte) error {
 	copy(buf, data)
 	return nil
 }
+
+// ShutdownAllI2CEndstops stops homing on every I2C endstop (called during shutdown)
+func ShutdownAllI2CEndstops() {
+	for _, es := range i2cEndstops {
+		if es != nil {
+			es.Flags &^= ESF_HOMING
+			CancelTimer(&es.Timer)
+		}
+	}
+}
+
+// releaseAllI2CEndstops forgets every I2C endstop (called on config reset)
+func releaseAllI2CEndstops() {
+	clear(i2cEndstops)
+}
@@ -2,9 +2,7 @@
 // Implements Klipper's digital_out protocol for controlling GPIO pins
 package core
 
-import (
-	"gopper/protocol"
-)
+import "unsafe"
 
 // DigitalOut flags
 const (
@@ -21,7 +19,8 @@ type DigitalOut struct {
 	Flags uint8   // State flags (DF_*)
 
 	// Timers for scheduled operations
-	Timer Timer // Main timer for scheduled updates and PWM
+	Timer Timer     // Main timer for scheduled updates and PWM
+	Queue MoveQueue // Changes from queue_digital_out, oldest first
 
 	// PWM timing
 	OnDuration  uint32 // PWM on time in ticks
@@ -36,8 +35,21 @@ type DigitalOut struct {
 // Global registry of digital outputs
 var digitalOutputs = make(map[uint8]*DigitalOut)
 
+// lookupDigitalOut retrieves a digital output by OID
+// The MCU shuts down if the OID is not a digital output.
+func lookupDigitalOut(oid uint8) (*DigitalOut, bool) {
+	if LookupOID(oid, OIDDigitalOut) != nil {
+		return nil, false
+	}
+	dout, exists := digitalOutputs[oid]
+	return dout, exists
+}
+
 // InitGPIOCommands registers GPIO-related commands with the command registry
 func InitGPIOCommands() {
+	RegisterShutdown(ShutdownAllDigitalOut)
+	RegisterConfigReset(releaseAllDigitalOut)
+
 	// Command to configure a digital output pin
 	RegisterCommand("config_digital_out", "oid=%c pin=%u value=%c default_value=%c max_duration=%u", handleConfigDigitalOut)
 
@@ -53,29 +65,13 @@ func InitGPIOCommands() {
 
 // handleConfigDigitalOut configures a pin for digital output
 // Format: config_digital_out oid=%c pin=%u value=%c default_value=%c max_duration=%u
-func handleConfigDigitalOut(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	value, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	defaultValue, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	maxDuration, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigDigitalOut(args *Args) error {
+	oid := args.Uint(0)
+	pin := args.Uint(1)
+	value := args.Uint(2)
+	defaultValue := args.Uint(3)
+	maxDuration := args.Uint(4)
+	if err := AllocOID(uint8(oid), OIDDigitalOut); err != nil {
 		return err
 	}
 
@@ -85,6 +81,7 @@ func handleConfigDigitalOut(data *[]byte) error {
 		Pin:         GPIOPin(pin),
 		MaxDuration: maxDuration,
 		Flags:       0,
+		Timer:       Timer{Owner: TimerOwnerDigitalOut},
 	}
 
 	// Set default value flag
@@ -94,12 +91,14 @@ func handleConfigDigitalOut(data *[]byte) error {
 
 	// Configure GPIO pin via HAL
 	if err := MustGPIO().ConfigureOutput(dout.Pin); err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
 	// Set initial value
 	initialState := value != 0
 	if err := MustGPIO().SetPin(dout.Pin, initialState); err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -114,31 +113,45 @@ func handleConfigDigitalOut(data *[]byte) error {
 	return nil
 }
 
-// handleQueueDigitalOut schedules a pin state change
+// handleQueueDigitalOut queues a pin state change
 // Format: queue_digital_out oid=%c clock=%u on_ticks=%u
-func handleQueueDigitalOut(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+// Changes take a node from the shared move pool and are applied in order by
+// digitalOutLoadEvent, each at its clock.
+func handleQueueDigitalOut(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
+	onTicks := args.Uint(2)
 
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
+	// Get the digital output object
+	dout, exists := lookupDigitalOut(uint8(oid))
+	if !exists {
+		return errInvalidOID
 	}
 
-	onTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
+	n := MoveAlloc()
+	if n == nil {
+		return errMoveQueueOverflow
 	}
+	*n.Output() = OutputMove{Clock: clock, Value: onTicks}
 
-	// Get the digital output object
-	dout, exists := digitalOutputs[uint8(oid)]
-	if !exists {
-		// Invalid OID - digital output not configured
-		return nil
+	// The timer may be pending, so queue the change with interrupts disabled
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+	dout.Queue.Push(n)
+
+	// An earlier queued change schedules this one when it is applied, and a
+	// running toggle hands over to it when it is due
+	if dout.Queue.Len() == 1 && (!dout.Timer.Pending() || int32(clock-dout.Timer.WakeTime) < 0) {
+		dout.Timer.WakeTime = clock
+		dout.Timer.Handler = digitalOutLoadEvent
+		ScheduleTimer(&dout.Timer)
 	}
 
+	return nil
+}
+
+// loadDigitalOut sets the flags for a queued change of on_ticks at clock
+func loadDigitalOut(dout *DigitalOut, clock, onTicks uint32) {
 	// If PWM cycle is configured, use it for PWM mode
 	if dout.CycleTime != 0 {
 		dout.OnDuration = onTicks
@@ -185,35 +198,37 @@ func handleQueueDigitalOut(data *[]byte) error {
 			dout.Flags &^= DF_CHECK_END
 		}
 	}
+}
 
-	// Schedule the timer to execute at the specified clock time
-	// Clear Next pointer to avoid issues if timer was previously scheduled
-	dout.Timer.Next = nil
-	dout.Timer.WakeTime = clock
-	dout.Timer.Handler = digitalOutLoadEvent
-	ScheduleTimer(&dout.Timer)
-
-	return nil
+// digitalOutNext schedules handler at wake, unless the next queued change
+// is due first. With a nil handler only a queued change is scheduled.
+func digitalOutNext(dout *DigitalOut, t *Timer, wake uint32, handler func(*Timer) uint8) uint8 {
+	if n := dout.Queue.First(); n != nil {
+		clock := n.Output().Clock
+		if handler == nil || int32(clock-wake) <= 0 {
+			t.WakeTime = clock
+			t.Handler = digitalOutLoadEvent
+			return SF_RESCHEDULE
+		}
+	}
+	if handler == nil {
+		return SF_DONE
+	}
+	t.WakeTime = wake
+	t.Handler = handler
+	return SF_RESCHEDULE
 }
 
 // handleUpdateDigitalOut immediately updates a pin value
 // Format: update_digital_out oid=%c value=%c
-func handleUpdateDigitalOut(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	value, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleUpdateDigitalOut(args *Args) error {
+	oid := args.Uint(0)
+	value := args.Uint(1)
 
 	// Get the digital output object
-	dout, exists := digitalOutputs[uint8(oid)]
+	dout, exists := lookupDigitalOut(uint8(oid))
 	if !exists {
-		// Invalid OID - digital output not configured
-		return nil
+		return errInvalidOID
 	}
 
 	// Update pin state immediately
@@ -222,7 +237,8 @@ func handleUpdateDigitalOut(data *[]byte) error {
 		return err
 	}
 
-	// Update flags
+	// Update flags (the timer handlers modify them too)
+	irq := disableInterrupts()
 	if state {
 		dout.Flags |= DF_ON
 	} else {
@@ -231,28 +247,21 @@ func handleUpdateDigitalOut(data *[]byte) error {
 
 	// Disable toggling mode
 	dout.Flags &^= DF_TOGGLING
+	restoreInterrupts(irq)
 
 	return nil
 }
 
 // handleSetDigitalOutPWMCycle sets the PWM cycle time
 // Format: set_digital_out_pwm_cycle oid=%c cycle_ticks=%u
-func handleSetDigitalOutPWMCycle(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	cycleTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleSetDigitalOutPWMCycle(args *Args) error {
+	oid := args.Uint(0)
+	cycleTicks := args.Uint(1)
 
 	// Get the digital output object
-	dout, exists := digitalOutputs[uint8(oid)]
+	dout, exists := lookupDigitalOut(uint8(oid))
 	if !exists {
-		// Invalid OID - digital output not configured
-		return nil
+		return errInvalidOID
 	}
 
 	// Set cycle time
@@ -261,22 +270,22 @@ func handleSetDigitalOutPWMCycle(data *[]byte) error {
 	return nil
 }
 
-// digitalOutLoadEvent is the timer handler for loading scheduled pin updates
+// digitalOutLoadEvent is the timer handler for applying queued pin changes
 // This executes at the scheduled time and sets up PWM toggling if needed
 func digitalOutLoadEvent(t *Timer) uint8 {
-	// Find the DigitalOut instance that owns this timer
-	var dout *DigitalOut
-	for _, dPtr := range digitalOutputs {
-		if dPtr != nil && &dPtr.Timer == t {
-			dout = dPtr
-			break
-		}
-	}
+	dout := timerContainer[DigitalOut](t, unsafe.Offsetof(DigitalOut{}.Timer))
+
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
-	if dout == nil {
-		// Timer fired but no DigitalOut found - should not happen
+	// Take the change that is due and return its node to the pool
+	n := dout.Queue.Pop()
+	if n == nil {
 		return SF_DONE
 	}
+	move := *n.Output()
+	MoveFree(n)
+	loadDigitalOut(dout, move.Clock, move.Value)
 
 	// Check if we're in toggling (PWM) mode
 	if (dout.Flags & DF_TOGGLING) != 0 {
@@ -285,50 +294,39 @@ func digitalOutLoadEvent(t *Timer) uint8 {
 		if err := MustGPIO().SetPin(dout.Pin, true); err != nil {
 			// On error, stop toggling
 			dout.Flags &^= DF_TOGGLING
-			return SF_DONE
+			return digitalOutNext(dout, t, 0, nil)
 		}
+		dout.Flags |= DF_ON
 
 		// Schedule next toggle (to turn OFF)
-		t.WakeTime = GetTime() + dout.OnDuration
-		t.Handler = digitalOutToggleEvent
-		return SF_RESCHEDULE
+		return digitalOutNext(dout, t, GetTime()+dout.OnDuration, digitalOutToggleEvent)
 	}
 
 	// Not toggling - simple on/off
-	state := (dout.Flags & DF_ON) != 0
-	if err := MustGPIO().SetPin(dout.Pin, state); err != nil {
-		return SF_DONE
+	on := (dout.Flags & DF_ON) != 0
+	if err := MustGPIO().SetPin(dout.Pin, on); err != nil {
+		return digitalOutNext(dout, t, 0, nil)
 	}
 
 	// Check if we need to monitor max_duration
 	if (dout.Flags & DF_CHECK_END) != 0 {
 		// Schedule a timer to enforce max_duration
-		t.WakeTime = dout.EndTime
-		t.Handler = digitalOutEndEvent
-		return SF_RESCHEDULE
+		return digitalOutNext(dout, t, dout.EndTime, digitalOutEndEvent)
 	}
 
-	return SF_DONE
+	return digitalOutNext(dout, t, 0, nil)
 }
 
 // digitalOutToggleEvent is the timer handler for PWM toggling
 func digitalOutToggleEvent(t *Timer) uint8 {
-	// Find the DigitalOut instance that owns this timer
-	var dout *DigitalOut
-	for _, dPtr := range digitalOutputs {
-		if dPtr != nil && &dPtr.Timer == t {
-			dout = dPtr
-			break
-		}
-	}
+	dout := timerContainer[DigitalOut](t, unsafe.Offsetof(DigitalOut{}.Timer))
 
-	if dout == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Stop toggling if flag is cleared
 	if (dout.Flags & DF_TOGGLING) == 0 {
-		return SF_DONE
+		return digitalOutNext(dout, t, 0, nil)
 	}
 
 	// Toggle pin state
@@ -338,7 +336,7 @@ func digitalOutToggleEvent(t *Timer) uint8 {
 	if err := MustGPIO().SetPin(dout.Pin, newState); err != nil {
 		// On error, stop toggling
 		dout.Flags &^= DF_TOGGLING
-		return SF_DONE
+		return digitalOutNext(dout, t, 0, nil)
 	}
 
 	// Update state flag
@@ -361,31 +359,20 @@ func digitalOutToggleEvent(t *Timer) uint8 {
 	// Check if we're approaching end time
 	currentTime := GetTime()
 	if (dout.Flags&DF_CHECK_END) != 0 && (currentTime+nextDuration >= dout.EndTime) {
-		// Switch to load event handler to check end time
-		t.WakeTime = dout.EndTime
-		t.Handler = digitalOutLoadEvent
-		return SF_RESCHEDULE
+		// Switch to the end event to enforce max_duration
+		return digitalOutNext(dout, t, dout.EndTime, digitalOutEndEvent)
 	}
 
-	// Continue toggling
-	t.WakeTime = currentTime + nextDuration
-	return SF_RESCHEDULE
+	// Continue toggling until the next queued change
+	return digitalOutNext(dout, t, currentTime+nextDuration, digitalOutToggleEvent)
 }
 
 // digitalOutEndEvent is the timer handler for max_duration enforcement
 func digitalOutEndEvent(t *Timer) uint8 {
-	// Find the DigitalOut instance that owns this timer
-	var dout *DigitalOut
-	for _, dPtr := range digitalOutputs {
-		if dPtr != nil && &dPtr.Timer == t {
-			dout = dPtr
-			break
-		}
-	}
+	dout := timerContainer[DigitalOut](t, unsafe.Offsetof(DigitalOut{}.Timer))
 
-	if dout == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Max duration expired - return to default state
 	defaultState := (dout.Flags & DF_DEFAULT_ON) != 0
@@ -403,7 +390,7 @@ func digitalOutEndEvent(t *Timer) uint8 {
 	// Clear toggling and check_end flags
 	dout.Flags &^= DF_TOGGLING | DF_CHECK_END
 
-	return SF_DONE
+	return digitalOutNext(dout, t, 0, nil)
 }
 
 // ShutdownDigitalOut returns a pin to its default state (called during shutdown)
@@ -422,8 +409,9 @@ func ShutdownDigitalOut(dout *DigitalOut) {
 	// Clear toggling and check_end flags
 	dout.Flags &^= DF_TOGGLING | DF_CHECK_END
 
-	// Stop any scheduled timers
-	dout.Timer.Next = nil
+	// Stop any scheduled timers and drop the queued changes
+	CancelTimer(&dout.Timer)
+	dout.Queue.Clear()
 }
 
 // ShutdownAllDigitalOut returns all pins to their default states
@@ -435,3 +423,9 @@ func ShutdownAllDigitalOut() {
 		}
 	}
 }
+
+// releaseAllDigitalOut forgets every digital output (called on config
+// reset, after shutdown has driven each pin to its default value)
+func releaseAllDigitalOut() {
+	clear(digitalOutputs)
+}
@@ -1,5 +1,3 @@
-//go:build tinygo
-
 // I2C (Inter-Integrated Circuit) support
 // Implements Klipper's I2C protocol for communicating with I2C devices
 package core
@@ -20,13 +18,20 @@ type I2CDevice struct {
 var i2cDevices = make(map[uint8]*I2CDevice)
 
 // GetI2C retrieves an I2C device by OID
+// The MCU shuts down if the OID is not an I2C device.
 func GetI2C(oid uint8) (*I2CDevice, bool) {
+	if LookupOID(oid, OIDI2C) != nil {
+		return nil, false
+	}
 	device, exists := i2cDevices[oid]
 	return device, exists
 }
 
 // InitI2CCommands registers I2C-related commands with the command registry
 func InitI2CCommands() {
+	RegisterShutdown(ShutdownAllI2C)
+	RegisterConfigReset(releaseAllI2C)
+
 	// Command to allocate an I2C device object
 	RegisterCommand("config_i2c", "oid=%c", handleConfigI2C)
 
@@ -45,9 +50,9 @@ func InitI2CCommands() {
 
 // handleConfigI2C allocates an I2C device object
 // Format: config_i2c oid=%c
-func handleConfigI2C(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigI2C(args *Args) error {
+	oid := args.Uint(0)
+	if err := AllocOID(uint8(oid), OIDI2C); err != nil {
 		return err
 	}
 
@@ -65,31 +70,16 @@ func handleConfigI2C(data *[]byte) error {
 
 // handleI2CSetBus configures the I2C bus, rate, and device address
 // Format: i2c_set_bus oid=%c i2c_bus=%u rate=%u address=%u
-func handleI2CSetBus(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	bus, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	rate, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	address, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleI2CSetBus(args *Args) error {
+	oid := args.Uint(0)
+	bus := args.Uint(1)
+	rate := args.Uint(2)
+	address := args.Uint(3)
 
 	// Get the I2C device object
-	device, exists := i2cDevices[uint8(oid)]
+	device, exists := GetI2C(uint8(oid))
 	if !exists {
-		return nil // Invalid OID
+		return errInvalidOID
 	}
 
 	// Mask address to 7 bits (Klipper behavior)
@@ -108,22 +98,19 @@ func handleI2CSetBus(data *[]byte) error {
 
 // handleI2CWrite writes data to an I2C device
 // Format: i2c_write oid=%c data=%*s
-func handleI2CWrite(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleI2CWrite(args *Args) error {
+	oid := args.Uint(0)
 
 	// Decode the data buffer
-	writeData, err := protocol.DecodeVLQBytes(data)
-	if err != nil {
-		return err
-	}
+	writeData := args.Bytes(1)
 
 	// Get the I2C device object
-	device, exists := i2cDevices[uint8(oid)]
-	if !exists || !device.Ready {
-		return nil // Invalid OID or not configured
+	device, exists := GetI2C(uint8(oid))
+	if !exists {
+		return errInvalidOID
+	}
+	if !device.Ready {
+		return nil // Bus not configured yet
 	}
 
 	// Write data via HAL
@@ -138,27 +125,20 @@ func handleI2CWrite(data *[]byte) error {
 
 // handleI2CRead reads data from an I2C device (with optional register addressing)
 // Format: i2c_read oid=%c reg=%*s read_len=%u
-func handleI2CRead(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleI2CRead(args *Args) error {
+	oid := args.Uint(0)
 
 	// Decode the register data (may be empty)
-	regData, err := protocol.DecodeVLQBytes(data)
-	if err != nil {
-		return err
-	}
-
-	readLen, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+	regData := args.Bytes(1)
+	readLen := args.Uint(2)
 
 	// Get the I2C device object
-	device, exists := i2cDevices[uint8(oid)]
-	if !exists || !device.Ready {
-		return nil // Invalid OID or not configured
+	device, exists := GetI2C(uint8(oid))
+	if !exists {
+		return errInvalidOID
+	}
+	if !device.Ready {
+		return nil // Bus not configured yet
 	}
 
 	// Read data via HAL
@@ -187,3 +167,8 @@ func ShutdownAllI2C() {
 		}
 	}
 }
+
+// releaseAllI2C forgets every I2C device (called on config reset)
+func releaseAllI2C() {
+	clear(i2cDevices)
+}
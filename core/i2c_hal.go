@@ -1,5 +1,3 @@
-//go:build tinygo
-
 package core
 
 // I2CBusID identifies a specific I2C bus (e.g., I2C0, I2C1).
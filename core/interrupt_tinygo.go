@@ -5,11 +5,15 @@ package core
 import "runtime/interrupt"
 
 // disableInterrupts disables interrupts and returns the previous state
+// On a dual-core target it also takes the core lock (see SetCoreLock).
 func disableInterrupts() interrupt.State {
-	return interrupt.Disable()
+	state := interrupt.Disable()
+	lockCores()
+	return state
 }
 
 // restoreInterrupts restores the interrupt state
 func restoreInterrupts(state interrupt.State) {
+	unlockCores()
 	interrupt.Restore(state)
 }
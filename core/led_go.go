@@ -0,0 +1,6 @@
+//go:build !tinygo
+
+package core
+
+// ledBlink is a no-op on regular Go (no status LED)
+func ledBlink(count int) {}
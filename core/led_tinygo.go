@@ -0,0 +1,21 @@
+//go:build tinygo
+
+package core
+
+import (
+	"machine"
+	"time"
+)
+
+// ledBlink blinks the LED a specific number of times for diagnostics
+func ledBlink(count int) {
+	led := machine.LED
+	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	for i := 0; i < count; i++ {
+		led.High()
+		time.Sleep(20 * time.Millisecond)
+		led.Low()
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // Pause after blink sequence
+}
@@ -0,0 +1,17 @@
+//go:build !tinygo
+
+package core
+
+// readMemory always returns 0 on regular Go (no raw memory access)
+func readMemory(order, addr uint32) uint32 {
+	return 0
+}
+
+// hostFreeMemory is the free heap reported on regular Go, where the process
+// heap has no fixed size. It sizes the simulator's move pool.
+const hostFreeMemory = 64 * 1024
+
+// freeMemory returns the number of heap bytes available for allocation
+func freeMemory() uint32 {
+	return hostFreeMemory
+}
@@ -0,0 +1,32 @@
+//go:build tinygo
+
+package core
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// readMemory reads a 16-bit (order 1) or 32-bit (order 2) value from an address
+func readMemory(order, addr uint32) uint32 {
+	switch order {
+	case 1: // 16-bit read
+		ptr := (*uint16)(unsafe.Pointer(uintptr(addr)))
+		return uint32(*ptr)
+	case 2: // 32-bit read
+		ptr := (*uint32)(unsafe.Pointer(uintptr(addr)))
+		return *ptr
+	default:
+		// Unknown order, return 0
+		return 0
+	}
+}
+
+// freeMemory returns the number of heap bytes available for allocation,
+// collecting garbage first so released objects are counted
+func freeMemory() uint32 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return uint32(m.HeapIdle)
+}
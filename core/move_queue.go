@@ -0,0 +1,172 @@
+package core
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// Shared move queue pool, like Klipper's move_queue. finalize_config
+// allocates one pool of move nodes from the memory left once every object
+// is configured and reports its size to the host as move_count. Steppers
+// (queue_step) and the scheduled outputs (queue_digital_out, queue_pwm_out)
+// take nodes from the pool as commands arrive and return them once
+// executed, so the host's flow control, which never has more than
+// move_count moves in flight, matches the memory actually available.
+
+const (
+	// Share of the free heap given to the pool; the rest stays available
+	// to the allocator for responses and driver buffers
+	moveQueueMemoryPercent = 50
+
+	// Bounds on the pool size. Klipper's host needs a few moves per
+	// stepper and move_count is sent as a %hu.
+	moveQueueMin = 16
+	moveQueueMax = 0xFFFF
+
+	// Shutdown reason when a command finds the pool empty
+	moveQueueOverflowReason = "Move queue overflow"
+)
+
+// errMoveQueueOverflow is returned by a queue command after MoveAlloc shut
+// the MCU down
+var errMoveQueueOverflow = errors.New("move queue overflow")
+
+// MoveNode is one slot of the shared move pool
+type MoveNode struct {
+	StepperMove
+	next *MoveNode
+}
+
+// OutputMove is a scheduled change of a digital or PWM output
+// It is kept in the storage of a node's StepperMove, which is larger.
+type OutputMove struct {
+	Clock uint32 // When to apply the change
+	Value uint32 // on_ticks of queue_digital_out, value of queue_pwm_out
+}
+
+// An OutputMove must fit in the StepperMove whose storage it uses
+var _ [unsafe.Sizeof(StepperMove{}) - unsafe.Sizeof(OutputMove{})]byte
+
+// Output returns the node's storage as an output change
+func (n *MoveNode) Output() *OutputMove {
+	return (*OutputMove)(unsafe.Pointer(&n.StepperMove))
+}
+
+// MoveQueue is a FIFO of nodes taken from the shared move pool
+// The zero value is an empty queue.
+type MoveQueue struct {
+	first *MoveNode
+	last  *MoveNode
+	count uint16
+}
+
+var (
+	movePool []MoveNode // Backing storage, nil until finalize_config
+	moveFree *MoveNode  // Free list
+)
+
+// allocMovePool sizes the pool from free memory and allocates it
+// It is called from finalize_config and does nothing if the pool exists.
+func allocMovePool() {
+	if movePool != nil {
+		return
+	}
+	count := freeMemory() * moveQueueMemoryPercent / 100 / uint32(unsafe.Sizeof(MoveNode{}))
+	if count < moveQueueMin {
+		count = moveQueueMin
+	}
+	if count > moveQueueMax {
+		count = moveQueueMax
+	}
+
+	movePool = make([]MoveNode, count)
+	for i := range movePool {
+		movePool[i].next = moveFree
+		moveFree = &movePool[i]
+	}
+	globalState.moveCount = uint16(count)
+}
+
+// resetMovePool drops the pool so the next finalize_config sizes it again
+// (called on config reset, once every queue has been discarded)
+func resetMovePool() {
+	movePool = nil
+	moveFree = nil
+	globalState.moveCount = 0
+}
+
+// MoveAlloc takes a node from the pool
+// The MCU shuts down with "Move queue overflow" if the pool is empty, which
+// only happens if the host sends more moves than move_count allows.
+func MoveAlloc() *MoveNode {
+	state := disableInterrupts()
+	n := moveFree
+	if n != nil {
+		moveFree = n.next
+		n.next = nil
+	}
+	restoreInterrupts(state)
+
+	if n == nil {
+		TryShutdown(moveQueueOverflowReason)
+	}
+	return n
+}
+
+// MoveFree returns a node to the pool
+func MoveFree(n *MoveNode) {
+	state := disableInterrupts()
+	n.next = moveFree
+	moveFree = n
+	restoreInterrupts(state)
+}
+
+// Push appends a node to the queue
+func (q *MoveQueue) Push(n *MoveNode) {
+	n.next = nil
+	if q.last == nil {
+		q.first = n
+	} else {
+		q.last.next = n
+	}
+	q.last = n
+	q.count++
+}
+
+// Pop removes the oldest node, returning nil if the queue is empty
+// The caller returns the node to the pool with MoveFree once done with it.
+func (q *MoveQueue) Pop() *MoveNode {
+	n := q.first
+	if n == nil {
+		return nil
+	}
+	q.first = n.next
+	if q.first == nil {
+		q.last = nil
+	}
+	q.count--
+	return n
+}
+
+// First returns the oldest node without removing it, or nil if the queue
+// is empty
+func (q *MoveQueue) First() *MoveNode {
+	return q.first
+}
+
+// Empty reports whether the queue holds no moves
+func (q *MoveQueue) Empty() bool {
+	return q.first == nil
+}
+
+// Len returns the number of queued moves
+func (q *MoveQueue) Len() uint16 {
+	return q.count
+}
+
+// Clear returns every queued node to the pool
+func (q *MoveQueue) Clear() {
+	for n := q.Pop(); n != nil; n = q.Pop() {
+		MoveFree(n)
+	}
+}
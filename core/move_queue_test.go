@@ -0,0 +1,162 @@
+package core
+
+import (
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"gopper/protocol"
+)
+
+func TestMovePoolSizedFromFreeMemory(t *testing.T) {
+	savedShutdown, savedReset := shutdownHooks, configResetHooks
+	defer func() {
+		shutdownHooks, configResetHooks = savedShutdown, savedReset
+		resetMovePool()
+		atomic.StoreUint32(&globalState.isShutdown, 0)
+	}()
+	shutdownHooks = nil
+	configResetHooks = nil
+	resetMovePool()
+
+	allocMovePool()
+	want := hostFreeMemory * moveQueueMemoryPercent / 100 / int(unsafe.Sizeof(MoveNode{}))
+	if int(globalState.moveCount) != want || len(movePool) != want {
+		t.Fatalf("move_count=%d pool=%d, want %d", globalState.moveCount, len(movePool), want)
+	}
+
+	// Every node can be queued, and one more overflows
+	var q MoveQueue
+	for i := 0; i < want; i++ {
+		n := MoveAlloc()
+		if n == nil {
+			t.Fatalf("pool empty after %d moves", i)
+		}
+		n.Count = uint16(i)
+		q.Push(n)
+	}
+	if MoveAlloc() != nil || !IsShutdown() {
+		t.Fatal("allocating past move_count did not shut down")
+	}
+	atomic.StoreUint32(&globalState.isShutdown, 0)
+
+	// Moves come back in order and return to the pool
+	for i := 0; i < 3; i++ {
+		n := q.Pop()
+		if n == nil || n.Count != uint16(i) {
+			t.Fatalf("pop %d returned %+v", i, n)
+		}
+		MoveFree(n)
+	}
+	if q.Len() != uint16(want-3) {
+		t.Errorf("queue length %d, want %d", q.Len(), want-3)
+	}
+	q.Clear()
+	if !q.Empty() {
+		t.Error("queue not empty after Clear")
+	}
+	for i := 0; i < want; i++ {
+		if MoveAlloc() == nil {
+			t.Fatalf("cleared nodes not returned to the pool (%d allocated)", i)
+		}
+	}
+
+	resetConfig()
+	if globalState.moveCount != 0 || movePool != nil {
+		t.Errorf("config reset left move_count=%d", globalState.moveCount)
+	}
+}
+
+// testPWM records duty cycles for tests that configure PWM outputs
+type testPWM struct {
+	duty map[PWMPin]PWMValue
+}
+
+func (p *testPWM) ConfigureHardwarePWM(pin PWMPin, cycleTicks uint32) (uint32, error) {
+	return cycleTicks, nil
+}
+func (p *testPWM) SetDutyCycle(pin PWMPin, value PWMValue) error { p.duty[pin] = value; return nil }
+func (p *testPWM) GetMaxValue() uint32                           { return 255 }
+func (p *testPWM) DisablePWM(pin PWMPin) error                   { return nil }
+
+// TestQueuedOutputsUsePool queues several changes on a digital output and
+// a PWM output and checks each is applied at its clock, in order, with its
+// node back in the pool afterwards
+func TestQueuedOutputsUsePool(t *testing.T) {
+	savedGPIO, savedPWM := gpioDriver, pwmDriver
+	resetTimerHeap(t)
+	resetOIDs()
+	resetMovePool()
+	defer func() {
+		gpioDriver, pwmDriver = savedGPIO, savedPWM
+		clear(digitalOutputs)
+		clear(hardwarePWMs)
+		resetOIDs()
+		resetMovePool()
+		SetTime(0)
+	}()
+	gpio := &testGPIO{pins: make(map[GPIOPin]bool)}
+	pwm := &testPWM{duty: make(map[PWMPin]PWMValue)}
+	gpioDriver, pwmDriver = gpio, pwm
+
+	r := NewCommandRegistry()
+	allocID := r.Register("allocate_oids", "count=%c", handleAllocateOids)
+	doutID := r.Register("config_digital_out", "oid=%c pin=%u value=%c default_value=%c max_duration=%u", handleConfigDigitalOut)
+	pwmID := r.Register("config_pwm_out", "oid=%c pin=%u cycle_ticks=%u value=%hu default_value=%hu max_duration=%u", handleConfigPWMOut)
+	queueDoutID := r.Register("queue_digital_out", "oid=%c clock=%u on_ticks=%u", handleQueueDigitalOut)
+	queuePWMID := r.Register("queue_pwm_out", "oid=%c clock=%u value=%hu", handleQueuePWMOut)
+	send := func(id uint16, args ...uint32) {
+		out := protocol.NewScratchOutput()
+		for _, a := range args {
+			protocol.EncodeVLQUint(out, a)
+		}
+		data := out.Result()
+		if err := r.Dispatch(id, &data); err != nil {
+			t.Fatalf("command %d: %v", id, err)
+		}
+	}
+
+	SetTime(1000)
+	send(allocID, 2)
+	send(doutID, 0, 25, 0, 0, 0)
+	send(pwmID, 1, 4, 1000, 0, 0, 0)
+	allocMovePool()
+	free := freeMoveNodes()
+
+	send(queueDoutID, 0, 1100, 1)
+	send(queueDoutID, 0, 1200, 0)
+	send(queueDoutID, 0, 1300, 1)
+	send(queuePWMID, 1, 1150, 10)
+	send(queuePWMID, 1, 1250, 20)
+	if got := freeMoveNodes(); got != free-5 {
+		t.Fatalf("%d nodes free with 5 changes queued, want %d", got, free-5)
+	}
+
+	steps := []struct {
+		at   uint32
+		pin  bool
+		duty PWMValue
+	}{
+		{1099, false, 0}, {1100, true, 0}, {1150, true, 10}, {1200, false, 10},
+		{1250, false, 20}, {1300, true, 20},
+	}
+	for _, st := range steps {
+		SetTime(st.at)
+		ProcessTimers()
+		if gpio.pins[25] != st.pin || pwm.duty[4] != st.duty {
+			t.Errorf("at %d: pin=%v duty=%d, want %v %d", st.at, gpio.pins[25], pwm.duty[4], st.pin, st.duty)
+		}
+	}
+	if got := freeMoveNodes(); got != free {
+		t.Errorf("%d nodes free after every change was applied, want %d", got, free)
+	}
+}
+
+// freeMoveNodes counts the nodes on the pool's free list
+func freeMoveNodes() int {
+	count := 0
+	for n := moveFree; n != nil; n = n.next {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,176 @@
+package core
+
+// Dual-core execution. A target with two cores may run the scheduler on the
+// second one: it enables the timer alarm interrupt (SetTimerAlarm) on core 1
+// only, so every timer handler, and with it step generation, runs there,
+// while core 0 keeps USB, Transport.Receive, command handlers, tasks and
+// response encoding.
+//
+// The two sides meet in the same places as a timer interrupt and the main
+// loop do on one core: commands reach the timers through ScheduleTimer,
+// CancelTimer and the move queues, and timers reach the host by waking a
+// task. All of that state is only touched inside critical sections
+// (disableInterrupts), which take the lock registered with SetCoreLock as
+// well as masking interrupts on the calling core.
+//
+// The lock is shared by every critical section rather than split into
+// per-queue handoffs: the sections are the few dozen instructions that
+// already run with interrupts masked on a single core, and the move queues,
+// timer heap and stepper state they guard are shared by more than one
+// producer and consumer. TimerDispatch holds it only while it takes a timer
+// from the heap and puts it back; the handler runs between the two without
+// it (releaseCores), with interrupts still masked, and takes a critical
+// section of its own around the state it shares with core 0, leaving out
+// anything that waits on hardware. What it costs core 1 is the time spent waiting for
+// core 0 to leave a section, which adds straight to timer lateness; lockCores
+// records every wait and get_timer_stats reports them per core
+// (core_lock_stats) next to the lateness of the step timers.
+//
+// Which core may call what:
+//
+//   - Core 0 only: command handlers, RunTasks and the registered tasks,
+//     SendResponse and anything else using the transport, config_reset, and
+//     anything that allocates.
+//   - Core 1 only: ProcessTimers and TimerDispatch, i.e. the timer handlers.
+//     They must not allocate, as TinyGo's heap belongs to core 0, and must
+//     not send responses; they wake a task (TaskWake.Wake) instead.
+//   - Either core: GetTime, ScheduleTimer, CancelTimer, TaskWake.Wake,
+//     MoveAlloc, MoveFree, TriggerSyncDoTrigger, and reads or writes of
+//     state shared with timers inside a critical section.
+//   - TryShutdown may be called from either core, but from a timer handler
+//     (on core 1, or in the alarm interrupt of a single-core build) it only
+//     marks the shutdown, purges the timers and stops the steppers. The
+//     shutdown hooks, which may allocate or use a bus, and the report run in
+//     ShutdownTask on core 0.
+//
+// Core 1 runs on a static stack that TinyGo's scheduler and garbage
+// collector do not know about. The collector runs on core 0 while core 1
+// keeps going, never scans core 1's stack, and has no write barrier, so
+// core 1 is only safe while:
+//
+//   - it never allocates. The timer heap is reserved by allocate_oids
+//     (reserveTimers) and a handler that would grow it shuts down instead;
+//     timer handlers build no debug strings and switch to plain functions,
+//     not method values; and TryShutdown leaves the hooks to core 0.
+//   - every object it touches stays reachable from core 0's globals while
+//     a timer can run: timers are embedded in objects the OID maps and the
+//     stepper table hold, move nodes live in the pool, and config_reset
+//     only drops them after the shutdown hooks have cancelled the timers.
+//   - it only stores pointers to such objects, never to memory that is
+//     only referenced from its own stack.
+
+// CoreLock is a lock shared by both cores, such as an RP2040 hardware
+// spinlock. It is never taken recursively.
+type CoreLock interface {
+	TryLock() bool // Takes the lock if it is free
+	Unlock()
+	CurrentCore() int // Number of the calling core (0 or 1)
+}
+
+// CoreLockStats records how often a core took the core lock and how long it
+// waited for the other core, in timer ticks
+type CoreLockStats struct {
+	Count     uint32 // Outermost critical sections entered
+	Contended uint32 // Of those, entries that found the lock held
+	Sum       uint32 // Total ticks spent waiting
+	Max       uint32 // Longest wait
+}
+
+var (
+	coreLock      CoreLock
+	coreLockDepth [2]uint8 // Nested critical sections on each core
+	coreLockStats [2]CoreLockStats
+)
+
+// SetCoreLock makes every critical section also exclude the other core
+// It must be called before the second core starts.
+func SetCoreLock(lock CoreLock) {
+	coreLock = lock
+}
+
+// GetCoreLockStats returns the core lock record of each core. With reset
+// set the counts start again.
+func GetCoreLockStats(reset bool) [2]CoreLockStats {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	stats := coreLockStats
+	if reset {
+		coreLockStats = [2]CoreLockStats{}
+	}
+	return stats
+}
+
+// inTimerContext reports whether the caller is a timer handler: core 1 of
+// a dual-core build, or timer dispatch on a single core. Interrupts must be
+// disabled.
+func inTimerContext() bool {
+	if coreLock != nil {
+		return coreLock.CurrentCore() != 0
+	}
+	return timerDispatching
+}
+
+// lockCores takes the core lock for the outermost critical section of the
+// calling core. Interrupts must already be disabled on this core.
+func lockCores() {
+	if coreLock == nil {
+		return
+	}
+	id := coreLock.CurrentCore()
+	if coreLockDepth[id] == 0 {
+		stats := &coreLockStats[id]
+		if !coreLock.TryLock() {
+			// Time the wait for the other core to leave its section
+			start := GetTime()
+			for !coreLock.TryLock() {
+			}
+			wait := GetTime() - start
+			stats.Contended++
+			stats.Sum += wait
+			if wait > stats.Max {
+				stats.Max = wait
+			}
+		}
+		stats.Count++
+	}
+	coreLockDepth[id]++
+}
+
+// releaseCores lets the other core into its critical sections while the
+// calling core is still in one of its own, and returns the nesting that
+// retakeCores restores. Interrupts stay disabled on the calling core.
+func releaseCores() uint8 {
+	if coreLock == nil {
+		return 0
+	}
+	id := coreLock.CurrentCore()
+	depth := coreLockDepth[id]
+	if depth != 0 {
+		coreLockDepth[id] = 0
+		coreLock.Unlock()
+	}
+	return depth
+}
+
+// retakeCores takes the core lock back after releaseCores
+func retakeCores(depth uint8) {
+	if depth == 0 {
+		return
+	}
+	lockCores()
+	coreLockDepth[coreLock.CurrentCore()] = depth
+}
+
+// unlockCores releases the core lock when the outermost critical section
+// of the calling core ends
+func unlockCores() {
+	if coreLock == nil {
+		return
+	}
+	id := coreLock.CurrentCore()
+	coreLockDepth[id]--
+	if coreLockDepth[id] == 0 {
+		coreLock.Unlock()
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import "testing"
+
+// fakeCoreLock records lock traffic for a chosen core
+type fakeCoreLock struct {
+	core  int
+	held  bool
+	taken int // Times the lock was taken
+	busy  int // TryLock calls still to fail, as if the other core held it
+}
+
+func (l *fakeCoreLock) TryLock() bool {
+	if l.held {
+		panic("core lock taken twice")
+	}
+	if l.busy > 0 {
+		l.busy--
+		setSystemTicks(getSystemTicks() + 10)
+		return false
+	}
+	l.held = true
+	l.taken++
+	return true
+}
+
+func (l *fakeCoreLock) Unlock() {
+	if !l.held {
+		panic("core lock released while free")
+	}
+	l.held = false
+}
+
+func (l *fakeCoreLock) CurrentCore() int { return l.core }
+
+// TestCoreLockNesting checks that nested critical sections take the core
+// lock once, on the outermost entry of each core
+func TestCoreLockNesting(t *testing.T) {
+	lock := &fakeCoreLock{core: 1}
+	SetCoreLock(lock)
+	defer SetCoreLock(nil)
+
+	lockCores()
+	lockCores()
+	unlockCores()
+	if !lock.held {
+		t.Fatal("inner critical section released the core lock")
+	}
+	unlockCores()
+	if lock.held {
+		t.Fatal("core lock still held after the outermost critical section")
+	}
+	if lock.taken != 1 {
+		t.Errorf("lock taken %d times, want 1", lock.taken)
+	}
+
+	// Each core counts its own nesting
+	lock.core = 0
+	lockCores()
+	unlockCores()
+	if lock.taken != 2 || coreLockDepth != [2]uint8{} {
+		t.Errorf("lock taken %d times, depths %v", lock.taken, coreLockDepth)
+	}
+}
+
+// TestShutdownOnTimerCore checks that a shutdown raised on core 1 leaves the
+// hooks and the report to ShutdownTask on core 0
+func TestShutdownOnTimerCore(t *testing.T) {
+	saved := shutdownHooks
+	lock := &fakeCoreLock{core: 1}
+	SetCoreLock(lock)
+	defer func() {
+		SetCoreLock(nil)
+		shutdownHooks = saved
+		ResetTimerPastErrors()
+		handleClearShutdown(nil)
+	}()
+
+	handleClearShutdown(nil)
+	hooks := 0
+	shutdownHooks = nil
+	RegisterShutdown(func() { hooks++ })
+	reasonID := RegisterStaticString("Emergency stop")
+
+	ScheduleTimer(&Timer{WakeTime: GetTime() + 1000, Handler: func(*Timer) uint8 { return SF_DONE }})
+	TryShutdown("Emergency stop")
+	if !IsShutdown() {
+		t.Fatal("not in shutdown after TryShutdown on core 1")
+	}
+	if hooks != 0 || shutdownReport {
+		t.Fatal("core 1 ran the shutdown hooks")
+	}
+	if len(timerHeap) != 0 {
+		t.Error("timer heap not purged on core 1")
+	}
+
+	lock.core = 0
+	ShutdownTask()
+	ShutdownTask()
+	if hooks != 1 {
+		t.Errorf("hooks ran %d times on core 0, want 1", hooks)
+	}
+	if shutdownReasonID != reasonID {
+		t.Error("shutdown reason lost on the way to core 0")
+	}
+}
+
+// TestCoreLockWaits checks that a contended lock records how long the core
+// waited, and that get_timer_stats resets the record
+func TestCoreLockWaits(t *testing.T) {
+	lock := &fakeCoreLock{core: 1}
+	SetCoreLock(lock)
+	defer SetCoreLock(nil)
+	GetCoreLockStats(true)
+
+	lock.busy = 3
+	lockCores()
+	unlockCores()
+	lockCores()
+	unlockCores()
+
+	// Timing starts after the first failed try
+	want := CoreLockStats{Count: 2, Contended: 1, Sum: 20, Max: 20}
+	stats := GetCoreLockStats(true)
+	if stats[1] != want {
+		t.Errorf("core 1 lock stats %+v, want %+v", stats[1], want)
+	}
+	if stats = GetCoreLockStats(false); stats[1] != (CoreLockStats{}) {
+		t.Errorf("core 1 lock stats %+v after reset", stats[1])
+	}
+}
+
+// TestTimerDispatchReleasesCoreLock checks that handlers run without the
+// core lock, and that a timer the other core cancels meanwhile stays
+// cancelled whatever its handler returns
+func TestTimerDispatchReleasesCoreLock(t *testing.T) {
+	resetTimerHeap(t)
+	lock := &fakeCoreLock{core: 1}
+	SetCoreLock(lock)
+	defer SetCoreLock(nil)
+
+	now := GetTime()
+	heldInHandler := true
+	timer := &Timer{WakeTime: now, Handler: func(t *Timer) uint8 {
+		heldInHandler = lock.held
+
+		// Core 0 cancels the timer while its handler runs
+		lock.core = 0
+		CancelTimer(t)
+		lock.core = 1
+
+		t.WakeTime += 100
+		return SF_RESCHEDULE
+	}}
+	ScheduleTimer(timer)
+
+	// The critical section a TinyGo build enters around the dispatch
+	lockCores()
+	ProcessTimers()
+	if !lock.held || coreLockDepth[1] != 1 {
+		t.Error("core lock not taken back after the handler")
+	}
+	unlockCores()
+
+	if heldInHandler {
+		t.Error("handler ran with the core lock held")
+	}
+	if timer.Pending() {
+		t.Error("timer cancelled on core 0 rescheduled by its handler")
+	}
+}
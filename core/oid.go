@@ -0,0 +1,93 @@
+package core
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// OID allocation table, like Klipper's oid_alloc/oid_lookup. The host sizes
+// the table with allocate_oids and every config_* command claims its OID for
+// one object type, so an OID cannot be configured as, say, both a stepper
+// and an endstop. Lookups check the owning type and shut the MCU down on a
+// mismatch. The objects themselves stay in each subsystem's registry.
+
+// OIDType identifies the kind of object that owns an OID
+type OIDType uint8
+
+const (
+	OIDFree          OIDType = iota // Not configured
+	OIDAnalogIn                     // config_analog_in
+	OIDDigitalOut                   // config_digital_out
+	OIDHardwarePWM                  // config_pwm_out
+	OIDSPI                          // config_spi, config_spi_without_cs
+	OIDSPIShutdown                  // config_spi_shutdown
+	OIDI2C                          // config_i2c
+	OIDTriggerSync                  // config_trsync
+	OIDEndstop                      // config_endstop
+	OIDAnalogEndstop                // config_analog_endstop
+	OIDI2CEndstop                   // config_i2c_endstop
+	OIDStepper                      // config_stepper
+	OIDDriver                       // config_driver
+)
+
+// Shutdown reasons for OID errors (registered as static strings)
+const (
+	oidsAllocatedReason = "oids already allocated"
+	oidAssignReason     = "Can't assign oid"
+	oidTypeReason       = "Invalid oid type"
+	unknownDriverReason = "Unknown driver"
+)
+
+// errInvalidOID is returned by handlers after an OID error shut the MCU down
+var errInvalidOID = errors.New("invalid oid")
+
+// oidTypes holds the owner of each OID; nil until allocate_oids
+var oidTypes []OIDType
+
+// AllocateOIDs sizes the OID table (allocate_oids)
+// The table can only be allocated once per configuration.
+func AllocateOIDs(count uint8) error {
+	if oidTypes != nil {
+		TryShutdown(oidsAllocatedReason)
+		return errInvalidOID
+	}
+	oidTypes = make([]OIDType, count)
+	reserveTimers(timersPerOID * int(count))
+	return nil
+}
+
+// AllocOID claims oid for an object of type typ
+// The MCU shuts down if the OID is out of range, already configured, or the
+// configuration has been finalized.
+func AllocOID(oid uint8, typ OIDType) error {
+	if int(oid) >= len(oidTypes) || oidTypes[oid] != OIDFree ||
+		atomic.LoadUint32(&globalState.configCRC) != 0 {
+		TryShutdown(oidAssignReason)
+		return errInvalidOID
+	}
+	oidTypes[oid] = typ
+	return nil
+}
+
+// freeOID releases an OID whose config_* command failed after claiming it,
+// so later lookups shut the MCU down instead of finding no object
+func freeOID(oid uint8) {
+	if int(oid) < len(oidTypes) {
+		oidTypes[oid] = OIDFree
+	}
+}
+
+// LookupOID checks that oid was configured as an object of type typ,
+// shutting the MCU down if it was not
+func LookupOID(oid uint8, typ OIDType) error {
+	if int(oid) >= len(oidTypes) || oidTypes[oid] != typ {
+		TryShutdown(oidTypeReason)
+		return errInvalidOID
+	}
+	return nil
+}
+
+// resetOIDs discards the OID table (config_reset)
+func resetOIDs() {
+	oidTypes = nil
+}
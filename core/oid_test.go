@@ -0,0 +1,93 @@
+package core
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"gopper/protocol"
+)
+
+// expectOIDShutdown checks that err came from an OID error that shut the
+// MCU down, then clears the shutdown
+func expectOIDShutdown(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != errInvalidOID || !IsShutdown() {
+		t.Errorf("%s: err=%v shutdown=%v, want an OID shutdown", what, err, IsShutdown())
+	}
+	atomic.StoreUint32(&globalState.isShutdown, 0)
+}
+
+func TestOIDOwnership(t *testing.T) {
+	savedShutdown := shutdownHooks
+	defer func() {
+		shutdownHooks = savedShutdown
+		resetOIDs()
+		atomic.StoreUint32(&globalState.isShutdown, 0)
+		atomic.StoreUint32(&globalState.configCRC, 0)
+	}()
+	shutdownHooks = nil
+	resetOIDs()
+
+	expectOIDShutdown(t, "alloc before allocate_oids", AllocOID(0, OIDStepper))
+	if err := AllocateOIDs(4); err != nil {
+		t.Fatalf("AllocateOIDs: %v", err)
+	}
+	expectOIDShutdown(t, "second allocate_oids", AllocateOIDs(4))
+
+	if err := AllocOID(3, OIDStepper); err != nil {
+		t.Fatalf("AllocOID: %v", err)
+	}
+	if err := LookupOID(3, OIDStepper); err != nil || IsShutdown() {
+		t.Errorf("lookup of the owning type failed: %v", err)
+	}
+	expectOIDShutdown(t, "stepper OID reused as endstop", AllocOID(3, OIDEndstop))
+	expectOIDShutdown(t, "stepper OID looked up as endstop", LookupOID(3, OIDEndstop))
+	expectOIDShutdown(t, "out of range alloc", AllocOID(4, OIDEndstop))
+	expectOIDShutdown(t, "out of range lookup", LookupOID(200, OIDStepper))
+	expectOIDShutdown(t, "lookup of a free OID", LookupOID(1, OIDEndstop))
+
+	atomic.StoreUint32(&globalState.configCRC, 0x1234)
+	expectOIDShutdown(t, "alloc after finalize_config", AllocOID(1, OIDEndstop))
+}
+
+// TestConfigFailureFreesOID checks that a config_* command that fails after
+// claiming its OID releases it, so a later lookup shuts the MCU down
+func TestConfigFailureFreesOID(t *testing.T) {
+	savedShutdown, savedFactory := shutdownHooks, stepperBackendFactory
+	defer func() {
+		shutdownHooks, stepperBackendFactory = savedShutdown, savedFactory
+		releaseAllSteppers()
+		resetOIDs()
+		atomic.StoreUint32(&globalState.isShutdown, 0)
+		shutdownReport = false
+	}()
+	shutdownHooks, stepperBackendFactory = nil, nil
+	resetOIDs()
+
+	r := NewCommandRegistry()
+	allocID := r.Register("allocate_oids", "count=%c", handleAllocateOids)
+	stepperID := r.Register("config_stepper", "oid=%c step_pin=%c dir_pin=%c invert_step=%c step_pulse_ticks=%u", cmdConfigStepper)
+	positionID := r.Register("stepper_get_position", "oid=%c", cmdStepperGetPosition)
+	driverID := r.Register("config_driver", "oid=%c", handleConfigDriver)
+	send := func(id uint16, args ...uint32) error {
+		out := protocol.NewScratchOutput()
+		for _, a := range args {
+			protocol.EncodeVLQUint(out, a)
+		}
+		data := out.Result()
+		return r.Dispatch(id, &data)
+	}
+	if err := send(allocID, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	// NewStepper takes OIDs below 16 only
+	if err := send(stepperID, 17, 2, 3, 0, 0); err == nil || IsShutdown() {
+		t.Fatalf("config_stepper oid=17: err=%v shutdown=%v", err, IsShutdown())
+	}
+	expectOIDShutdown(t, "lookup of a failed stepper", send(positionID, 17))
+
+	// A driver this firmware does not have is a configuration error
+	expectOIDShutdown(t, "config_driver of an unregistered driver", send(driverID, 5))
+	expectOIDShutdown(t, "lookup of the unregistered driver", LookupOID(5, OIDDriver))
+}
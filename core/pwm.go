@@ -1,12 +1,8 @@
-//go:build tinygo
-
 // PWM (Pulse Width Modulation) support
 // Implements Klipper's hardware PWM protocol for controlling PWM outputs
 package core
 
-import (
-	"gopper/protocol"
-)
+import "unsafe"
 
 // HardwarePWM flags
 const (
@@ -20,7 +16,8 @@ type HardwarePWM struct {
 	Flags uint8  // State flags
 
 	// Timer for scheduled operations
-	Timer Timer // Timer for scheduled PWM updates and max_duration
+	Timer Timer     // Timer for scheduled PWM updates and max_duration
+	Queue MoveQueue // Values from queue_pwm_out, oldest first
 
 	// PWM configuration
 	CycleTicks uint32   // PWM cycle time in ticks
@@ -35,8 +32,21 @@ type HardwarePWM struct {
 // Global registry of hardware PWM outputs
 var hardwarePWMs = make(map[uint8]*HardwarePWM)
 
+// lookupHardwarePWM retrieves a hardware PWM output by OID
+// The MCU shuts down if the OID is not a hardware PWM output.
+func lookupHardwarePWM(oid uint8) (*HardwarePWM, bool) {
+	if LookupOID(oid, OIDHardwarePWM) != nil {
+		return nil, false
+	}
+	pwm, exists := hardwarePWMs[oid]
+	return pwm, exists
+}
+
 // InitPWMCommands registers PWM-related commands with the command registry
 func InitPWMCommands() {
+	RegisterShutdown(ShutdownAllHardwarePWM)
+	RegisterConfigReset(releaseAllHardwarePWM)
+
 	// Command to configure a hardware PWM output pin
 	RegisterCommand("config_pwm_out", "oid=%c pin=%u cycle_ticks=%u value=%hu default_value=%hu max_duration=%u", handleConfigPWMOut)
 
@@ -55,40 +65,21 @@ func InitPWMCommands() {
 
 // handleConfigPWMOut configures a pin for hardware PWM output
 // Format: config_pwm_out oid=%c pin=%u cycle_ticks=%u value=%hu default_value=%hu max_duration=%u
-func handleConfigPWMOut(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	cycleTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	value, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	defaultValue, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	maxDuration, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigPWMOut(args *Args) error {
+	oid := args.Uint(0)
+	pin := args.Uint(1)
+	cycleTicks := args.Uint(2)
+	value := args.Uint(3)
+	defaultValue := args.Uint(4)
+	maxDuration := args.Uint(5)
+	if err := AllocOID(uint8(oid), OIDHardwarePWM); err != nil {
 		return err
 	}
 
 	// Configure hardware PWM via HAL
 	actualCycleTicks, err := MustPWM().ConfigureHardwarePWM(PWMPin(pin), cycleTicks)
 	if err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -101,10 +92,12 @@ func handleConfigPWMOut(data *[]byte) error {
 		DefaultValue: PWMValue(defaultValue),
 		MaxDuration:  maxDuration,
 		Flags:        0,
+		Timer:        Timer{Owner: TimerOwnerPWM},
 	}
 
 	// Set initial PWM value
 	if err := MustPWM().SetDutyCycle(pwm.Pin, pwm.Value); err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -114,73 +107,72 @@ func handleConfigPWMOut(data *[]byte) error {
 	return nil
 }
 
-// handleQueuePWMOut schedules a PWM value change
+// handleQueuePWMOut queues a PWM value change
 // Format: queue_pwm_out oid=%c clock=%u value=%hu
-func handleQueuePWMOut(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+// Changes take a node from the shared move pool and are applied in order by
+// pwmLoadEvent, each at its clock.
+func handleQueuePWMOut(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
+	value := args.Uint(2)
 
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
+	// Get the hardware PWM object
+	pwm, exists := lookupHardwarePWM(uint8(oid))
+	if !exists {
+		return errInvalidOID
 	}
 
-	value, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
+	n := MoveAlloc()
+	if n == nil {
+		return errMoveQueueOverflow
 	}
-
-	// Get the hardware PWM object
-	pwm, exists := hardwarePWMs[uint8(oid)]
-	if !exists {
-		// Invalid OID - PWM not configured
-		return nil
+	*n.Output() = OutputMove{Clock: clock, Value: value}
+
+	// The timer may be pending, so queue the change with interrupts disabled
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+	pwm.Queue.Push(n)
+
+	// An earlier queued change schedules this one when it is applied, and a
+	// pending max_duration check hands over to it when it is due
+	if pwm.Queue.Len() == 1 && (!pwm.Timer.Pending() || int32(clock-pwm.Timer.WakeTime) < 0) {
+		pwm.Timer.WakeTime = clock
+		pwm.Timer.Handler = pwmLoadEvent
+		ScheduleTimer(&pwm.Timer)
 	}
 
-	// Store the new value to apply at scheduled time
-	pwm.Value = PWMValue(value)
+	return nil
+}
 
-	// Update max_duration end time if needed
-	if pwm.MaxDuration != 0 {
-		// Check if new value differs from default
-		if pwm.Value != pwm.DefaultValue {
-			pwm.EndTime = clock + pwm.MaxDuration
-			pwm.Flags |= PWM_CHECK_END
-		} else {
-			pwm.Flags &^= PWM_CHECK_END
+// pwmNext schedules handler at wake, unless the next queued change is due
+// first. With a nil handler only a queued change is scheduled.
+func pwmNext(pwm *HardwarePWM, t *Timer, wake uint32, handler func(*Timer) uint8) uint8 {
+	if n := pwm.Queue.First(); n != nil {
+		clock := n.Output().Clock
+		if handler == nil || int32(clock-wake) <= 0 {
+			t.WakeTime = clock
+			t.Handler = pwmLoadEvent
+			return SF_RESCHEDULE
 		}
 	}
-
-	// Schedule the timer to execute at the specified clock time
-	// Clear Next pointer to avoid issues if timer was previously scheduled
-	pwm.Timer.Next = nil
-	pwm.Timer.WakeTime = clock
-	pwm.Timer.Handler = pwmLoadEvent
-	ScheduleTimer(&pwm.Timer)
-
-	return nil
+	if handler == nil {
+		return SF_DONE
+	}
+	t.WakeTime = wake
+	t.Handler = handler
+	return SF_RESCHEDULE
 }
 
 // handleSetPWMOut immediately sets a PWM value
 // Format: set_pwm_out oid=%c value=%hu
-func handleSetPWMOut(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	value, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleSetPWMOut(args *Args) error {
+	oid := args.Uint(0)
+	value := args.Uint(1)
 
 	// Get the hardware PWM object
-	pwm, exists := hardwarePWMs[uint8(oid)]
+	pwm, exists := lookupHardwarePWM(uint8(oid))
 	if !exists {
-		// Invalid OID - PWM not configured
-		return nil
+		return errInvalidOID
 	}
 
 	// Set PWM value immediately
@@ -192,54 +184,55 @@ func handleSetPWMOut(data *[]byte) error {
 	return nil
 }
 
-// pwmLoadEvent is the timer handler for loading scheduled PWM updates
+// pwmLoadEvent is the timer handler for applying queued PWM changes
 // This executes at the scheduled time and applies the PWM value
 func pwmLoadEvent(t *Timer) uint8 {
-	// Find the HardwarePWM instance that owns this timer
-	var pwm *HardwarePWM
-	for _, pPtr := range hardwarePWMs {
-		if pPtr != nil && &pPtr.Timer == t {
-			pwm = pPtr
-			break
-		}
-	}
+	pwm := timerContainer[HardwarePWM](t, unsafe.Offsetof(HardwarePWM{}.Timer))
+
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
-	if pwm == nil {
-		// Timer fired but no HardwarePWM found - should not happen
+	// Take the change that is due and return its node to the pool
+	n := pwm.Queue.Pop()
+	if n == nil {
 		return SF_DONE
 	}
+	move := *n.Output()
+	MoveFree(n)
+	pwm.Value = PWMValue(move.Value)
+
+	// Update max_duration end time if needed
+	if pwm.MaxDuration != 0 {
+		// Check if new value differs from default
+		if pwm.Value != pwm.DefaultValue {
+			pwm.EndTime = move.Clock + pwm.MaxDuration
+			pwm.Flags |= PWM_CHECK_END
+		} else {
+			pwm.Flags &^= PWM_CHECK_END
+		}
+	}
 
 	// Apply the scheduled PWM value to hardware
 	if err := MustPWM().SetDutyCycle(pwm.Pin, pwm.Value); err != nil {
-		// On error, stop further operations
-		return SF_DONE
+		// On error, move on to the next change
+		return pwmNext(pwm, t, 0, nil)
 	}
 
 	// Check if we need to monitor max_duration
 	if (pwm.Flags & PWM_CHECK_END) != 0 {
 		// Schedule a timer to enforce max_duration
-		t.WakeTime = pwm.EndTime
-		t.Handler = pwmEndEvent
-		return SF_RESCHEDULE
+		return pwmNext(pwm, t, pwm.EndTime, pwmEndEvent)
 	}
 
-	return SF_DONE
+	return pwmNext(pwm, t, 0, nil)
 }
 
 // pwmEndEvent is the timer handler for max_duration enforcement
 func pwmEndEvent(t *Timer) uint8 {
-	// Find the HardwarePWM instance that owns this timer
-	var pwm *HardwarePWM
-	for _, pPtr := range hardwarePWMs {
-		if pPtr != nil && &pPtr.Timer == t {
-			pwm = pPtr
-			break
-		}
-	}
+	pwm := timerContainer[HardwarePWM](t, unsafe.Offsetof(HardwarePWM{}.Timer))
 
-	if pwm == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Max duration expired - return to default value
 	pwm.Value = pwm.DefaultValue
@@ -250,7 +243,7 @@ func pwmEndEvent(t *Timer) uint8 {
 	// Clear check_end flag
 	pwm.Flags &^= PWM_CHECK_END
 
-	return SF_DONE
+	return pwmNext(pwm, t, 0, nil)
 }
 
 // ShutdownHardwarePWM returns a PWM output to its default value (called during shutdown)
@@ -262,8 +255,9 @@ func ShutdownHardwarePWM(pwm *HardwarePWM) {
 	// Clear flags
 	pwm.Flags &^= PWM_CHECK_END
 
-	// Stop any scheduled timers
-	pwm.Timer.Next = nil
+	// Stop any scheduled timers and drop the queued changes
+	CancelTimer(&pwm.Timer)
+	pwm.Queue.Clear()
 }
 
 // ShutdownAllHardwarePWM returns all PWM outputs to their default values
@@ -275,3 +269,9 @@ func ShutdownAllHardwarePWM() {
 		}
 	}
 }
+
+// releaseAllHardwarePWM forgets every hardware PWM output (called on config
+// reset, after shutdown has set each channel to its default value)
+func releaseAllHardwarePWM() {
+	clear(hardwarePWMs)
+}
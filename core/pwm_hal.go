@@ -1,5 +1,3 @@
-//go:build tinygo
-
 package core
 
 // PWMPin identifies a hardware pin capable of PWM output
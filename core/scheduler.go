@@ -1,10 +1,23 @@
 package core
 
+import "unsafe"
+
 // Timer represents a scheduled event
 type Timer struct {
 	WakeTime uint32
 	Handler  func(*Timer) uint8
-	Next     *Timer
+	Owner    TimerOwner // Subsystem the lateness diagnostics count it under
+
+	pos int    // Index in timerHeap plus one, 0 when not scheduled
+	seq uint32 // Scheduling order, so timers due together run first-in first-out
+}
+
+// timerContainer returns the object of type T whose field at offset is t,
+// like Klipper's container_of. Timer handlers use it to find the object
+// that embeds their timer instead of searching the maps command handlers
+// change, which they may interrupt on another core or in the alarm IRQ.
+func timerContainer[T any](t *Timer, offset uintptr) *T {
+	return (*T)(unsafe.Add(unsafe.Pointer(t), -int(offset)))
 }
 
 const (
@@ -14,56 +27,248 @@ const (
 	// Timer in past threshold - if timer is more than 100ms behind, report error
 	// At 12MHz, 100ms = 1,200,000 ticks
 	TimerPastThreshold = 1200000
+
+	// Initial heap capacity; allocate_oids reserves room for every timer
+	// the configuration can have (reserveTimers)
+	timerHeapCapacity = 64
+
+	// Timers a configured object may own at most (trsync has two)
+	timersPerOID = 2
+
+	// Shortest delay the hardware alarm is programmed for. A timer due
+	// sooner is dispatched that much late rather than the alarm being set
+	// for a time that may already have passed.
+	TimerMinTryTicks = 2
 )
 
 var (
-	timerList       *Timer
+	// Pending timers as a binary min-heap ordered by WakeTime, so scheduling
+	// and dispatching cost O(log n) however many steppers, PWMs, ADCs and
+	// endstops are active
+	timerHeap = make([]*Timer, 0, timerHeapCapacity)
+	timerSeq  uint32
+
+	// Hardware alarm programmed for the earliest timer (nil when the main
+	// loop polls ProcessTimers instead)
+	timerAlarm       func(wake uint32)
+	timerDispatching bool // TimerDispatch re-arms the alarm when it is done
+
+	// Timer whose handler TimerDispatch is running without the core lock,
+	// and whether the other core scheduled or cancelled it meanwhile
+	timerRunning *Timer
+	timerTouched bool
+
 	currentTime     uint32
 	timerPastErrors uint32 // Count of "timer in past" errors
 )
 
 // ScheduleTimer adds a timer to the schedule
+// Scheduling a timer that is already pending moves it to its new WakeTime.
+// Code outside timer handlers must set WakeTime with interrupts disabled if
+// the timer may be pending or running, as the alarm interrupt can dispatch
+// at any time.
 func ScheduleTimer(t *Timer) {
 	state := disableInterrupts()
 	defer restoreInterrupts(state)
 
-	// Insert timer in sorted order
 	// Implementation similar to Klipper's sched_add_timer
+	touchTimer(t)
 	insertTimer(t)
+
+	// A new earliest timer needs the alarm brought forward
+	if t.pos == 1 && !timerDispatching {
+		armTimerAlarm()
+	}
+}
+
+// CancelTimer removes a timer from the schedule, like Klipper's
+// sched_del_timer. It does nothing if the timer is not pending.
+func CancelTimer(t *Timer) {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	touchTimer(t)
+	if t.pos != 0 {
+		removeTimer(t)
+	}
+}
+
+// touchTimer notes that the other core scheduled or cancelled the timer
+// whose handler is running, so TimerDispatch leaves it as that core put it
+// Interrupts must be disabled.
+func touchTimer(t *Timer) {
+	if t == timerRunning && !inTimerContext() {
+		timerTouched = true
+	}
+}
+
+// Pending reports whether the timer is scheduled. A timer whose handler is
+// running is not pending. Interrupts must be disabled.
+func (t *Timer) Pending() bool {
+	return t.pos != 0
+}
+
+// SetTimerAlarm registers the target's hardware alarm, moving timer dispatch
+// from main loop polling to the alarm interrupt as in Klipper. The alarm is
+// programmed for the earliest timer whenever that changes, and the target
+// calls ProcessTimers from the alarm interrupt.
+func SetTimerAlarm(alarm func(wake uint32)) {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	timerAlarm = alarm
+	armTimerAlarm()
+}
+
+// armTimerAlarm programs the alarm for the earliest timer, if any
+// Interrupts must be disabled.
+func armTimerAlarm() {
+	if timerAlarm == nil || len(timerHeap) == 0 {
+		return
+	}
+	wake := timerHeap[0].WakeTime
+	if now := GetTime(); int32(wake-now) < TimerMinTryTicks {
+		wake = now + TimerMinTryTicks
+	}
+	timerAlarm(wake)
+}
+
+// timerBefore reports whether a is due before b
+// Uses signed comparison to handle 32-bit wrap-around correctly: int32(a - b) < 0
+// means a is before b, within half the 32-bit range (~35 min at 1MHz).
+// Timers due together keep the order they were scheduled in.
+func timerBefore(a, b *Timer) bool {
+	if d := int32(a.WakeTime - b.WakeTime); d != 0 {
+		return d < 0
+	}
+	return int32(a.seq-b.seq) < 0
 }
 
-// insertTimer inserts a timer in sorted order by WakeTime
-// Uses signed comparison to handle 32-bit wrap-around correctly
+// insertTimer adds a timer to the heap, or moves it if it is already there
 func insertTimer(t *Timer) {
-	// Use signed comparison: int32(a - b) < 0 means a is before b
-	// This handles wrap-around correctly within half the 32-bit range (~35 min at 1MHz)
-	if timerList == nil || int32(t.WakeTime-timerList.WakeTime) < 0 {
-		t.Next = timerList
-		timerList = t
+	timerSeq++
+	t.seq = timerSeq
+	if t.pos != 0 {
+		timerUp(t.pos - 1)
+		timerDown(t.pos - 1)
+		return
+	}
+	if len(timerHeap) == cap(timerHeap) && inTimerContext() {
+		// Growing the heap allocates, which a timer handler must not do
+		TryShutdown(timerHeapFullReason)
+		return
+	}
+	timerHeap = append(timerHeap, t)
+	timerUp(len(timerHeap) - 1)
+}
+
+// removeTimer takes a pending timer out of the heap
+func removeTimer(t *Timer) {
+	i := t.pos - 1
+	last := len(timerHeap) - 1
+	moved := timerHeap[last]
+	timerHeap[last] = nil
+	timerHeap = timerHeap[:last]
+	t.pos = 0
+
+	if i != last {
+		timerHeap[i] = moved
+		timerUp(i)
+		timerDown(moved.pos - 1)
+	}
+}
+
+// timerUp moves the timer at index i towards the root until its parent is
+// due before it
+func timerUp(i int) {
+	t := timerHeap[i]
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !timerBefore(t, timerHeap[parent]) {
+			break
+		}
+		timerHeap[i] = timerHeap[parent]
+		timerHeap[i].pos = i + 1
+		i = parent
+	}
+	timerHeap[i] = t
+	t.pos = i + 1
+}
+
+// timerDown moves the timer at index i away from the root until both
+// children are due after it
+func timerDown(i int) {
+	n := len(timerHeap)
+	t := timerHeap[i]
+	for {
+		child := 2*i + 1
+		if child >= n {
+			break
+		}
+		if right := child + 1; right < n && timerBefore(timerHeap[right], timerHeap[child]) {
+			child = right
+		}
+		if !timerBefore(timerHeap[child], t) {
+			break
+		}
+		timerHeap[i] = timerHeap[child]
+		timerHeap[i].pos = i + 1
+		i = child
+	}
+	timerHeap[i] = t
+	t.pos = i + 1
+}
+
+// reserveTimers makes room in the timer heap for n timers, so that timer
+// handlers never have to grow it. It allocates, so it runs in command
+// context.
+func reserveTimers(n int) {
+	state := disableInterrupts()
+	room := cap(timerHeap)
+	restoreInterrupts(state)
+	if n <= room {
 		return
 	}
 
-	current := timerList
-	for current.Next != nil && int32(current.Next.WakeTime-t.WakeTime) < 0 {
-		current = current.Next
+	heap := make([]*Timer, 0, n)
+	state = disableInterrupts()
+	if n > cap(timerHeap) {
+		timerHeap = append(heap, timerHeap...)
 	}
+	restoreInterrupts(state)
+}
 
-	t.Next = current.Next
-	current.Next = t
+// PurgeTimers removes every scheduled timer (used on shutdown)
+func PurgeTimers() {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	for i, t := range timerHeap {
+		t.pos = 0
+		timerHeap[i] = nil
+	}
+	timerHeap = timerHeap[:0]
 }
 
 // TimerDispatch processes due timers
+// The core lock is only held while a timer is taken from the heap and put
+// back: each handler runs without it (releaseCores), with interrupts still
+// masked, and takes a critical section of its own for the state it shares
+// with the other core, so a handler waiting on hardware does not hold that
+// core out of its critical sections.
 func TimerDispatch() {
 	state := disableInterrupts()
 	defer restoreInterrupts(state)
 
+	timerDispatching = true
+
 	// Process all timers with WakeTime <= currentTime
 	// Use signed comparison to handle 32-bit wrap-around:
 	// int32(currentTime - WakeTime) >= 0 means timer is due
-	for timerList != nil && int32(currentTime-timerList.WakeTime) >= 0 {
-		timer := timerList
-		timerList = timer.Next
-		timer.Next = nil // Clear Next pointer to avoid circular references
+	for len(timerHeap) > 0 && int32(currentTime-timerHeap[0].WakeTime) >= 0 {
+		timer := timerHeap[0]
+		removeTimer(timer)
+		recordTimerLate(timer, currentTime-timer.WakeTime)
 
 		// Check for "timer in past" condition - timer is too far behind
 		// This indicates the MCU can't keep up with requested step rate
@@ -72,10 +277,8 @@ func TimerDispatch() {
 		if timeDiff > int32(TimerPastThreshold) {
 			timerPastErrors++
 
-			// Debug output BEFORE any other action
-			DebugPrintln("[SCHED] TIMER IN PAST! Shutting down...")
-
-			// Record timing event for post-mortem analysis
+			// Record timing event for post-mortem analysis (no debug
+			// print: timer handlers must not allocate)
 			RecordTiming(EvtTimerPast, 0, currentTime, timer.WakeTime, uint32(timeDiff))
 
 			// NOTE: Removed "go DumpTimingRing()" - spawning goroutine with
@@ -83,22 +286,41 @@ func TimerDispatch() {
 
 			// Trigger shutdown with "Rescheduled timer in the past" error
 			TryShutdown("Rescheduled timer in the past")
-			return
+			break
 		}
 
 		// Call handler
+		timerRunning, timerTouched = timer, false
+		depth := releaseCores()
 		result := timer.Handler(timer)
+		retakeCores(depth)
+		timerRunning = nil
 
-		// Reschedule if requested
-		if result == SF_RESCHEDULE {
+		if timerTouched {
+			// The other core's ScheduleTimer or CancelTimer has the last
+			// word; the handler may have moved a timer already back in
+			// the heap
+			if timer.pos != 0 {
+				insertTimer(timer)
+			}
+		} else if result == SF_RESCHEDULE && !IsShutdown() {
+			// Reschedule if requested (unless the handler shut the MCU
+			// down, which purged the timer heap)
 			insertTimer(timer)
 		}
 
 		// CRITICAL: Re-read current time after each timer handler
-		// Timer handlers may block (e.g., PIO FIFO full), advancing real time
+		// Timer handlers may wait on hardware (e.g., an ADC conversion), advancing real time
 		// Without this, all subsequent timers appear "due" even if scheduled for the future
 		currentTime = GetTime()
+		if result == SF_RESCHEDULE {
+			checkTimerTooClose(timer, currentTime)
+		}
 	}
+
+	// Program the alarm for whatever is now earliest
+	timerDispatching = false
+	armTimerAlarm()
 }
 
 // GetTimerPastErrors returns the count of timer-in-past errors
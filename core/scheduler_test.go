@@ -0,0 +1,316 @@
+package core
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"unsafe"
+)
+
+// listScheduler is the sorted singly linked list the timer heap replaced,
+// kept as a reference for the tests and benchmarks. Unlike the original it
+// keeps timers due together in scheduling order, as the heap does.
+type listScheduler struct {
+	head *listTimer
+}
+
+type listTimer struct {
+	t    *Timer
+	id   int
+	next *listTimer
+}
+
+func (l *listScheduler) insert(n *listTimer) {
+	if l.head == nil || int32(n.t.WakeTime-l.head.t.WakeTime) < 0 {
+		n.next = l.head
+		l.head = n
+		return
+	}
+	cur := l.head
+	for cur.next != nil && int32(cur.next.t.WakeTime-n.t.WakeTime) <= 0 {
+		cur = cur.next
+	}
+	n.next = cur.next
+	cur.next = n
+}
+
+func (l *listScheduler) pop() *listTimer {
+	n := l.head
+	l.head = n.next
+	n.next = nil
+	return n
+}
+
+// resetTimerHeap empties the heap around a test
+func resetTimerHeap(t testing.TB) {
+	PurgeTimers()
+	t.Cleanup(PurgeTimers)
+}
+
+// TestSchedulerMatchesList schedules, reschedules and dispatches random
+// timers across the 32-bit clock wrap and checks that the heap runs them in
+// the same order as the sorted list
+func TestSchedulerMatchesList(t *testing.T) {
+	resetTimerHeap(t)
+	rng := rand.New(rand.NewPCG(1, 2))
+	var ran []int
+	var list listScheduler
+	nodes := make([]listTimer, 50)
+	timers := make([]Timer, len(nodes))
+	for i := range timers {
+		timers[i].Handler = func(*Timer) uint8 {
+			ran = append(ran, i)
+			return SF_DONE
+		}
+		nodes[i].t, nodes[i].id = &timers[i], i
+	}
+
+	now := uint32(0xFFFFF000)
+	for round := 0; round < 200; round++ {
+		// Schedule a few timers that are not pending, a short time ahead and
+		// with frequent ties
+		for k := 0; k < 5; k++ {
+			i := rng.IntN(len(timers))
+			if timers[i].pos != 0 {
+				continue
+			}
+			timers[i].WakeTime = now + uint32(rng.IntN(64))*16
+			ScheduleTimer(&timers[i])
+			list.insert(&nodes[i])
+		}
+
+		now += 256
+		SetTime(now)
+		ran = ran[:0]
+		ProcessTimers()
+
+		var want []int
+		for list.head != nil && int32(now-list.head.t.WakeTime) >= 0 {
+			n := list.pop()
+			want = append(want, n.id)
+		}
+		if !slices.Equal(ran, want) {
+			t.Fatalf("round %d at %#x: heap ran %v, list ran %v", round, now, ran, want)
+		}
+	}
+	SetTime(0)
+}
+
+func TestSchedulerRescheduleAndCancel(t *testing.T) {
+	resetTimerHeap(t)
+	var ran []string
+	timer := func(name string, wake uint32) *Timer {
+		return &Timer{WakeTime: wake, Handler: func(*Timer) uint8 {
+			ran = append(ran, name)
+			return SF_DONE
+		}}
+	}
+	now := GetTime()
+	a := timer("a", now+100)
+	b := timer("b", now+200)
+	c := timer("c", now+300)
+	for _, tm := range []*Timer{a, b, c} {
+		ScheduleTimer(tm)
+	}
+
+	// Scheduling a pending timer moves it rather than queuing it twice
+	a.WakeTime = now + 250
+	ScheduleTimer(a)
+	CancelTimer(c)
+	CancelTimer(c)
+	if len(timerHeap) != 2 {
+		t.Fatalf("%d timers pending, want 2", len(timerHeap))
+	}
+
+	SetTime(now + 1000)
+	ProcessTimers()
+	SetTime(now)
+	if !slices.Equal(ran, []string{"b", "a"}) {
+		t.Errorf("ran %v, want [b a]", ran)
+	}
+	if len(timerHeap) != 0 || a.pos != 0 || c.pos != 0 {
+		t.Error("timers left pending after dispatch")
+	}
+}
+
+func TestSchedulerProgramsAlarm(t *testing.T) {
+	resetTimerHeap(t)
+	var alarms []uint32
+	SetTimerAlarm(func(wake uint32) { alarms = append(alarms, wake) })
+	defer SetTimerAlarm(nil)
+	SetTime(1000)
+	defer SetTime(0)
+
+	done := func(*Timer) uint8 { return SF_DONE }
+	a := &Timer{WakeTime: 5000, Handler: done}
+	b := &Timer{WakeTime: 8000, Handler: done}
+	c := &Timer{WakeTime: 1001, Handler: done}
+
+	// Only a new earliest timer moves the alarm, and never closer than
+	// TimerMinTryTicks
+	ScheduleTimer(a)
+	ScheduleTimer(b)
+	ScheduleTimer(c)
+	if want := []uint32{5000, 1000 + TimerMinTryTicks}; !slices.Equal(alarms, want) {
+		t.Fatalf("alarms %v, want %v", alarms, want)
+	}
+
+	// Dispatch re-arms the alarm for the next timer
+	alarms = nil
+	SetTime(1000 + TimerMinTryTicks)
+	ProcessTimers()
+	if !slices.Equal(alarms, []uint32{5000}) {
+		t.Errorf("alarms after dispatch %v, want [5000]", alarms)
+	}
+}
+
+func TestSchedulerLatenessStats(t *testing.T) {
+	resetTimerHeap(t)
+	GetTimerStats(true)
+	SetTime(1000)
+	defer SetTime(0)
+
+	// A stepper timer run 20 ticks late that reschedules itself behind the
+	// clock, and an ADC timer run on time
+	step := &Timer{WakeTime: 980, Owner: TimerOwnerStepper}
+	step.Handler = func(t *Timer) uint8 {
+		if t.WakeTime == 980 {
+			t.WakeTime = 990
+			return SF_RESCHEDULE
+		}
+		return SF_DONE
+	}
+	adc := &Timer{WakeTime: 1000, Owner: TimerOwnerAnalogIn, Handler: func(*Timer) uint8 { return SF_DONE }}
+	ScheduleTimer(step)
+	ScheduleTimer(adc)
+	ProcessTimers()
+
+	stats, _ := GetTimerStats(true)
+	s := stats[TimerOwnerStepper]
+	if s.Count != 2 || s.Max != 20 || s.TooClose != 1 {
+		t.Errorf("stepper stats %+v, want 2 dispatches, max 20, 1 too close", s)
+	}
+	// 20 and 10 ticks late fall in [16, 64) and [4, 16)
+	if s.Late[3] != 1 || s.Late[2] != 1 {
+		t.Errorf("stepper histogram %v", s.Late)
+	}
+	if a := stats[TimerOwnerAnalogIn]; a.Count != 1 || a.Late[0] != 1 || a.TooClose != 0 {
+		t.Errorf("analog_in stats %+v, want one on-time dispatch", a)
+	}
+	if stats, _ = GetTimerStats(false); stats[TimerOwnerStepper].Count != 0 {
+		t.Error("stats not reset")
+	}
+}
+
+// Realistic timer counts: a small printer, 8 steppers with their PWMs,
+// ADCs and endstops, and a large multi-MCU style configuration
+var benchTimerCounts = []int{8, 32, 128}
+
+// benchTimers returns timers rescheduling at distinct intervals, like
+// steppers and outputs running at unrelated rates, starting just before
+// the clock wraps
+func benchTimers(n int) []Timer {
+	timers := make([]Timer, n)
+	for i := range timers {
+		period := 1000 + uint32(i*7919%3000)
+		timers[i].WakeTime = 0xFFFF0000 + period
+		timers[i].Handler = func(t *Timer) uint8 {
+			t.WakeTime += period
+			return SF_RESCHEDULE
+		}
+	}
+	return timers
+}
+
+// BenchmarkSchedulerHeap measures one dispatch and reschedule of the
+// earliest timer, the path every step, PWM toggle and ADC sample takes
+func BenchmarkSchedulerHeap(b *testing.B) {
+	for _, n := range benchTimerCounts {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			resetTimerHeap(b)
+			timers := benchTimers(n)
+			for i := range timers {
+				insertTimer(&timers[i])
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tm := timerHeap[0]
+				removeTimer(tm)
+				tm.Handler(tm)
+				insertTimer(tm)
+			}
+		})
+	}
+}
+
+// BenchmarkSchedulerList runs the same workload on the sorted list
+func BenchmarkSchedulerList(b *testing.B) {
+	for _, n := range benchTimerCounts {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			timers := benchTimers(n)
+			nodes := make([]listTimer, n)
+			var list listScheduler
+			for i := range nodes {
+				nodes[i].t = &timers[i]
+				list.insert(&nodes[i])
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				node := list.pop()
+				node.t.Handler(node.t)
+				list.insert(node)
+			}
+		})
+	}
+}
+
+// TestTimerContainer checks that a handler finds the object embedding its
+// timer, whichever field the timer is
+func TestTimerContainer(t *testing.T) {
+	ts := &TriggerSync{}
+	if got := timerContainer[TriggerSync](&ts.ReportTimer, unsafe.Offsetof(ts.ReportTimer)); got != ts {
+		t.Error("report timer resolved to the wrong trigger sync")
+	}
+	if got := timerContainer[TriggerSync](&ts.ExpireTimer, unsafe.Offsetof(ts.ExpireTimer)); got != ts {
+		t.Error("expire timer resolved to the wrong trigger sync")
+	}
+}
+
+// TestTimerHeapNeverGrowsInTimer checks that allocate_oids reserves the heap
+// and that a timer handler overflowing it shuts down instead of allocating
+func TestTimerHeapNeverGrowsInTimer(t *testing.T) {
+	resetTimerHeap(t)
+	saved, savedHeap := shutdownHooks, timerHeap
+	defer func() {
+		shutdownHooks, timerHeap = saved, savedHeap
+		handleClearShutdown(nil)
+		resetOIDs()
+	}()
+	shutdownHooks = nil
+	resetOIDs()
+
+	if err := AllocateOIDs(100); err != nil {
+		t.Fatal(err)
+	}
+	if cap(timerHeap) < 100*timersPerOID {
+		t.Fatalf("allocate_oids reserved %d timers, want %d", cap(timerHeap), 100*timersPerOID)
+	}
+
+	timerHeap = make([]*Timer, 0, 2)
+	extra := make([]Timer, 3)
+	ScheduleTimer(&Timer{WakeTime: GetTime(), Handler: func(*Timer) uint8 {
+		for i := range extra {
+			extra[i].WakeTime = GetTime() + 1000
+			ScheduleTimer(&extra[i])
+		}
+		return SF_DONE
+	}})
+	ProcessTimers()
+	if !IsShutdown() || shutdownReason != timerHeapFullReason {
+		t.Errorf("overflowing the heap in a timer: shutdown=%v reason=%q", IsShutdown(), shutdownReason)
+	}
+	if cap(timerHeap) != 2 {
+		t.Errorf("timer handler grew the heap to %d", cap(timerHeap))
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+// Shutdown hooks, like Klipper's DECL_SHUTDOWN: every subsystem registers a
+// function at init that returns its outputs to a safe state. A firmware
+// shutdown (TryShutdown, which emergency_stop also goes through) purges the
+// timer heap and then runs every hook, so no subsystem can be forgotten.
+
+var shutdownHooks []func()
+
+const (
+	// Reported when TryShutdown is given a reason missing from shutdownReasons
+	unknownShutdownReason = "Unknown shutdown reason"
+	// Reported when config_reset arrives while the MCU is running
+	configResetReason = "config_reset only available when shutdown"
+	// Reported when a timer handler schedules more timers than were reserved
+	timerHeapFullReason = "Timer heap full"
+)
+
+// shutdownReasons lists every reason passed to TryShutdown. The host decodes
+// a shutdown message's static_string_id with the dictionary, which is built
+// (or generated by cmd/gopper-dictgen) before any shutdown can happen, so
+// InitCoreCommands registers the whole table up front.
+// TestShutdownReasonsRegistered fails if a TryShutdown call anywhere in the
+// tree uses a reason missing here.
+var shutdownReasons = []string{
+	"Rescheduled timer in the past",
+	"ADC out of range",
+	"Emergency stop",
+	"I2C write error",
+	"I2C read error",
+	oidsAllocatedReason,
+	oidAssignReason,
+	oidTypeReason,
+	unknownDriverReason,
+	moveQueueOverflowReason,
+	configResetReason,
+	timerHeapFullReason,
+	unknownShutdownReason,
+}
+
+// RegisterShutdown adds a hook run on every shutdown
+// Hooks run in registration order with the timer heap already purged, so
+// they must not rely on their timers firing again.
+func RegisterShutdown(hook func()) {
+	shutdownHooks = append(shutdownHooks, hook)
+}
+
+// runShutdownHooks purges all scheduled timers and runs every hook
+// A hook that panics does not stop the remaining hooks from running.
+func runShutdownHooks() {
+	PurgeTimers()
+	for _, hook := range shutdownHooks {
+		runShutdownHook(hook)
+	}
+}
+
+// runShutdownHook runs one hook, recovering from a panic
+func runShutdownHook(hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			DebugPrintln("[SHUTDOWN] hook panicked")
+		}
+	}()
+	hook()
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShutdownRunsEveryHook(t *testing.T) {
+	saved := shutdownHooks
+	defer func() {
+		shutdownHooks = saved
+		atomic.StoreUint32(&globalState.isShutdown, 0)
+		shutdownReport = false
+	}()
+
+	var ran []int
+	shutdownHooks = nil
+	RegisterShutdown(func() { ran = append(ran, 1) })
+	RegisterShutdown(func() { panic("broken subsystem") })
+	RegisterShutdown(func() { ran = append(ran, 3) })
+
+	timer := &Timer{WakeTime: GetTime() + 1000, Handler: func(*Timer) uint8 { return SF_DONE }}
+	ScheduleTimer(timer)
+	reasonID := RegisterStaticString("Emergency stop")
+
+	if err := handleEmergencyStop(nil); err != nil {
+		t.Fatalf("emergency_stop: %v", err)
+	}
+	if len(ran) != 2 || ran[0] != 1 || ran[1] != 3 {
+		t.Errorf("hooks run: %v, want [1 3]", ran)
+	}
+	if len(timerHeap) != 0 {
+		t.Error("timer heap not purged")
+	}
+	if !IsShutdown() {
+		t.Error("not in shutdown after emergency_stop")
+	}
+	if !shutdownReport || shutdownReasonID != reasonID {
+		t.Error("emergency_stop did not report its reason")
+	}
+}
+
+func TestShutdownStopsRescheduling(t *testing.T) {
+	saved := shutdownHooks
+	defer func() {
+		shutdownHooks = saved
+		atomic.StoreUint32(&globalState.isShutdown, 0)
+	}()
+	shutdownHooks = nil
+
+	// A timer whose handler shuts the MCU down must not be re-inserted
+	timer := &Timer{WakeTime: GetTime(), Handler: func(*Timer) uint8 {
+		atomic.StoreUint32(&globalState.isShutdown, 1)
+		runShutdownHooks()
+		return SF_RESCHEDULE
+	}}
+	ScheduleTimer(timer)
+	ProcessTimers()
+
+	if len(timerHeap) != 0 {
+		t.Error("timer rescheduled after shutdown")
+	}
+}
+
+// TestShutdownReasonsRegistered finds every TryShutdown call in the tree and
+// checks that its reason is a string constant listed in shutdownReasons, so
+// the host can decode every shutdown message
+func TestShutdownReasonsRegistered(t *testing.T) {
+	listed := make(map[string]bool)
+	for _, reason := range shutdownReasons {
+		if listed[reason] {
+			t.Errorf("reason %q listed twice", reason)
+		}
+		listed[reason] = true
+	}
+
+	fset := token.NewFileSet()
+	consts := make(map[string]string) // String constants by name
+	var calls []*ast.CallExpr
+	for file := range parseModule(t, fset) {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.GenDecl:
+				if n.Tok != token.CONST {
+					return true
+				}
+				for _, spec := range n.Specs {
+					vs := spec.(*ast.ValueSpec)
+					for i, name := range vs.Names {
+						if i >= len(vs.Values) {
+							break
+						}
+						if lit, ok := vs.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							consts[name.Name], _ = strconv.Unquote(lit.Value)
+						}
+					}
+				}
+			case *ast.CallExpr:
+				switch fn := n.Fun.(type) {
+				case *ast.Ident:
+					if fn.Name == "TryShutdown" {
+						calls = append(calls, n)
+					}
+				case *ast.SelectorExpr:
+					if fn.Sel.Name == "TryShutdown" {
+						calls = append(calls, n)
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(calls) == 0 {
+		t.Fatal("no TryShutdown calls found")
+	}
+
+	for _, call := range calls {
+		pos := fset.Position(call.Pos())
+		var reason string
+		var ok bool
+		switch arg := call.Args[0].(type) {
+		case *ast.BasicLit:
+			reason, _ = strconv.Unquote(arg.Value)
+			ok = arg.Kind == token.STRING
+		case *ast.Ident:
+			reason, ok = consts[arg.Name]
+		case *ast.SelectorExpr:
+			reason, ok = consts[arg.Sel.Name]
+		}
+		if !ok {
+			t.Errorf("%s: shutdown reason is not a string constant", pos)
+		} else if !listed[reason] {
+			t.Errorf("%s: shutdown reason %q is missing from shutdownReasons", pos, reason)
+		}
+	}
+}
+
+// TestShutdownFromTimerDefersHooks checks that a timer handler shutting a
+// single-core MCU down leaves the hooks and the report to ShutdownTask
+func TestShutdownFromTimerDefersHooks(t *testing.T) {
+	saved := shutdownHooks
+	defer func() {
+		shutdownHooks = saved
+		handleClearShutdown(nil)
+	}()
+	handleClearShutdown(nil)
+	hooks := 0
+	shutdownHooks = nil
+	RegisterShutdown(func() { hooks++ })
+	reasonID := RegisterStaticString("ADC out of range")
+
+	ScheduleTimer(&Timer{WakeTime: GetTime(), Handler: func(*Timer) uint8 {
+		TryShutdown("ADC out of range")
+		return SF_DONE
+	}})
+	ScheduleTimer(&Timer{WakeTime: GetTime() + 1000, Handler: func(*Timer) uint8 { return SF_DONE }})
+	ProcessTimers()
+	if !IsShutdown() {
+		t.Fatal("not in shutdown after TryShutdown in a timer")
+	}
+	if hooks != 0 || shutdownReport {
+		t.Fatal("shutdown hooks ran in timer context")
+	}
+	if len(timerHeap) != 0 {
+		t.Error("timer heap not purged in timer context")
+	}
+
+	ShutdownTask()
+	if hooks != 1 || shutdownReasonID != reasonID {
+		t.Errorf("ShutdownTask ran %d hooks with reason %d, want 1 and %d", hooks, shutdownReasonID, reasonID)
+	}
+}
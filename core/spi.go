@@ -1,5 +1,3 @@
-//go:build tinygo
-
 // SPI (Serial Peripheral Interface) support
 // Implements Klipper's SPI protocol for hardware and software SPI communication
 package core
@@ -35,8 +33,21 @@ type SPIDevice struct {
 // Global registry of SPI devices
 var spiDevices = make(map[uint8]*SPIDevice)
 
+// lookupSPI retrieves an SPI device by OID
+// The MCU shuts down if the OID is not an SPI device.
+func lookupSPI(oid uint8) (*SPIDevice, bool) {
+	if LookupOID(oid, OIDSPI) != nil {
+		return nil, false
+	}
+	dev, exists := spiDevices[oid]
+	return dev, exists
+}
+
 // InitSPICommands registers SPI-related commands with the command registry
 func InitSPICommands() {
+	RegisterShutdown(ShutdownSPI)
+	RegisterConfigReset(releaseAllSPI)
+
 	// Command to configure an SPI device with chip select pin
 	RegisterCommand("config_spi", "oid=%c pin=%u cs_active_high=%c", handleConfigSPI)
 
@@ -61,19 +72,11 @@ func InitSPICommands() {
 
 // handleConfigSPI configures an SPI device with a chip select pin
 // Format: config_spi oid=%c pin=%u cs_active_high=%c
-func handleConfigSPI(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	pin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	csActiveHigh, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigSPI(args *Args) error {
+	oid := args.Uint(0)
+	pin := args.Uint(1)
+	csActiveHigh := args.Uint(2)
+	if err := AllocOID(uint8(oid), OIDSPI); err != nil {
 		return err
 	}
 
@@ -91,6 +94,7 @@ func handleConfigSPI(data *[]byte) error {
 
 	// Configure CS pin as output via GPIO HAL
 	if err := MustGPIO().ConfigureOutput(GPIOPin(pin)); err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -101,6 +105,7 @@ func handleConfigSPI(data *[]byte) error {
 	}
 
 	if err := MustGPIO().SetPin(GPIOPin(pin), csInactive); err != nil {
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -112,9 +117,9 @@ func handleConfigSPI(data *[]byte) error {
 
 // handleConfigSPIWithoutCS configures an SPI device without a chip select pin
 // Format: config_spi_without_cs oid=%c
-func handleConfigSPIWithoutCS(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigSPIWithoutCS(args *Args) error {
+	oid := args.Uint(0)
+	if err := AllocOID(uint8(oid), OIDSPI); err != nil {
 		return err
 	}
 
@@ -132,32 +137,16 @@ func handleConfigSPIWithoutCS(data *[]byte) error {
 
 // handleSPISetBus configures the SPI bus parameters for a device
 // Format: spi_set_bus oid=%c spi_bus=%u mode=%u rate=%u
-func handleSPISetBus(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	spiBus, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	mode, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	rate, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleSPISetBus(args *Args) error {
+	oid := args.Uint(0)
+	spiBus := args.Uint(1)
+	mode := args.Uint(2)
+	rate := args.Uint(3)
 
 	// Get the SPI device
-	dev, exists := spiDevices[uint8(oid)]
+	dev, exists := lookupSPI(uint8(oid))
 	if !exists {
-		// Invalid OID - device not configured
-		return nil
+		return errInvalidOID
 	}
 
 	// Store bus configuration
@@ -193,28 +182,23 @@ func handleSPISetBus(data *[]byte) error {
 
 // handleConfigSPIShutdown configures a message to send on MCU shutdown
 // Format: config_spi_shutdown oid=%c spi_oid=%c shutdown_msg=%*s
-func handleConfigSPIShutdown(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	spiOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigSPIShutdown(args *Args) error {
+	oid := args.Uint(0)
+	spiOID := args.Uint(1)
+	if err := AllocOID(uint8(oid), OIDSPIShutdown); err != nil {
 		return err
 	}
 
-	// Decode shutdown message (variable length)
-	msgLen := len(*data)
-	shutdownMsg := make([]byte, msgLen)
-	copy(shutdownMsg, *data)
-	*data = (*data)[msgLen:] // Consume all remaining data
+	// Copy the shutdown message - argument buffers alias the frame
+	msg := args.Bytes(2)
+	shutdownMsg := make([]byte, len(msg))
+	copy(shutdownMsg, msg)
 
 	// Get the SPI device
-	dev, exists := spiDevices[uint8(spiOID)]
+	dev, exists := lookupSPI(uint8(spiOID))
 	if !exists {
-		// Invalid OID - device not configured
-		return nil
+		freeOID(uint8(oid))
+		return errInvalidOID
 	}
 
 	// Store shutdown message
@@ -272,23 +256,18 @@ func spiDeviceTransfer(dev *SPIDevice, txData []byte, rxData []byte) error {
 // handleSPITransfer sends and receives SPI data
 // Format: spi_transfer oid=%c data=%*s
 // Response: spi_transfer_response oid=%c response=%*s
-func handleSPITransfer(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleSPITransfer(args *Args) error {
+	oid := args.Uint(0)
 
-	// Remaining data is the transfer payload
-	txLen := len(*data)
+	// Copy the transfer payload - argument buffers alias the frame
+	txLen := len(args.Bytes(1))
 	txData := make([]byte, txLen)
-	copy(txData, *data)
-	*data = (*data)[txLen:] // Consume all remaining data
+	copy(txData, args.Bytes(1))
 
 	// Get the SPI device
-	dev, exists := spiDevices[uint8(oid)]
+	dev, exists := lookupSPI(uint8(oid))
 	if !exists {
-		// Invalid OID - device not configured
-		return nil
+		return errInvalidOID
 	}
 
 	// Allocate receive buffer
@@ -303,7 +282,7 @@ func handleSPITransfer(data *[]byte) error {
 	SendResponse("spi_transfer_response", func(output protocol.OutputBuffer) {
 		protocol.EncodeVLQUint(output, uint32(oid))
 		// Encode response data as variable-length byte array
-		output.Output(rxData)
+		protocol.EncodeVLQBytes(output, rxData)
 	})
 
 	return nil
@@ -311,23 +290,18 @@ func handleSPITransfer(data *[]byte) error {
 
 // handleSPISend sends SPI data without receiving
 // Format: spi_send oid=%c data=%*s
-func handleSPISend(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleSPISend(args *Args) error {
+	oid := args.Uint(0)
 
-	// Remaining data is the transfer payload
-	txLen := len(*data)
+	// Copy the transfer payload - argument buffers alias the frame
+	txLen := len(args.Bytes(1))
 	txData := make([]byte, txLen)
-	copy(txData, *data)
-	*data = (*data)[txLen:] // Consume all remaining data
+	copy(txData, args.Bytes(1))
 
 	// Get the SPI device
-	dev, exists := spiDevices[uint8(oid)]
+	dev, exists := lookupSPI(uint8(oid))
 	if !exists {
-		// Invalid OID - device not configured
-		return nil
+		return errInvalidOID
 	}
 
 	// Perform SPI transfer (discard received data)
@@ -353,3 +327,8 @@ func ShutdownSPI() {
 		}
 	}
 }
+
+// releaseAllSPI forgets every SPI device (called on config reset)
+func releaseAllSPI() {
+	clear(spiDevices)
+}
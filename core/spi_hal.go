@@ -1,5 +1,3 @@
-//go:build tinygo
-
 package core
 
 // SPIBusID identifies a hardware SPI bus configuration
@@ -0,0 +1,62 @@
+package core
+
+import "gopper/protocol"
+
+// Load statistics, reported like Klipper's basecmd.c stats_update: every
+// StatsInterval the MCU sends "stats count=%u sum=%u sumsq=%u" covering the
+// main loop iterations since the previous report, and the host logs the
+// resulting MCU load in klippy.log.
+const (
+	StatsSumsqBase = 256 // sumsq is scaled down by this (STATS_SUMSQ_BASE)
+	StatsInterval  = 5   // Seconds between stats reports
+)
+
+var (
+	statsCount    uint32
+	statsSum      uint32
+	statsSumsq    uint32
+	statsSendTime uint32 // Clock of the next report
+)
+
+// StatsUpdate records one main loop iteration that ran from start to cur
+// (both in timer ticks) and sends the stats response when it is due
+func StatsUpdate(start, cur uint32) {
+	diff := cur - start
+	if diff > mainLoopMax {
+		mainLoopMax = diff
+	}
+	statsCount++
+	statsSum += diff
+
+	// Sum of diff^2, saturating instead of overflowing
+	var next uint32
+	switch {
+	case diff <= 0xffff:
+		next = statsSumsq + divRoundUp(diff*diff, StatsSumsqBase)
+	case diff <= 0xfffff:
+		next = statsSumsq + divRoundUp(diff, StatsSumsqBase)*diff
+	default:
+		next = 0xffffffff
+	}
+	if next < statsSumsq {
+		next = 0xffffffff
+	}
+	statsSumsq = next
+
+	if int32(cur-statsSendTime) < 0 {
+		return
+	}
+	count, sum, sumsq := statsCount, statsSum, statsSumsq
+	SendResponse("stats", func(output protocol.OutputBuffer) {
+		protocol.EncodeVLQUint(output, count)
+		protocol.EncodeVLQUint(output, sum)
+		protocol.EncodeVLQUint(output, sumsq)
+	})
+	statsSendTime = cur + StatsInterval*GetGlobalDictionary().ClockFreq()
+	statsCount, statsSum, statsSumsq = 0, 0, 0
+}
+
+// divRoundUp divides rounding up, like Klipper's DIV_ROUND_UP
+func divRoundUp(n, d uint32) uint32 {
+	return (n + d - 1) / d
+}
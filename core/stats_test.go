@@ -0,0 +1,43 @@
+package core
+
+import "testing"
+
+func TestStatsUpdateSums(t *testing.T) {
+	statsCount, statsSum, statsSumsq = 0, 0, 0
+	statsSendTime = 1 << 30 // Not due
+
+	StatsUpdate(100, 110)   // 10 ticks: ceil(100/256) = 1
+	StatsUpdate(1000, 1300) // 300 ticks: ceil(90000/256) = 352
+	StatsUpdate(0, 0x20000) // Above 0xffff: ceil(0x20000/256) * 0x20000
+	if statsCount != 3 || statsSum != 10+300+0x20000 {
+		t.Errorf("count=%d sum=%d", statsCount, statsSum)
+	}
+	if want := uint32(1 + 352 + 512*0x20000); statsSumsq != want {
+		t.Errorf("sumsq=%d, want %d", statsSumsq, want)
+	}
+
+	// Long iterations saturate instead of wrapping
+	StatsUpdate(0, 0x100000)
+	if statsSumsq != 0xffffffff {
+		t.Errorf("sumsq=%#x, want saturated", statsSumsq)
+	}
+}
+
+func TestStatsUpdateReportInterval(t *testing.T) {
+	statsCount, statsSum, statsSumsq = 5, 50, 5
+	statsSendTime = 1000
+
+	// Due: counters restart and the next report is StatsInterval later
+	StatsUpdate(990, 1000)
+	if statsCount != 0 || statsSum != 0 || statsSumsq != 0 {
+		t.Errorf("counters not cleared after report: %d %d %d", statsCount, statsSum, statsSumsq)
+	}
+	if want := 1000 + StatsInterval*GetGlobalDictionary().ClockFreq(); statsSendTime != want {
+		t.Errorf("next report at %d, want %d", statsSendTime, want)
+	}
+
+	StatsUpdate(1000, 1010)
+	if statsCount != 1 {
+		t.Errorf("report sent before the interval elapsed")
+	}
+}
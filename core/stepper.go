@@ -5,15 +5,10 @@ package core
 
 import (
 	"errors"
+	"unsafe"
 )
 
 const (
-	// Queue size for pending moves
-	// Klipper typically sends bursts of moves, especially during direction changes
-	// STEPPER_BUZZ can send 50+ moves for 10 oscillations with direction changes
-	// 64 provides enough headroom for typical motion patterns including buzzing
-	StepperQueueSize = 64
-
 	// Step generation modes
 	StepModeNormal = 0 // Normal stepping
 	StepModeEdge   = 1 // Step on both edges (STEPPER_BOTH_EDGE)
@@ -36,15 +31,18 @@ type Stepper struct {
 	InvertStep      bool   // Invert step signal polarity
 	InvertDir       bool   // Invert direction signal polarity
 	MinStopInterval uint32 // Minimum interval between steps (safety limit)
+	StepMode        uint8  // StepModeNormal or StepModeEdge
+	StepPulseTicks  uint32 // Step pulse width, also the dir setup time
 
 	// State
 	Position int64 // Current position in steps (signed)
 	NextDir  uint8 // Direction for next move
 
-	// Move queue
-	Queue     [StepperQueueSize]StepperMove
-	QueueHead uint8 // Next move to execute
-	QueueTail uint8 // Next slot to fill
+	// Move queue (nodes come from the shared move pool)
+	Queue MoveQueue
+
+	// Move being executed, copied out of its queue node
+	CurrentMove StepperMove
 
 	// Timer for next step event
 	StepTimer Timer
@@ -59,8 +57,23 @@ type Stepper struct {
 	ClockSet      bool   // True if NextStepClock has been set
 	LastStepTime  uint32 // Time of last step (for interval calculations)
 
+	// Position and clock latched when stepper_stop_on_trigger fired, until
+	// the next reset_step_clock or queue_step
+	Triggered    bool
+	TriggerPos   int64
+	TriggerClock uint32
+
 	// Hardware backend
 	Backend StepperBackend
+
+	// Segment stepping, when Backend is a StepperSegmentBackend
+	segBackend StepperSegmentBackend
+	segLead    uint32       // Earliest handover before a segment's first step
+	segPending bool         // CurrentMove is loaded but not handed over yet
+	hwSegs     [2]hwSegment // Moves handed to the backend, oldest first: the one it runs and one more
+	hwHead     uint8
+	hwLen      uint8
+	hwDone     uint32 // StepsDone at the start of hwSegs[hwHead]
 }
 
 // Global stepper registry
@@ -69,22 +82,25 @@ var (
 	stepperCount uint8
 
 	// Backend factory function (set by platform-specific code)
-	stepperBackendFactory func() StepperBackend
+	stepperBackendFactory func(cfg StepperConfig) (StepperBackend, error)
 
 	// Debug: step counter for diagnostics
 	totalStepCount uint32
 )
 
 // GetStepper returns a stepper by OID
+// The MCU shuts down if the OID is not a stepper.
 func GetStepper(oid uint8) *Stepper {
-	if oid >= stepperCount {
+	if LookupOID(oid, OIDStepper) != nil || oid >= stepperCount {
 		return nil
 	}
 	return steppers[oid]
 }
 
 // NewStepper creates a new stepper instance
-func NewStepper(oid uint8, stepPin, dirPin uint8, invertStep bool, minStopInterval uint32) (*Stepper, error) {
+// A step cannot come before the pulse of the one before it ends, so
+// stepPulseTicks is also the shortest step interval.
+func NewStepper(oid uint8, stepPin, dirPin uint8, invertStep bool, stepMode uint8, stepPulseTicks uint32) (*Stepper, error) {
 	DebugPrintln("[STEPPER] NewStepper: oid=" + itoa(int(oid)) + " stepPin=" + itoa(int(stepPin)) + " dirPin=" + itoa(int(dirPin)))
 
 	if oid >= 16 {
@@ -97,29 +113,29 @@ func NewStepper(oid uint8, stepPin, dirPin uint8, invertStep bool, minStopInterv
 		StepPin:         stepPin,
 		DirPin:          dirPin,
 		InvertStep:      invertStep,
-		MinStopInterval: minStopInterval,
+		StepMode:        stepMode,
+		StepPulseTicks:  stepPulseTicks,
+		MinStopInterval: stepPulseTicks,
 		Position:        0,
 		NextDir:         0,
-		QueueHead:       0,
-		QueueTail:       0,
+		StepTimer:       Timer{Owner: TimerOwnerStepper},
 	}
 
 	// Initialize step timer
-	s.StepTimer.Handler = s.stepperEventHandler
+	s.StepTimer.Handler = stepperStepEvent
 
 	// Create backend if factory is available
 	DebugPrintln("[STEPPER] Checking for backend factory...")
 	if stepperBackendFactory != nil {
 		DebugPrintln("[STEPPER] Backend factory exists, creating backend...")
-		backend := stepperBackendFactory()
+		backend, err := stepperBackendFactory(s.backendConfig())
+		if err != nil {
+			DebugPrintln("[STEPPER] ERROR: backend init failed: " + err.Error())
+			return nil, err
+		}
 		if backend != nil {
-			DebugPrintln("[STEPPER] Backend created: " + backend.GetName())
-			err := s.InitBackend(backend)
-			if err != nil {
-				DebugPrintln("[STEPPER] ERROR: InitBackend failed: " + err.Error())
-				return nil, err
-			}
-			DebugPrintln("[STEPPER] Backend initialized successfully")
+			DebugPrintln("[STEPPER] Backend initialized: " + backend.GetName())
+			s.setBackend(backend)
 		} else {
 			DebugPrintln("[STEPPER] WARNING: Backend factory returned nil")
 		}
@@ -138,23 +154,49 @@ func NewStepper(oid uint8, stepPin, dirPin uint8, invertStep bool, minStopInterv
 }
 
 // SetStepperBackendFactory sets the factory function for creating stepper backends
-// This should be called by platform-specific initialization code
-func SetStepperBackendFactory(factory func() StepperBackend) {
+// The factory returns a backend initialized for cfg, so it can pick another
+// one when the first it tries does not take cfg. This should be called by
+// platform-specific initialization code.
+func SetStepperBackendFactory(factory func(cfg StepperConfig) (StepperBackend, error)) {
 	stepperBackendFactory = factory
 }
 
+// backendConfig returns the configuration of the stepper's backend
+func (s *Stepper) backendConfig() StepperConfig {
+	// Like Klipper's step_pulse_duration, the pulse width is also the time
+	// the dir pin is given before a step
+	return StepperConfig{
+		StepPin:    s.StepPin,
+		DirPin:     s.DirPin,
+		InvertStep: s.InvertStep,
+		InvertDir:  s.InvertDir,
+		StepMode:   s.StepMode,
+		PulseTicks: s.StepPulseTicks,
+		SetupTicks: s.StepPulseTicks,
+	}
+}
+
 // InitBackend initializes the hardware backend
 func (s *Stepper) InitBackend(backend StepperBackend) error {
+	if err := backend.Init(s.backendConfig()); err != nil {
+		return err
+	}
+	s.setBackend(backend)
+	return nil
+}
+
+// setBackend makes an initialized backend step the stepper
+func (s *Stepper) setBackend(backend StepperBackend) {
 	s.Backend = backend
-	return backend.Init(s.StepPin, s.DirPin, s.InvertStep, s.InvertDir)
+	s.initSegments(backend)
 }
 
 // QueueMove adds a move to the queue
 func (s *Stepper) QueueMove(interval uint32, count uint16, add int16) error {
-	// Check for queue overflow
-	nextTail := (s.QueueTail + 1) % StepperQueueSize
-	if nextTail == s.QueueHead {
-		return errors.New("queue overflow")
+	// Take a node from the shared pool (shuts down if it is empty)
+	n := MoveAlloc()
+	if n == nil {
+		return errMoveQueueOverflow
 	}
 
 	// Validate minimum interval
@@ -162,17 +204,24 @@ func (s *Stepper) QueueMove(interval uint32, count uint16, add int16) error {
 		interval = s.MinStopInterval
 	}
 
-	// Add to queue
-	s.Queue[s.QueueTail] = StepperMove{
+	// Add to queue, with interrupts disabled as the step timer pops from it
+	n.StepperMove = StepperMove{
 		Interval:  interval,
 		Count:     count,
 		Add:       add,
 		Direction: s.NextDir,
 	}
-	s.QueueTail = nextTail
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+	s.Triggered = false
+	s.Queue.Push(n)
 
 	// Start stepping if not already running
-	if s.CurrentCount == 0 {
+	if s.segBackend != nil {
+		if !s.StepTimer.Pending() {
+			s.startSegments()
+		}
+	} else if s.CurrentCount == 0 {
 		s.loadNextMove()
 	}
 
@@ -182,13 +231,16 @@ func (s *Stepper) QueueMove(interval uint32, count uint16, add int16) error {
 // loadNextMove loads the next move from the queue
 func (s *Stepper) loadNextMove() {
 	// Check if queue is empty
-	if s.QueueHead == s.QueueTail {
+	n := s.Queue.Pop()
+	if n == nil {
 		s.CurrentCount = 0
 		return
 	}
 
-	// Load move
-	move := &s.Queue[s.QueueHead]
+	// Load move and return its node to the pool
+	s.CurrentMove = n.StepperMove
+	MoveFree(n)
+	move := &s.CurrentMove
 	s.CurrentInterval = move.Interval
 	s.CurrentCount = move.Count
 	s.CurrentAdd = move.Add
@@ -199,9 +251,6 @@ func (s *Stepper) loadNextMove() {
 	// Configure backend timing for this step rate
 	s.Backend.SetStepInterval(s.CurrentInterval)
 
-	// Advance queue head
-	s.QueueHead = (s.QueueHead + 1) % StepperQueueSize
-
 	// Get current time for timing capture
 	currentTime := GetTime()
 
@@ -220,6 +269,15 @@ func (s *Stepper) loadNextMove() {
 	ScheduleTimer(&s.StepTimer)
 }
 
+// stepperStepEvent is the step timer in CPU stepping. It is a plain
+// function rather than a method value, so timer handlers can switch to it
+// without allocating.
+func stepperStepEvent(t *Timer) uint8 {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+	return timerContainer[Stepper](t, unsafe.Offsetof(Stepper{}.StepTimer)).stepperEventHandler(t)
+}
+
 // stepperEventHandler handles timer events for step generation
 // This is the main stepping loop - called for each step
 func (s *Stepper) stepperEventHandler(t *Timer) uint8 {
@@ -236,11 +294,13 @@ func (s *Stepper) stepperEventHandler(t *Timer) uint8 {
 	// Track total steps for diagnostics
 	totalStepCount++
 
-	// Update position
-	if s.Queue[(s.QueueHead+StepperQueueSize-1)%StepperQueueSize].Direction == 0 {
-		s.Position++
-	} else {
-		s.Position--
+	// Update position (a segment backend counts the step itself)
+	if s.segBackend == nil {
+		if s.CurrentMove.Direction == 0 {
+			s.Position++
+		} else {
+			s.Position--
+		}
 	}
 
 	// Decrement step count
@@ -270,14 +330,23 @@ func (s *Stepper) stepperEventHandler(t *Timer) uint8 {
 // Returns SF_DONE if no more moves, SF_RESCHEDULE otherwise
 // Unlike loadNextMove, this doesn't call ScheduleTimer - the timer system handles it
 func (s *Stepper) loadNextMoveFromHandler(t *Timer) uint8 {
+	if s.segBackend != nil {
+		s.CurrentCount = 0
+		t.Handler = stepperSegmentEvent
+		return s.segmentEventHandler(t)
+	}
+
 	// Check if queue is empty
-	if s.QueueHead == s.QueueTail {
+	n := s.Queue.Pop()
+	if n == nil {
 		s.CurrentCount = 0
 		return SF_DONE
 	}
 
-	// Load move
-	move := &s.Queue[s.QueueHead]
+	// Load move and return its node to the pool
+	s.CurrentMove = n.StepperMove
+	MoveFree(n)
+	move := &s.CurrentMove
 	s.CurrentInterval = move.Interval
 	s.CurrentCount = move.Count
 	s.CurrentAdd = move.Add
@@ -288,9 +357,6 @@ func (s *Stepper) loadNextMoveFromHandler(t *Timer) uint8 {
 	// Configure backend timing for this step rate
 	s.Backend.SetStepInterval(s.CurrentInterval)
 
-	// Advance queue head
-	s.QueueHead = (s.QueueHead + 1) % StepperQueueSize
-
 	// Calculate next step time using LastStepTime (which was just updated)
 	t.WakeTime = s.LastStepTime + s.CurrentInterval
 
@@ -305,28 +371,44 @@ func (s *Stepper) SetNextDir(dir uint8) {
 	s.NextDir = dir
 }
 
-// GetPosition returns the current position
+// GetPosition returns the current position, or the position latched by
+// the last trigger
 func (s *Stepper) GetPosition() int64 {
-	// If currently stepping, calculate position including in-progress move
-	if s.CurrentCount > 0 {
-		move := &s.Queue[(s.QueueHead+StepperQueueSize-1)%StepperQueueSize]
-		stepsCompleted := int64(move.Count - s.CurrentCount)
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
-		if move.Direction == 0 {
-			return s.Position + stepsCompleted
-		} else {
-			return s.Position - stepsCompleted
-		}
+	if s.Triggered {
+		return s.TriggerPos
 	}
+
+	// A segment backend counts the steps of every move it was handed
+	if s.segBackend != nil {
+		return s.Position + s.retireSegments()
+	}
+
+	// stepperEventHandler counts every step as it makes it
 	return s.Position
 }
 
+// GetTrigger returns the position and clock latched by the last trigger,
+// and whether they are still held
+func (s *Stepper) GetTrigger() (int64, uint32, bool) {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	return s.TriggerPos, s.TriggerClock, s.Triggered
+}
+
 // ResetClock synchronizes the step clock (for Klipper coordination)
 func (s *Stepper) ResetClock(clockTime uint32) {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
 	currentTime := GetTime()
 
 	// Record timing event (fast, non-blocking)
 	RecordTiming(EvtResetClock, s.OID, currentTime, clockTime, 0)
+	s.Triggered = false
 
 	// Store the clock time for the next move
 	// This is called BEFORE queue_step, so we save it for loadNextMove to use
@@ -344,23 +426,81 @@ func (s *Stepper) ResetClock(clockTime uint32) {
 
 // Stop immediately stops the stepper and clears the queue
 func (s *Stepper) Stop() {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
 	s.CurrentCount = 0
-	s.QueueHead = 0
-	s.QueueTail = 0
+	s.Queue.Clear()
+	CancelTimer(&s.StepTimer)
 	s.Backend.Stop()
+	if s.segBackend != nil {
+		s.abortSegments()
+	}
+}
+
+// StopOnTrigger stops the stepper for a trsync trigger and latches the
+// position it stopped at and the clock
+// Interrupts must be disabled.
+func (s *Stepper) StopOnTrigger() {
+	clock := GetTime()
+	s.CurrentCount = 0
+	s.Queue.Clear()
+	CancelTimer(&s.StepTimer)
+	if s.Backend != nil {
+		s.Backend.Stop()
+	}
+	if s.segBackend != nil {
+		s.abortSegments()
+	}
+	s.TriggerPos = s.Position
+	s.TriggerClock = clock
+	s.Triggered = true
+	RecordTiming(EvtTrigger, s.OID, clock, uint32(s.TriggerPos), 0)
+}
+
+// ShutdownAllSteppers stops every stepper and discards its queued moves
+// (called during shutdown)
+func ShutdownAllSteppers() {
+	for i := uint8(0); i < stepperCount; i++ {
+		s := steppers[i]
+		if s == nil {
+			continue
+		}
+		s.CurrentCount = 0
+		s.Queue.Clear()
+		s.ClockSet = false
+		CancelTimer(&s.StepTimer)
+		if s.Backend != nil {
+			s.Backend.Stop()
+		}
+		if s.segBackend != nil {
+			s.abortSegments()
+		}
+	}
+}
+
+// releaseAllSteppers forgets every stepper (called on config reset)
+func releaseAllSteppers() {
+	steppers = [16]*Stepper{}
+	stepperCount = 0
 }
 
 // IsActive returns true if the stepper has pending moves
 func (s *Stepper) IsActive() bool {
-	return s.CurrentCount > 0 || s.QueueHead != s.QueueTail
+	if s.segBackend != nil {
+		state := disableInterrupts()
+		defer restoreInterrupts(state)
+		s.retireSegments()
+		if s.segPending || s.hwLen > 0 {
+			return true
+		}
+	}
+	return s.CurrentCount > 0 || !s.Queue.Empty()
 }
 
 // GetQueueCount returns the number of queued moves
-func (s *Stepper) GetQueueCount() uint8 {
-	if s.QueueTail >= s.QueueHead {
-		return s.QueueTail - s.QueueHead
-	}
-	return StepperQueueSize - s.QueueHead + s.QueueTail
+func (s *Stepper) GetQueueCount() uint16 {
+	return s.Queue.Len()
 }
 
 // GetTotalStepCount returns the total number of steps executed (for diagnostics)
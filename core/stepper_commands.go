@@ -10,6 +10,13 @@ import (
 
 // RegisterStepperCommands registers all stepper-related commands
 func RegisterStepperCommands() {
+	RegisterShutdown(ShutdownAllSteppers)
+	RegisterConfigReset(releaseAllSteppers)
+
+	// The host toggles the step pin once per step for drivers that step on
+	// both edges, by sending invert_step=-1 with step_pulse_ticks=0
+	RegisterConstant("STEPPER_BOTH_EDGE", uint32(1))
+
 	// NOTE: RegisterCommand now takes (name, format, handler) directly.
 	// The Command struct is still used internally for the dictionary,
 	// but registration is via this helper.
@@ -39,7 +46,7 @@ func RegisterStepperCommands() {
 		"oid=%c",
 		cmdStepperGetPosition)
 
-	// Debug command to get stepper info
+	// Debug command to get the stepper's backend and its performance
 	RegisterCommand("stepper_get_info",
 		"oid=%c",
 		cmdStepperGetInfo)
@@ -50,83 +57,68 @@ func RegisterStepperCommands() {
 
 	// Response: stepper position query result
 	RegisterResponse("stepper_position", "oid=%c pos=%i")
+
+	// Response: position and clock latched by stepper_stop_on_trigger,
+	// sent after stepper_position while they are held
+	RegisterResponse("stepper_trigger", "oid=%c pos=%i clock=%u")
+
+	// Response: stepper backend query result
+	RegisterResponse("stepper_info",
+		"oid=%c backend=%.*s max_step_rate=%u min_pulse_ns=%u jitter_ns=%u cpu_overhead=%c")
 }
 
-func cmdStepperStopOnTrigger(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-	trsyncOID, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func cmdStepperStopOnTrigger(args *Args) error {
+	oid := args.Uint(0)
+	trsyncOID := args.Uint(1)
 
 	// Get the stepper
 	stepper := GetStepper(uint8(oid))
 	if stepper == nil {
-		return errors.New("stepper not found")
+		return errInvalidOID
 	}
 
 	// Get the trsync
 	ts, exists := GetTriggerSync(uint8(trsyncOID))
 	if !exists {
-		return errors.New("trsync not found")
+		return errInvalidOID
 	}
 
-	// Register callback to stop stepper when trigger fires
+	// Stop the stepper and latch its position when the trigger fires
 	TriggerSyncAddSignal(ts, func(reason uint8) {
-		// Stop the stepper by clearing its queue and canceling the timer
-		stepper.QueueHead = 0
-		stepper.QueueTail = 0
-		stepper.CurrentCount = 0
-		// The timer will naturally stop when it finds no more moves
+		stepper.StopOnTrigger()
 	})
 
 	return nil
 }
 
 // cmdConfigStepper handles config_stepper command
-// Format: oid=%c step_pin=%c dir_pin=%c invert_step=%c min_stop_interval=%u
-func cmdConfigStepper(data *[]byte) error {
+// Format: oid=%c step_pin=%c dir_pin=%c invert_step=%c step_pulse_ticks=%u
+// invert_step is signed: -1 with step_pulse_ticks=0 selects StepModeEdge.
+func cmdConfigStepper(args *Args) error {
 	DebugPrintln("[STEPPER] config_stepper called")
 
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode oid")
-		return err
-	}
-
-	stepPin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode step_pin")
-		return err
-	}
+	oid := args.Uint(0)
+	stepPin := args.Uint(1)
+	dirPin := args.Uint(2)
+	invertStep := int8(args.Uint(3))
+	stepPulseTicks := args.Uint(4)
 
-	dirPin, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode dir_pin")
-		return err
+	stepMode := uint8(StepModeNormal)
+	if invertStep < 0 && stepPulseTicks == 0 {
+		stepMode = StepModeEdge
 	}
 
-	invertStep, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode invert_step")
-		return err
-	}
+	DebugPrintln("[STEPPER] config_stepper oid=" + itoa(int(oid)) + " step=" + itoa(int(stepPin)) + " dir=" + itoa(int(dirPin)))
 
-	minStopInterval, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode min_stop_interval")
+	if err := AllocOID(uint8(oid), OIDStepper); err != nil {
 		return err
 	}
 
-	DebugPrintln("[STEPPER] config_stepper oid=" + itoa(int(oid)) + " step=" + itoa(int(stepPin)) + " dir=" + itoa(int(dirPin)))
-
 	// Create stepper
-	_, err = NewStepper(uint8(oid), uint8(stepPin), uint8(dirPin), invertStep != 0, minStopInterval)
+	_, err := NewStepper(uint8(oid), uint8(stepPin), uint8(dirPin), invertStep > 0, stepMode, stepPulseTicks)
 	if err != nil {
 		DebugPrintln("[STEPPER] ERROR: NewStepper failed: " + err.Error())
+		freeOID(uint8(oid))
 		return err
 	}
 
@@ -136,38 +128,23 @@ func cmdConfigStepper(data *[]byte) error {
 
 // cmdQueueStep handles queue_step command
 // Format: oid=%c interval=%u count=%hu add=%hi
-func cmdQueueStep(data *[]byte) error {
+func cmdQueueStep(args *Args) error {
 	DebugPrintln("[STEPPER] queue_step called")
 
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	interval, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	count, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	add, err := protocol.DecodeVLQInt(data)
-	if err != nil {
-		return err
-	}
+	oid := args.Uint(0)
+	interval := args.Uint(1)
+	count := args.Uint(2)
+	add := args.Int(3)
 
 	DebugPrintln("[STEPPER] queue_step oid=" + itoa(int(oid)) + " interval=" + itoa(int(interval)) + " count=" + itoa(int(count)))
 
 	stepper := GetStepper(uint8(oid))
 	if stepper == nil {
 		DebugPrintln("[STEPPER] ERROR: stepper not found for oid=" + itoa(int(oid)))
-		return errors.New("stepper not found")
+		return errInvalidOID
 	}
 
-	err = stepper.QueueMove(interval, uint16(count), int16(add))
+	err := stepper.QueueMove(interval, uint16(count), int16(add))
 	if err != nil {
 		DebugPrintln("[STEPPER] ERROR: QueueMove failed: " + err.Error())
 		return err
@@ -177,50 +154,34 @@ func cmdQueueStep(data *[]byte) error {
 	return nil
 }
 
-func cmdSetNextStepDir(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	dir, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func cmdSetNextStepDir(args *Args) error {
+	oid := args.Uint(0)
+	dir := args.Uint(1)
 
 	DebugPrintln("[STEPPER] set_next_step_dir oid=" + itoa(int(oid)) + " dir=" + itoa(int(dir)))
 
 	stepper := GetStepper(uint8(oid))
 	if stepper == nil {
 		DebugPrintln("[STEPPER] ERROR: stepper not found for oid=" + itoa(int(oid)))
-		return errors.New("stepper not found")
+		return errInvalidOID
 	}
 
 	stepper.SetNextDir(uint8(dir))
 	return nil
 }
 
-func cmdResetStepClock(data *[]byte) error {
+func cmdResetStepClock(args *Args) error {
 	DebugPrintln("[STEPPER] reset_step_clock called")
 
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode oid in reset_step_clock")
-		return err
-	}
-
-	clockTime, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		DebugPrintln("[STEPPER] ERROR: failed to decode clock in reset_step_clock")
-		return err
-	}
+	oid := args.Uint(0)
+	clockTime := args.Uint(1)
 
 	DebugPrintln("[STEPPER] reset_step_clock oid=" + itoa(int(oid)) + " clock=" + itoa(int(clockTime)))
 
 	stepper := GetStepper(uint8(oid))
 	if stepper == nil {
 		DebugPrintln("[STEPPER] ERROR: stepper not found for oid=" + itoa(int(oid)) + " (stepperCount=" + itoa(int(stepperCount)) + ")")
-		return errors.New("stepper not found")
+		return errInvalidOID
 	}
 
 	stepper.ResetClock(clockTime)
@@ -228,17 +189,16 @@ func cmdResetStepClock(data *[]byte) error {
 	return nil
 }
 
-func cmdStepperGetPosition(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func cmdStepperGetPosition(args *Args) error {
+	oid := args.Uint(0)
 
 	stepper := GetStepper(uint8(oid))
 	if stepper == nil {
-		return errors.New("stepper not found")
+		return errInvalidOID
 	}
 
+	// Trigger first: one firing in between still leaves a latched position
+	triggerPos, triggerClock, triggered := stepper.GetTrigger()
 	position := stepper.GetPosition()
 
 	// Send stepper_position response
@@ -247,22 +207,39 @@ func cmdStepperGetPosition(data *[]byte) error {
 		protocol.EncodeVLQInt(output, int32(position))
 	})
 
+	// And when the trigger fired
+	if triggered {
+		SendResponse("stepper_trigger", func(output protocol.OutputBuffer) {
+			protocol.EncodeVLQUint(output, oid)
+			protocol.EncodeVLQInt(output, int32(triggerPos))
+			protocol.EncodeVLQUint(output, triggerClock)
+		})
+	}
+
 	return nil
 }
 
-func cmdStepperGetInfo(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func cmdStepperGetInfo(args *Args) error {
+	oid := args.Uint(0)
 
 	stepper := GetStepper(uint8(oid))
 	if stepper == nil {
-		return errors.New("stepper not found")
+		return errInvalidOID
 	}
 
-	// Debug info available via stepper struct but not logged to reduce bloat
-	_ = stepper
+	if stepper.Backend == nil {
+		return errors.New("stepper has no backend")
+	}
+	info := stepper.Backend.GetInfo()
+
+	SendResponse("stepper_info", func(output protocol.OutputBuffer) {
+		protocol.EncodeVLQUint(output, oid)
+		protocol.EncodeVLQBytes(output, []byte(info.Name))
+		protocol.EncodeVLQUint(output, info.MaxStepRate)
+		protocol.EncodeVLQUint(output, info.MinPulseNs)
+		protocol.EncodeVLQUint(output, info.TypicalJitter)
+		protocol.EncodeVLQUint(output, uint32(info.CPUOverhead))
+	})
 
 	return nil
 }
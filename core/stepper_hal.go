@@ -4,20 +4,18 @@ package core
 // Implementations can use GPIO, PIO, or other methods
 type StepperBackend interface {
 	// Init initializes the stepper hardware
-	// stepPin: GPIO pin for step pulses
-	// dirPin: GPIO pin for direction signal
-	// invertStep: invert step pin polarity
-	// invertDir: invert direction pin polarity
-	Init(stepPin, dirPin uint8, invertStep, invertDir bool) error
-
-	// Step generates a single step pulse
-	// Must handle pulse width timing internally
+	// Timing in cfg is in CLOCK_FREQ ticks; the backend converts it to its
+	// own clock with TicksToCycles.
+	Init(cfg StepperConfig) error
+
+	// Step generates a single step pulse, or a single edge in StepModeEdge
+	// The pulse lasts at least PulseTicks.
 	// Should be fast (called from timer interrupt)
 	Step()
 
 	// SetDirection sets the direction output
 	// dir: true = reverse, false = forward
-	// Must ensure proper dir-to-step setup time
+	// A change takes SetupTicks to settle before the next step edge.
 	SetDirection(dir bool)
 
 	// Stop immediately halts stepping
@@ -26,12 +24,37 @@ type StepperBackend interface {
 	// GetName returns backend implementation name
 	GetName() string
 
+	// GetInfo returns the backend's performance, for stepper_get_info
+	GetInfo() StepperBackendInfo
+
 	// SetStepInterval sets the step interval in timer ticks
 	// This allows backends to optimize timing (e.g., PIO clock divider)
 	// intervalTicks: time between steps in CLOCK_FREQ ticks (1 MHz = 1 µs)
 	SetStepInterval(intervalTicks uint32)
 }
 
+// StepperConfig is the configuration a StepperBackend is initialized with,
+// from config_stepper
+type StepperConfig struct {
+	StepPin    uint8 // GPIO pin for step pulses
+	DirPin     uint8 // GPIO pin for direction signal
+	InvertStep bool  // Invert step pin polarity
+	InvertDir  bool  // Invert direction pin polarity
+	StepMode   uint8 // StepModeNormal pulses the step pin, StepModeEdge toggles it
+
+	// Timing in CLOCK_FREQ ticks. Zero asks for the shortest the backend
+	// makes.
+	PulseTicks uint32 // Step pulse width (StepModeNormal)
+	SetupTicks uint32 // From a dir change to the next step edge
+}
+
+// TicksToCycles converts CLOCK_FREQ ticks to cycles of a clock running at
+// hz, rounding up so a minimum time is never shortened
+func TicksToCycles(ticks, hz uint32) uint32 {
+	freq := uint64(GetGlobalDictionary().ClockFreq())
+	return uint32((uint64(ticks)*uint64(hz) + freq - 1) / freq)
+}
+
 // StepperBackendInfo provides information about available backends
 type StepperBackendInfo struct {
 	Name          string
@@ -40,3 +63,40 @@ type StepperBackendInfo struct {
 	TypicalJitter uint32 // Typical timing jitter (ns)
 	CPUOverhead   uint8  // CPU overhead percentage (0-100)
 }
+
+// StepperSegment is one queue_step move handed to a StepperSegmentBackend,
+// with the times Klipper's step loop gives it: the first step at Clock and
+// step k at Clock + k*Interval + Add*k*(k+1)/2
+type StepperSegment struct {
+	Clock     uint32 // Time of the first step (previous step + Interval)
+	Interval  uint32 // Ticks from the previous step to the first step
+	Count     uint16 // Number of steps, at least 1
+	Add       int16  // Added to the interval after every step
+	Direction bool   // true = reverse, as for SetDirection
+}
+
+// LastStep returns the time of the last step of seg
+func (seg *StepperSegment) LastStep() uint32 {
+	k := int64(seg.Count) - 1
+	return seg.Clock + uint32(k*int64(seg.Interval)+int64(seg.Add)*k*(k+1)/2)
+}
+
+// StepperSegmentBackend is a StepperBackend that generates whole segments
+// in hardware, so the step timer runs once per queue_step rather than once
+// per step. The core hands over a segment no earlier than the first step of
+// the one before it, so the hardware only ever holds the segment it is
+// running and one more.
+type StepperSegmentBackend interface {
+	StepperBackend
+
+	// QueueSegment starts seg after the segments already queued, setting
+	// the direction before its first step. It returns false if the hardware
+	// cannot produce its timing (too fast for the step pulse), and the core
+	// then steps that segment with SetDirection and Step, which the backend
+	// runs after the queued segments.
+	QueueSegment(seg StepperSegment) bool
+
+	// StepsDone returns the number of steps generated since Init, counting
+	// those of Step, wrapping at 2^32. Stop keeps the steps already made.
+	StepsDone() uint32
+}
@@ -0,0 +1,190 @@
+package core
+
+// Segment stepping: when the backend is a StepperSegmentBackend the step
+// timer hands every queue_step move to the hardware, which makes all of its
+// steps, so the timer fires once per move instead of once per step. A move
+// the hardware cannot time is stepped by stepperEventHandler as before. The
+// backend counts every step it makes, so the position is the sum of the
+// segments it has finished plus StepsDone into the one it is running.
+
+import "unsafe"
+
+// hwSegment is a move handed to a segment backend and not yet retired
+type hwSegment struct {
+	count uint16
+	dir   uint8
+	start uint32 // Time of its first step
+	end   uint32 // Time of its last step
+}
+
+// initSegments switches the stepper to segment stepping if the backend
+// supports it
+func (s *Stepper) initSegments(backend StepperBackend) {
+	sb, ok := backend.(StepperSegmentBackend)
+	if !ok {
+		return
+	}
+	s.segBackend = sb
+	s.hwDone = sb.StepsDone()
+	// Hand segments over at most 1ms before their first step
+	s.segLead = GetGlobalDictionary().ClockFreq() / 1000
+	s.StepTimer.Handler = stepperSegmentEvent
+}
+
+// startSegments runs the step timer at once to hand over the first queued
+// move. Interrupts must be disabled.
+func (s *Stepper) startSegments() {
+	t := &s.StepTimer
+	t.Handler = stepperSegmentEvent
+	if s.segmentEventHandler(t) == SF_RESCHEDULE {
+		ScheduleTimer(t)
+	}
+}
+
+// stepperSegmentEvent is the step timer in segment stepping, as a plain
+// function like stepperStepEvent
+func stepperSegmentEvent(t *Timer) uint8 {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+	return timerContainer[Stepper](t, unsafe.Offsetof(Stepper{}.StepTimer)).segmentEventHandler(t)
+}
+
+// segmentEventHandler is the step timer in segment stepping. It hands the
+// next move to the backend once the previous one has started, then waits
+// for the new one to start.
+func (s *Stepper) segmentEventHandler(t *Timer) uint8 {
+	s.retireSegments()
+
+	for !s.segPending {
+		n := s.Queue.Pop()
+		if n == nil {
+			return SF_DONE
+		}
+		s.CurrentMove = n.StepperMove
+		MoveFree(n)
+		if s.ClockSet {
+			s.LastStepTime = s.NextStepClock
+			s.ClockSet = false
+		}
+		// A move without steps has nothing to hand over
+		s.segPending = s.CurrentMove.Count != 0
+	}
+	move := &s.CurrentMove
+	seg := StepperSegment{
+		Clock:     s.LastStepTime + move.Interval,
+		Interval:  move.Interval,
+		Count:     move.Count,
+		Add:       move.Add,
+		Direction: move.Direction != 0,
+	}
+
+	// Keep the move until shortly before it starts, and until the hardware
+	// has room for it
+	now := GetTime()
+	if wake, ready := s.segmentWake(seg.Clock, now); !ready {
+		t.WakeTime = wake
+		return SF_RESCHEDULE
+	}
+	s.segPending = false
+	s.pushSegment(&seg)
+	RecordTiming(EvtLoadMove, s.OID, now, seg.Clock, move.Interval)
+
+	if s.segmentClamped(&seg) || !s.segBackend.QueueSegment(seg) {
+		// Step it on the CPU; the backend still counts the steps
+		s.CurrentInterval = move.Interval
+		s.CurrentCount = move.Count
+		s.CurrentAdd = move.Add
+		s.Backend.SetDirection(seg.Direction)
+		s.Backend.SetStepInterval(move.Interval)
+		t.WakeTime = seg.Clock
+		t.Handler = stepperStepEvent
+		return SF_RESCHEDULE
+	}
+
+	s.LastStepTime = seg.LastStep()
+	t.WakeTime = seg.Clock
+	return SF_RESCHEDULE
+}
+
+// segmentClamped reports whether the interval of seg falls below
+// MinStopInterval, which only per-step timing applies
+func (s *Stepper) segmentClamped(seg *StepperSegment) bool {
+	last := int64(seg.Interval) + int64(seg.Count-1)*int64(seg.Add)
+	return last < int64(s.MinStopInterval) || last <= 0
+}
+
+// segmentWake returns when a segment whose first step is at clock may be
+// handed over, and whether that is now. That is at most segLead before its
+// first step, and once the segment handed over before it has started, so
+// the hardware holds the one it is running and one more. The timer sleeps
+// until then rather than polling, as it knows when each segment starts and
+// ends.
+func (s *Stepper) segmentWake(clock, now uint32) (uint32, bool) {
+	if int32(clock-now) > int32(s.segLead) {
+		return clock - s.segLead, false
+	}
+	n := uint8(len(s.hwSegs))
+	if s.hwLen == 0 {
+		return now, true
+	}
+	if last := &s.hwSegs[(s.hwHead+s.hwLen-1)%n]; int32(last.start-now) > 0 {
+		return last.start, false
+	}
+	if s.hwLen == n {
+		// The step counter has yet to count out the segment before the
+		// running one
+		if end := s.hwSegs[s.hwHead].end; int32(end-now) > TimerMinTryTicks {
+			return end, false
+		}
+		return now + TimerMinTryTicks, false
+	}
+	return now, true
+}
+
+// pushSegment records a segment handed to the backend
+func (s *Stepper) pushSegment(seg *StepperSegment) {
+	i := (s.hwHead + s.hwLen) % uint8(len(s.hwSegs))
+	s.hwSegs[i] = hwSegment{count: seg.Count, start: seg.Clock, end: seg.LastStep()}
+	if seg.Direction {
+		s.hwSegs[i].dir = 1
+	}
+	s.hwLen++
+}
+
+// retireSegments adds the segments the backend has finished to Position
+// and returns the steps it has made into the next one
+// Interrupts must be disabled.
+func (s *Stepper) retireSegments() int64 {
+	done := s.segBackend.StepsDone() - s.hwDone
+	for s.hwLen > 0 {
+		seg := &s.hwSegs[s.hwHead]
+		if done < uint32(seg.count) {
+			return segmentSteps(done, seg.dir)
+		}
+		s.Position += segmentSteps(uint32(seg.count), seg.dir)
+		s.hwDone += uint32(seg.count)
+		done -= uint32(seg.count)
+		s.hwHead = (s.hwHead + 1) % uint8(len(s.hwSegs))
+		s.hwLen--
+	}
+	return 0
+}
+
+// abortSegments keeps the steps of a stopped backend and forgets the
+// segments it did not finish
+// Interrupts must be disabled.
+func (s *Stepper) abortSegments() {
+	s.Position += s.retireSegments()
+	s.hwLen = 0
+	s.hwDone = s.segBackend.StepsDone()
+	s.segPending = false
+	s.StepTimer.Handler = stepperSegmentEvent
+}
+
+// segmentSteps returns steps as a position change in direction dir
+func segmentSteps(steps uint32, dir uint8) int64 {
+	if dir != 0 {
+		return -int64(steps)
+	}
+	return int64(steps)
+}
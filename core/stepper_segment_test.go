@@ -0,0 +1,240 @@
+package core
+
+import "testing"
+
+// fakeSegmentBackend makes the steps of every segment at the times Klipper's
+// step loop would, working out StepsDone from the clock
+type fakeSegmentBackend struct {
+	segs        []StepperSegment
+	minInterval uint32 // QueueSegment refuses segments faster than this
+	stepped     uint32 // Steps of Step calls and of stopped segments
+	dir         bool
+	early       int // Segments handed over before the previous one started
+}
+
+func (b *fakeSegmentBackend) Init(cfg StepperConfig) error {
+	return nil
+}
+func (b *fakeSegmentBackend) Step()                  { b.stepped++ }
+func (b *fakeSegmentBackend) SetDirection(dir bool)  { b.dir = dir }
+func (b *fakeSegmentBackend) GetName() string        { return "fake_segment" }
+func (b *fakeSegmentBackend) SetStepInterval(uint32) {}
+func (b *fakeSegmentBackend) GetInfo() StepperBackendInfo {
+	return StepperBackendInfo{Name: b.GetName()}
+}
+func (b *fakeSegmentBackend) QueueSegment(seg StepperSegment) bool {
+	if seg.Interval < b.minInterval {
+		return false
+	}
+	if n := len(b.segs); n > 0 && int32(b.segs[n-1].Clock-GetTime()) > 0 {
+		b.early++
+	}
+	b.segs = append(b.segs, seg)
+	return true
+}
+
+func (b *fakeSegmentBackend) Stop() {
+	b.stepped = b.StepsDone()
+	b.segs = nil
+}
+
+func (b *fakeSegmentBackend) StepsDone() uint32 {
+	done := b.stepped
+	now := GetTime()
+	for _, seg := range b.segs {
+		for k := uint16(0); k < seg.Count; k++ {
+			step := seg
+			step.Count = k + 1
+			if int32(now-step.LastStep()) >= 0 {
+				done++
+			}
+		}
+	}
+	return done
+}
+
+// newTestStepper returns a stepper on a fake backend, with the move pool
+// and timers reset around the test
+func newTestStepper(t *testing.T, backend StepperBackend) *Stepper {
+	resetTimerHeap(t)
+	savedShutdown, savedReset := shutdownHooks, configResetHooks
+	shutdownHooks, configResetHooks = nil, nil
+	resetMovePool()
+	allocMovePool()
+	t.Cleanup(func() {
+		shutdownHooks, configResetHooks = savedShutdown, savedReset
+		resetMovePool()
+		SetTime(0)
+	})
+
+	s := &Stepper{StepTimer: Timer{Owner: TimerOwnerStepper}}
+	s.StepTimer.Handler = stepperStepEvent
+	if err := s.InitBackend(backend); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestStepperSegments queues three moves, two the backend times and one
+// too fast for it, and checks the position as time passes against the step
+// times of the per-step timer
+func TestStepperSegments(t *testing.T) {
+	backend := &fakeSegmentBackend{minInterval: 40}
+	SetTime(1000)
+	s := newTestStepper(t, backend)
+	GetTimerStats(true)
+
+	s.ResetClock(1000)
+	s.QueueMove(100, 10, 0) // Steps at 1100, 1200, ... 2000
+	s.SetNextDir(1)
+	s.QueueMove(50, 4, 10) // Back at 2050, 2110, 2180, 2260
+	s.SetNextDir(0)
+	s.QueueMove(30, 3, 0) // On the CPU at 2290, 2320, 2350
+
+	var steps []uint32
+	for at := uint32(1100); at <= 2000; at += 100 {
+		steps = append(steps, at)
+	}
+	steps = append(steps, 2050, 2110, 2180, 2260, 2290, 2320, 2350)
+	want := func(now uint32) int64 {
+		pos := int64(0)
+		for i, at := range steps {
+			if at > now {
+				break
+			}
+			if i >= 10 && i < 14 {
+				pos--
+			} else {
+				pos++
+			}
+		}
+		return pos
+	}
+
+	for now := uint32(1000); now <= 2500; now += 5 {
+		SetTime(now)
+		ProcessTimers()
+		if pos := s.GetPosition(); pos != want(now) {
+			t.Fatalf("position %d at %d, want %d", pos, now, want(now))
+		}
+	}
+	if len(backend.segs) != 2 || !backend.segs[1].Direction || backend.segs[1].Clock != 2050 {
+		t.Errorf("segments %+v", backend.segs)
+	}
+	if backend.stepped != 3 || backend.dir {
+		t.Errorf("%d CPU steps with reverse=%v, want 3 forward", backend.stepped, backend.dir)
+	}
+	if s.IsActive() {
+		t.Error("stepper active after its moves")
+	}
+
+	// The timer ran to hand over the second and third moves, then once per
+	// step of the third
+	if stats, _ := GetTimerStats(true); stats[TimerOwnerStepper].Count != 5 {
+		t.Errorf("%d step timer dispatches, want 5", stats[TimerOwnerStepper].Count)
+	}
+}
+
+// TestStepperSegmentStop checks that stopping keeps the steps the backend
+// has made and drops the rest
+func TestStepperSegmentStop(t *testing.T) {
+	backend := &fakeSegmentBackend{}
+	SetTime(1000)
+	s := newTestStepper(t, backend)
+
+	s.ResetClock(1000)
+	s.QueueMove(100, 10, 0)
+	s.QueueMove(100, 10, 0)
+	for now := uint32(1000); now <= 1550; now += 50 {
+		SetTime(now)
+		ProcessTimers()
+	}
+	s.Stop()
+	SetTime(5000)
+	ProcessTimers()
+	if pos := s.GetPosition(); pos != 5 {
+		t.Errorf("position %d after stopping, want 5", pos)
+	}
+	if s.IsActive() || s.StepTimer.Pending() {
+		t.Error("stepper still running after Stop")
+	}
+}
+
+// TestStepperStopOnTrigger stops a move with a trsync on the CPU and on a
+// segment backend, and checks the position and clock latched at the trigger
+func TestStepperStopOnTrigger(t *testing.T) {
+	backends := []StepperBackend{&recordBackend{}, &fakeSegmentBackend{}}
+	for _, backend := range backends {
+		SetTime(1000)
+		s := newTestStepper(t, backend)
+		ts := &TriggerSync{Flags: TSF_CAN_TRIGGER}
+		TriggerSyncAddSignal(ts, func(reason uint8) {
+			s.StopOnTrigger()
+		})
+
+		s.ResetClock(1000)
+		s.QueueMove(100, 10, 0) // Steps at 1100, 1200, ... 2000
+		s.QueueMove(100, 10, 0)
+		for now := uint32(1000); now <= 1550; now += 50 {
+			SetTime(now)
+			ProcessTimers()
+		}
+		if pos := s.GetPosition(); pos != 5 {
+			t.Errorf("%s: position %d before the trigger, want 5", backend.GetName(), pos)
+		}
+		TriggerSyncDoTrigger(ts, 1)
+		SetTime(5000)
+		ProcessTimers()
+		if pos := s.GetPosition(); !s.Triggered || pos != 5 || s.TriggerClock != 1550 {
+			t.Errorf("%s: latched position %d at %d, want 5 at 1550",
+				backend.GetName(), pos, s.TriggerClock)
+		}
+		if s.IsActive() || s.StepTimer.Pending() {
+			t.Errorf("%s: stepper still running after the trigger", backend.GetName())
+		}
+		if ts.Signals != nil {
+			t.Errorf("%s: signal still registered after the trigger", backend.GetName())
+		}
+
+		// The next move starts from the latched position
+		s.ResetClock(5000)
+		s.SetNextDir(1)
+		s.QueueMove(100, 2, 0)
+		SetTime(5200)
+		ProcessTimers()
+		if pos := s.GetPosition(); s.Triggered || pos != 3 {
+			t.Errorf("%s: position %d after moving back 2, want 3", backend.GetName(), pos)
+		}
+	}
+}
+
+// TestStepperSegmentHandover queues moves shorter than the handover lead
+// and checks that each is handed over once the one before it has started,
+// with the timer sleeping rather than polling in between
+func TestStepperSegmentHandover(t *testing.T) {
+	backend := &fakeSegmentBackend{}
+	SetTime(1000)
+	s := newTestStepper(t, backend)
+	GetTimerStats(true)
+
+	s.ResetClock(1000)
+	for i := 0; i < 6; i++ {
+		s.QueueMove(20, 5, 0) // 100 ticks each, from 1020
+	}
+	for now := uint32(1000); now <= 2000; now++ {
+		SetTime(now)
+		ProcessTimers()
+	}
+	if pos := s.GetPosition(); pos != 30 {
+		t.Errorf("position %d, want 30", pos)
+	}
+	if len(backend.segs) != 6 || backend.early != 0 {
+		t.Errorf("%d segments, %d handed over early", len(backend.segs), backend.early)
+	}
+
+	// Once to hand over the first, then once per later move at the start
+	// of the one before it
+	if stats, _ := GetTimerStats(true); stats[TimerOwnerStepper].Count != 6 {
+		t.Errorf("%d step timer dispatches, want 6", stats[TimerOwnerStepper].Count)
+	}
+}
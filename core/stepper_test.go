@@ -0,0 +1,100 @@
+package core
+
+import (
+	"testing"
+
+	"gopper/protocol"
+)
+
+// recordBackend records the configuration its stepper passed to Init
+type recordBackend struct {
+	cfg StepperConfig
+}
+
+func (b *recordBackend) Init(cfg StepperConfig) error {
+	b.cfg = cfg
+	return nil
+}
+func (b *recordBackend) Step()                  {}
+func (b *recordBackend) SetDirection(bool)      {}
+func (b *recordBackend) Stop()                  {}
+func (b *recordBackend) GetName() string        { return "record" }
+func (b *recordBackend) SetStepInterval(uint32) {}
+func (b *recordBackend) GetInfo() StepperBackendInfo {
+	return StepperBackendInfo{Name: b.GetName()}
+}
+
+// TestConfigStepper checks the backend configuration config_stepper sets
+// up: stepping on both edges only for invert_step=-1 with
+// step_pulse_ticks=0, and step_pulse_ticks as the pulse width and dir setup
+// time
+func TestConfigStepper(t *testing.T) {
+	savedFactory := stepperBackendFactory
+	t.Cleanup(func() {
+		stepperBackendFactory = savedFactory
+		releaseAllSteppers()
+		resetOIDs()
+	})
+	var backend *recordBackend
+	SetStepperBackendFactory(func(cfg StepperConfig) (StepperBackend, error) {
+		backend = &recordBackend{}
+		return backend, backend.Init(cfg)
+	})
+
+	r := NewCommandRegistry()
+	configID := r.Register("config_stepper", "oid=%c step_pin=%c dir_pin=%c invert_step=%c step_pulse_ticks=%u", cmdConfigStepper)
+	allocID := r.Register("allocate_oids", "count=%c", handleAllocateOids)
+	send := func(id uint16, args ...uint32) {
+		out := protocol.NewScratchOutput()
+		for _, a := range args {
+			protocol.EncodeVLQUint(out, a)
+		}
+		data := out.Result()
+		if err := r.Dispatch(id, &data); err != nil {
+			t.Fatalf("command %d: %v", id, err)
+		}
+	}
+	send(allocID, 4)
+
+	tests := []struct {
+		invertStep, pulseTicks uint32
+		want                   StepperConfig
+	}{
+		{0, 2, StepperConfig{StepMode: StepModeNormal, PulseTicks: 2, SetupTicks: 2}},
+		{1, 0, StepperConfig{InvertStep: true, StepMode: StepModeNormal}},
+		{255, 0, StepperConfig{StepMode: StepModeEdge}}, // -1 as a %c byte
+		{255, 5, StepperConfig{StepMode: StepModeNormal, PulseTicks: 5, SetupTicks: 5}},
+	}
+	for i, tt := range tests {
+		send(configID, uint32(i), 2, 3, tt.invertStep, tt.pulseTicks)
+		want := tt.want
+		want.StepPin, want.DirPin = 2, 3
+		if backend.cfg != want {
+			t.Errorf("invert_step=%d step_pulse_ticks=%d: Init with %+v, want %+v",
+				tt.invertStep, tt.pulseTicks, backend.cfg, want)
+		}
+		if s := GetStepper(uint8(i)); s == nil || s.StepMode != want.StepMode {
+			t.Errorf("stepper %d not configured in mode %d", i, want.StepMode)
+		}
+	}
+}
+
+// TestTicksToCycles checks the conversion of 1MHz ticks to CPU and PIO
+// clocks, which rounds up
+func TestTicksToCycles(t *testing.T) {
+	tests := []struct {
+		ticks, hz, want uint32
+	}{
+		{2, 125000000, 250},
+		{2, 150000000, 300},
+		{5, 200000000, 1000},
+		{2, 5000000, 10}, // PIO at 5 cycles per tick
+		{0, 150000000, 0},
+		{1, 1500000, 2},
+	}
+	for _, tt := range tests {
+		if got := TicksToCycles(tt.ticks, tt.hz); got != tt.want {
+			t.Errorf("TicksToCycles(%d, %d) = %d, want %d", tt.ticks, tt.hz, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package core
+
+import "gopper/protocol"
+
+// Tasks, like Klipper's DECL_TASK: work that must not run from a timer
+// (sending responses, talking to a bus, resetting the MCU) is registered by
+// its subsystem at init and run by RunTasks, which every target calls once
+// per main loop iteration. A timer hands work to its task by waking it with
+// TaskWake.Wake; the task returns at once unless TaskWake.Check reports a
+// wake, so idle tasks cost little.
+
+// TaskWake is a task's wake flag, like Klipper's struct task_wake
+// The zero value is not woken.
+type TaskWake struct {
+	woken bool
+}
+
+// Wake asks for the task to run, like Klipper's sched_wake_task
+// It is safe from timer handlers and from either core.
+func (w *TaskWake) Wake() {
+	state := disableInterrupts()
+	w.woken = true
+	restoreInterrupts(state)
+}
+
+// Check reports whether the task was woken and clears the flag, like
+// Klipper's sched_check_wake. Wakes that arrive while the task runs are
+// kept for the next call.
+func (w *TaskWake) Check() bool {
+	state := disableInterrupts()
+	woken := w.woken
+	w.woken = false
+	restoreInterrupts(state)
+	return woken
+}
+
+// TaskStats is the time RunTasks has spent in one task, in timer ticks
+type TaskStats struct {
+	Name string
+	Runs uint32 // Calls since the stats were last read
+	Sum  uint32 // Total run time
+	Max  uint32 // Longest single run
+}
+
+type task struct {
+	run   func()
+	stats TaskStats
+}
+
+var tasks []task
+
+// RegisterTask adds a function RunTasks calls on every main loop iteration
+// Tasks run in registration order.
+func RegisterTask(name string, run func()) {
+	tasks = append(tasks, task{run: run, stats: TaskStats{Name: name}})
+}
+
+// RunTasks runs every registered task once and records its run time
+// Targets call it from the main loop after writing out pending responses.
+func RunTasks() {
+	for i := range tasks {
+		t := &tasks[i]
+		start := GetTime()
+		t.run()
+		diff := GetTime() - start
+
+		t.stats.Runs++
+		t.stats.Sum += diff
+		if diff > t.stats.Max {
+			t.stats.Max = diff
+		}
+	}
+}
+
+// GetTaskStats returns the stats of every task in registration order and
+// starts counting again
+func GetTaskStats() []TaskStats {
+	stats := make([]TaskStats, len(tasks))
+	for i := range tasks {
+		stats[i] = tasks[i].stats
+		tasks[i].stats = TaskStats{Name: tasks[i].stats.Name}
+	}
+	return stats
+}
+
+// handleGetTaskStats sends one task_stats response per task
+func handleGetTaskStats(_ *Args) error {
+	for i, s := range GetTaskStats() {
+		SendResponse("task_stats", func(output protocol.OutputBuffer) {
+			protocol.EncodeVLQUint(output, uint32(i))
+			protocol.EncodeVLQBytes(output, []byte(s.Name))
+			protocol.EncodeVLQUint(output, s.Runs)
+			protocol.EncodeVLQUint(output, s.Sum)
+			protocol.EncodeVLQUint(output, s.Max)
+		})
+	}
+	return nil
+}
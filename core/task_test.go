@@ -0,0 +1,43 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRunTasks(t *testing.T) {
+	saved := tasks
+	defer func() { tasks = saved }()
+	tasks = nil
+	SetTime(1000)
+	defer SetTime(0)
+
+	var wake TaskWake
+	var ran []string
+	RegisterTask("woken", func() {
+		if !wake.Check() {
+			return
+		}
+		ran = append(ran, "woken")
+		SetTime(GetTime() + 50) // Takes 50 ticks when it has work
+	})
+	RegisterTask("always", func() { ran = append(ran, "always") })
+
+	RunTasks()
+	wake.Wake()
+	wake.Wake()
+	RunTasks()
+	RunTasks()
+	if want := []string{"always", "woken", "always", "always"}; !slices.Equal(ran, want) {
+		t.Fatalf("ran %v, want %v", ran, want)
+	}
+
+	stats := GetTaskStats()
+	want := TaskStats{Name: "woken", Runs: 3, Sum: 50, Max: 50}
+	if len(stats) != 2 || stats[0] != want || stats[1].Runs != 3 {
+		t.Errorf("stats %+v, want %+v first", stats, want)
+	}
+	if s := GetTaskStats(); s[0] != (TaskStats{Name: "woken"}) {
+		t.Errorf("stats not restarted after reading: %+v", s[0])
+	}
+}
@@ -8,6 +8,12 @@ const (
 var (
 	systemTicks uint32
 	bootTime    uint64 // Time at boot for uptime calculation
+
+	// 64-bit uptime: wraps of the 32-bit clock counted in software, unless
+	// the target registers its 64-bit hardware counter
+	uptimeHigh uint32        // Number of times the 32-bit clock has wrapped
+	uptimeLast uint32        // Last clock value seen, to detect a wrap
+	uptimeFunc func() uint64 // Hardware 64-bit counter (nil if none)
 )
 
 // GetTime returns the current system time in timer ticks
@@ -17,14 +23,45 @@ func GetTime() uint32 {
 
 // SetTime sets the current system time (for testing/hardware integration)
 func SetTime(ticks uint32) {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
 	setSystemTicks(ticks)
+	trackWrap()
 }
 
 // GetUptime returns 64-bit uptime in timer ticks
+// Without a hardware counter the high word counts wraps of the 32-bit clock,
+// so the clock must be observed (SetTime or GetUptime) at least once per
+// half wrap period (2^31 ticks, ~35 minutes at 1MHz); the main loop does
+// this every iteration.
 func GetUptime() uint64 {
-	// Return current time as 64-bit value
-	// In a real implementation with hardware, this would read a 64-bit counter
-	return uint64(GetTime())
+	if uptimeFunc != nil {
+		return uptimeFunc()
+	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+	return trackWrap()
+}
+
+// SetHardwareUptimeFunc registers a function reading the target's 64-bit
+// hardware timer, which GetUptime then returns directly
+func SetHardwareUptimeFunc(f func() uint64) {
+	uptimeFunc = f
+}
+
+// trackWrap reads the clock, counts a wrap when it has moved forward past
+// 0xFFFFFFFF since it was last seen, and returns the 64-bit uptime. A clock
+// set backwards (e.g. a replay restarting) is not a wrap.
+// Interrupts must be disabled, so the clock read and the update of the last
+// value seen cannot interleave with another observation.
+func trackWrap() uint64 {
+	now := GetTime()
+	if now < uptimeLast && int32(now-uptimeLast) >= 0 {
+		uptimeHigh++
+	}
+	uptimeLast = now
+	return uint64(uptimeHigh)<<32 | uint64(now)
 }
 
 // TimerFromUS converts microseconds to timer ticks
@@ -44,7 +81,9 @@ func TimerInit() {
 	bootTime = uint64(GetTime())
 }
 
-// ProcessTimers processes scheduled timers
+// ProcessTimers dispatches every due timer
+// Targets with a hardware alarm (see SetTimerAlarm) call it from the alarm
+// interrupt; the others poll it from the main loop.
 func ProcessTimers() {
 	currentTime = GetTime()
 	TimerDispatch()
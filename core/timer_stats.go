@@ -0,0 +1,145 @@
+package core
+
+import "gopper/protocol"
+
+// Timer diagnostics. TimerDispatch records how late every timer ran, per
+// owning subsystem, as a histogram and a maximum, and counts handlers that
+// reschedule themselves too close to (or behind) the current time.
+// get_timer_stats reports them with the longest main loop iteration, so a
+// failed print can be put down to step rate (stepper timers running late or
+// too close), ADC or endstop load (their timers late) or USB stalls (long
+// main loop iterations with timers on time). A dual-core build also reports
+// how long each core waited for the core lock.
+
+// TimerOwner identifies the subsystem a timer belongs to
+type TimerOwner uint8
+
+const (
+	TimerOwnerOther TimerOwner = iota
+	TimerOwnerStepper
+	TimerOwnerDigitalOut
+	TimerOwnerPWM
+	TimerOwnerAnalogIn
+	TimerOwnerEndstop
+	TimerOwnerTriggerSync
+	TimerOwnerDriver
+	timerOwnerCount
+)
+
+// Owner names, registered as the timer_owner enumeration so the host
+// decodes timer_stats by name
+var timerOwnerNames = [timerOwnerCount]string{
+	"other", "stepper", "digital_out", "pwm", "analog_in", "endstop",
+	"trsync", "driver",
+}
+
+// Lateness histogram: bucket i counts timers that ran less than
+// 4^i ticks late, the last bucket everything later
+const TimerLateBuckets = 8
+
+// TimerStats is the lateness record of one timer owner, in timer ticks
+type TimerStats struct {
+	Count    uint32 // Timers dispatched
+	Max      uint32 // Latest dispatch
+	TooClose uint32 // Reschedules closer than TimerMinTryTicks to now
+	Late     [TimerLateBuckets]uint32
+}
+
+var (
+	timerStats  [timerOwnerCount]TimerStats
+	mainLoopMax uint32 // Longest main loop iteration seen by StatsUpdate
+)
+
+// timerLateBucket returns the histogram bucket for late ticks
+func timerLateBucket(late uint32) int {
+	b := 0
+	for limit := uint32(1); b < TimerLateBuckets-1 && late >= limit; limit <<= 2 {
+		b++
+	}
+	return b
+}
+
+// recordTimerLate notes a dispatch late ticks after the timer's WakeTime
+// Interrupts must be disabled.
+func recordTimerLate(t *Timer, late uint32) {
+	s := &timerStats[t.owner()]
+	s.Count++
+	if late > s.Max {
+		s.Max = late
+	}
+	s.Late[timerLateBucket(late)]++
+}
+
+// checkTimerTooClose counts a handler that rescheduled its timer for less
+// than TimerMinTryTicks from now, which the alarm can only honour late.
+// Interrupts must be disabled.
+func checkTimerTooClose(t *Timer, now uint32) {
+	if int32(t.WakeTime-now) >= TimerMinTryTicks {
+		return
+	}
+	timerStats[t.owner()].TooClose++
+	RecordTiming(EvtTimerTooClose, 0, now, t.WakeTime, uint32(t.Owner))
+}
+
+// owner returns the timer's owner, treating unknown values as other
+func (t *Timer) owner() TimerOwner {
+	if t.Owner >= timerOwnerCount {
+		return TimerOwnerOther
+	}
+	return t.Owner
+}
+
+// GetTimerStats returns the timer diagnostics of every owner, indexed by
+// TimerOwner, and the longest main loop iteration. With reset set the
+// counts start again.
+func GetTimerStats(reset bool) ([timerOwnerCount]TimerStats, uint32) {
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
+	stats, loopMax := timerStats, mainLoopMax
+	if reset {
+		timerStats = [timerOwnerCount]TimerStats{}
+		mainLoopMax = 0
+	}
+	return stats, loopMax
+}
+
+// handleGetTimerStats sends one timer_stats response per owner that has run
+// a timer, core_lock_stats for each core of a dual-core build, then
+// timer_stats_end with the totals
+// Format: get_timer_stats reset=%c
+func handleGetTimerStats(args *Args) error {
+	reset := args.Uint(0) != 0
+	stats, loopMax := GetTimerStats(reset)
+	lockStats := GetCoreLockStats(reset)
+	for owner, s := range stats {
+		if s.Count == 0 && s.TooClose == 0 {
+			continue
+		}
+		SendResponse("timer_stats", func(output protocol.OutputBuffer) {
+			protocol.EncodeVLQUint(output, uint32(owner))
+			protocol.EncodeVLQUint(output, s.Count)
+			protocol.EncodeVLQUint(output, s.Max)
+			protocol.EncodeVLQUint(output, s.TooClose)
+			for _, n := range s.Late {
+				protocol.EncodeVLQUint(output, n)
+			}
+		})
+	}
+	if coreLock != nil {
+		for core, s := range lockStats {
+			SendResponse("core_lock_stats", func(output protocol.OutputBuffer) {
+				protocol.EncodeVLQUint(output, uint32(core))
+				protocol.EncodeVLQUint(output, s.Count)
+				protocol.EncodeVLQUint(output, s.Contended)
+				protocol.EncodeVLQUint(output, s.Sum)
+				protocol.EncodeVLQUint(output, s.Max)
+			})
+		}
+	}
+	SendResponse("timer_stats_end", func(output protocol.OutputBuffer) {
+		protocol.EncodeVLQUint(output, GetTimerPastErrors())
+		protocol.EncodeVLQUint(output, loopMax)
+	})
+	return nil
+}
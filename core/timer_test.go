@@ -0,0 +1,45 @@
+package core
+
+import "testing"
+
+func TestUptimeTracksWraps(t *testing.T) {
+	uptimeHigh, uptimeLast, uptimeFunc = 0, 0, nil
+	defer SetTime(0)
+
+	SetTime(0xFFFFFF00)
+	if up := GetUptime(); up != 0xFFFFFF00 {
+		t.Errorf("uptime before wrap = %#x", up)
+	}
+
+	SetTime(0x10)
+	if up := GetUptime(); up != 1<<32|0x10 {
+		t.Errorf("uptime after wrap = %#x", up)
+	}
+
+	// Reading the uptime without a new SetTime must not count a wrap again
+	if up := GetUptime(); up != 1<<32|0x10 {
+		t.Errorf("uptime re-read = %#x", up)
+	}
+
+	// Setting the clock backwards is not a wrap
+	SetTime(0x08)
+	if up := GetUptime(); up != 1<<32|0x08 {
+		t.Errorf("uptime after clock set back = %#x", up)
+	}
+
+	SetTime(0xFFFFFFFF)
+	SetTime(5)
+	if up := GetUptime(); up != 2<<32|5 {
+		t.Errorf("uptime after second wrap = %#x", up)
+	}
+	uptimeHigh, uptimeLast = 0, 0
+}
+
+func TestUptimeHardwareCounter(t *testing.T) {
+	SetHardwareUptimeFunc(func() uint64 { return 7<<32 | 42 })
+	defer SetHardwareUptimeFunc(nil)
+
+	if up := GetUptime(); up != 7<<32|42 {
+		t.Errorf("uptime = %#x, want hardware value", up)
+	}
+}
@@ -4,12 +4,14 @@ package core
 
 import (
 	"gopper/protocol"
+	"unsafe"
 )
 
 // TriggerSync flags
 const (
 	TSF_CAN_TRIGGER = 1 << 0 // Trigger is enabled
 	TSF_TRIGGERED   = 1 << 1 // Trigger has fired
+	TSF_REPORT      = 1 << 2 // A report is waiting for TriggerSyncTask
 )
 
 // TriggerSignal represents a callback registered with a TriggerSync
@@ -33,8 +35,15 @@ type TriggerSync struct {
 // Global registry of trigger sync objects
 var triggerSyncs = make(map[uint8]*TriggerSync)
 
+// triggerSyncWake is set when a trigger sync has a report to send
+var triggerSyncWake TaskWake
+
 // InitTriggerSyncCommands registers trsync-related commands
 func InitTriggerSyncCommands() {
+	RegisterShutdown(ShutdownAllTriggerSyncs)
+	RegisterConfigReset(releaseAllTriggerSyncs)
+	RegisterTask("trsync", TriggerSyncTask)
+
 	// Command to configure a trigger sync object
 	RegisterCommand("config_trsync", "oid=%c", handleConfigTriggerSync)
 	// Command to set timeout for trigger synchronization
@@ -53,15 +62,18 @@ func InitTriggerSyncCommands() {
 // handleConfigTriggerSync allocates and initializes a trsync object
 // Format: config_trsync oid=%c
 
-func handleConfigTriggerSync(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
+func handleConfigTriggerSync(args *Args) error {
+	oid := args.Uint(0)
+	if err := AllocOID(uint8(oid), OIDTriggerSync); err != nil {
 		return err
 	}
-	// Create or reset trigger sync object
+
+	// Create trigger sync object
 	ts := &TriggerSync{
-		OID:   uint8(oid),
-		Flags: 0,
+		OID:         uint8(oid),
+		Flags:       0,
+		ReportTimer: Timer{Owner: TimerOwnerTriggerSync},
+		ExpireTimer: Timer{Owner: TimerOwnerTriggerSync},
 	}
 	triggerSyncs[uint8(oid)] = ts
 	return nil
@@ -69,36 +81,21 @@ func handleConfigTriggerSync(data *[]byte) error {
 
 // handleTriggerSyncStart starts a trigger synchronization session
 // Format: trsync_start oid=%c report_clock=%u report_ticks=%u expire_reason=%c
-func handleTriggerSyncStart(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	reportClock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleTriggerSyncStart(args *Args) error {
+	oid := args.Uint(0)
+	reportClock := args.Uint(1)
+	reportTicks := args.Uint(2)
+	expireReason := args.Uint(3)
 
-	reportTicks, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	expireReason, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	// Get or create trigger sync object
-	ts, exists := triggerSyncs[uint8(oid)]
+	// Get trigger sync object
+	ts, exists := GetTriggerSync(uint8(oid))
 	if !exists {
-		ts = &TriggerSync{
-			OID: uint8(oid),
-		}
-		triggerSyncs[uint8(oid)] = ts
+		return errInvalidOID
 	}
 
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
+
 	// Reset state
 	ts.Flags = TSF_CAN_TRIGGER
 	ts.TriggerReason = 0
@@ -117,48 +114,36 @@ func handleTriggerSyncStart(data *[]byte) error {
 
 // handleTriggerSyncSetTimeout sets a timeout for trigger synchronization
 // Format: trsync_set_timeout oid=%c clock=%u
-func handleTriggerSyncSetTimeout(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	clock, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleTriggerSyncSetTimeout(args *Args) error {
+	oid := args.Uint(0)
+	clock := args.Uint(1)
 
 	// Get trigger sync object
-	ts, exists := triggerSyncs[uint8(oid)]
+	ts, exists := GetTriggerSync(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Schedule expire timer
+	state := disableInterrupts()
 	ts.ExpireTimer.WakeTime = clock
 	ts.ExpireTimer.Handler = triggerSyncExpireEvent
 	ScheduleTimer(&ts.ExpireTimer)
+	restoreInterrupts(state)
 
 	return nil
 }
 
 // handleTriggerSyncTrigger manually triggers a trsync
 // Format: trsync_trigger oid=%c reason=%c
-func handleTriggerSyncTrigger(data *[]byte) error {
-	oid, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
-
-	reason, err := protocol.DecodeVLQUint(data)
-	if err != nil {
-		return err
-	}
+func handleTriggerSyncTrigger(args *Args) error {
+	oid := args.Uint(0)
+	reason := args.Uint(1)
 
 	// Get trigger sync object
-	ts, exists := triggerSyncs[uint8(oid)]
+	ts, exists := GetTriggerSync(uint8(oid))
 	if !exists {
-		return nil // Silently ignore if not configured
+		return errInvalidOID
 	}
 
 	// Trigger it
@@ -183,8 +168,10 @@ func TriggerSyncDoTrigger(ts *TriggerSync, reason uint8) {
 	ts.Flags |= TSF_TRIGGERED
 	ts.TriggerReason = reason
 
-	// Call all registered signal callbacks
+	// Call all registered signal callbacks, unregistering them as Klipper
+	// does, so each only applies to the homing move it was added for
 	signal := ts.Signals
+	ts.Signals = nil
 	for signal != nil {
 		if signal.Callback != nil {
 			signal.Callback(reason)
@@ -209,21 +196,13 @@ func TriggerSyncAddSignal(ts *TriggerSync, callback func(reason uint8)) *Trigger
 
 // triggerSyncReportEvent is the timer handler for periodic status reports
 func triggerSyncReportEvent(t *Timer) uint8 {
-	// Find the TriggerSync instance that owns this timer
-	var ts *TriggerSync
-	for _, tsPtr := range triggerSyncs {
-		if tsPtr != nil && &tsPtr.ReportTimer == t {
-			ts = tsPtr
-			break
-		}
-	}
+	ts := timerContainer[TriggerSync](t, unsafe.Offsetof(TriggerSync{}.ReportTimer))
 
-	if ts == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
-	// Send report to host
-	triggerSyncReport(ts)
+	// Have a report sent to the host
+	wakeTriggerSyncTask(ts)
 
 	// Reschedule if still active
 	if (ts.Flags & TSF_CAN_TRIGGER) != 0 {
@@ -236,34 +215,58 @@ func triggerSyncReportEvent(t *Timer) uint8 {
 
 // triggerSyncExpireEvent is the timer handler for timeout expiration
 func triggerSyncExpireEvent(t *Timer) uint8 {
-	// Find the TriggerSync instance that owns this timer
-	var ts *TriggerSync
-	for _, tsPtr := range triggerSyncs {
-		if tsPtr != nil && &tsPtr.ExpireTimer == t {
-			ts = tsPtr
-			break
-		}
-	}
+	ts := timerContainer[TriggerSync](t, unsafe.Offsetof(TriggerSync{}.ExpireTimer))
 
-	if ts == nil {
-		return SF_DONE
-	}
+	state := disableInterrupts()
+	defer restoreInterrupts(state)
 
 	// Trigger with expire reason
 	TriggerSyncDoTrigger(ts, ts.ExpireReason)
 
-	// Send final report
-	triggerSyncReport(ts)
+	// Have the final report sent
+	wakeTriggerSyncTask(ts)
 
 	return SF_DONE
 }
 
+// wakeTriggerSyncTask marks a report as pending for TriggerSyncTask
+func wakeTriggerSyncTask(ts *TriggerSync) {
+	state := disableInterrupts()
+	ts.Flags |= TSF_REPORT
+	restoreInterrupts(state)
+	triggerSyncWake.Wake()
+}
+
+// TriggerSyncTask mirrors Klipper's trsync_task: it sends the reports the
+// timers asked for from task context
+func TriggerSyncTask() {
+	if !triggerSyncWake.Check() {
+		return
+	}
+
+	for _, ts := range triggerSyncs {
+		if ts == nil {
+			continue
+		}
+		state := disableInterrupts()
+		pending := ts.Flags&TSF_REPORT != 0
+		ts.Flags &^= TSF_REPORT
+		restoreInterrupts(state)
+		if pending {
+			triggerSyncReport(ts)
+		}
+	}
+}
+
 // triggerSyncReport sends a status report to the host
 func triggerSyncReport(ts *TriggerSync) {
+	state := disableInterrupts()
 	canTrigger := uint32(0)
 	if (ts.Flags & TSF_CAN_TRIGGER) != 0 {
 		canTrigger = 1
 	}
+	reason := ts.TriggerReason
+	restoreInterrupts(state)
 
 	clock := GetTime()
 
@@ -271,13 +274,33 @@ func triggerSyncReport(ts *TriggerSync) {
 	SendResponse("trsync_state", func(output protocol.OutputBuffer) {
 		protocol.EncodeVLQUint(output, uint32(ts.OID))
 		protocol.EncodeVLQUint(output, canTrigger)
-		protocol.EncodeVLQUint(output, uint32(ts.TriggerReason))
+		protocol.EncodeVLQUint(output, uint32(reason))
 		protocol.EncodeVLQUint(output, clock)
 	})
 }
 
 // GetTriggerSync retrieves a trigger sync by OID
+// The MCU shuts down if the OID is not a trigger sync.
 func GetTriggerSync(oid uint8) (*TriggerSync, bool) {
+	if LookupOID(oid, OIDTriggerSync) != nil {
+		return nil, false
+	}
 	ts, exists := triggerSyncs[oid]
 	return ts, exists
 }
+
+// ShutdownAllTriggerSyncs disarms every trigger sync (called during shutdown)
+func ShutdownAllTriggerSyncs() {
+	for _, ts := range triggerSyncs {
+		if ts != nil {
+			ts.Flags &^= TSF_CAN_TRIGGER
+			CancelTimer(&ts.ReportTimer)
+			CancelTimer(&ts.ExpireTimer)
+		}
+	}
+}
+
+// releaseAllTriggerSyncs forgets every trigger sync (called on config reset)
+func releaseAllTriggerSyncs() {
+	clear(triggerSyncs)
+}
@@ -0,0 +1,171 @@
+package protocol
+
+import "errors"
+
+// CaptureKind identifies the direction of a captured frame
+type CaptureKind uint8
+
+const (
+	CaptureRx CaptureKind = 1 // Bytes received from the host, as they arrived
+	CaptureTx CaptureKind = 2 // Frame sent to the host (responses and ACK/NAKs)
+)
+
+// CaptureRecordMax is the most data one record holds
+const CaptureRecordMax = 0xFF
+
+// Capture file layout:
+//
+//	header: "GCAP" version(1)
+//	record: kind(1) seq(1) clock(4, little endian) len(1) frame(len)
+//
+// The ring buffer stores records in the same layout, so a snapshot is the
+// header followed by the ring contents oldest first.
+const (
+	captureMagic      = "GCAP"
+	CaptureVersion    = 1
+	captureHeaderSize = len(captureMagic) + 1
+	captureRecordHead = 7
+)
+
+var (
+	ErrCaptureMagic     = errors.New("not a capture file")
+	ErrCaptureVersion   = errors.New("unsupported capture version")
+	ErrCaptureTruncated = errors.New("truncated capture record")
+)
+
+// CaptureRecord is one captured frame, or a run of received bytes
+type CaptureRecord struct {
+	Kind  CaptureKind
+	Seq   uint8  // Transport's expected receive sequence (low 4 bits) when captured
+	Clock uint32 // MCU clock when captured
+
+	// Whole frame for Tx. For Rx, the bytes as received, including corrupt
+	// frames and garbage skipped while resynchronizing.
+	Frame []byte
+}
+
+// Capture is a fixed-size ring of captured frames. When the ring is full the
+// oldest records are discarded, so it always holds the most recent traffic.
+type Capture struct {
+	buf     []byte
+	start   int // Offset of the oldest record
+	used    int // Bytes in use
+	clock   func() uint32
+	dropped uint32 // Records discarded to make room
+}
+
+// NewCapture creates a capture ring of size bytes. clock supplies the MCU
+// clock stored with each record and may be nil.
+func NewCapture(size int, clock func() uint32) *Capture {
+	return &Capture{
+		buf:   make([]byte, size),
+		clock: clock,
+	}
+}
+
+// Record appends a frame to the ring
+func (c *Capture) Record(kind CaptureKind, seq uint8, frame []byte) {
+	n := captureRecordHead + len(frame)
+	if len(frame) > CaptureRecordMax || n > len(c.buf) {
+		c.dropped++
+		return
+	}
+
+	// Make room by discarding the oldest records
+	for len(c.buf)-c.used < n {
+		c.discardOldest()
+	}
+
+	var clock uint32
+	if c.clock != nil {
+		clock = c.clock()
+	}
+	head := [captureRecordHead]byte{
+		byte(kind),
+		seq & MessageSeqMask,
+		byte(clock),
+		byte(clock >> 8),
+		byte(clock >> 16),
+		byte(clock >> 24),
+		byte(len(frame)),
+	}
+	c.write(head[:])
+	c.write(frame)
+}
+
+// discardOldest removes the record at the start of the ring
+func (c *Capture) discardOldest() {
+	length := int(c.buf[(c.start+captureRecordHead-1)%len(c.buf)])
+	n := captureRecordHead + length
+	c.start = (c.start + n) % len(c.buf)
+	c.used -= n
+	c.dropped++
+}
+
+// write copies data to the end of the ring, wrapping as needed
+func (c *Capture) write(data []byte) {
+	pos := (c.start + c.used) % len(c.buf)
+	n := copy(c.buf[pos:], data)
+	copy(c.buf, data[n:])
+	c.used += len(data)
+}
+
+// Len returns the number of bytes of record data held in the ring
+func (c *Capture) Len() int {
+	return c.used
+}
+
+// Dropped returns the number of records discarded since the last Reset
+func (c *Capture) Dropped() uint32 {
+	return c.dropped
+}
+
+// Reset discards all records
+func (c *Capture) Reset() {
+	c.start = 0
+	c.used = 0
+	c.dropped = 0
+}
+
+// AppendSnapshot appends the capture in file format to dst
+func (c *Capture) AppendSnapshot(dst []byte) []byte {
+	dst = append(dst, captureMagic...)
+	dst = append(dst, CaptureVersion)
+	end := c.start + c.used
+	if end <= len(c.buf) {
+		return append(dst, c.buf[c.start:end]...)
+	}
+	dst = append(dst, c.buf[c.start:]...)
+	return append(dst, c.buf[:end-len(c.buf)]...)
+}
+
+// ParseCapture decodes a capture file. Records parsed before an error are
+// returned along with it, so a truncated file can still be inspected.
+func ParseCapture(data []byte) ([]CaptureRecord, error) {
+	if len(data) < captureHeaderSize || string(data[:len(captureMagic)]) != captureMagic {
+		return nil, ErrCaptureMagic
+	}
+	if data[len(captureMagic)] != CaptureVersion {
+		return nil, ErrCaptureVersion
+	}
+	data = data[captureHeaderSize:]
+
+	var records []CaptureRecord
+	for len(data) > 0 {
+		if len(data) < captureRecordHead {
+			return records, ErrCaptureTruncated
+		}
+		n := int(data[captureRecordHead-1])
+		if len(data) < captureRecordHead+n {
+			return records, ErrCaptureTruncated
+		}
+		records = append(records, CaptureRecord{
+			Kind:  CaptureKind(data[0]),
+			Seq:   data[1],
+			Clock: uint32(data[2]) | uint32(data[3])<<8 | uint32(data[4])<<16 | uint32(data[5])<<24,
+			Frame: data[captureRecordHead : captureRecordHead+n],
+		})
+		data = data[captureRecordHead+n:]
+	}
+	return records, nil
+}
@@ -0,0 +1,166 @@
+package protocol
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	clock := uint32(1000)
+	c := NewCapture(256, func() uint32 { return clock })
+
+	c.Record(CaptureRx, 0x11, []byte{1, 2, 3})
+	clock = 0x12345678
+	c.Record(CaptureTx, 0x02, []byte{4, 5})
+
+	records, err := ParseCapture(c.AppendSnapshot(nil))
+	if err != nil {
+		t.Fatalf("ParseCapture: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if r := records[0]; r.Kind != CaptureRx || r.Seq != 0x01 || r.Clock != 1000 || !bytes.Equal(r.Frame, []byte{1, 2, 3}) {
+		t.Errorf("record 0 = %+v", r)
+	}
+	if r := records[1]; r.Kind != CaptureTx || r.Seq != 0x02 || r.Clock != 0x12345678 || !bytes.Equal(r.Frame, []byte{4, 5}) {
+		t.Errorf("record 1 = %+v", r)
+	}
+}
+
+func TestCaptureRingDiscardsOldest(t *testing.T) {
+	// Room for three 10-byte records
+	c := NewCapture(3*(captureRecordHead+3), nil)
+	for i := 0; i < 5; i++ {
+		c.Record(CaptureRx, uint8(i), []byte{byte(i), byte(i), byte(i)})
+	}
+
+	records, err := ParseCapture(c.AppendSnapshot(nil))
+	if err != nil {
+		t.Fatalf("ParseCapture: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	for i, r := range records {
+		want := byte(i + 2)
+		if r.Seq != want || !bytes.Equal(r.Frame, []byte{want, want, want}) {
+			t.Errorf("record %d = %+v, want frame of %d", i, r, want)
+		}
+	}
+	if c.Dropped() != 2 {
+		t.Errorf("expected 2 dropped records, got %d", c.Dropped())
+	}
+}
+
+func TestCaptureWrappedRecords(t *testing.T) {
+	// Odd ring size so records straddle the end of the buffer
+	c := NewCapture(23, nil)
+	for i := 0; i < 7; i++ {
+		c.Record(CaptureTx, 0, []byte{byte(i), byte(i + 1), byte(i + 2), byte(i + 3)})
+	}
+
+	records, err := ParseCapture(c.AppendSnapshot(nil))
+	if err != nil {
+		t.Fatalf("ParseCapture: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if !bytes.Equal(records[1].Frame, []byte{6, 7, 8, 9}) {
+		t.Errorf("last record frame = %v", records[1].Frame)
+	}
+}
+
+func TestParseCaptureErrors(t *testing.T) {
+	if _, err := ParseCapture([]byte("nope!")); err != ErrCaptureMagic {
+		t.Errorf("expected ErrCaptureMagic, got %v", err)
+	}
+	if _, err := ParseCapture([]byte("GCAP\x09")); err != ErrCaptureVersion {
+		t.Errorf("expected ErrCaptureVersion, got %v", err)
+	}
+	records, err := ParseCapture([]byte("GCAP\x01\x01\x00\x00\x00\x00\x00\x01\xaa\x02\x00"))
+	if err != ErrCaptureTruncated || len(records) != 1 {
+		t.Errorf("expected 1 record and ErrCaptureTruncated, got %d, %v", len(records), err)
+	}
+}
+
+func TestTransportCapture(t *testing.T) {
+	output := NewScratchOutput()
+	transport := NewTransport(output, func(cmdID uint16, data *[]byte) error {
+		return nil
+	})
+	c := NewCapture(1024, nil)
+	transport.SetCapture(c)
+
+	// get_uptime-like message with command ID 5 and sequence 0x10
+	frame := []byte{6, 0x10, 5}
+	crc := CRC16(frame)
+	frame = append(frame, byte(crc>>8), byte(crc), MessageValueSync)
+	transport.Receive(NewSliceInputBuffer(frame))
+	transport.SendCommand(7, nil)
+
+	records, err := ParseCapture(c.AppendSnapshot(nil))
+	if err != nil {
+		t.Fatalf("ParseCapture: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected rx, ack and response records, got %d", len(records))
+	}
+	if records[0].Kind != CaptureRx || !bytes.Equal(records[0].Frame, frame) || records[0].Seq != 0 {
+		t.Errorf("rx record = %+v", records[0])
+	}
+	if records[1].Kind != CaptureTx || len(records[1].Frame) != MessageLengthMin || records[1].Seq != 1 {
+		t.Errorf("ack record = %+v", records[1])
+	}
+	if records[2].Kind != CaptureTx || !bytes.Equal(records[2].Frame, output.Result()[MessageLengthMin:]) {
+		t.Errorf("response record = %+v, output %v", records[2], output.Result())
+	}
+}
+
+// TestTransportCapturesRawInput checks that the capture holds every received
+// byte, corrupt frames included, and that replaying the Rx records in order
+// reproduces the transport's output
+func TestTransportCapturesRawInput(t *testing.T) {
+	bad := testFrame(0, []byte{9})
+	bad[len(bad)-2] ^= 0xFF // Corrupt the CRC
+	var input []byte
+	input = append(input, 0x01, 0x02, MessageValueSync) // Line noise
+	input = append(input, bad...)
+	input = append(input, testFrame(0, []byte{1, 2})...)
+	input = append(input, testFrame(1, []byte{3})...)
+
+	h := newTransportHarness(t)
+	c := NewCapture(1024, nil)
+	h.transport.SetCapture(c)
+	splitFeed(h, input, []byte{2, 6, 1, 30})
+
+	records, err := ParseCapture(c.AppendSnapshot(nil))
+	if err != nil {
+		t.Fatalf("ParseCapture: %v", err)
+	}
+	var rx, tx []byte
+	replay := newTransportHarness(t)
+	for _, r := range records {
+		switch r.Kind {
+		case CaptureRx:
+			rx = append(rx, r.Frame...)
+			replay.feed(r.Frame)
+		case CaptureTx:
+			tx = append(tx, r.Frame...)
+			if !bytes.HasPrefix(replay.out.data, tx) {
+				t.Fatalf("Tx record % x captured before the input that caused it", r.Frame)
+			}
+		}
+	}
+	if !bytes.Equal(rx, input) {
+		t.Errorf("captured input % x, want % x", rx, input)
+	}
+	if !bytes.Equal(tx, h.out.data) || !bytes.Equal(replay.out.data, h.out.data) {
+		t.Errorf("replayed output % x, captured % x, sent % x", replay.out.data, tx, h.out.data)
+	}
+	if !slices.Equal(replay.cmds, h.cmds) || !slices.Equal(h.cmds, []uint16{1, 2, 3}) {
+		t.Errorf("replayed commands %v, original %v", replay.cmds, h.cmds)
+	}
+}
@@ -0,0 +1,126 @@
+package protocol
+
+import "errors"
+
+// ErrInvalidFormat is returned when a message format string cannot be parsed
+var ErrInvalidFormat = errors.New("invalid message format")
+
+// ParamType identifies how a message parameter is encoded on the wire
+type ParamType uint8
+
+const (
+	ParamUint32        ParamType = iota // %u
+	ParamInt32                          // %i
+	ParamUint16                         // %hu
+	ParamInt16                          // %hi
+	ParamByte                           // %c
+	ParamString                         // %s
+	ParamBuffer                         // %*s
+	ParamProgmemBuffer                  // %.*s
+)
+
+// Param describes one "name=%x" parameter of a message format
+type Param struct {
+	Name string
+	Type ParamType
+}
+
+// IsBuffer reports whether the parameter is length-prefixed data
+func (t ParamType) IsBuffer() bool {
+	return t >= ParamString
+}
+
+// IsSigned reports whether the parameter is a signed integer
+func (t ParamType) IsSigned() bool {
+	return t == ParamInt32 || t == ParamInt16
+}
+
+// String returns the printf-style conversion for the parameter type
+func (t ParamType) String() string {
+	switch t {
+	case ParamUint32:
+		return "%u"
+	case ParamInt32:
+		return "%i"
+	case ParamUint16:
+		return "%hu"
+	case ParamInt16:
+		return "%hi"
+	case ParamByte:
+		return "%c"
+	case ParamString:
+		return "%s"
+	case ParamBuffer:
+		return "%*s"
+	case ParamProgmemBuffer:
+		return "%.*s"
+	}
+	return "%?"
+}
+
+// parseParamType converts a printf-style conversion to a ParamType
+func parseParamType(conv string) (ParamType, bool) {
+	switch conv {
+	case "%u":
+		return ParamUint32, true
+	case "%i":
+		return ParamInt32, true
+	case "%hu":
+		return ParamUint16, true
+	case "%hi":
+		return ParamInt16, true
+	case "%c":
+		return ParamByte, true
+	case "%s":
+		return ParamString, true
+	case "%*s":
+		return ParamBuffer, true
+	case "%.*s":
+		return ParamProgmemBuffer, true
+	}
+	return 0, false
+}
+
+// ParseFormat parses the parameter part of a message format
+// e.g. "oid=%c interval=%u count=%hu add=%hi" (without the message name)
+func ParseFormat(format string) ([]Param, error) {
+	var params []Param
+	for len(format) > 0 {
+		// Skip separating spaces
+		if format[0] == ' ' {
+			format = format[1:]
+			continue
+		}
+
+		// Take the next "name=%x" token
+		end := 0
+		for end < len(format) && format[end] != ' ' {
+			end++
+		}
+		token := format[:end]
+		format = format[end:]
+
+		eq := -1
+		for i := 0; i < len(token); i++ {
+			if token[i] == '=' {
+				eq = i
+				break
+			}
+		}
+		if eq <= 0 {
+			return nil, ErrInvalidFormat
+		}
+		typ, ok := parseParamType(token[eq+1:])
+		if !ok {
+			return nil, ErrInvalidFormat
+		}
+		name := token[:eq]
+		for _, p := range params {
+			if p.Name == name {
+				return nil, ErrInvalidFormat
+			}
+		}
+		params = append(params, Param{Name: name, Type: typ})
+	}
+	return params, nil
+}
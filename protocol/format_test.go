@@ -0,0 +1,56 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	params, err := ParseFormat("oid=%c interval=%u count=%hu add=%hi pos=%i data=%*s msg=%s buf=%.*s")
+	if err != nil {
+		t.Fatalf("Failed to parse format: %v", err)
+	}
+
+	expected := []Param{
+		{"oid", ParamByte},
+		{"interval", ParamUint32},
+		{"count", ParamUint16},
+		{"add", ParamInt16},
+		{"pos", ParamInt32},
+		{"data", ParamBuffer},
+		{"msg", ParamString},
+		{"buf", ParamProgmemBuffer},
+	}
+	if len(params) != len(expected) {
+		t.Fatalf("Expected %d params, got %d", len(expected), len(params))
+	}
+	for i, p := range params {
+		if p != expected[i] {
+			t.Errorf("Param %d: expected %v, got %v", i, expected[i], p)
+		}
+	}
+}
+
+func TestParseFormatEmpty(t *testing.T) {
+	params, err := ParseFormat("")
+	if err != nil {
+		t.Errorf("Expected no error for empty format, got %v", err)
+	}
+	if len(params) != 0 {
+		t.Errorf("Expected no params, got %d", len(params))
+	}
+}
+
+func TestParseFormatInvalid(t *testing.T) {
+	invalid := []string{
+		"oid",           // missing conversion
+		"=%c",           // missing name
+		"oid=%d",        // unsupported conversion
+		"oid=%c oid=%u", // duplicate name
+		"oid=%c count",  // trailing garbage
+	}
+	for _, format := range invalid {
+		if _, err := ParseFormat(format); err != ErrInvalidFormat {
+			t.Errorf("Expected ErrInvalidFormat for %q, got %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopper/protocol"
+)
+
+var (
+	ErrTimeout       = errors.New("timeout waiting for MCU")
+	ErrClosed        = errors.New("client closed")
+	ErrFrameTooLarge = errors.New("command does not fit in one frame")
+)
+
+const (
+	// identifyChunk is the number of dictionary bytes requested per identify
+	identifyChunk = 40
+
+	// maxBacklog bounds the number of unclaimed messages kept for WaitFor
+	maxBacklog = 1024
+)
+
+// Client talks to an MCU over a byte stream (serial port, pseudo-terminal,
+// pipe). Commands are sent one frame at a time and retransmitted until the
+// MCU acknowledges them; received responses are queued for WaitFor.
+type Client struct {
+	// Timeout bounds each wait for an acknowledgement or response
+	Timeout time.Duration
+	// Retries is the number of retransmissions before Send gives up
+	Retries int
+
+	rw io.ReadWriter
+
+	dictMu sync.RWMutex
+	dict   *Dictionary
+
+	sendMu sync.Mutex
+	seq    uint8 // Sequence number of the next frame to send (0-15)
+	acks   chan uint8
+
+	msgMu   sync.Mutex
+	backlog []*Message
+	notify  chan struct{} // Closed and replaced whenever a message arrives
+	err     error         // Reader error, reported by WaitFor
+	done    chan struct{}
+}
+
+// Open opens a serial device or pseudo-terminal in raw mode and starts a client
+func Open(path string) (*Client, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := MakeRaw(f.Fd()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return NewClient(f), nil
+}
+
+// NewClient starts a client on an already open stream
+func NewClient(rw io.ReadWriter) *Client {
+	c := &Client{
+		Timeout: time.Second,
+		Retries: 5,
+		rw:      rw,
+		dict:    bootstrapDictionary(),
+		acks:    make(chan uint8, 16),
+		notify:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Close closes the underlying stream if it is closable
+func (c *Client) Close() error {
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Dictionary returns the current dictionary (only identify before Identify)
+func (c *Client) Dictionary() *Dictionary {
+	c.dictMu.RLock()
+	defer c.dictMu.RUnlock()
+	return c.dict
+}
+
+// Identify downloads and parses the MCU data dictionary
+func (c *Client) Identify() (*Dictionary, error) {
+	var data []byte
+	for {
+		offset := len(data)
+		err := c.Send("identify", Params{"offset": offset, "count": identifyChunk})
+		if err != nil {
+			return nil, err
+		}
+		msg, err := c.WaitFor("identify_response")
+		if err != nil {
+			return nil, err
+		}
+		if msg.Int("offset") != int64(offset) {
+			return nil, fmt.Errorf("identify: asked for offset %d, got %d", offset, msg.Int("offset"))
+		}
+		chunk := msg.Bytes("data")
+		if len(chunk) == 0 {
+			break
+		}
+		data = append(data, chunk...)
+	}
+
+	dict, err := ParseDictionary(data)
+	if err != nil {
+		return nil, fmt.Errorf("identify: %v", err)
+	}
+	c.dictMu.Lock()
+	c.dict = dict
+	c.dictMu.Unlock()
+	return dict, nil
+}
+
+// Send encodes a command from the dictionary and sends it, waiting for the
+// MCU to acknowledge the frame
+func (c *Client) Send(name string, params Params) error {
+	payload, err := c.Dictionary().EncodeCommand(name, params)
+	if err != nil {
+		return err
+	}
+	return c.SendRaw(payload)
+}
+
+// Query sends a command and waits for the named response
+func (c *Client) Query(name string, params Params, response string) (*Message, error) {
+	if err := c.Send(name, params); err != nil {
+		return nil, err
+	}
+	return c.WaitFor(response)
+}
+
+// SendRaw sends already encoded messages as a single frame
+func (c *Client) SendRaw(payload []byte) error {
+	if len(payload)+protocol.MessageLengthMin > protocol.MessageLengthMax {
+		return ErrFrameTooLarge
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	frame := EncodeFrame(c.seq, payload)
+	next := (c.seq + 1) & protocol.MessageSeqMask
+
+	// Drop acknowledgements left over from earlier frames
+	for len(c.acks) > 0 {
+		<-c.acks
+	}
+
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err := c.rw.Write(frame); err != nil {
+			return err
+		}
+		deadline := time.After(c.Timeout)
+	wait:
+		for {
+			select {
+			case seq := <-c.acks:
+				if seq == next {
+					c.seq = next
+					return nil
+				}
+				// The MCU still expects an older sequence (NAK) - retransmit
+				break wait
+			case <-deadline:
+				break wait
+			case <-c.done:
+				return c.readErr()
+			}
+		}
+	}
+	return ErrTimeout
+}
+
+// WaitFor returns the oldest unclaimed response with the given name,
+// waiting up to Timeout for one to arrive
+func (c *Client) WaitFor(name string) (*Message, error) {
+	deadline := time.After(c.Timeout)
+	for {
+		c.msgMu.Lock()
+		for i, msg := range c.backlog {
+			if msg.Name == name {
+				c.backlog = append(c.backlog[:i], c.backlog[i+1:]...)
+				c.msgMu.Unlock()
+				return msg, nil
+			}
+		}
+		notify := c.notify
+		c.msgMu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return nil, ErrTimeout
+		case <-c.done:
+			return nil, c.readErr()
+		}
+	}
+}
+
+// readErr returns the error that stopped the reader
+func (c *Client) readErr() error {
+	c.msgMu.Lock()
+	defer c.msgMu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return ErrClosed
+}
+
+// readLoop reads frames from the stream until it fails
+func (c *Client) readLoop() {
+	var dec FrameDecoder
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.rw.Read(buf)
+		if n > 0 {
+			for _, f := range dec.Feed(buf[:n]) {
+				c.handleFrame(f)
+			}
+		}
+		if err != nil {
+			c.msgMu.Lock()
+			c.err = err
+			c.msgMu.Unlock()
+			close(c.done)
+			return
+		}
+	}
+}
+
+// handleFrame records the acknowledged sequence and queues decoded messages
+func (c *Client) handleFrame(f Frame) {
+	if f.Err != nil {
+		return
+	}
+	select {
+	case c.acks <- f.Seq:
+	default:
+	}
+	if len(f.Payload) == 0 {
+		return
+	}
+
+	msgs, _ := c.Dictionary().DecodeResponses(f.Payload)
+	if len(msgs) == 0 {
+		return
+	}
+	c.msgMu.Lock()
+	c.backlog = append(c.backlog, msgs...)
+	if len(c.backlog) > maxBacklog {
+		c.backlog = c.backlog[len(c.backlog)-maxBacklog:]
+	}
+	close(c.notify)
+	c.notify = make(chan struct{})
+	c.msgMu.Unlock()
+}
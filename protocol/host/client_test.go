@@ -0,0 +1,217 @@
+package host
+
+import (
+	"bytes"
+	"compress/zlib"
+	"net"
+	"testing"
+	"time"
+
+	"gopper/protocol"
+)
+
+const testDictionary = `{"version":"test","build_versions":"go",` +
+	`"config":{"CLOCK_FREQ":"1000000","MCU":"test"},` +
+	`"commands":{"identify offset=%u count=%c":1,"config_stepper oid=%c step_pin=%c":2,` +
+	`"queue_step oid=%c interval=%u count=%hu add=%hi":3,"stepper_get_position oid=%c":4},` +
+	`"responses":{"identify_response offset=%u data=%*s":0,"stepper_position oid=%c pos=%i":5},` +
+	`"enumerations":{"pin":{"gpio0":[0,4],"ADC0":10}}}`
+
+// fakeMCU answers identify and tracks a stepper position from queue_step
+type fakeMCU struct {
+	conn      net.Conn
+	dict      []byte
+	output    *protocol.ScratchOutput
+	transport *protocol.Transport
+	position  int32
+	stepPin   uint32
+}
+
+func newFakeMCU(t *testing.T, conn net.Conn) *fakeMCU {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(testDictionary))
+	zw.Close()
+
+	m := &fakeMCU{conn: conn, dict: buf.Bytes(), output: protocol.NewScratchOutput()}
+	m.transport = protocol.NewTransport(m.output, m.handle)
+	go m.run()
+	return m
+}
+
+func (m *fakeMCU) run() {
+	var pending []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := m.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+		input := protocol.NewSliceInputBuffer(pending)
+		m.transport.Receive(input)
+		pending = append([]byte(nil), input.Data()...)
+		if out := m.output.Result(); len(out) > 0 {
+			data := append([]byte(nil), out...)
+			m.output.Reset()
+			if _, err := m.conn.Write(data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *fakeMCU) handle(cmdID uint16, data *[]byte) error {
+	switch cmdID {
+	case 1: // identify
+		offset, _ := protocol.DecodeVLQUint(data)
+		count, _ := protocol.DecodeVLQUint(data)
+		end := int(offset) + int(count)
+		if end > len(m.dict) {
+			end = len(m.dict)
+		}
+		chunk := m.dict[min(int(offset), end):end]
+		m.transport.SendCommand(0, func(out protocol.OutputBuffer) {
+			protocol.EncodeVLQUint(out, offset)
+			protocol.EncodeVLQBytes(out, chunk)
+		})
+	case 2: // config_stepper
+		protocol.DecodeVLQUint(data)
+		m.stepPin, _ = protocol.DecodeVLQUint(data)
+	case 3: // queue_step
+		protocol.DecodeVLQUint(data)
+		protocol.DecodeVLQUint(data)
+		count, _ := protocol.DecodeVLQUint(data)
+		protocol.DecodeVLQInt(data)
+		m.position += int32(count)
+	case 4: // stepper_get_position
+		oid, _ := protocol.DecodeVLQUint(data)
+		m.transport.SendCommand(5, func(out protocol.OutputBuffer) {
+			protocol.EncodeVLQUint(out, oid)
+			protocol.EncodeVLQInt(out, m.position)
+		})
+	}
+	return nil
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeMCU) {
+	hostConn, mcuConn := net.Pipe()
+	mcu := newFakeMCU(t, mcuConn)
+	c := NewClient(hostConn)
+	c.Timeout = 2 * time.Second
+	t.Cleanup(func() {
+		hostConn.Close()
+		mcuConn.Close()
+	})
+	return c, mcu
+}
+
+func TestClientIdentify(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	dict, err := c.Identify()
+	if err != nil {
+		t.Fatalf("Identify failed: %v", err)
+	}
+	if dict.Version != "test" {
+		t.Errorf("Expected version test, got %q", dict.Version)
+	}
+	if freq, err := dict.ConstantInt("CLOCK_FREQ"); err != nil || freq != 1000000 {
+		t.Errorf("Expected CLOCK_FREQ 1000000, got %d (%v)", freq, err)
+	}
+	if mf, ok := dict.Command("queue_step"); !ok || mf.ID != 3 || len(mf.Params) != 4 {
+		t.Errorf("queue_step not parsed correctly: %+v", mf)
+	}
+	if dict.Enumerations["pin"]["gpio3"] != 3 || dict.Enumerations["pin"]["ADC0"] != 10 {
+		t.Errorf("Pin enumeration not parsed correctly: %v", dict.Enumerations["pin"])
+	}
+}
+
+func TestClientSendAndWaitFor(t *testing.T) {
+	c, mcu := newTestClient(t)
+	if _, err := c.Identify(); err != nil {
+		t.Fatalf("Identify failed: %v", err)
+	}
+
+	if err := c.Send("config_stepper", Params{"oid": 0, "step_pin": "gpio2"}); err != nil {
+		t.Fatalf("config_stepper failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		err := c.Send("queue_step", Params{"oid": 0, "interval": 1200, "count": 40, "add": -2})
+		if err != nil {
+			t.Fatalf("queue_step failed: %v", err)
+		}
+	}
+	if err := c.Send("stepper_get_position", Params{"oid": 0}); err != nil {
+		t.Fatalf("stepper_get_position failed: %v", err)
+	}
+	msg, err := c.WaitFor("stepper_position")
+	if err != nil {
+		t.Fatalf("WaitFor failed: %v", err)
+	}
+	if msg.Int("pos") != 120 {
+		t.Errorf("Expected position 120, got %d", msg.Int("pos"))
+	}
+	if msg.String() != "stepper_position oid=0 pos=120" {
+		t.Errorf("Unexpected message string %q", msg.String())
+	}
+	if mcu.stepPin != 2 {
+		t.Errorf("Expected step pin 2 from enumeration, got %d", mcu.stepPin)
+	}
+}
+
+func TestClientEncodeErrors(t *testing.T) {
+	c, _ := newTestClient(t)
+	if _, err := c.Identify(); err != nil {
+		t.Fatalf("Identify failed: %v", err)
+	}
+
+	if err := c.Send("no_such_command", nil); err == nil {
+		t.Error("Expected error for unknown command")
+	}
+	if err := c.Send("queue_step", Params{"oid": 0}); err == nil {
+		t.Error("Expected error for missing parameters")
+	}
+	if err := c.Send("stepper_get_position", Params{"oid": 0, "extra": 1}); err == nil {
+		t.Error("Expected error for unknown parameter")
+	}
+	if err := c.Send("config_stepper", Params{"oid": 0, "step_pin": "gpio99"}); err == nil {
+		t.Error("Expected error for unknown pin name")
+	}
+}
+
+func TestFrameDecoderResync(t *testing.T) {
+	good := EncodeFrame(1, []byte{5, 0, 1})
+	good2 := EncodeFrame(3, []byte{5, 0, 3})
+	bad := EncodeFrame(2, []byte{5, 0, 2})
+	bad[3] ^= 0xFF // Corrupt the payload
+
+	var stream []byte
+	stream = append(stream, bad...)
+	stream = append(stream, good...)
+	stream = append(stream, 0x01, 0x02, protocol.MessageValueSync) // Garbage
+	stream = append(stream, good2...)
+
+	var dec FrameDecoder
+	var frames []Frame
+	// Feed one byte at a time to exercise partial frames
+	for _, b := range stream {
+		frames = append(frames, dec.Feed([]byte{b})...)
+	}
+
+	if len(frames) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(frames))
+	}
+	if frames[0].Err != ErrBadCRC {
+		t.Errorf("Expected ErrBadCRC, got %v", frames[0].Err)
+	}
+	if frames[1].Err != nil || frames[1].Seq != 1 || !bytes.Equal(frames[1].Payload, []byte{5, 0, 1}) {
+		t.Errorf("Expected valid frame after bad CRC, got %+v", frames[1])
+	}
+	if frames[2].Err != ErrBadLength {
+		t.Errorf("Expected ErrBadLength for garbage, got %v", frames[2].Err)
+	}
+	if frames[3].Err != nil || frames[3].Seq != 3 || frames[3].Skipped != 2 {
+		t.Errorf("Expected valid frame after resync with 2 skipped bytes, got %+v", frames[3])
+	}
+}
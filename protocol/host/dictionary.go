@@ -0,0 +1,258 @@
+// Package host implements the host side of the Klipper protocol: framing,
+// the identify handshake, and dictionary-driven message encoding/decoding.
+// It is meant for regular Go tools and tests, not for TinyGo firmware.
+package host
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopper/protocol"
+)
+
+// MessageFormat describes one command or response from the dictionary
+type MessageFormat struct {
+	ID     int
+	Name   string
+	Format string // Full format, e.g. "queue_step oid=%c interval=%u count=%hu add=%hi"
+	Params []protocol.Param
+}
+
+// Dictionary is a parsed MCU data dictionary
+type Dictionary struct {
+	Version       string
+	BuildVersions string
+	Config        map[string]string
+	Enumerations  map[string]map[string]int
+	StaticStrings map[int]string
+
+	commands      map[string]*MessageFormat
+	responses     map[string]*MessageFormat
+	commandsByID  map[int]*MessageFormat
+	responsesByID map[int]*MessageFormat
+}
+
+// rawDictionary mirrors the JSON layout of the data dictionary
+type rawDictionary struct {
+	Version       string                                `json:"version"`
+	BuildVersions string                                `json:"build_versions"`
+	Config        map[string]json.RawMessage            `json:"config"`
+	Commands      map[string]int                        `json:"commands"`
+	Responses     map[string]int                        `json:"responses"`
+	Enumerations  map[string]map[string]json.RawMessage `json:"enumerations"`
+	StaticStrings map[string]string                     `json:"static_strings"`
+}
+
+// newDictionary creates an empty dictionary
+func newDictionary() *Dictionary {
+	return &Dictionary{
+		Config:        make(map[string]string),
+		Enumerations:  make(map[string]map[string]int),
+		StaticStrings: make(map[int]string),
+		commands:      make(map[string]*MessageFormat),
+		responses:     make(map[string]*MessageFormat),
+		commandsByID:  make(map[int]*MessageFormat),
+		responsesByID: make(map[int]*MessageFormat),
+	}
+}
+
+// bootstrapDictionary knows only the messages needed to run identify
+// Their IDs are fixed by the protocol
+func bootstrapDictionary() *Dictionary {
+	d := newDictionary()
+	d.addMessage("identify offset=%u count=%c", 1, true)
+	d.addMessage("identify_response offset=%u data=%.*s", 0, false)
+	return d
+}
+
+// ParseDictionary parses a dictionary, either zlib-compressed (as sent by
+// the MCU) or plain JSON
+func ParseDictionary(data []byte) (*Dictionary, error) {
+	if len(data) > 0 && data[0] != '{' {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var raw rawDictionary
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	d := newDictionary()
+	d.Version = raw.Version
+	d.BuildVersions = raw.BuildVersions
+	for name, value := range raw.Config {
+		d.Config[name] = rawValueString(value)
+	}
+	for format, id := range raw.Commands {
+		if err := d.addMessage(format, id, true); err != nil {
+			return nil, err
+		}
+	}
+	for format, id := range raw.Responses {
+		if err := d.addMessage(format, id, false); err != nil {
+			return nil, err
+		}
+	}
+	for name, values := range raw.Enumerations {
+		enum := make(map[string]int)
+		for key, value := range values {
+			if err := addEnumValue(enum, key, value); err != nil {
+				return nil, fmt.Errorf("enumeration %s: %v", name, err)
+			}
+		}
+		d.Enumerations[name] = enum
+	}
+	for id, str := range raw.StaticStrings {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("static string id %q: %v", id, err)
+		}
+		d.StaticStrings[n] = str
+	}
+	return d, nil
+}
+
+// addMessage parses a "name params..." format and adds it to the dictionary
+func (d *Dictionary) addMessage(format string, id int, isCommand bool) error {
+	name, paramFormat, _ := strings.Cut(format, " ")
+	params, err := protocol.ParseFormat(paramFormat)
+	if err != nil {
+		return fmt.Errorf("message %q: %v", format, err)
+	}
+	mf := &MessageFormat{ID: id, Name: name, Format: format, Params: params}
+	if isCommand {
+		d.commands[name] = mf
+		d.commandsByID[id] = mf
+	} else {
+		d.responses[name] = mf
+		d.responsesByID[id] = mf
+	}
+	return nil
+}
+
+// rawValueString converts a JSON config value to its string form
+func rawValueString(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
+
+// addEnumValue adds "name": index or a Klipper range "name0": [start, count]
+func addEnumValue(enum map[string]int, key string, value json.RawMessage) error {
+	var index int
+	if err := json.Unmarshal(value, &index); err == nil {
+		enum[key] = index
+		return nil
+	}
+	var rng [2]int
+	if err := json.Unmarshal(value, &rng); err != nil {
+		return fmt.Errorf("bad value for %q", key)
+	}
+	// Ranges expand a trailing number: "gpio0": [0, 30] -> gpio0..gpio29
+	prefix := strings.TrimRight(key, "0123456789")
+	first, err := strconv.Atoi(key[len(prefix):])
+	if err != nil {
+		return fmt.Errorf("bad range key %q", key)
+	}
+	for i := 0; i < rng[1]; i++ {
+		enum[prefix+strconv.Itoa(first+i)] = rng[0] + i
+	}
+	return nil
+}
+
+// Command returns the format of a command by name
+func (d *Dictionary) Command(name string) (*MessageFormat, bool) {
+	mf, ok := d.commands[name]
+	return mf, ok
+}
+
+// Response returns the format of a response by name
+func (d *Dictionary) Response(name string) (*MessageFormat, bool) {
+	mf, ok := d.responses[name]
+	return mf, ok
+}
+
+// CommandByID returns the format of a command by ID
+func (d *Dictionary) CommandByID(id int) (*MessageFormat, bool) {
+	mf, ok := d.commandsByID[id]
+	return mf, ok
+}
+
+// ResponseByID returns the format of a response by ID
+func (d *Dictionary) ResponseByID(id int) (*MessageFormat, bool) {
+	mf, ok := d.responsesByID[id]
+	return mf, ok
+}
+
+// Commands returns all command formats sorted by ID
+func (d *Dictionary) Commands() []*MessageFormat {
+	return sortedByID(d.commandsByID)
+}
+
+// Responses returns all response formats sorted by ID
+func (d *Dictionary) Responses() []*MessageFormat {
+	return sortedByID(d.responsesByID)
+}
+
+func sortedByID(m map[int]*MessageFormat) []*MessageFormat {
+	list := make([]*MessageFormat, 0, len(m))
+	for _, mf := range m {
+		list = append(list, mf)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Constant returns a config constant as a string
+func (d *Dictionary) Constant(name string) (string, bool) {
+	v, ok := d.Config[name]
+	return v, ok
+}
+
+// ConstantInt returns a config constant as an integer
+func (d *Dictionary) ConstantInt(name string) (int64, error) {
+	v, ok := d.Config[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown constant %q", name)
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// errUnknownEnum is returned for symbolic values missing from the dictionary
+var errUnknownEnum = errors.New("unknown enumeration value")
+
+// enumValue looks up a symbolic value for a parameter
+// Parameters named "pin" or "*_pin" use the "pin" enumeration
+func (d *Dictionary) enumValue(param, value string) (int64, error) {
+	enumName := param
+	if i := strings.LastIndexByte(param, '_'); i >= 0 {
+		if _, ok := d.Enumerations[param]; !ok {
+			enumName = param[i+1:]
+		}
+	}
+	enum, ok := d.Enumerations[enumName]
+	if !ok {
+		return 0, fmt.Errorf("%w: no enumeration for %s", errUnknownEnum, param)
+	}
+	v, ok := enum[value]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s=%s", errUnknownEnum, param, value)
+	}
+	return int64(v), nil
+}
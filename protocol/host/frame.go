@@ -0,0 +1,136 @@
+package host
+
+import (
+	"errors"
+
+	"gopper/protocol"
+)
+
+var (
+	ErrBadLength = errors.New("invalid frame length")
+	ErrBadSeq    = errors.New("invalid sequence byte")
+	ErrBadSync   = errors.New("missing trailing sync byte")
+	ErrBadCRC    = errors.New("CRC mismatch")
+)
+
+// Frame is one message block read from the stream
+type Frame struct {
+	Seq     uint8  // Sequence number (low 4 bits of the header byte)
+	Payload []byte // Messages between header and trailer
+	Raw     []byte // Whole frame as received
+	Skipped int    // Bytes discarded while resynchronizing before this frame
+	Err     error  // Set when the frame failed validation
+}
+
+// EncodeFrame builds a frame around a payload
+func EncodeFrame(seq uint8, payload []byte) []byte {
+	n := len(payload) + protocol.MessageLengthMin
+	frame := make([]byte, 0, n)
+	frame = append(frame, byte(n), protocol.MessageDest|(seq&protocol.MessageSeqMask))
+	frame = append(frame, payload...)
+	crc := protocol.CRC16(frame)
+	return append(frame, byte(crc>>8), byte(crc), protocol.MessageValueSync)
+}
+
+// FrameDecoder splits a byte stream into frames, resynchronizing on the
+// sync byte after errors the same way the firmware's Transport does
+type FrameDecoder struct {
+	buf      []byte
+	unsynced bool
+	skipped  int
+}
+
+// Feed adds data and returns every complete frame (valid or not)
+func (d *FrameDecoder) Feed(data []byte) []Frame {
+	d.buf = append(d.buf, data...)
+	var frames []Frame
+	for len(d.buf) > 0 {
+		if d.unsynced {
+			pos := -1
+			for i, b := range d.buf {
+				if b == protocol.MessageValueSync {
+					pos = i
+					break
+				}
+			}
+			if pos < 0 {
+				d.skipped += len(d.buf)
+				d.buf = d.buf[:0]
+				break
+			}
+			d.skipped += pos + 1
+			d.buf = d.buf[pos+1:]
+			d.unsynced = false
+			continue
+		}
+
+		// Sync bytes between frames are allowed
+		if d.buf[0] == protocol.MessageValueSync {
+			d.buf = d.buf[1:]
+			continue
+		}
+		if len(d.buf) < protocol.MessageLengthMin {
+			break
+		}
+
+		n := int(d.buf[protocol.MessagePositionLen])
+		if n < protocol.MessageLengthMin || n > protocol.MessageLengthMax {
+			frames = append(frames, d.fail(1, ErrBadLength))
+			continue
+		}
+		if d.buf[protocol.MessagePositionSeq]&^protocol.MessageSeqMask != protocol.MessageDest {
+			frames = append(frames, d.fail(2, ErrBadSeq))
+			continue
+		}
+		if len(d.buf) < n {
+			break
+		}
+		if d.buf[n-protocol.MessageTrailerSync] != protocol.MessageValueSync {
+			frames = append(frames, d.fail(n, ErrBadSync))
+			continue
+		}
+		crc := uint16(d.buf[n-protocol.MessageTrailerCRC])<<8 | uint16(d.buf[n-protocol.MessageTrailerCRC+1])
+		if crc != protocol.CRC16(d.buf[:n-protocol.MessageTrailerSize]) {
+			frames = append(frames, d.fail(n, ErrBadCRC))
+			continue
+		}
+
+		raw := append([]byte(nil), d.buf[:n]...)
+		frames = append(frames, Frame{
+			Seq:     raw[protocol.MessagePositionSeq] & protocol.MessageSeqMask,
+			Payload: raw[protocol.MessageHeaderSize : n-protocol.MessageTrailerSize],
+			Raw:     raw,
+			Skipped: d.takeSkipped(),
+		})
+		d.buf = d.buf[n:]
+	}
+	return frames
+}
+
+// fail reports an invalid frame and drops out of sync
+// The bytes are left in the buffer so resync can find a sync byte inside
+// them; they are not counted again as skipped
+func (d *FrameDecoder) fail(n int, err error) Frame {
+	if n > len(d.buf) {
+		n = len(d.buf)
+	}
+	f := Frame{
+		Seq:     d.buf[protocol.MessagePositionSeq] & protocol.MessageSeqMask,
+		Raw:     append([]byte(nil), d.buf[:n]...),
+		Skipped: d.takeSkipped(),
+		Err:     err,
+	}
+	d.skipped = -n
+	d.unsynced = true
+	return f
+}
+
+// takeSkipped returns and clears the resync byte count
+func (d *FrameDecoder) takeSkipped() int {
+	n := d.skipped
+	d.skipped = 0
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
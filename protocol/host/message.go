@@ -0,0 +1,223 @@
+package host
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopper/protocol"
+)
+
+// Params holds message parameters by name
+// Integer parameters accept any Go integer type (or a string naming an
+// enumeration value, e.g. "gpio5"); buffer parameters accept []byte or string.
+// Decoded integers are int64 and decoded buffers are []byte.
+type Params map[string]interface{}
+
+// Message is a decoded command or response
+type Message struct {
+	Name   string
+	Format *MessageFormat
+	Params Params
+}
+
+// Int returns an integer parameter (0 if missing)
+func (m *Message) Int(name string) int64 {
+	v, _ := m.Params[name].(int64)
+	return v
+}
+
+// Bytes returns a buffer parameter (nil if missing)
+func (m *Message) Bytes(name string) []byte {
+	v, _ := m.Params[name].([]byte)
+	return v
+}
+
+// String formats the message like "queue_step oid=3 interval=1200 count=40 add=-2"
+func (m *Message) String() string {
+	var sb strings.Builder
+	sb.WriteString(m.Name)
+	if m.Format == nil {
+		return sb.String()
+	}
+	for _, p := range m.Format.Params {
+		sb.WriteByte(' ')
+		sb.WriteString(p.Name)
+		sb.WriteByte('=')
+		switch v := m.Params[p.Name].(type) {
+		case int64:
+			sb.WriteString(strconv.FormatInt(v, 10))
+		case []byte:
+			sb.WriteString(strconv.Quote(string(v)))
+		}
+	}
+	return sb.String()
+}
+
+// byteBuffer implements protocol.OutputBuffer on a growable slice
+type byteBuffer struct {
+	data []byte
+}
+
+func (b *byteBuffer) Output(data []byte)       { b.data = append(b.data, data...) }
+func (b *byteBuffer) CurPosition() int         { return len(b.data) }
+func (b *byteBuffer) Update(pos int, val byte) { b.data[pos] = val }
+func (b *byteBuffer) DataSince(pos int) []byte { return b.data[pos:] }
+
+// EncodeCommand encodes a command (ID followed by its parameters)
+func (d *Dictionary) EncodeCommand(name string, params Params) ([]byte, error) {
+	mf, ok := d.commands[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+	return d.encode(mf, params)
+}
+
+// EncodeResponse encodes a response (used by tests and simulators)
+func (d *Dictionary) EncodeResponse(name string, params Params) ([]byte, error) {
+	mf, ok := d.responses[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown response %q", name)
+	}
+	return d.encode(mf, params)
+}
+
+func (d *Dictionary) encode(mf *MessageFormat, params Params) ([]byte, error) {
+	for name := range params {
+		found := false
+		for _, p := range mf.Params {
+			if p.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: unknown parameter %q", mf.Name, name)
+		}
+	}
+
+	var out byteBuffer
+	protocol.EncodeVLQUint(&out, uint32(mf.ID))
+	for _, p := range mf.Params {
+		value, ok := params[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s: missing parameter %q", mf.Name, p.Name)
+		}
+		if p.Type.IsBuffer() {
+			switch v := value.(type) {
+			case []byte:
+				protocol.EncodeVLQBytes(&out, v)
+			case string:
+				protocol.EncodeVLQString(&out, v)
+			default:
+				return nil, fmt.Errorf("%s: parameter %q needs []byte or string", mf.Name, p.Name)
+			}
+			continue
+		}
+		n, err := d.intValue(p.Name, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", mf.Name, err)
+		}
+		protocol.EncodeVLQInt(&out, int32(n))
+	}
+	return out.data, nil
+}
+
+// intValue converts an integer-like parameter value
+func (d *Dictionary) intValue(name string, value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return d.enumValue(name, v)
+	}
+	return 0, fmt.Errorf("parameter %q has unsupported type %T", name, value)
+}
+
+// DecodeResponses decodes every response in a frame payload
+func (d *Dictionary) DecodeResponses(payload []byte) ([]*Message, error) {
+	return decodeMessages(payload, d.responsesByID)
+}
+
+// DecodeCommands decodes every command in a frame payload
+func (d *Dictionary) DecodeCommands(payload []byte) ([]*Message, error) {
+	return decodeMessages(payload, d.commandsByID)
+}
+
+// decodeMessages decodes messages until the payload is exhausted
+// Messages decoded before an error are returned along with it
+func decodeMessages(payload []byte, byID map[int]*MessageFormat) ([]*Message, error) {
+	var msgs []*Message
+	for len(payload) > 0 {
+		id, err := protocol.DecodeVLQUint(&payload)
+		if err != nil {
+			return msgs, err
+		}
+		mf, ok := byID[int(id)]
+		if !ok {
+			return msgs, fmt.Errorf("unknown message id %d", id)
+		}
+		msg, err := DecodeParams(mf, &payload)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// DecodeParams decodes the parameters of one message whose ID has already
+// been consumed; data is advanced past the message
+func DecodeParams(mf *MessageFormat, data *[]byte) (*Message, error) {
+	msg := &Message{Name: mf.Name, Format: mf, Params: make(Params, len(mf.Params))}
+	for _, p := range mf.Params {
+		if p.Type.IsBuffer() {
+			buf, err := protocol.DecodeVLQBytes(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: parameter %q: %v", mf.Name, p.Name, err)
+			}
+			msg.Params[p.Name] = append([]byte(nil), buf...)
+			continue
+		}
+		v, err := protocol.DecodeVLQInt(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: parameter %q: %v", mf.Name, p.Name, err)
+		}
+		switch p.Type {
+		case protocol.ParamUint32:
+			msg.Params[p.Name] = int64(uint32(v))
+		case protocol.ParamInt32:
+			msg.Params[p.Name] = int64(v)
+		case protocol.ParamUint16:
+			msg.Params[p.Name] = int64(uint16(v))
+		case protocol.ParamInt16:
+			msg.Params[p.Name] = int64(int16(v))
+		case protocol.ParamByte:
+			msg.Params[p.Name] = int64(uint8(v))
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package host
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// OpenPTY creates a pseudo-terminal pair in raw mode
+// Returns the master side (used by the simulator), the slave side (kept open
+// so the master doesn't report EIO while no host is attached) and the slave path
+func OpenPTY() (master, slave *os.File, name string, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// unlockpt()
+	var unlock int32
+	if err = ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, "", err
+	}
+
+	// ptsname()
+	var ptn uint32
+	if err = ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptn))); err != nil {
+		master.Close()
+		return nil, nil, "", err
+	}
+	name = "/dev/pts/" + strconv.Itoa(int(ptn))
+
+	slave, err = os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, "", err
+	}
+
+	if err = MakeRaw(slave.Fd()); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, nil, "", err
+	}
+	return master, slave, name, nil
+}
+
+// MakeRaw puts a terminal into raw mode (equivalent of cfmakeraw)
+// Non-terminal files are left untouched
+func MakeRaw(fd uintptr) error {
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		if err == syscall.ENOTTY {
+			return nil
+		}
+		return err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
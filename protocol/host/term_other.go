@@ -0,0 +1,9 @@
+//go:build !linux
+
+package host
+
+// MakeRaw is a no-op where terminal ioctls are not implemented;
+// configure the port externally (e.g. stty raw) before opening it
+func MakeRaw(fd uintptr) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package host
+
+import "fmt"
+
+// Direction identifies which side sent the traffic being traced
+type Direction uint8
+
+const (
+	ToMCU   Direction = iota // Commands sent by the host
+	FromMCU                  // Responses, ACKs and NAKs sent by the MCU
+)
+
+// Tracer turns a byte stream in one direction into readable lines such as
+// "seq=3 queue_step oid=3 interval=1200 count=40 add=-2". Invalid frames,
+// resyncs, NAKs and retransmits are flagged with "!" so they stand out in
+// CI logs and bug reports.
+type Tracer struct {
+	dict    *Dictionary
+	dir     Direction
+	dec     FrameDecoder
+	lastSeq int // Sequence of the previous ACK (FromMCU) or command frame (ToMCU)
+}
+
+// NewTracer creates a tracer for one direction of traffic
+func NewTracer(dict *Dictionary, dir Direction) *Tracer {
+	return &Tracer{dict: dict, dir: dir, lastSeq: -1}
+}
+
+// Feed adds data and returns one line per decoded message or event
+func (t *Tracer) Feed(data []byte) []string {
+	var lines []string
+	for _, f := range t.dec.Feed(data) {
+		lines = append(lines, t.frameLines(f)...)
+	}
+	return lines
+}
+
+// frameLines describes one frame
+func (t *Tracer) frameLines(f Frame) []string {
+	var lines []string
+	if f.Skipped > 0 {
+		lines = append(lines, fmt.Sprintf("! resync: skipped %d bytes", f.Skipped))
+	}
+	prefix := fmt.Sprintf("seq=%d ", f.Seq)
+
+	if f.Err != nil {
+		t.lastSeq = -1
+		return append(lines, fmt.Sprintf("! %s%v: % x", prefix, f.Err, f.Raw))
+	}
+
+	if len(f.Payload) == 0 {
+		if t.dir == ToMCU {
+			return append(lines, prefix+"(empty)")
+		}
+		// The MCU answers an out-of-sequence frame by repeating its ACK
+		nak := int(f.Seq) == t.lastSeq
+		t.lastSeq = int(f.Seq)
+		if nak {
+			return append(lines, "! "+prefix+"nak")
+		}
+		return append(lines, prefix+"ack")
+	}
+
+	if t.dir == ToMCU {
+		if int(f.Seq) == t.lastSeq {
+			prefix = "! " + prefix + "retransmit "
+		}
+		t.lastSeq = int(f.Seq)
+	}
+
+	var msgs []*Message
+	var err error
+	if t.dir == ToMCU {
+		msgs, err = t.dict.DecodeCommands(f.Payload)
+	} else {
+		msgs, err = t.dict.DecodeResponses(f.Payload)
+	}
+	for _, m := range msgs {
+		lines = append(lines, prefix+t.messageString(m))
+	}
+	if err != nil {
+		lines = append(lines, fmt.Sprintf("! %sdecode error: %v: % x", prefix, err, f.Payload))
+	}
+	return lines
+}
+
+// messageString formats a message, adding the text of a static_string_id
+// parameter when the dictionary has it
+func (t *Tracer) messageString(m *Message) string {
+	s := m.String()
+	if _, ok := m.Params["static_string_id"]; ok {
+		if str, ok := t.dict.StaticStrings[int(m.Int("static_string_id"))]; ok {
+			s += fmt.Sprintf(" (%q)", str)
+		}
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package host
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTracerCommands(t *testing.T) {
+	dict, err := ParseDictionary([]byte(testDictionary))
+	if err != nil {
+		t.Fatalf("ParseDictionary: %v", err)
+	}
+
+	step, err := dict.EncodeCommand("queue_step", Params{"oid": 3, "interval": 1200, "count": 40, "add": -3})
+	if err != nil {
+		t.Fatalf("EncodeCommand: %v", err)
+	}
+	frame := EncodeFrame(1, step)
+	bad := append([]byte(nil), frame...)
+	bad[len(bad)-2] ^= 0xFF // Corrupt the CRC
+
+	var stream []byte
+	stream = append(stream, 0x7E, 0x01, 0x02, 0x7E) // Garbage between syncs
+	stream = append(stream, frame...)               // Valid
+	stream = append(stream, frame...)               // Retransmit
+	stream = append(stream, bad...)                 // CRC failure
+	stream = append(stream, EncodeFrame(2, step)...)
+
+	got := NewTracer(dict, ToMCU).Feed(stream)
+	want := []string{
+		"! seq=2 invalid frame length: 01",
+		"! resync: skipped 2 bytes",
+		"seq=1 queue_step oid=3 interval=1200 count=40 add=-3",
+		"! seq=1 retransmit queue_step oid=3 interval=1200 count=40 add=-3",
+		"! seq=1 CRC mismatch: " + fmt.Sprintf("% x", bad),
+		"seq=2 queue_step oid=3 interval=1200 count=40 add=-3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trace mismatch\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestTracerResponses(t *testing.T) {
+	dict, err := ParseDictionary([]byte(testDictionary))
+	if err != nil {
+		t.Fatalf("ParseDictionary: %v", err)
+	}
+
+	pos, err := dict.EncodeResponse("stepper_position", Params{"oid": 3, "pos": -100})
+	if err != nil {
+		t.Fatalf("EncodeResponse: %v", err)
+	}
+
+	var stream []byte
+	stream = append(stream, EncodeFrame(1, nil)...)
+	stream = append(stream, EncodeFrame(2, pos)...)
+	stream = append(stream, EncodeFrame(2, nil)...)
+	stream = append(stream, EncodeFrame(2, nil)...) // Repeated ACK is a NAK
+	stream = append(stream, EncodeFrame(3, []byte{60})...)
+
+	got := NewTracer(dict, FromMCU).Feed(stream)
+	want := []string{
+		"seq=1 ack",
+		"seq=2 stepper_position oid=3 pos=-100",
+		"seq=2 ack",
+		"! seq=2 nak",
+		"! seq=3 decode error: unknown message id 60: 3c",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trace mismatch\ngot:  %q\nwant: %q", got, want)
+	}
+}
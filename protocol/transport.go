@@ -29,6 +29,8 @@ type Transport struct {
 	handler       CommandHandler
 	resetCallback func() // Called when host reset is detected
 	flushCallback func() // Called to immediately flush ACK to USB
+	capture       *Capture
+	rxHeld        int // Bytes the last Receive left in the input
 }
 
 // NewTransport creates a new Transport instance
@@ -46,6 +48,9 @@ func NewTransport(output OutputBuffer, handler CommandHandler) *Transport {
 // This is the main entry point for handling received messages
 func (t *Transport) Receive(input InputBuffer) {
 	data := input.Data()
+	if t.capture != nil {
+		t.captureRx(data)
+	}
 
 	for len(data) > 0 {
 		if !t.getSynchronized() {
@@ -150,6 +155,21 @@ func (t *Transport) Receive(input InputBuffer) {
 	if consumed > 0 {
 		input.Pop(consumed)
 	}
+	t.rxHeld = input.Available()
+}
+
+// captureRx tees the bytes that arrived since the last Receive, the input
+// past what it left unconsumed, into the capture before any of them are
+// acted on. Corrupt frames and line noise are kept, and replaying the
+// records through Receive in order reproduces the same decisions.
+func (t *Transport) captureRx(data []byte) {
+	data = data[min(t.rxHeld, len(data)):]
+	seq := uint8(atomic.LoadUint32(&t.nextSequence))
+	for len(data) > 0 {
+		n := min(len(data), CaptureRecordMax)
+		t.capture.Record(CaptureRx, seq, data[:n])
+		data = data[n:]
+	}
 }
 
 // parseFrame extracts and dispatches commands from a frame
@@ -199,6 +219,9 @@ func (t *Transport) encodeAckNak() {
 	}
 
 	t.output.Output(ackMsg)
+	if t.capture != nil {
+		t.capture.Record(CaptureTx, ns, ackMsg)
+	}
 
 	// Force immediate flush of ACK - don't wait for main loop
 	// This is critical for serialqueue which waits for ACK before accepting responses
@@ -232,6 +255,9 @@ func (t *Transport) EncodeFrame(frameData func(output OutputBuffer)) {
 		uint8(crc & 0xFF),
 		MessageValueSync,
 	})
+	if t.capture != nil {
+		t.capture.Record(CaptureTx, seq, t.output.DataSince(cursor))
+	}
 
 	// Don't increment sequence - nextSequence is already correct
 	// Multiple responses can be sent with the same sequence number
@@ -251,6 +277,7 @@ func (t *Transport) SendCommand(cmdID uint16, args func(output OutputBuffer)) {
 func (t *Transport) Reset() {
 	atomic.StoreUint32(&t.isSynchronized, 1)
 	atomic.StoreUint32(&t.nextSequence, MessageDest)
+	t.rxHeld = 0
 
 	// Call reset callback if set
 	if t.resetCallback != nil {
@@ -269,6 +296,13 @@ func (t *Transport) SetFlushCallback(callback func()) {
 	t.flushCallback = callback
 }
 
+// SetCapture tees every received byte and every encoded frame into
+// capture (nil disables capturing). Bytes left unconsumed must stay at the
+// start of the input for the next Receive, as the targets' FIFOs keep them.
+func (t *Transport) SetCapture(capture *Capture) {
+	t.capture = capture
+}
+
 // Helper methods for atomic operations
 func (t *Transport) getSynchronized() bool {
 	return atomic.LoadUint32(&t.isSynchronized) != 0
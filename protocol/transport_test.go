@@ -0,0 +1,267 @@
+package protocol
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// panicCmdID makes the test handler panic, to check parseFrame recovers
+const panicCmdID = 0x3D
+
+// growOutput implements OutputBuffer on a growable slice
+type growOutput struct {
+	data []byte
+}
+
+func (g *growOutput) Output(data []byte)       { g.data = append(g.data, data...) }
+func (g *growOutput) CurPosition() int         { return len(g.data) }
+func (g *growOutput) Update(pos int, val byte) { g.data[pos] = val }
+func (g *growOutput) DataSince(pos int) []byte { return g.data[pos:] }
+
+// transportHarness feeds a Transport through a FifoBuffer the way the
+// targets' main loops do, checking invariants after every Receive
+type transportHarness struct {
+	t         *testing.T
+	transport *Transport
+	fifo      *FifoBuffer
+	out       *growOutput
+	cmds      []uint16 // Dispatched command IDs, in order
+	resets    int
+}
+
+func newTransportHarness(t *testing.T) *transportHarness {
+	h := &transportHarness{t: t, fifo: NewFifoBuffer(256), out: &growOutput{}}
+	h.transport = NewTransport(h.out, func(cmdID uint16, data *[]byte) error {
+		if cmdID == panicCmdID {
+			panic("test handler panic")
+		}
+		h.cmds = append(h.cmds, cmdID)
+		return nil
+	})
+	h.transport.SetResetCallback(func() { h.resets++ })
+	return h
+}
+
+// feed delivers data, receiving whenever the FIFO fills up
+func (h *transportHarness) feed(data []byte) {
+	for len(data) > 0 {
+		n := h.fifo.Write(data)
+		data = data[n:]
+		h.receive()
+		if n == 0 && h.fifo.Free() == 0 {
+			h.t.Fatalf("FIFO full with %d bytes pending: % x", h.fifo.Available(), h.fifo.Data())
+		}
+	}
+}
+
+// receive runs Receive and checks the framing invariants
+func (h *transportHarness) receive() {
+	t := h.t
+	before := append([]byte(nil), h.fifo.Data()...)
+	h.transport.Receive(h.fifo)
+	rest := h.fifo.Data()
+
+	// Only a prefix of the input may be consumed
+	if !bytes.HasSuffix(before, rest) {
+		t.Fatalf("remaining data is not a suffix of the input\nbefore: % x\nafter:  % x", before, rest)
+	}
+
+	// Whatever is left must be the start of a frame still being received
+	if len(rest) > 0 {
+		if !h.transport.getSynchronized() {
+			t.Fatalf("unsynchronized transport left %d bytes: % x", len(rest), rest)
+		}
+		if rest[0] == MessageValueSync {
+			t.Fatalf("leading sync byte left unconsumed: % x", rest)
+		}
+		if len(rest) >= MessageLengthMin {
+			n := int(rest[MessagePositionLen])
+			if n < MessageLengthMin || n > MessageLengthMax ||
+				rest[MessagePositionSeq]&^MessageSeqMask != MessageDest || len(rest) >= n {
+				t.Fatalf("complete or invalid frame left unconsumed: % x", rest)
+			}
+		}
+	}
+
+	// Receiving again without new data is a no-op
+	outLen, cmds := len(h.out.data), len(h.cmds)
+	h.transport.Receive(h.fifo)
+	if h.fifo.Available() != len(rest) || len(h.out.data) != outLen || len(h.cmds) != cmds {
+		t.Fatalf("second Receive without new data made progress")
+	}
+}
+
+// acks checks that the output is a series of valid ACK/NAK frames whose
+// sequence only stays put, advances by one, or restarts after a host reset,
+// and returns the sequence numbers
+func (h *transportHarness) acks() []uint8 {
+	t := h.t
+	out := h.out.data
+	if len(out)%MessageLengthMin != 0 {
+		t.Fatalf("output is not a series of ACK frames: % x", out)
+	}
+	var seqs []uint8
+	for i := 0; i < len(out); i += MessageLengthMin {
+		f := out[i : i+MessageLengthMin]
+		crc := CRC16(f[:MessageHeaderSize])
+		if f[0] != MessageLengthMin || f[1]&^MessageSeqMask != MessageDest ||
+			f[2] != byte(crc>>8) || f[3] != byte(crc) || f[4] != MessageValueSync {
+			t.Fatalf("malformed ACK frame % x", f)
+		}
+		seq := f[1]
+		if len(seqs) > 0 {
+			prev := seqs[len(seqs)-1]
+			next := ((prev + 1) & MessageSeqMask) | MessageDest
+			if seq != prev && seq != next && seq != MessageDest+1 {
+				t.Fatalf("ACK sequence jumped from %#x to %#x", prev, seq)
+			}
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
+
+// testFrame builds a host frame with the given sequence and payload
+func testFrame(seq uint8, payload []byte) []byte {
+	frame := []byte{byte(len(payload) + MessageLengthMin), MessageDest | seq&MessageSeqMask}
+	frame = append(frame, payload...)
+	crc := CRC16(frame)
+	return append(frame, byte(crc>>8), byte(crc), MessageValueSync)
+}
+
+// splitFeed delivers data in chunks whose sizes come from splits
+func splitFeed(h *transportHarness, data, splits []byte) {
+	for _, s := range splits {
+		if len(data) == 0 {
+			break
+		}
+		n := min(int(s)%80+1, len(data))
+		h.feed(data[:n])
+		data = data[n:]
+	}
+	h.feed(data)
+}
+
+func TestTransportPartialFrame(t *testing.T) {
+	h := newTransportHarness(t)
+	frame := testFrame(0, []byte{1, 2, 3})
+
+	for i := 0; i < len(frame)-1; i++ {
+		h.feed(frame[i : i+1])
+		if h.fifo.Available() != i+1 || len(h.cmds) != 0 {
+			t.Fatalf("after %d bytes: %d buffered, %d commands", i+1, h.fifo.Available(), len(h.cmds))
+		}
+	}
+	h.feed(frame[len(frame)-1:])
+	if h.fifo.Available() != 0 || !slices.Equal(h.cmds, []uint16{1, 2, 3}) {
+		t.Fatalf("frame not processed: %d buffered, commands %v", h.fifo.Available(), h.cmds)
+	}
+	if seqs := h.acks(); len(seqs) != 1 || seqs[0] != MessageDest+1 {
+		t.Errorf("expected one ACK for seq 1, got %x", seqs)
+	}
+}
+
+func TestTransportHandlerPanicResyncs(t *testing.T) {
+	h := newTransportHarness(t)
+	h.feed(testFrame(0, []byte{panicCmdID, 5}))
+	h.feed(testFrame(1, []byte{6}))
+	// The panic drops sync, so the next frame is lost until a sync byte
+	h.feed(testFrame(1, []byte{6}))
+
+	if !slices.Equal(h.cmds, []uint16{6}) {
+		t.Errorf("expected only the retransmitted command, got %v", h.cmds)
+	}
+	h.acks()
+}
+
+func TestTransportHostReset(t *testing.T) {
+	h := newTransportHarness(t)
+	h.feed(testFrame(0, []byte{1}))
+	h.feed(testFrame(1, []byte{2}))
+	h.feed(testFrame(0, []byte{3}))
+
+	if h.resets != 1 || !slices.Equal(h.cmds, []uint16{1, 2, 3}) {
+		t.Errorf("resets=%d commands=%v", h.resets, h.cmds)
+	}
+	if seqs := h.acks(); !bytes.Equal(seqs, []byte{0x11, 0x12, 0x11}) {
+		t.Errorf("ACK sequence %x", seqs)
+	}
+}
+
+// FuzzTransportReceive feeds arbitrary streams, delivered whole and split at
+// fuzzed boundaries, and requires both deliveries to behave identically
+func FuzzTransportReceive(f *testing.F) {
+	good := append(testFrame(0, []byte{1, 2}), testFrame(1, []byte{3})...)
+	f.Add(good, []byte{3})
+	f.Add(append([]byte{0x12, 0x7E, 0x00, 0x05}, good...), []byte{1, 1, 7})
+	f.Add(append(testFrame(0, []byte{panicCmdID}), good...), []byte{})
+	f.Add(append(testFrame(5, []byte{1}), testFrame(0, []byte{0x80})...), []byte{2, 9})
+	f.Add([]byte{0x40, 0x10, 0x01, 0x7E, 0x7E, 0x05, 0x10}, []byte{0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, stream, splits []byte) {
+		whole := newTransportHarness(t)
+		whole.feed(stream)
+		whole.acks()
+
+		split := newTransportHarness(t)
+		splitFeed(split, stream, splits)
+		split.acks()
+
+		if !slices.Equal(whole.cmds, split.cmds) {
+			t.Fatalf("commands differ: whole %v, split %v", whole.cmds, split.cmds)
+		}
+		if !bytes.Equal(whole.out.data, split.out.data) {
+			t.Fatalf("output differs:\nwhole % x\nsplit % x", whole.out.data, split.out.data)
+		}
+		if whole.resets != split.resets || whole.fifo.Available() != split.fifo.Available() {
+			t.Fatalf("state differs: resets %d/%d, buffered %d/%d",
+				whole.resets, split.resets, whole.fifo.Available(), split.fifo.Available())
+		}
+	})
+}
+
+// FuzzTransportValidFrames checks that a well-formed session is processed
+// completely and in order however it is split
+func FuzzTransportValidFrames(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{4, 2}, []byte{1})
+	f.Add(bytes.Repeat([]byte{0x21}, 300), []byte{59, 1, 30}, []byte{7, 0, 13})
+
+	f.Fuzz(func(t *testing.T, cmds, sizes, splits []byte) {
+		var stream []byte
+		var want []uint16
+		for i := 0; len(cmds) > 0; i++ {
+			n := MessageLengthMax - MessageLengthMin
+			if i < len(sizes) {
+				n = int(sizes[i])%n + 1
+			}
+			n = min(n, len(cmds))
+			payload := make([]byte, n)
+			for j, c := range cmds[:n] {
+				// Single byte VLQ command IDs, avoiding the panic ID
+				payload[j] = c % panicCmdID
+			}
+			for _, c := range payload {
+				want = append(want, uint16(c))
+			}
+			stream = append(stream, testFrame(uint8(i), payload)...)
+			cmds = cmds[n:]
+		}
+
+		h := newTransportHarness(t)
+		splitFeed(h, stream, splits)
+
+		if !slices.Equal(h.cmds, want) {
+			t.Fatalf("commands %v, want %v", h.cmds, want)
+		}
+		if h.fifo.Available() != 0 || h.resets != 0 {
+			t.Fatalf("%d bytes left, %d resets", h.fifo.Available(), h.resets)
+		}
+		seqs := h.acks()
+		for i, seq := range seqs {
+			if want := uint8(i+1)&MessageSeqMask | MessageDest; seq != want {
+				t.Fatalf("ACK %d has seq %#x, want %#x", i, seq, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,74 @@
+// Package chip describes the MCUs Gopper runs on: the identity, clock and
+// pin names each one reports in the data dictionary. It has no hardware
+// dependencies, so host tools (cmd/gopper-dictgen) register exactly the same
+// dictionary entries as the firmware.
+package chip
+
+import (
+	"strconv"
+
+	"gopper/core"
+)
+
+// Info describes one MCU family
+type Info struct {
+	MCU       string   // MCU constant reported to the host
+	ClockFreq uint32   // CLOCK_FREQ constant (timer ticks per second)
+	NumGPIO   int      // GPIO pins, named gpio0..gpioN-1
+	ADCNames  []string // ADC channel names, enumerated after the GPIO pins
+}
+
+// RP2040 has 30 GPIOs and a 1MHz microsecond timer
+var RP2040 = Info{
+	MCU:       "rp2040",
+	ClockFreq: 1000000,
+	NumGPIO:   30,
+	ADCNames:  []string{"ADC0", "ADC1", "ADC2", "ADC3", "ADC_TEMPERATURE"},
+}
+
+// RP2350 (QFN-80 "B" package) has 48 GPIOs and the same timer as the RP2040
+var RP2350 = Info{
+	MCU:       "rp2350",
+	ClockFreq: 1000000,
+	NumGPIO:   48,
+	ADCNames:  []string{"ADC0", "ADC1", "ADC2", "ADC3", "ADC_TEMPERATURE"},
+}
+
+// Sim is the Linux host simulator (targets/sim) with a 1MHz host clock
+var Sim = Info{
+	MCU:       "linux-sim",
+	ClockFreq: 1000000,
+	NumGPIO:   64,
+	ADCNames:  []string{"ADC0", "ADC1", "ADC2", "ADC3", "ADC4", "ADC5", "ADC6", "ADC7"},
+}
+
+// Lookup returns the chip with the given MCU name
+func Lookup(mcu string) (Info, bool) {
+	switch mcu {
+	case RP2040.MCU:
+		return RP2040, true
+	case RP2350.MCU:
+		return RP2350, true
+	case Sim.MCU:
+		return Sim, true
+	}
+	return Info{}, false
+}
+
+// PinNames returns the combined pin enumeration: GPIO pins first, then ADC
+// channels (e.g. on the RP2040 gpio0-gpio29 are 0-29 and ADC0 is 30)
+func (c Info) PinNames() []string {
+	names := make([]string, 0, c.NumGPIO+len(c.ADCNames))
+	for i := 0; i < c.NumGPIO; i++ {
+		names = append(names, "gpio"+strconv.Itoa(i))
+	}
+	return append(names, c.ADCNames...)
+}
+
+// Register adds the chip's constants and pin enumeration to the dictionary
+// This must happen before the dictionary is built.
+func (c Info) Register() {
+	core.RegisterConstant("MCU", c.MCU)
+	core.RegisterConstant("CLOCK_FREQ", c.ClockFreq)
+	core.RegisterEnumeration("pin", c.PinNames())
+}
@@ -0,0 +1,78 @@
+package pio
+
+import "gopper/core"
+
+var (
+	// PIO allocation tracking
+	// RP2040/RP2350 has 2 PIO blocks (PIO0, PIO1) with 4 state machines each
+	pioAllocations = [2][4]bool{} // [pioNum][smNum]
+	nextPIONum     = uint8(0)
+	nextSMNum      = uint8(0)
+)
+
+// newStepperBackend returns a backend initialized for cfg: on a PIO state
+// machine while one is free and takes cfg, otherwise on GPIO, which any
+// number of steppers can share the step timer for. newPIO and newGPIO make
+// the backends, so the choice does not depend on the hardware.
+func newStepperBackend(cfg core.StepperConfig, newPIO func(pioNum, smNum uint8) core.StepperBackend, newGPIO func() core.StepperBackend) (core.StepperBackend, error) {
+	if pioNum, smNum, ok := allocatePIO(); ok {
+		backend := newPIO(pioNum, smNum)
+		err := backend.Init(cfg)
+		if err == nil {
+			return backend, nil
+		}
+		// A step pulse the program cannot make, or a state machine
+		// claimed by other code
+		core.DebugPrintln("[PIO] Falling back to GPIO: " + err.Error())
+		freePIO(pioNum, smNum)
+	}
+
+	backend := newGPIO()
+	if err := backend.Init(cfg); err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// allocatePIO allocates a PIO state machine
+// Returns (pioNum, smNum, ok)
+func allocatePIO() (uint8, uint8, bool) {
+	// Round-robin allocation across PIO blocks and state machines
+	for i := 0; i < 8; i++ { // 2 PIO × 4 SM = 8 total
+		pioNum := nextPIONum
+		smNum := nextSMNum
+
+		// Advance to next slot
+		nextSMNum++
+		if nextSMNum >= 4 {
+			nextSMNum = 0
+			nextPIONum = (nextPIONum + 1) % 2
+		}
+
+		// Check if this slot is free
+		if !pioAllocations[pioNum][smNum] {
+			pioAllocations[pioNum][smNum] = true
+			return pioNum, smNum, true
+		}
+	}
+
+	// All PIO resources exhausted
+	return 0, 0, false
+}
+
+// freePIO returns a state machine allocatePIO gave out
+func freePIO(pioNum, smNum uint8) {
+	pioAllocations[pioNum][smNum] = false
+}
+
+// GetPIOAllocationStatus returns PIO allocation status for debugging
+func GetPIOAllocationStatus() [2][4]bool {
+	return pioAllocations
+}
+
+// resetAllocations frees every state machine
+func resetAllocations() {
+	pioAllocations = [2][4]bool{}
+	nextPIONum = 0
+	nextSMNum = 0
+}
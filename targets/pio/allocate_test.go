@@ -0,0 +1,77 @@
+package pio
+
+import (
+	"errors"
+	"testing"
+
+	"gopper/core"
+)
+
+// fakeBackend is a stepper backend whose Init fails on request
+type fakeBackend struct {
+	name    string
+	initErr error
+	inits   int
+}
+
+func (b *fakeBackend) Init(cfg core.StepperConfig) error {
+	b.inits++
+	return b.initErr
+}
+func (b *fakeBackend) Step()                            {}
+func (b *fakeBackend) SetDirection(dir bool)            {}
+func (b *fakeBackend) Stop()                            {}
+func (b *fakeBackend) GetName() string                  { return b.name }
+func (b *fakeBackend) GetInfo() core.StepperBackendInfo { return core.StepperBackendInfo{} }
+func (b *fakeBackend) SetStepInterval(uint32)           {}
+
+// TestStepperBackendFallback checks that a stepper gets GPIO when the PIO
+// state machines run out or one fails to take the configuration, and that
+// a failed one is freed for the next stepper
+func TestStepperBackendFallback(t *testing.T) {
+	resetAllocations()
+	t.Cleanup(resetAllocations)
+
+	var pioErr error
+	newPIO := func(pioNum, smNum uint8) core.StepperBackend {
+		return &fakeBackend{name: "PIO", initErr: pioErr}
+	}
+	var gpioErr error
+	newGPIO := func() core.StepperBackend {
+		return &fakeBackend{name: "GPIO", initErr: gpioErr}
+	}
+	create := func() string {
+		t.Helper()
+		backend, err := newStepperBackend(core.StepperConfig{}, newPIO, newGPIO)
+		if err != nil {
+			t.Fatalf("no backend: %v", err)
+		}
+		return backend.GetName()
+	}
+
+	// A state machine that fails Init falls back to GPIO and is freed
+	pioErr = errors.New("step pulse too long for PIO")
+	if name := create(); name != "GPIO" {
+		t.Errorf("backend %s after the PIO init failed, want GPIO", name)
+	}
+	if GetPIOAllocationStatus() != ([2][4]bool{}) {
+		t.Errorf("state machine still allocated after its init failed: %v", GetPIOAllocationStatus())
+	}
+
+	// Eight steppers get the eight state machines, the ninth GPIO
+	pioErr = nil
+	for i := 0; i < 8; i++ {
+		if name := create(); name != "PIO" {
+			t.Fatalf("stepper %d got %s, want PIO", i, name)
+		}
+	}
+	if name := create(); name != "GPIO" {
+		t.Errorf("ninth stepper got %s, want GPIO", name)
+	}
+
+	// Only a failing GPIO init fails config_stepper
+	gpioErr = errors.New("bad pin")
+	if _, err := newStepperBackend(core.StepperConfig{}, newPIO, newGPIO); err == nil {
+		t.Error("no error when GPIO init failed too")
+	}
+}
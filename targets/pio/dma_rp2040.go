@@ -0,0 +1,11 @@
+//go:build rp2040
+
+package pio
+
+// RP2040 DMA CTRL_TRIG fields
+const (
+	dmaCtrlEn       = 1 << 0
+	dmaCtrlSizeWord = 2 << 2
+	dmaCtrlChainTo  = 11 // Chaining a channel to itself disables chaining
+	dmaCtrlTreqSel  = 15
+)
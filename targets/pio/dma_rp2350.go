@@ -0,0 +1,11 @@
+//go:build rp2350
+
+package pio
+
+// RP2350 DMA CTRL_TRIG fields
+const (
+	dmaCtrlEn       = 1 << 0
+	dmaCtrlSizeWord = 2 << 2
+	dmaCtrlChainTo  = 13 // Chaining a channel to itself disables chaining
+	dmaCtrlTreqSel  = 17
+)
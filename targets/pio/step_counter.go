@@ -0,0 +1,80 @@
+//go:build rp2040 || rp2350
+
+package pio
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+// Step counting: the stepper program pushes a word to its RX FIFO after
+// every step, and a DMA channel per state machine moves each word to a sink.
+// The channel's remaining transfer count is then a hardware count of the
+// steps made, which StepsDone reads without stopping the program. The
+// channels are 4-11, which nothing else in the firmware uses.
+
+const (
+	dmaBase       = 0x50000000
+	dmaChanStride = 0x40
+	dmaStepChan0  = 4 // First step counting channel, one per state machine
+
+	pioBase0  = 0x50200000
+	pioStride = 0x100000
+	pioRXF0   = 0x20 // RX FIFO of state machine 0, the others follow
+
+	dreqPIORX0   = 4          // DREQ of PIO0 RX FIFO 0; each block adds 8
+	stepCountMax = 0x0FFFFFFF // Largest count both chips take in normal mode
+)
+
+// dmaChannel is the register block of one DMA channel
+type dmaChannel struct {
+	readAddr   volatile.Register32
+	writeAddr  volatile.Register32
+	transCount volatile.Register32
+	ctrlTrig   volatile.Register32
+}
+
+var dmaChanAbort = (*volatile.Register32)(unsafe.Pointer(uintptr(dmaBase + 0x444)))
+
+// stepCounter counts the steps of one state machine
+type stepCounter struct {
+	ch   *dmaChannel
+	num  uint32
+	rxf  uint32 // RX FIFO the channel reads
+	dreq uint32
+	base uint32 // Steps counted before the channel was last armed
+	sink uint32 // Where the channel writes the words it counts
+}
+
+// init arms the channel of a state machine, counting from zero
+func (c *stepCounter) init(pioNum, smNum uint8) {
+	c.num = dmaStepChan0 + uint32(pioNum)*4 + uint32(smNum)
+	c.ch = (*dmaChannel)(unsafe.Pointer(uintptr(dmaBase + c.num*dmaChanStride)))
+	c.rxf = pioBase0 + uint32(pioNum)*pioStride + pioRXF0 + uint32(smNum)*4
+	c.dreq = dreqPIORX0 + uint32(pioNum)*8 + uint32(smNum)
+	c.base = 0
+	c.arm()
+}
+
+// count returns the steps counted since init, wrapping at 2^32
+func (c *stepCounter) count() uint32 {
+	return c.base + stepCountMax - c.ch.transCount.Get()&stepCountMax
+}
+
+// rearm restarts the transfer count before it runs out
+// The state machine must not be stepping.
+func (c *stepCounter) rearm() {
+	c.base = c.count()
+	c.arm()
+}
+
+// arm stops the channel and starts it again with a full transfer count
+func (c *stepCounter) arm() {
+	dmaChanAbort.Set(1 << c.num)
+	for dmaChanAbort.Get()&(1<<c.num) != 0 {
+	}
+	c.ch.readAddr.Set(c.rxf)
+	c.ch.writeAddr.Set(uint32(uintptr(unsafe.Pointer(&c.sink))))
+	c.ch.transCount.Set(stepCountMax)
+	c.ch.ctrlTrig.Set(dmaCtrlEn | dmaCtrlSizeWord | c.num<<dmaCtrlChainTo | c.dreq<<dmaCtrlTreqSel)
+}
@@ -0,0 +1,163 @@
+//go:build rp2040 || rp2350
+
+package pio
+
+import (
+	"gopper/core"
+	"machine"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// StepperGPIO implements a simple GPIO-based stepper backend
+// Uses direct GPIO toggling for step pulses, on a timer interrupt per step.
+// Steppers get it once the PIO state machines are all in use.
+type StepperGPIO struct {
+	stepPin    machine.Pin
+	dirPin     machine.Pin
+	invertStep bool
+	invertDir  bool
+	edge       bool // StepModeEdge: toggle the step pin once per step
+	stepLevel  bool // Step pin level in StepModeEdge
+	direction  bool
+	dirLevel   bool
+	pulse      uint32 // Step pulse width in CPU cycles
+	setup      uint32 // Dir setup time in CPU cycles
+}
+
+// NewStepperGPIO creates a new GPIO-based stepper backend
+func NewStepperGPIO() *StepperGPIO {
+	return &StepperGPIO{}
+}
+
+// Init initializes the stepper GPIO pins
+func (s *StepperGPIO) Init(cfg core.StepperConfig) error {
+	s.stepPin = machine.Pin(cfg.StepPin)
+	s.dirPin = machine.Pin(cfg.DirPin)
+	s.invertStep = cfg.InvertStep
+	s.invertDir = cfg.InvertDir
+	s.edge = cfg.StepMode == core.StepModeEdge
+	s.stepLevel = cfg.InvertStep
+	s.pulse = core.TicksToCycles(cfg.PulseTicks, machine.CPUFrequency())
+	s.setup = core.TicksToCycles(cfg.SetupTicks, machine.CPUFrequency())
+
+	// Configure pins as outputs
+	s.stepPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	s.dirPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	// Set initial states (step low, direction forward)
+	if s.invertStep {
+		s.stepPin.High()
+	} else {
+		s.stepPin.Low()
+	}
+	s.dirLevel = !s.invertDir // So SetDirection writes the pin
+	s.SetDirection(false)
+
+	core.DebugPrintln("[GPIO] Stepper initialized: step=" + itoa(int(cfg.StepPin)) + " dir=" + itoa(int(cfg.DirPin)))
+	return nil
+}
+
+// Step generates a single step pulse using GPIO
+// In StepModeEdge it toggles the step pin instead, with no delay.
+func (s *StepperGPIO) Step() {
+	if s.edge {
+		s.stepLevel = !s.stepLevel
+		s.stepPin.Set(s.stepLevel)
+		return
+	}
+
+	s.stepPin.Set(!s.invertStep)
+	spinCycles(s.pulse)
+	s.stepPin.Set(s.invertStep)
+}
+
+// SetDirection sets the direction output
+// A change waits out the setup time, so the next step can follow at once.
+func (s *StepperGPIO) SetDirection(dir bool) {
+	s.direction = dir
+	level := dir != s.invertDir
+	if level == s.dirLevel {
+		return
+	}
+	s.dirLevel = level
+	s.dirPin.Set(level)
+	spinCycles(s.setup)
+}
+
+// Stop halts stepping (nothing to do for GPIO backend)
+func (s *StepperGPIO) Stop() {
+	// Either level is idle when stepping on both edges, and changing it
+	// would make a step
+	if s.edge {
+		return
+	}
+
+	// Ensure step pin is in idle state
+	if s.invertStep {
+		s.stepPin.High()
+	} else {
+		s.stepPin.Low()
+	}
+}
+
+// GetName returns the backend name
+func (s *StepperGPIO) GetName() string {
+	return "GPIO"
+}
+
+// GetInfo returns backend performance information
+func (s *StepperGPIO) GetInfo() core.StepperBackendInfo {
+	return core.StepperBackendInfo{
+		Name:          s.GetName(),
+		MaxStepRate:   100000, // One timer interrupt per step
+		MinPulseNs:    uint32(uint64(s.pulse) * 1000000000 / uint64(machine.CPUFrequency())),
+		TypicalJitter: 1000, // Timer interrupt latency
+		CPUOverhead:   15,   // At the maximum step rate
+	}
+}
+
+// SetStepInterval is a no-op for GPIO backend
+// Timing is handled by the core timer system, not the backend
+func (s *StepperGPIO) SetStepInterval(intervalTicks uint32) {
+	// GPIO backend doesn't need to adjust anything for interval changes
+	// The core timer system handles all timing
+}
+
+// SysTick registers of the core running the step timer
+var (
+	systCSR = (*volatile.Register32)(unsafe.Pointer(uintptr(0xE000E010)))
+	systRVR = (*volatile.Register32)(unsafe.Pointer(uintptr(0xE000E014)))
+	systCVR = (*volatile.Register32)(unsafe.Pointer(uintptr(0xE000E018)))
+)
+
+const (
+	systEnable  = 1 << 0
+	systClkCore = 1 << 2 // Count CPU cycles
+	systMax     = 0xFFFFFF
+)
+
+// spinCycles busy-waits at least n CPU cycles, counting them with the
+// SysTick of the calling core, which it starts free-running if nothing
+// else has
+func spinCycles(n uint32) {
+	if n == 0 {
+		return
+	}
+	if systCSR.Get()&systEnable == 0 {
+		systRVR.Set(systMax)
+		systCVR.Set(0)
+		systCSR.Set(systEnable | systClkCore)
+	}
+	wrap := systRVR.Get() + 1
+	last := systCVR.Get()
+	for elapsed := uint32(0); elapsed < n; {
+		now := systCVR.Get()
+		if now <= last {
+			elapsed += last - now
+		} else {
+			elapsed += last + wrap - now
+		}
+		last = now
+	}
+}
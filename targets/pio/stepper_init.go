@@ -6,71 +6,43 @@ import (
 	"gopper/core"
 )
 
-var (
-	// PIO allocation tracking
-	// RP2040/RP2350 has 2 PIO blocks (PIO0, PIO1) with 4 state machines each
-	pioAllocations = [2][4]bool{} // [pioNum][smNum]
-	nextPIONum     = uint8(0)
-	nextSMNum      = uint8(0)
-)
-
 // InitSteppers initializes the stepper subsystem
+// Stepper commands are registered by core.RegisterFirmwareCommands.
 func InitSteppers() {
-	// Register stepper commands
-	core.RegisterStepperCommands()
-
 	// Set backend factory function
 	// This is called by config_stepper command when a stepper is created
-	core.SetStepperBackendFactory(createPIOBackend)
-}
+	core.SetStepperBackendFactory(createBackend)
 
-// createPIOBackend creates a PIO-based stepper backend
-// Returns nil if no PIO resources available
-func createPIOBackend() core.StepperBackend {
-	// Find available PIO state machine
-	pioNum, smNum, ok := allocatePIO()
-	if !ok {
-		// No PIO available (max 8 steppers supported)
-		return nil
-	}
-
-	return NewStepperPIO(pioNum, smNum)
+	// Steppers are recreated after config_reset, so free their state machines
+	core.RegisterConfigReset(ResetPIOAllocations)
 }
 
-// allocatePIO allocates a PIO state machine
-// Returns (pioNum, smNum, ok)
-func allocatePIO() (uint8, uint8, bool) {
-	// Round-robin allocation across PIO blocks and state machines
-	for i := 0; i < 8; i++ { // 2 PIO × 4 SM = 8 total
-		pioNum := nextPIONum
-		smNum := nextSMNum
-
-		// Advance to next slot
-		nextSMNum++
-		if nextSMNum >= 4 {
-			nextSMNum = 0
-			nextPIONum = (nextPIONum + 1) % 2
-		}
-
-		// Check if this slot is free
-		if !pioAllocations[pioNum][smNum] {
-			pioAllocations[pioNum][smNum] = true
-			return pioNum, smNum, true
-		}
-	}
+// createBackend creates a stepper backend initialized for cfg: a PIO state
+// machine while one is free and takes cfg, then GPIO (newStepperBackend)
+func createBackend(cfg core.StepperConfig) (core.StepperBackend, error) {
+	return newStepperBackend(cfg, newPIOBackend, newGPIOBackend)
+}
 
-	// All PIO resources exhausted
-	return 0, 0, false
+func newPIOBackend(pioNum, smNum uint8) core.StepperBackend {
+	return NewStepperPIO(pioNum, smNum)
 }
 
-// GetPIOAllocationStatus returns PIO allocation status for debugging
-func GetPIOAllocationStatus() [2][4]bool {
-	return pioAllocations
+func newGPIOBackend() core.StepperBackend {
+	return NewStepperGPIO()
 }
 
-// ResetPIOAllocations resets all PIO allocations (for testing)
+// ResetPIOAllocations resets all PIO allocations (on config reset and for testing)
+// The state machines are released for the next configuration to claim.
 func ResetPIOAllocations() {
-	pioAllocations = [2][4]bool{}
-	nextPIONum = 0
-	nextSMNum = 0
+	for pioNum, sms := range pioAllocations {
+		for smNum, used := range sms {
+			if used {
+				pioBlock(uint8(pioNum)).StateMachine(uint8(smNum)).Unclaim()
+			}
+		}
+	}
+	resetAllocations()
+	for i := range blockPrograms {
+		blockPrograms[i].users = 0
+	}
 }
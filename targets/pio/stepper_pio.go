@@ -3,44 +3,94 @@
 package pio
 
 import (
+	"errors"
 	"gopper/core"
 	"machine"
 
 	piolib "github.com/tinygo-org/pio/rp2-pio"
 )
 
+// blockProgram is the stepper program loaded in a PIO block. The step
+// pulse is built into the program, from the first stepper to use the block
+// after a config reset; later ones take it if theirs is no longer.
+type blockProgram struct {
+	offset uint8  // 0xFF = not loaded
+	pulse  uint32 // Step pulse in PIO cycles
+	users  uint8  // State machines running it since the last config reset
+}
+
 // PIO program storage - loaded once per PIO block
-var (
-	pio0ProgramOffset uint8 = 0xFF // 0xFF = not loaded
-	pio1ProgramOffset uint8 = 0xFF
-	stepperProgram    []uint16
+var blockPrograms = [2]blockProgram{{offset: 0xFF}, {offset: 0xFF}}
+
+// PIO timing. The state machines run at pioCyclesPerTick cycles per timer
+// tick, which divides the 125, 150 and 200MHz system clocks exactly at the
+// 1MHz CLOCK_FREQ, so every step of a segment lands on the tick Klipper's
+// step loop gives it.
+const (
+	pioCyclesPerTick = 5
+
+	// Step pulse range of the program's delays, 600ns to 6.4µs
+	minPulseCycles = 3
+	maxPulseCycles = 32
+
+	// Cycles the program spends outside its wait and add loops: per step
+	// (one more when the interval grows) and from a segment's last step to
+	// the next segment's lead, both besides the step pulse, and from the
+	// lead to the first step (one less when the interval grows). Both step
+	// modes take the same.
+	stepLoopCycles = 13
+	tailCycles     = 6
+	entryCycles    = 12
+	fifoLatency    = 2 // From writing the TX FIFO to the first pull
+
+	// Cycles from writing the dir pin to the first step edge, besides the
+	// lead
+	dirCycles = 5
+
+	// Program addresses the encoder needs
+	progLead    = 7
+	progStep    = 11
+	progFall    = 16 // Falling edge of StepModeEdge
+	progPulled  = 17 // End of the pulse of StepModeNormal
+	progStepped = 18
+	progWait    = 27
+	progAdd     = 29
+	progEnd     = 31
+
+	// MOV STATUS compares the TX FIFO level with N: never below 0, always
+	// below 15, so it reads as the step mode
+	statusNormal = 0
+	statusEdge   = 15
 )
 
-// StepperPIO handles PIO-based stepper pulse generation
-// Implements core.StepperBackend interface
+// StepperPIO generates whole queue_step segments in a PIO state machine
+// Implements core.StepperSegmentBackend: the step timer hands over each
+// move, the program makes its steps with their exact acceleration, and a
+// DMA channel counts them for stepper_get_position.
 type StepperPIO struct {
-	pio        *piolib.PIO
-	sm         piolib.StateMachine
-	offset     uint8
-	stepPin    machine.Pin
-	dirPin     machine.Pin
-	direction  bool
-	pioNum     uint8
-	smNum      uint8
-	cpuFreqMHz uint32 // Cached CPU frequency in MHz for fast divider calculation
+	pio       *piolib.PIO
+	sm        piolib.StateMachine
+	offset    uint8
+	stepPin   machine.Pin
+	dirPin    machine.Pin
+	invertDir bool
+	edge      bool   // StepModeEdge: one step pin edge per step
+	pulse     uint32 // Step pulse of the block's program, in PIO cycles
+	setup     uint32 // Dir setup time in PIO cycles
+	lastDir   uint32 // Dir pin level of the last segment
+	direction bool
+	pioNum    uint8
+	smNum     uint8
+	interval  uint32 // From SetStepInterval, for QueueSteps
+	lastStep  uint32 // Time of the last step handed to the program
+	counter   stepCounter
 }
 
 // NewStepperPIO creates a new PIO stepper controller
 // pioNum: 0 for PIO0, 1 for PIO1
 // smNum: 0-3 for state machine number
 func NewStepperPIO(pioNum, smNum uint8) *StepperPIO {
-	var p *piolib.PIO
-	if pioNum == 0 {
-		p = piolib.PIO0
-	} else {
-		p = piolib.PIO1
-	}
-
+	p := pioBlock(pioNum)
 	return &StepperPIO{
 		pio:    p,
 		sm:     p.StateMachine(smNum),
@@ -49,137 +99,354 @@ func NewStepperPIO(pioNum, smNum uint8) *StepperPIO {
 	}
 }
 
-// buildStepperProgram creates the PIO stepper program using AssemblerV0
-// Simple version: direction controlled via GPIO, PIO only generates step pulses
-// Based on known-working minimal test pattern
-func buildStepperProgram() []uint16 {
+// pioBlock returns PIO0 or PIO1
+func pioBlock(pioNum uint8) *piolib.PIO {
+	if pioNum == 0 {
+		return piolib.PIO0
+	}
+	return piolib.PIO1
+}
+
+// buildStepperProgram creates the segment program using AssemblerV0
+//
+// A segment is three TX FIFO words:
+//
+//	Y0:          wait of the first step, inverted when the interval grows
+//	count<<16 |  steps, and cycles to wait before the first one
+//	lead
+//	A<<2 |       A: cycles added to or taken from the wait every step,
+//	grow<<1 |    grow: the interval grows (add > 0),
+//	dir          dir: direction pin level
+//
+// PIO can only decrement, so the wait is kept in Y and Y is decremented A
+// times per step: when the interval grows Y holds the inverted wait, which
+// grows as Y falls. The grow bit is left shifted out of the OSR, which the
+// pull threshold of 2 then reports as empty, so the step loop tells the two
+// cases apart with jmp !osre while the OSR keeps A. After every step the
+// program pushes a word for the DMA step counter.
+//
+// Both step modes share the program. The JMP pin is the step pin, and MOV
+// STATUS reads all-ones in StepModeEdge: a step from a high pin is a falling
+// edge, from a low pin a rising edge that StepModeNormal ends after pulse
+// cycles. Every path leaves the edge the same cycles before the rest of the
+// loop.
+func buildStepperProgram(pulse uint32) []uint16 {
 	asm := piolib.AssemblerV0{SidesetBits: 0}
 
 	return []uint16{
-		// Wait for step count from TX FIFO
-		asm.Pull(false, true).Encode(),        // 0: pull block
-		asm.Out(piolib.OutDestX, 32).Encode(), // 1: X = step count
+		// Load a segment
+		asm.Pull(false, true).Encode(),                        // 0: pull block
+		asm.Mov(piolib.MovDestY, piolib.MovSrcOSR).Encode(),   // 1: Y = first wait
+		asm.Pull(false, true).Encode(),                        // 2: pull block
+		asm.Out(piolib.OutDestX, 16).Encode(),                 // 3: X = lead
+		asm.Out(piolib.OutDestISR, 16).Encode(),               // 4: ISR = count
+		asm.Pull(false, true).Encode(),                        // 5: pull block
+		asm.Out(piolib.OutDestPins, 1).Encode(),               // 6: dir pin
+		asm.Jmp(progLead, piolib.JmpXNZeroDec).Encode(),       // 7: lead: jmp x--, lead
+		asm.Out(piolib.OutDestX, 1).Encode(),                  // 8: X = grow
+		asm.Jmp(progStep, piolib.JmpXNZeroDec).Encode(),       // 9: growing: OSR stays empty
+		asm.Mov(piolib.MovDestOSR, piolib.MovSrcOSR).Encode(), // 10: shrinking: OSR not empty
 		// Step loop
-		asm.Set(piolib.SetDestPins, 1).Delay(7).Encode(), // 2: step HIGH [7]
-		asm.Set(piolib.SetDestPins, 0).Delay(7).Encode(), // 3: step LOW [7]
-		asm.Jmp(2, piolib.JmpXNZeroDec).Encode(),         // 4: jmp x--, 2
-		// Wraps back to 0 (pull) when X reaches 0
+		asm.Jmp(progFall, piolib.JmpPinInput).Encode(),                  // 11: step: pin high: fall
+		asm.Set(piolib.SetDestPins, 1).Delay(uint8(pulse - 3)).Encode(), // 12: step HIGH
+		asm.Mov(piolib.MovDestX, piolib.MovSrcStatus).Encode(),          // 13: X = step mode
+		asm.Jmp(progPulled, piolib.JmpXZero).Encode(),                   // 14: normal: end the pulse
+		asm.Jmp(progStepped, piolib.JmpAlways).Encode(),                 // 15: edge: stay HIGH
+		asm.Set(piolib.SetDestPins, 0).Delay(uint8(pulse - 1)).Encode(), // 16: edge: step LOW
+		asm.Set(piolib.SetDestPins, 0).Encode(),                         // 17: step LOW
+		asm.Mov(piolib.MovDestX, piolib.MovSrcISR).Encode(),             // 18: X = steps left
+		asm.Jmp(20, piolib.JmpXNZeroDec).Encode(),                       // 19: X--
+		asm.Push(false, false).Encode(),                                 // 20: push noblock (step counter)
+		asm.Mov(piolib.MovDestISR, piolib.MovSrcX).Encode(),             // 21: ISR = steps left
+		asm.Jmp(0, piolib.JmpXZero).Encode(),                            // 22: segment done: load next
+		asm.Jmp(26, piolib.JmpOSRNotEmpty).Encode(),                     // 23: shrinking: goto 26
+		asm.MovInvertBits(piolib.MovDestX, piolib.MovSrcY).Encode(),     // 24: X = ~Y
+		asm.Jmp(progWait, piolib.JmpAlways).Encode(),                    // 25: goto wait
+		asm.Mov(piolib.MovDestX, piolib.MovSrcY).Encode(),               // 26: X = Y
+		asm.Jmp(progWait, piolib.JmpXNZeroDec).Encode(),                 // 27: wait: jmp x--, wait
+		asm.Mov(piolib.MovDestX, piolib.MovSrcOSR).Encode(),             // 28: X = A
+		asm.Jmp(progEnd, piolib.JmpXNZeroDec).Encode(),                  // 29: add: jmp x--, 31
+		asm.Jmp(progStep, piolib.JmpAlways).Encode(),                    // 30: next step
+		asm.Jmp(progAdd, piolib.JmpYNZeroDec).Encode(),                  // 31: Y--, goto add
 	}
 }
 
 // Init initializes the stepper hardware
-func (s *StepperPIO) Init(stepPin, dirPin uint8, invertStep, invertDir bool) error {
-	core.DebugPrintln("[PIO] Init: stepPin=" + itoa(int(stepPin)) + " dirPin=" + itoa(int(dirPin)))
-
-	s.stepPin = machine.Pin(stepPin)
-	s.dirPin = machine.Pin(dirPin)
+func (s *StepperPIO) Init(cfg core.StepperConfig) error {
+	core.DebugPrintln("[PIO] Init: stepPin=" + itoa(int(cfg.StepPin)) + " dirPin=" + itoa(int(cfg.DirPin)))
+
+	s.stepPin = machine.Pin(cfg.StepPin)
+	s.dirPin = machine.Pin(cfg.DirPin)
+	s.invertDir = cfg.InvertDir
+	s.edge = cfg.StepMode == core.StepModeEdge
+
+	// Timing in PIO cycles
+	pioFreq := core.GetGlobalDictionary().ClockFreq() * pioCyclesPerTick
+	pulse := core.TicksToCycles(cfg.PulseTicks, pioFreq)
+	if pulse < minPulseCycles {
+		pulse = minPulseCycles
+	}
+	if pulse > maxPulseCycles {
+		return errors.New("step pulse too long for PIO")
+	}
+	s.setup = core.TicksToCycles(cfg.SetupTicks, pioFreq)
 
 	// Claim state machine
 	core.DebugPrintln("[PIO] Claiming state machine...")
-	s.sm.TryClaim()
-
-	// Build program if not already built
-	if stepperProgram == nil {
-		core.DebugPrintln("[PIO] Building stepper program...")
-		stepperProgram = buildStepperProgram()
+	if !s.sm.TryClaim() {
+		return errors.New("PIO state machine already claimed")
 	}
 
-	// Load program once per PIO block
-	var offset uint8
-	var err error
-
 	core.DebugPrintln("[PIO] Loading program to PIO" + itoa(int(s.pioNum)) + "...")
-	if s.pioNum == 0 {
-		if pio0ProgramOffset == 0xFF {
-			offset, err = s.pio.AddProgram(stepperProgram, 0)
-			if err != nil {
-				core.DebugPrintln("[PIO] ERROR: AddProgram failed: " + err.Error())
-				return err
-			}
-			pio0ProgramOffset = offset
-		}
-		offset = pio0ProgramOffset
-	} else {
-		if pio1ProgramOffset == 0xFF {
-			offset, err = s.pio.AddProgram(stepperProgram, 0)
-			if err != nil {
-				core.DebugPrintln("[PIO] ERROR: AddProgram failed: " + err.Error())
-				return err
-			}
-			pio1ProgramOffset = offset
-		}
-		offset = pio1ProgramOffset
+	if err := s.loadProgram(pulse); err != nil {
+		core.DebugPrintln("[PIO] ERROR: AddProgram failed: " + err.Error())
+		s.sm.Unclaim()
+		return err
 	}
-	s.offset = offset
+	offset := s.offset
 	core.DebugPrintln("[PIO] Program loaded at offset " + itoa(int(offset)))
 
 	// Configure state machine
 	cfg := piolib.DefaultStateMachineConfig()
 
-	// SET pins = step pin (for pulse generation)
+	// SET pins = step pin, OUT pins = dir pin
 	cfg.SetSetPins(s.stepPin, 1)
+	cfg.SetOutPins(s.dirPin, 1)
+
+	// The step loop reads the step pin and the step mode
+	cfg.SetJmpPin(s.stepPin)
+	if s.edge {
+		cfg.SetMovStatus(piolib.MovStatusTxLessThan, statusEdge)
+	} else {
+		cfg.SetMovStatus(piolib.MovStatusTxLessThan, statusNormal)
+	}
 
-	// Shift control: shift right, no autopull, 32-bit threshold
-	cfg.SetOutShift(true, false, 32)
+	// Shift right, no autopull, threshold 2 so the grow bit empties the OSR
+	cfg.SetOutShift(true, false, 2)
 
-	// Wrap points (5 instruction program: 0-4)
-	cfg.SetWrap(offset+4, offset)
+	// The program jumps back to its start itself
+	cfg.SetWrap(offset+progEnd, offset)
 
-	// Clock divider - default to fast pulses (~1µs pulse width)
-	// This will be adjusted dynamically by SetStepInterval based on step rate
-	// divider 10 at 150MHz = 15MHz PIO clock, 16 cycles/step = ~1µs pulse
-	cfg.SetClkDivIntFrac(10, 0)
+	// pioCyclesPerTick cycles per timer tick
+	div := uint64(machine.CPUFrequency()) * 256 / uint64(pioFreq)
+	cfg.SetClkDivIntFrac(uint16(div>>8), uint8(div))
 
-	// Configure step pin for PIO control
-	core.DebugPrintln("[PIO] Configuring step pin " + itoa(int(stepPin)) + " for PIO mode...")
+	// Both pins belong to the state machine
+	core.DebugPrintln("[PIO] Configuring step and dir pins for PIO mode...")
 	s.stepPin.Configure(machine.PinConfig{Mode: s.pio.PinMode()})
+	s.dirPin.Configure(machine.PinConfig{Mode: s.pio.PinMode()})
 
-	// Configure direction pin as regular GPIO output (not PIO)
-	core.DebugPrintln("[PIO] Configuring dir pin " + itoa(int(dirPin)) + " as GPIO output...")
-	s.dirPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	s.dirPin.Low()
-
-	// Set step pin direction BEFORE init (critical!)
+	// Set pin directions BEFORE init (critical!)
 	s.sm.SetPindirsConsecutive(s.stepPin, 1, true)
+	s.sm.SetPindirsConsecutive(s.dirPin, 1, true)
 
-	// Cache CPU frequency for fast divider calculations
-	s.cpuFreqMHz = machine.CPUFrequency() / 1000000
-
-	// Initialize and enable state machine
+	// Initialize and enable state machine, with its step counter
 	core.DebugPrintln("[PIO] Initializing state machine...")
 	s.sm.Init(offset, cfg)
+	s.counter.init(s.pioNum, s.smNum)
+	s.lastStep = core.GetTime()
+	s.lastDir = 0
 	s.sm.SetEnabled(true)
 
-	core.DebugPrintln("[PIO] Init complete, CPU freq: " + itoa(int(s.cpuFreqMHz)) + " MHz")
+	core.DebugPrintln("[PIO] Init complete, clock divider " + itoa(int(div>>8)))
 	return nil
 }
 
-// Step generates a single step pulse
+// loadProgram loads the program into the block for a step pulse of pulse
+// cycles, unless it is already there with a pulse at least as long
+func (s *StepperPIO) loadProgram(pulse uint32) error {
+	b := &blockPrograms[s.pioNum]
+	if b.offset != 0xFF && b.users == 0 && b.pulse != pulse {
+		// Nothing has run it since the last config reset
+		s.pio.ClearProgramSection(b.offset, progEnd+1)
+		b.offset = 0xFF
+	}
+	if b.offset == 0xFF {
+		offset, err := s.pio.AddProgram(buildStepperProgram(pulse), 0)
+		if err != nil {
+			return err
+		}
+		b.offset, b.pulse = offset, pulse
+	}
+	if pulse > b.pulse {
+		return errors.New("step pulse longer than the PIO block's")
+	}
+	b.users++
+	s.offset, s.pulse = b.offset, b.pulse
+	return nil
+}
+
+// QueueSegment hands a segment to the program
+// Implements core.StepperSegmentBackend interface. It returns false if the
+// interval gets too short for the program's loop. It never waits: the core
+// hands a segment over once the one before it has started, by when the
+// program has pulled that one's words and the TX FIFO is empty.
+func (s *StepperPIO) QueueSegment(seg core.StepperSegment) bool {
+	if !s.sm.IsTxFIFOEmpty() {
+		return false
+	}
+
+	// Cycles the wait changes by per step, and the first wait
+	a := int64(seg.Add) * pioCyclesPerTick
+	grow := a > 0
+	if !grow {
+		a = -a
+	}
+	loop, entry := int64(s.pulse)+stepLoopCycles, int64(entryCycles)
+	if grow {
+		loop++
+		entry--
+	}
+	wait := int64(seg.Interval)*pioCyclesPerTick - loop - 3*a
+	if grow {
+		wait += 2 * a
+	}
+
+	var y0 uint32
+	if seg.Count > 1 {
+		// The shortest wait is the first when growing, the last otherwise
+		shortest := wait
+		if !grow {
+			shortest -= int64(seg.Count-1) * a
+		}
+		if shortest < 0 || wait > 0xFFFFFFFF {
+			return false
+		}
+		y0 = uint32(wait)
+		if grow {
+			y0 = ^y0
+		}
+	}
+
+	// The lead runs from the previous segment's last step while the
+	// program may still be busy with it: exact if the words reach the FIFO
+	// before the program is back at its pull, and late by no more than the
+	// rest of its tail otherwise. Once it is idle the lead runs from now,
+	// which is up to one tick before the program pulls the words, so the
+	// first step is up to one tick late and never early.
+	now := core.GetTime()
+	var lead int64
+	late := uint32(0)
+	if idle := int32(now - s.lastStep); idle < s.tailTicks() {
+		lead = int64(seg.Clock-s.lastStep)*pioCyclesPerTick - int64(s.pulse) - tailCycles - entry
+		if lead < 0 && idle > 0 {
+			// Behind already: start once the program is back at its pull
+			late = uint32((-lead + pioCyclesPerTick - 1) / pioCyclesPerTick)
+			lead = 0
+		}
+	} else {
+		s.rearmCounter()
+		lead = int64(int32(seg.Clock-now))*pioCyclesPerTick - entry - fifoLatency
+		if lead < 0 {
+			// Behind already: start at once
+			late = now - seg.Clock + 1
+			lead = 0
+		}
+	}
+	if lead < 0 || a > 0x3FFFFFFF {
+		return false
+	}
+
+	// A dir change holds the first step back for the setup time
+	dir := s.dirBit(seg.Direction)
+	if minLead := int64(s.setup) - dirCycles; dir != s.lastDir && lead < minLead {
+		late += uint32((minLead - lead + pioCyclesPerTick - 1) / pioCyclesPerTick)
+		lead = minLead
+	}
+	if lead > 0xFFFF {
+		return false
+	}
+
+	flags := dir
+	if grow {
+		flags |= 2
+	}
+	s.put(y0, uint32(seg.Count)<<16|uint32(lead), uint32(a)<<2|flags)
+	s.lastStep = seg.LastStep() + late
+	s.lastDir = dir
+	return true
+}
+
+// StepsDone returns the steps counted by the DMA step counter
+// Implements core.StepperSegmentBackend interface
+func (s *StepperPIO) StepsDone() uint32 {
+	return s.counter.count()
+}
+
+// tailTicks returns the ticks after its last step by which the program is
+// surely back at its first pull
+func (s *StepperPIO) tailTicks() int32 {
+	return int32(s.pulse+tailCycles)/pioCyclesPerTick + 2
+}
+
+// rearmCounter restarts the step counter well before it runs out. The
+// program must be idle.
+func (s *StepperPIO) rearmCounter() {
+	if s.counter.count()-s.counter.base > stepCountMax/2 {
+		s.counter.rearm()
+	}
+}
+
+// put writes a segment's words to the TX FIFO, waiting for room in it if
+// Step outruns the program
+func (s *StepperPIO) put(y0, countLead, flags uint32) {
+	for _, w := range [3]uint32{y0, countLead, flags} {
+		for s.sm.IsTxFIFOFull() {
+		}
+		s.sm.TxPut(w)
+	}
+}
+
+// dirBit returns the dir pin level for a direction
+func (s *StepperPIO) dirBit(dir bool) uint32 {
+	if dir != s.invertDir {
+		return 1
+	}
+	return 0
+}
+
+// Step generates a single step pulse, after any queued segment
 // Implements core.StepperBackend interface
 func (s *StepperPIO) Step() {
-	// Queue single step with current direction
-	s.QueueSteps(1)
+	// A dir change holds the step back for the setup time
+	dir := s.dirBit(s.direction)
+	lead := uint32(0)
+	if dir != s.lastDir && s.setup > dirCycles {
+		lead = s.setup - dirCycles
+	}
+	s.put(0, 1<<16|lead, dir)
+	s.lastDir = dir
+	if now := core.GetTime() + (lead+pioCyclesPerTick-1)/pioCyclesPerTick; int32(now-s.lastStep) > 0 {
+		s.lastStep = now
+	}
 }
 
-// SetDirection sets the direction for the next step(s)
+// SetDirection sets the direction of the next Step
 // Implements core.StepperBackend interface
-// Direction is controlled via GPIO (not PIO)
+// The program sets the dir pin before the step, after queued segments.
 func (s *StepperPIO) SetDirection(dir bool) {
 	s.direction = dir
-	if dir {
-		s.dirPin.High()
-	} else {
-		s.dirPin.Low()
-	}
 }
 
-// Stop immediately halts the stepper
+// Stop immediately halts the stepper and drops queued segments
 // Implements core.StepperBackend interface
 func (s *StepperPIO) Stop() {
+	asm := piolib.AssemblerV0{SidesetBits: 0}
+
 	s.sm.SetEnabled(false)
+	// Let the step counter take the last step before the FIFOs are cleared
+	for !s.sm.IsRxFIFOEmpty() {
+	}
 	s.sm.ClearFIFOs()
 	s.sm.Restart()
+	// End a pulse cut short; in StepModeEdge either level is idle, and
+	// changing it would make a step
+	if !s.edge {
+		s.sm.Exec(asm.Set(piolib.SetDestPins, 0).Encode())
+	}
+	s.sm.Exec(asm.Jmp(s.offset, piolib.JmpAlways).Encode())
 	s.sm.SetEnabled(true)
+	s.lastStep = core.GetTime()
 }
 
 // GetName returns the backend name
@@ -190,23 +457,29 @@ func (s *StepperPIO) GetName() string {
 
 // GetInfo returns backend performance information
 func (s *StepperPIO) GetInfo() core.StepperBackendInfo {
+	pioFreq := core.GetGlobalDictionary().ClockFreq() * pioCyclesPerTick
 	return core.StepperBackendInfo{
 		Name:          s.GetName(),
-		MaxStepRate:   500000, // 500 kHz
-		MinPulseNs:    64,     // ~64ns @ 125MHz with 8 cycle delay
-		TypicalJitter: 10,     // <10ns jitter (hardware-timed)
-		CPUOverhead:   1,      // ~1% CPU (only FIFO management)
+		MaxStepRate:   pioFreq / (s.pulse + stepLoopCycles),
+		MinPulseNs:    uint32(uint64(s.pulse) * 1000000000 / uint64(pioFreq)),
+		TypicalJitter: 200, // One PIO cycle
+		CPUOverhead:   1,   // One timer event per queue_step
 	}
 }
 
-// QueueSteps queues multiple steps to PIO
-// This is the efficient way to send steps - queue many at once
-// Direction must be set via SetDirection() before calling this
+// QueueSteps queues count steps at the SetStepInterval rate, after any
+// queued segment (for bench testing without the core)
 func (s *StepperPIO) QueueSteps(count uint16) {
-	// Wait for FIFO space and send count
-	for s.sm.IsTxFIFOFull() {
+	prev := s.lastStep
+	if now := core.GetTime(); int32(now-prev) > 0 {
+		prev = now
 	}
-	s.sm.TxPut(uint32(count))
+	s.QueueSegment(core.StepperSegment{
+		Clock:     prev + s.interval,
+		Interval:  s.interval,
+		Count:     count,
+		Direction: s.direction,
+	})
 }
 
 // SendSteps queues steps with explicit direction
@@ -218,64 +491,14 @@ func (s *StepperPIO) SendSteps(steps uint16, direction bool) {
 
 // IsBusy returns true if the stepper has pending steps
 func (s *StepperPIO) IsBusy() bool {
-	return !s.sm.IsTxFIFOEmpty()
-}
-
-// SetClockDiv sets the clock divider to control step rate
-// Higher values = slower steps
-// With 125MHz CPU: divider 125 = 1MHz = 1us per PIO cycle
-// Each step takes ~18 PIO cycles, so 1MHz / 18 ≈ 55kHz max step rate
-func (s *StepperPIO) SetClockDiv(whole uint16, frac uint8) {
-	s.sm.SetClkDiv(whole, frac)
+	return !s.sm.IsTxFIFOEmpty() || int32(s.lastStep-core.GetTime()) > 0
 }
 
 // SetStepInterval implements core.StepperBackend interface
-// Sets the PIO clock divider based on the requested step interval
-// intervalTicks: time between steps in CLOCK_FREQ ticks (1 MHz = 1 µs for RP2350)
+// The program times segments itself; the interval is only used by
+// QueueSteps.
 func (s *StepperPIO) SetStepInterval(intervalTicks uint32) {
-	// Use cached CPU frequency (set during Init) for fast calculation
-	// Supports 150MHz, 300MHz, etc. based on actual runtime frequency
-	cpuFreqMHz := s.cpuFreqMHz
-
-	// Each step takes 16 PIO cycles (8 HIGH + 8 LOW with Delay(7) each)
-	//
-	// Step timing calculation:
-	//   step_time_us = 16 * divider / cpuFreqMHz
-	//
-	// We want the step pulse to complete well within the interval
-	// so the timer system can control precise timing between steps.
-	//
-	// Strategy:
-	//   - Calculate divider to make pulse complete in ~intervalTicks/4
-	//   - Clamp to reasonable bounds (min pulse ~1µs, max divider 65535)
-	//
-	// divider = (interval_us / 4) * cpuFreqMHz / pioCycles
-	//         = interval_us * cpuFreqMHz / 64
-
-	const pioCycles = 16 // cycles per step (8 HIGH + 8 LOW)
-
-	// Calculate target divider
-	// We want step pulse to complete in interval/4 to leave timing slack
-	// divider = (interval_us / 4) * cpuFreqMHz / pioCycles
-	var divider uint32
-	if intervalTicks >= 4 {
-		divider = (intervalTicks * cpuFreqMHz) / (pioCycles * 4)
-	} else {
-		// Very fast stepping - use minimum divider for fastest pulses
-		divider = 1
-	}
-
-	// Clamp divider to valid range
-	// Minimum divider ~10 gives ~1µs pulse width (safe for most drivers)
-	// Maximum divider is 65535 (16-bit)
-	if divider < 10 {
-		divider = 10
-	}
-	if divider > 65535 {
-		divider = 65535
-	}
-
-	s.sm.SetClkDiv(uint16(divider), 0)
+	s.interval = intervalTicks
 }
 
 // itoa converts int to string without importing strconv (for embedded)
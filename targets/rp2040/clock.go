@@ -3,7 +3,9 @@
 package main
 
 import (
+	"device/rp"
 	"gopper/core"
+	"runtime/interrupt"
 	"runtime/volatile"
 	"unsafe"
 )
@@ -11,22 +13,33 @@ import (
 // RP2040/RP2350 Timer peripheral memory map
 const (
 	timerBase     = 0x40054000
-	timerTIMERAWH = timerBase + 0x08 // Raw timer high word
-	timerTIMERAWL = timerBase + 0x0C // Raw timer low word
+	timerTIMERAWH = timerBase + 0x24 // Raw timer high word (no latching, safe from interrupts)
+	timerTIMERAWL = timerBase + 0x28 // Raw timer low word
+	timerALARM1   = timerBase + 0x14 // Alarm 1 target (writing arms it)
+	timerARMED    = timerBase + 0x20 // Armed alarms (write 1 to disarm)
+	timerINTR     = timerBase + 0x34 // Raw interrupts (write 1 to clear)
+	timerINTE     = timerBase + 0x38 // Interrupt enable
+	timerINTF     = timerBase + 0x3C // Interrupt force
 )
 
+// Timer dispatch uses alarm 1; TinyGo's runtime sleeps on alarm 0
+const timerAlarmBit = 1 << 1
+
 var (
-	timerRAWH = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTIMERAWH)))
-	timerRAWL = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTIMERAWL)))
+	timerRAWH   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTIMERAWH)))
+	timerRAWL   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTIMERAWL)))
+	timerAlarm1 = (*volatile.Register32)(unsafe.Pointer(uintptr(timerALARM1)))
+	timerArmed  = (*volatile.Register32)(unsafe.Pointer(uintptr(timerARMED)))
+	timerIntr   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerINTR)))
+	timerInte   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerINTE)))
+	timerIntf   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerINTF)))
 )
 
 // InitClock initializes the RP2040 hardware timer
 // The RP2040 has a 64-bit microsecond timer at 1MHz
+// MCU and CLOCK_FREQ are registered from chip.RP2040
 func InitClock() {
 	// RP2040 timer runs at 1MHz by default
-	// Register MCU-specific constant
-	core.RegisterConstant("MCU", "rp2040")
-	core.RegisterConstant("CLOCK_FREQ", uint32(1000000)) // 1MHz
 }
 
 // GetHardwareTime reads the RP2040 hardware timer
@@ -58,3 +71,31 @@ func GetHardwareUptime() uint64 {
 func UpdateSystemTime() {
 	core.SetTime(GetHardwareTime())
 }
+
+// InitTimerAlarm hands alarm 1 to the scheduler, which from then on
+// dispatches timers from its interrupt rather than the main loop
+func InitTimerAlarm() {
+	timerIntr.Set(timerAlarmBit)
+	timerInte.SetBits(timerAlarmBit)
+	irq := interrupt.New(rp.IRQ_TIMER_IRQ_1, timerAlarmIRQ)
+	irq.Enable()
+	core.SetTimerAlarm(SetTimerAlarm)
+}
+
+// SetTimerAlarm arms alarm 1 for wake
+// An alarm armed for a time that has already passed would not fire until
+// the counter wraps, so in that case the interrupt is forced instead.
+func SetTimerAlarm(wake uint32) {
+	timerAlarm1.Set(wake)
+	if int32(GetHardwareTime()-wake) >= 0 && timerArmed.HasBits(timerAlarmBit) {
+		timerArmed.Set(timerAlarmBit)
+		timerIntf.SetBits(timerAlarmBit)
+	}
+}
+
+// timerAlarmIRQ dispatches the due timers and re-arms the alarm
+func timerAlarmIRQ(interrupt.Interrupt) {
+	timerIntf.ClearBits(timerAlarmBit)
+	timerIntr.Set(timerAlarmBit)
+	core.ProcessTimers()
+}
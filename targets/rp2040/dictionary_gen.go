@@ -0,0 +1,72 @@
+// Code generated by gopper-dictgen -target rp2040; DO NOT EDIT.
+
+//go:build rp2040
+
+package main
+
+// dictionaryBlob is the zlib-compressed data dictionary (1901 bytes)
+// As a string constant it stays in flash.
+const dictionaryBlob = "" +
+	"\x78\x9c\xbd\x57\x5b\x6f\xe3\xb6\x12\xfe\x2b\x82\x80\xc5\x01\x0e\xdc\x85\x25\x5b\x96\x1d\x60\x1f\xd2\xac\xcf\x05\xe7\x04\xdd\x26" +
+	"\x59\xb4\x6f\x82\x2c\xd1\x36\x1b\x59\x52\x29\x29\x59\xb7\xc8\x7f\xef\x37\x33\x14\x25\x5f\x16\x2d\xd0\xa2\x7e\x90\x87\xe4\x90\x73" +
+	"\xe5\xc7\x99\x5f\xfd\x17\x65\x1a\x5d\x95\xfe\x8d\xbf\xab\xea\x5a\x99\x6f\xa6\xef\x83\xf7\x53\x7f\xe2\x6f\x3a\x5d\xe4\x89\x5d\x6e" +
+	"\x78\xfd\x9b\x56\x97\xc7\x5d\x85\xc5\xac\x2a\xb7\x7a\xe7\xdf\xfc\xea\xdf\x7e\xbc\x4b\xee\x6f\x7f\xc4\xfa\x7c\xba\x8a\xb0\x74\xf7" +
+	"\xff\xef\xee\xfe\x97\xfc\xeb\x61\xfd\x3d\xe6\x82\x29\xff\x30\x7d\x7f\xf7\x19\x63\x53\x87\xd3\x39\x0d\x3f\xfd\x70\x6f\xb7\x85\x11" +
+	"\xed\x7a\x7c\xba\x7d\x7a\x4c\x1e\x3f\xdf\x3f\x7e\x9f\x7c\x7b\xfb\xb8\xe6\x85\x05\x2f\xac\x3f\x7d\x5a\x3f\x24\xdf\x7e\xf7\xf4\x9f" +
+	"\x64\xfd\xf1\xdf\xb4\x12\xf8\x6f\xa4\xc2\xe1\x90\x96\x79\x43\x4a\xe8\x5c\x95\xad\xde\x1e\xbd\x6a\xbb\x6d\x54\xfb\xe1\x5d\xe7\x65" +
+	"\x55\x57\x82\xc8\xfc\x9b\x60\xe2\xef\x54\x9b\x74\x75\xab\x0f\xca\xbf\x09\x65\x98\x15\x55\xf6\xec\xdf\xcc\xec\xc8\xda\x33\xef\x4d" +
+	"\x4b\x8c\xc2\x41\xfe\x4d\x34\xf1\xb7\xba\x4c\x0b\xfd\x8b\xb2\x4c\x5e\x66\x32\x08\xf0\x6f\x16\x13\x3f\x2d\x70\x4a\xda\xaa\xa4\xd2" +
+	"\x79\x33\x12\x19\x4f\x7c\x75\x50\x66\xa7\xca\xec\x98\x34\x6d\x55\xfb\x37\x4b\x9c\x5c\xa8\xd4\x24\xcd\xbe\x6b\xf3\xea\x15\x1e\x5f" +
+	"\x4d\x7c\x2b\x25\x98\x4e\xfc\x5c\x6d\x3a\x12\x9b\xe6\x5e\x65\x72\x65\x70\x90\x97\xe6\xb9\x61\x59\x41\xd0\x33\x94\x74\x58\x00\xb5" +
+	"\xb1\x31\xe1\x29\x4f\x95\xe9\xa6\x50\x62\xeb\x5c\xec\x69\xd3\xe6\x19\x82\xd3\x16\xee\x09\x22\x3b\x07\xf3\x8d\x4c\x7a\x2c\x57\x76" +
+	"\x2c\x9c\xc9\x29\xec\xac\x76\x89\x2e\x3d\x98\x43\xe2\x6b\x5d\xb2\xf4\x10\xf6\xfc\xdc\x29\x73\xbc\x64\x61\x37\x92\xbf\x9b\xf4\x50" +
+	"\x17\x0a\x42\xb2\xe7\x66\x34\xee\x7d\x42\x12\xdb\x61\xf5\xa0\xcb\xe4\x25\x2d\x3a\x68\xbd\xc7\x28\xfd\x32\x1a\x99\xb4\xdc\x61\xe3" +
+	"\x5e\x65\xcf\xc9\xe0\xd2\x70\xe9\xf4\xcc\xf5\x4e\xb7\x69\x91\x54\x5d\x7b\xaa\xa9\x67\x0f\xc9\xbc\x5c\x6d\xd3\xae\x68\x13\x37\x41" +
+	"\x22\xf2\xce\xa4\x2d\x92\x99\x6d\x9a\x4d\xd9\xa6\x4e\x5d\x3b\xce\x59\x55\x95\x4e\x67\x6c\x41\x10\xba\x3a\xa7\x78\x5f\xd9\xd3\x8b" +
+	"\x02\x5f\x68\xa3\x33\x30\x25\xf5\xeb\x21\xc9\x8e\xc8\x00\x27\x82\x06\xe3\xc3\x67\xce\x3e\xe2\xbd\xb4\xed\x74\x83\x37\xf8\xeb\xcc" +
+	"\x56\xeb\xcf\x53\x63\xe7\xbd\xb1\x67\x67\x3b\x43\xdd\x66\x30\x47\xa2\xfe\x19\xeb\x98\x63\xc8\x99\xa6\xd6\xe7\x7a\x36\x49\x9a\xb5" +
+	"\xfa\x45\x25\x7b\xbd\xdb\x8b\x43\xe2\x31\x7f\xf2\xaa\xdb\x3d\xf9\x24\x6b\xec\x56\x70\x20\xba\xb4\x44\x72\x37\x5d\x3f\xef\xd1\x14" +
+	"\x86\x9c\x31\x55\xae\xe8\x1f\x56\x29\xb1\x69\x75\x72\x68\x7f\xad\xc6\x5b\x7b\xd2\x2e\x25\x87\x66\xf7\xe1\xdd\x3f\x71\x25\xe6\x53" +
+	"\x11\xd7\x22\xd7\x9a\xad\x32\xfd\x26\xc4\x36\xb5\x1c\x41\xaf\x50\x99\x5f\x59\x0d\x9d\xec\xd6\x34\xc7\x32\x73\x86\xcc\xe1\x69\x99" +
+	"\xa2\x9b\x66\x9c\xf7\x8c\xaa\x2b\x63\x51\x87\xcd\x90\xb1\x0b\xa7\xfa\x52\x6b\xa3\xe8\xfa\x37\x14\x33\x3a\x29\x1a\x4e\xb2\xb7\xf7" +
+	"\x4a\xe0\xc0\xb7\x70\x7c\xad\xd1\xbb\xdd\x60\xcd\xf8\xb0\x21\x02\x3a\x1c\x69\x0b\x1f\x62\x7c\xee\x76\x9a\xb2\x6e\xb7\xee\x66\x24" +
+	"\x52\x8d\xa4\x6a\x34\x95\x5d\xaf\x46\xb7\xea\xd2\x39\x51\x20\xcb\x02\x65\xbd\x2a\xec\x79\x52\x29\x4f\x0a\x25\x59\x19\x0d\x5e\x84" +
+	"\x97\x09\x26\xcf\x52\xa9\xee\x8a\x02\xb8\xcd\xaa\x46\x70\xac\xe5\x4a\xf6\xd5\x41\xfd\x49\x00\xaa\x07\x00\xca\x3c\xeb\x3e\x7b\xa2" +
+	"\xf5\xe2\x38\x16\x51\x34\x08\x17\x20\x24\x18\x55\xce\x8f\xd1\x05\x88\x9e\x19\x94\xe6\xc3\xf1\x7b\x68\xb2\xaf\x8a\x9c\xd4\xe8\x65" +
+	"\xa5\x9b\xea\x85\x55\xd9\x1f\x9b\x56\x81\x41\x5b\x57\xe3\x5e\x9c\x9e\xf8\x57\x18\xff\xfb\xf6\xae\x2e\xc4\x5e\x33\x7b\x31\x1d\x67" +
+	"\xd5\xb9\xcd\x34\xe5\xcc\xcf\xf9\x3d\xc3\x6d\x6a\x2a\x93\xb4\xc7\x5a\x50\x5a\xe3\xbc\x32\x83\xde\xd7\x7c\xb2\x51\x45\xf5\x7a\xc5" +
+	"\x27\x8b\x50\xf2\xeb\xef\x74\xc8\x62\x76\x2a\xf3\xaa\x37\x86\xe2\x01\xfa\x52\x2d\xe5\xb0\x08\xc3\x84\x73\x9a\x6c\x36\x3d\xa9\x4b" +
+	"\x54\x57\x2d\x33\x0f\x5c\x5d\xd1\x8c\x9f\x85\xc5\xa2\x47\x6e\x5a\x76\xae\x2d\xe1\x10\xa4\xef\x87\xa1\xd0\xd9\xf3\x1d\xc5\xbf\xc6" +
+	"\xa6\x58\x10\xbc\x54\x5f\xe4\x78\x3c\x45\x03\xc6\x69\x23\xea\x2e\x6d\xf9\x21\x1c\xec\xb9\x4b\x74\x59\x20\x13\xac\x35\x09\x15\x11" +
+	"\x75\xd5\x68\x7a\x56\x9c\xd5\xf1\xf4\x94\x41\x97\xdb\x6a\x58\x0c\x86\x45\xf6\x1b\xbd\xa7\xa7\x20\x75\xe2\x7a\xec\x18\x30\x21\x37" +
+	"\x78\x44\xcc\x70\x16\x3c\x21\x53\x27\xc8\x52\xa7\x26\x3d\x34\x82\x3c\x71\xec\x58\xbe\x82\x4d\xf1\xd2\x71\x30\x3c\xc3\x9e\xa2\x70" +
+	"\x47\x81\x1e\xb9\x3e\x5e\x8d\x78\xa1\xfb\x88\x15\xe5\xdc\xd4\x2d\x5e\xcb\x85\x65\xe0\x96\xbb\x12\xe0\xa7\x29\x83\x87\xd5\xf0\x8d" +
+	"\x7d\x5f\xa3\xb0\x56\x27\x05\x6c\xd2\xcf\x8e\x2a\xd9\x41\xfb\x51\x95\xd8\xe0\xc5\xf7\x24\x03\x50\xc3\x91\xd3\x38\x7e\x43\xe0\x82" +
+	"\x98\x8a\x15\x7a\x35\x3c\x79\x87\xbb\xf1\xa2\x2b\xa6\x3c\xdd\xd8\xba\x96\xe3\xce\xa5\x2d\xcd\xf5\x6f\x26\xcd\x1e\x80\x4d\x89\x4b" +
+	"\x33\xec\xa6\x9c\xe8\x9f\xdb\xe1\xc6\xc1\x01\x9a\x5e\x3d\xa3\x4b\xe0\x41\x2e\xbc\x21\xbd\x15\xc3\x71\x5f\xe3\xe2\x3c\xa1\xc2\xd4" +
+	"\x8a\xc1\x71\xdd\xc1\xfe\x35\x3f\xb3\xce\x21\x8c\x1c\xca\x5a\x5c\x81\x5c\x7d\x21\xed\xca\xf4\xa0\xe4\x6d\xe9\xca\x66\xb4\x13\x45" +
+	"\x90\xec\xc3\xd5\x1d\x97\xbe\x42\x43\x17\x29\xb1\x9d\x40\xe1\xf7\xda\xaa\xa2\xbb\xd0\xf0\xab\xb7\x99\xf2\x37\xe0\x6f\xc8\xdf\x19" +
+	"\x7f\xe7\xfc\x8d\xf8\xbb\xe0\x6f\x2c\xc2\x18\x03\xf0\x90\x93\x57\x92\xde\x24\xa3\x4e\x24\xc1\xdf\x2d\x80\x44\xe5\xd7\xb4\x8d\x4e" +
+	"\xb4\x25\xc0\x41\x8a\x03\xab\x94\x31\x95\x61\xfb\x8a\x0a\xc9\xe8\xf8\x17\x0e\xa9\xf1\xa2\x8d\x93\xd0\xe3\xdb\x7f\xad\xc0\x0b\x57" +
+	"\xa7\xd5\xcf\x28\xe9\x64\x67\x3f\xb6\xc5\xce\x6c\x5c\xd2\x0c\xe7\x67\xa9\xbb\xcc\x57\x51\x73\x5c\xa3\x2c\x87\x92\xe0\x77\xa4\x45" +
+	"\xb3\xe1\xa9\x3d\x11\x07\x98\x47\xca\x5c\x1a\x36\x7e\xc9\xb1\x3d\xbe\x78\xb9\xfe\xd0\x29\xf6\x04\x42\xbc\xe0\x14\xea\xff\xd0\xf6" +
+	"\xfe\x25\x93\x13\xa2\x01\xf5\xce\xf0\x12\x18\x83\x18\x02\xa2\xe3\xd9\xc0\x73\x86\x88\xc2\x32\xf2\x5e\x3c\x1f\x78\x47\xf0\xea\x6d" +
+	"\xd2\xec\x19\x5a\x7e\x78\xf7\x1e\xd9\x4f\x35\x3f\x03\x79\x5f\xb1\x51\x8b\x25\xaf\x89\x5c\x8b\x9f\x74\x0b\x0c\xb2\x83\xac\xee\x12" +
+	"\xdc\x6a\xb3\x47\x40\x04\x5d\x23\x07\x58\x84\x37\x97\xc8\xb9\x9c\x8d\x91\x73\x94\x05\x0c\x1e\x9d\x51\x3c\x92\xca\x9f\x28\xce\x57" +
+	"\xa0\x46\x2e\x71\x59\xce\xdd\x76\x86\xd9\xaf\x08\x89\xde\x28\xfa\x1d\xf2\x9f\x9b\x17\xc6\x46\x04\x98\xfe\x76\xb5\xae\xa6\x8c\x81" +
+	"\x44\x05\xd2\xd7\x83\x0a\xa5\xa5\x07\x35\x93\x76\x1e\xd4\x9c\x3b\x79\xa2\x22\x6e\xe1\x89\x5a\x70\xc7\x4e\x54\xcc\x0d\x3a\x51\x4b" +
+	"\xee\xcb\x89\x5a\x71\x3b\xce\x27\x4f\xa5\x1f\x67\x3a\x90\xd6\x9b\xe9\x50\x80\x96\xe9\x99\xf4\xe0\x4c\xcf\x6d\xdb\x4d\x74\x64\xdb" +
+	"\x6d\xa2\x17\xd2\x5c\x33\x1d\x0b\x20\x33\xbd\x14\xfc\x65\x7a\x25\x68\xca\x76\x4c\x05\x2d\x99\x0e\x04\x13\x99\x0e\x05\xfb\x98\x9e" +
+	"\x09\x9e\x31\x3d\x17\xb8\x61\x3a\x12\xe4\x60\x7a\x21\xa8\xc0\x74\x2c\xcd\x3b\xd3\x4b\x69\xa2\x99\x5e\x09\x0a\xdc\x7e\xbc\x9b\x4a" +
+	"\x2b\x0c\x2a\x90\x0e\x17\x54\x28\x3d\x2c\xa8\x99\x34\xa6\xa0\x92\xa7\xf5\xfd\xa7\xf5\xc3\xed\xd3\xe7\x87\x35\x35\x94\x6f\x3d\x4e" +
+	"\x31\x92\x52\x80\xaa\x76\x4f\xc4\x50\x0f\x70\x88\x46\x4d\x30\x07\x0a\x5d\x25\x87\xc9\x81\x16\x87\xca\x5e\x36\x0e\x96\x60\x0d\x47" +
+	"\x4b\x32\x06\xe1\x7a\x7b\x93\x07\xc2\x3d\x1d\x9c\x19\xd0\xdd\x7f\x50\x4d\xb6\x57\x79\x57\xa8\x5c\xa0\x1d\x2f\x03\x6a\x6c\xc5\xa8" +
+	"\xe9\x4f\x7c\x58\x45\xea\x7b\xdc\x3b\x6d\xd1\xcf\x94\x3b\x85\x69\x98\xe8\xaf\xc1\xbd\x53\x65\x76\xf4\x58\xf6\xc4\x87\xb5\xfe\x7f" +
+	"\xc3\x3b\x4f\x8a\x07\xce\x60\xcc\xce\xed\x2c\x57\x1d\xfd\x24\x1c\xee\x23\x7d\x1b\x2f\x2d\x68\xfe\x88\x7f\xdc\x57\xdc\x8b\x1c\x8b" +
+	"\x88\x80\x7f\x97\x96\xff\x68\xbd\xb4\x69\xf4\x8e\x2f\x3f\xa6\x63\x3a\xa8\x04\xd2\x68\xae\x5e\x3c\x2a\x83\x31\x8d\xb8\xf8\x9f\xcb" +
+	"\xe7\x92\x9e\x47\x6b\xf0\xc4\x47\x80\xfc\x7b\xdc\x50\x8f\x8b\x3f\x8f\xee\xea\x16\xe5\x30\x19\x44\x56\xdb\x12\x89\xeb\x37\xaf\x2a" +
+	"\x0b\xc8\x7f\x49\x75\x91\x6e\x0a\xe5\xbd\xee\x55\xe9\x7a\x5e\xda\x40\x2e\x78\x62\xd7\xe0\xba\xd7\xde\x16\x5d\x15\x4d\x87\x23\xb9" +
+	"\xee\x7d\x16\xf4\xf6\xdf\xde\x7e\x03\xe4\xdf\xb6\x2f"
+
+// dictionaryHash is the fingerprint of the registry the blob was built from
+const dictionaryHash = 0x3975bd8b
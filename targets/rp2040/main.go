@@ -2,10 +2,13 @@
 
 package main
 
+//go:generate go run ../../cmd/gopper-dictgen -target rp2040
+
 import (
 	"gopper/core"
 	"gopper/protocol"
-	// piostepper "gopper/targets/pio" // TEMPORARILY DISABLED FOR DEBUGGING
+	"gopper/targets/chip"
+	piostepper "gopper/targets/pio"
 	"machine"
 	"time"
 )
@@ -39,52 +42,24 @@ func main() {
 
 	// Initialize clock
 	InitClock()
+	core.SetHardwareTimerFunc(GetHardwareTime)
+	core.SetHardwareUptimeFunc(GetHardwareUptime)
 	core.TimerInit()
 
-	// Initialize core commands
-	core.InitCoreCommands()
-
-	// Initialize ADC commands
-	core.InitADCCommands()
-
-	// Initialize GPIO commands
-	core.InitGPIOCommands()
-
-	// Initialize PWM commands
-	core.InitPWMCommands()
-
-	// Initialize SPI commands
-	core.InitSPICommands()
-
-	// Initialize trigger sync commands (needed for stepper homing)
-	core.InitTriggerSyncCommands()
+	// Timers are dispatched from the alarm interrupt from here on, on
+	// core 1 in dual-core builds
+	startTimerCore()
 
-	// Initialize I2C commands
-	core.InitI2CCommands()
+	// Register all commands (same order as cmd/gopper-dictgen)
+	core.RegisterFirmwareCommands()
 
-	// Initialize endstop commands
-	core.InitEndstopCommands()
-	core.InitAnalogEndstopCommands()
-	core.InitI2CEndstopCommands()
+	// Stepper backends: PIO state machines, then GPIO
+	piostepper.InitSteppers()
 
-	// Initialize trigger sync commands
-	core.InitTriggerSyncCommands()
-
-	// Initialize stepper commands and backend
-	// TEMPORARILY DISABLED FOR DEBUGGING
-	// piostepper.InitSteppers()
-
-	// Register stepper commands but without backend (for testing)
-	core.RegisterStepperCommands()
-
-	// Initialize driver registry commands
-	core.InitDriverCommands()
-
-	// Register combined pin enumeration for RP2040
-	// This must happen before BuildDictionary()
+	// Register MCU constants and the combined pin enumeration
 	// Indices 0-29: GPIO pins (gpio0-gpio29)
 	// Indices 30-34: ADC channels (ADC0-ADC3, ADC_TEMPERATURE)
-	registerRP2040Pins()
+	chip.RP2040.Register()
 
 	// Initialize and register ADC driver (without registering pins - already done above)
 	adcDriver := NewRPAdcDriver()
@@ -104,9 +79,9 @@ func main() {
 	softwareSPIDriver := NewRP2040SoftwareSPIDriver()
 	core.SetSoftwareSPIDriver(softwareSPIDriver)
 
-	// Build and cache dictionary after all commands registered
-	// This compresses the dictionary with zlib
-	core.GetGlobalDictionary().BuildDictionary()
+	// Serve the dictionary generated at build time (see dictionary_gen.go)
+	// Falls back to building it here if the registry no longer matches
+	core.GetGlobalDictionary().SetPrecompressed(dictionaryBlob, dictionaryHash)
 	// Create buffers
 	inputBuffer = protocol.NewFifoBuffer(256)
 	outputBuffer = protocol.NewScratchOutput()
@@ -114,11 +89,11 @@ func main() {
 	// Create transport with a command handler and reset callback
 	transport = protocol.NewTransport(outputBuffer, handleCommand)
 	transport.SetResetCallback(func() {
-		// Clear buffers on host reset
+		// Clear buffers on host reset. The sequence restarting is only a
+		// guess at a reset (a retransmit after a lost ACK looks the same),
+		// so the configuration is kept; config_reset releases it.
 		inputBuffer.Reset()
 		outputBuffer.Reset()
-
-		core.ResetFirmwareState() // Clear the shutdown flag and config state
 	})
 	// Set flush callback to immediately send ACKs to USB
 	// This is critical - serialqueue expects ACK before response
@@ -151,6 +126,9 @@ func main() {
 				}
 			}()
 
+			// Start of this iteration, for the load statistics
+			loopStart := GetHardwareTime()
+
 			// Update system time from hardware
 			UpdateSystemTime()
 
@@ -201,15 +179,12 @@ func main() {
 				messagesSent++
 			}
 
-			// Check for pending reset after all messages sent
-			// This ensures the ACK has been transmitted before reset
-			core.CheckPendingReset()
-
-			// Process scheduled timers
-			core.ProcessTimers()
+			// Run the tasks after all messages are sent, so a pending
+			// reset happens once the ACK has been transmitted
+			core.RunTasks()
 
-			// Run an analog-in task to send any pending analog_in_state reports.
-			core.AnalogInTask()
+			// Record the iteration's run time and send stats when due
+			core.StatsUpdate(loopStart, GetHardwareTime())
 		}()
 
 		// Yield to other goroutines
@@ -268,97 +243,3 @@ func usbReaderLoop() {
 func handleCommand(cmdID uint16, data *[]byte) error {
 	return core.DispatchCommand(cmdID, data)
 }
-
-// registerRP2040Pins registers all pin names for the RP2040
-// Combines GPIO pins (0-29) and ADC channels (30-34) into a single enumeration
-func registerRP2040Pins() {
-	// Total: 30 GPIO pins + 5 ADC channels = 35 total pins
-	pinNames := make([]string, 35)
-
-	// Indices 0-29: GPIO pins (gpio0-gpio29)
-	for i := 0; i < 30; i++ {
-		pinNames[i] = "gpio" + itoa(i)
-	}
-
-	// Indices 30-34: ADC channels
-	pinNames[30] = "ADC0"
-	pinNames[31] = "ADC1"
-	pinNames[32] = "ADC2"
-	pinNames[33] = "ADC3"
-	pinNames[34] = "ADC_TEMPERATURE"
-
-	// Register the combined enumeration
-	core.RegisterEnumeration("pin", pinNames)
-}
-
-// itoa converts int to string without importing strconv (for embedded)
-func itoa(i int) string {
-	if i == 0 {
-		return "0"
-	}
-
-	// Handle negative numbers
-	negative := i < 0
-	if negative {
-		i = -i
-	}
-
-	// Convert to string
-	var buf [20]byte
-	pos := len(buf)
-	for i > 0 {
-		pos--
-		buf[pos] = byte('0' + i%10)
-		i /= 10
-	}
-
-	if negative {
-		pos--
-		buf[pos] = '-'
-	}
-
-	return string(buf[pos:])
-}
-
-// writeUSB writes available data from output buffer to USB
-func writeUSB() {
-	result := outputBuffer.Result()
-	if len(result) > 0 {
-		// Write all data, handling partial writes
-		written := 0
-		for written < len(result) {
-			n, err := USBWriteBytes(result[written:])
-			if err != nil {
-				// Write error - likely disconnect
-				consecutiveWriteFailures++
-				// After several failures, mark as disconnected and clear stale data
-				if consecutiveWriteFailures > 10 {
-					usbWasDisconnected = true
-					consecutiveWriteFailures = 0
-					// Clear output buffer - don't keep trying to send stale data
-					outputBuffer.Reset()
-					// Also clear input buffer for a clean state
-					inputBuffer.Reset()
-				}
-				return
-			}
-			if n == 0 {
-				// No progress - likely disconnect
-				consecutiveWriteFailures++
-				if consecutiveWriteFailures > 10 {
-					usbWasDisconnected = true
-					consecutiveWriteFailures = 0
-					outputBuffer.Reset()
-					inputBuffer.Reset()
-				}
-				return
-			}
-			written += n
-		}
-		// Successfully wrote everything
-		if written == len(result) {
-			consecutiveWriteFailures = 0 // Reset failure counter on success
-			outputBuffer.Reset()
-		}
-	}
-}
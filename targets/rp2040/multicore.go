@@ -0,0 +1,125 @@
+//go:build rp2040 && dualcore
+
+package main
+
+import (
+	"device/arm"
+	"gopper/core"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// Dual-core build (-tags dualcore): core 1 takes the timer alarm interrupt
+// and runs every timer handler, core 0 keeps USB, the transport, commands
+// and tasks. See core/multicore.go for what each core may call.
+
+// SIO registers shared by both cores
+const (
+	sioBase     = 0xd0000000
+	sioCPUID    = sioBase + 0x000 // Number of the core reading it
+	sioFIFOST   = sioBase + 0x050 // Inter-core FIFO status
+	sioFIFOWR   = sioBase + 0x054 // Write to the other core's FIFO
+	sioFIFORD   = sioBase + 0x058 // Read from this core's FIFO
+	sioSpinlock = sioBase + 0x100 // Spinlock 0; the others follow 4 bytes apart
+
+	sioFIFOVLD = 1 << 0 // This core's FIFO holds data
+	sioFIFORDY = 1 << 1 // The other core's FIFO has room
+
+	// Spinlock used by the core lock. The Pico SDK leaves 24 to 31 free
+	// for applications.
+	coreSpinlockNum = 31
+
+	ppbVTOR = 0xe000ed08 // Vector table offset, handed to core 1 at launch
+)
+
+var (
+	sioCPUIDReg  = (*volatile.Register32)(unsafe.Pointer(uintptr(sioCPUID)))
+	sioFIFOSTReg = (*volatile.Register32)(unsafe.Pointer(uintptr(sioFIFOST)))
+	sioFIFOWRReg = (*volatile.Register32)(unsafe.Pointer(uintptr(sioFIFOWR)))
+	sioFIFORDReg = (*volatile.Register32)(unsafe.Pointer(uintptr(sioFIFORD)))
+	coreSpinlock = (*volatile.Register32)(unsafe.Pointer(uintptr(sioSpinlock + 4*coreSpinlockNum)))
+	vtorReg      = (*volatile.Register32)(unsafe.Pointer(uintptr(ppbVTOR)))
+
+	// Core 1 only runs timer handlers and never allocates, so a small
+	// static stack is enough (uint64 keeps it 8-byte aligned). The garbage
+	// collector does not scan it; see core/multicore.go for what that
+	// requires of the timer handlers.
+	core1Stack [512]uint64
+)
+
+// rpCoreLock is the core lock backed by an SIO hardware spinlock
+type rpCoreLock struct{}
+
+// TryLock claims the spinlock if it is free
+// Reading the spinlock claims it, returning zero if the other core holds it.
+func (rpCoreLock) TryLock() bool {
+	if coreSpinlock.Get() == 0 {
+		return false
+	}
+	arm.Asm("dmb")
+	return true
+}
+
+// Unlock releases the spinlock
+func (rpCoreLock) Unlock() {
+	arm.Asm("dmb")
+	coreSpinlock.Set(1)
+}
+
+// CurrentCore returns the number of the calling core
+func (rpCoreLock) CurrentCore() int {
+	return int(sioCPUIDReg.Get())
+}
+
+// startTimerCore shares the scheduler's critical sections between the cores
+// and starts core 1, which enables the timer alarm interrupt for itself
+func startTimerCore() {
+	// Release the spinlock in case a soft reset left it held
+	coreSpinlock.Set(1)
+	core.SetCoreLock(rpCoreLock{})
+	launchCore1(core1Main)
+}
+
+// core1Main is where core 1 starts: it takes the alarm interrupt, then
+// sleeps between timers
+func core1Main() {
+	InitTimerAlarm()
+	for {
+		arm.Asm("wfi")
+	}
+}
+
+// launchCore1 starts core 1 at entry using the bootrom's FIFO handshake,
+// as the Pico SDK's multicore_launch_core1 does. Every word sent must be
+// echoed back; a wrong echo restarts the sequence.
+func launchCore1(entry func()) {
+	// A func value is a context word followed by the function address;
+	// the bootrom needs the Thumb bit set on the address
+	fn := *(*[2]uintptr)(unsafe.Pointer(&entry))
+	stackTop := uintptr(unsafe.Pointer(&core1Stack[0])) + unsafe.Sizeof(core1Stack)
+	seq := [...]uint32{0, 0, 1, vtorReg.Get(), uint32(stackTop), uint32(fn[1]) | 1}
+
+	for i := 0; i < len(seq); {
+		cmd := seq[i]
+		if cmd == 0 {
+			// Core 1 may have left stale words; drain them and wake it
+			for sioFIFOSTReg.HasBits(sioFIFOVLD) {
+				sioFIFORDReg.Get()
+			}
+			arm.Asm("sev")
+		}
+		for !sioFIFOSTReg.HasBits(sioFIFORDY) {
+		}
+		sioFIFOWRReg.Set(cmd)
+		arm.Asm("sev")
+
+		for !sioFIFOSTReg.HasBits(sioFIFOVLD) {
+			arm.Asm("wfe")
+		}
+		if sioFIFORDReg.Get() == cmd {
+			i++
+		} else {
+			i = 0
+		}
+	}
+}
@@ -3,7 +3,9 @@
 package main
 
 import (
+	"device/rp"
 	"gopper/core"
+	"runtime/interrupt"
 	"runtime/volatile"
 	"unsafe"
 )
@@ -19,18 +21,32 @@ import (
 // timeHR   @ 0x08 - Latched read from upper 32b
 // timeLR   @ 0x0C - Latched read from lower 32b (latches timeHR)
 // alarm[4] @ 0x10-0x1C
-// armed    @ 0x20
-// timeRawH @ 0x24 - Raw read from upper 32b
-// timeRawL @ 0x28 - Raw read from lower 32b (what TinyGo uses)
+// armed    @ 0x20 - Armed alarms (write 1 to disarm)
+// intr     @ 0x3C - Raw interrupts (write 1 to clear)
+// inte     @ 0x40 - Interrupt enable
+// intf     @ 0x44 - Interrupt force
 const (
 	timerBase     = 0x400B0000       // RP2350 TIMER0 base address
 	timerTimeRawH = timerBase + 0x24 // Raw timer high (no latching)
 	timerTimeRawL = timerBase + 0x28 // Raw timer low (no latching)
+	timerALARM1   = timerBase + 0x14
+	timerARMED    = timerBase + 0x20
+	timerINTR     = timerBase + 0x3C
+	timerINTE     = timerBase + 0x40
+	timerINTF     = timerBase + 0x44
 )
 
+// Timer dispatch uses alarm 1; TinyGo's runtime sleeps on alarm 0
+const timerAlarmBit = 1 << 1
+
 var (
-	timerRawH = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTimeRawH)))
-	timerRawL = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTimeRawL)))
+	timerRawH   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTimeRawH)))
+	timerRawL   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerTimeRawL)))
+	timerAlarm1 = (*volatile.Register32)(unsafe.Pointer(uintptr(timerALARM1)))
+	timerArmed  = (*volatile.Register32)(unsafe.Pointer(uintptr(timerARMED)))
+	timerIntr   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerINTR)))
+	timerInte   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerINTE)))
+	timerIntf   = (*volatile.Register32)(unsafe.Pointer(uintptr(timerINTF)))
 )
 
 // InitClock initializes the RP2350 hardware timer
@@ -43,9 +59,7 @@ func InitClock() {
 	_ = timerRawL.Get()
 	_ = timerRawL.Get()
 
-	// Register MCU-specific constant
-	core.RegisterConstant("MCU", "rp2350")
-	core.RegisterConstant("CLOCK_FREQ", uint32(1000000)) // 1MHz
+	// MCU and CLOCK_FREQ are registered from chip.RP2350
 }
 
 // GetHardwareTime reads the RP2350 hardware timer
@@ -77,3 +91,31 @@ func GetHardwareUptime() uint64 {
 func UpdateSystemTime() {
 	core.SetTime(GetHardwareTime())
 }
+
+// InitTimerAlarm hands alarm 1 to the scheduler, which from then on
+// dispatches timers from its interrupt rather than the main loop
+func InitTimerAlarm() {
+	timerIntr.Set(timerAlarmBit)
+	timerInte.SetBits(timerAlarmBit)
+	irq := interrupt.New(rp.IRQ_TIMER0_IRQ_1, timerAlarmIRQ)
+	irq.Enable()
+	core.SetTimerAlarm(SetTimerAlarm)
+}
+
+// SetTimerAlarm arms alarm 1 for wake
+// An alarm armed for a time that has already passed would not fire until
+// the counter wraps, so in that case the interrupt is forced instead.
+func SetTimerAlarm(wake uint32) {
+	timerAlarm1.Set(wake)
+	if int32(GetHardwareTime()-wake) >= 0 && timerArmed.HasBits(timerAlarmBit) {
+		timerArmed.Set(timerAlarmBit)
+		timerIntf.SetBits(timerAlarmBit)
+	}
+}
+
+// timerAlarmIRQ dispatches the due timers and re-arms the alarm
+func timerAlarmIRQ(interrupt.Interrupt) {
+	timerIntf.ClearBits(timerAlarmBit)
+	timerIntr.Set(timerAlarmBit)
+	core.ProcessTimers()
+}
@@ -0,0 +1,74 @@
+// Code generated by gopper-dictgen -target rp2350; DO NOT EDIT.
+
+//go:build rp2350
+
+package main
+
+// dictionaryBlob is the zlib-compressed data dictionary (1981 bytes)
+// As a string constant it stays in flash.
+const dictionaryBlob = "" +
+	"\x78\x9c\xbd\x57\x6d\x6f\xe3\xb8\x11\xfe\x2b\x82\x80\x45\x81\xc2\xb7\x90\x64\xcb\xb2\x03\xec\x87\x5c\x36\x7d\x41\x1b\xdc\x5e\x92" +
+	"\x45\xfb\x4d\x90\x25\xda\x66\x23\x4b\x3a\x4a\x4a\xd6\x3d\xe4\xbf\xf7\x99\x19\x8a\x92\x5f\x16\x77\x40\x8b\xfa\x83\x3c\x24\x87\x9c" +
+	"\x17\x0e\x9f\x99\xf9\xd5\x7f\x55\xa6\xd5\x75\xe5\xdf\xf8\xbb\xba\x69\x94\xf9\x21\xf8\x18\x7e\x0c\xfc\x99\xbf\xe9\x75\x59\xa4\x76" +
+	"\xb9\xe5\xf5\x1f\x3a\x5d\x1d\x77\x35\x16\xf3\xba\xda\xea\x9d\x7f\xf3\xab\x7f\xfb\xf9\x2e\x7d\xb8\xfd\x27\xd6\x17\xc1\x3a\xc6\xd2" +
+	"\xdd\xdf\x7f\xba\xfb\x5b\xfa\xa7\xc7\xfb\x9f\x31\x17\x06\xfc\xc3\xf4\xc3\xdd\x57\x8c\x4d\x13\xcd\x63\x1a\x7e\xf9\xc7\x83\xdd\x16" +
+	"\xc5\xb4\xeb\xe9\xf9\xf6\xf9\x29\x7d\xfa\xfa\xf0\xf4\x73\xfa\xe3\xed\xd3\x3d\x2f\x2c\x79\xe1\xfe\xcb\x97\xfb\xc7\xf4\xc7\x9f\x9e" +
+	"\xff\x92\xde\x7f\xfe\x33\xad\x84\xfe\x3b\xa9\x70\x38\x64\x55\xd1\x92\x12\xba\x50\x55\xa7\xb7\x47\xaf\xde\x6e\x5b\xd5\x7d\xfa\xd0" +
+	"\x7b\x79\xdd\x57\x20\x72\xff\x26\x9c\xf9\x3b\xd5\xa5\x7d\xd3\xe9\x83\xf2\x6f\x22\x19\xe6\x65\x9d\xbf\xf8\x37\x73\x3b\xb2\xf6\x2c" +
+	"\x06\xd3\x52\xa3\x70\x90\x7f\x13\xcf\xfc\xad\xae\xb2\x52\xff\x5b\x59\x26\x2f\x37\x39\x04\xf8\x37\xcb\x99\x9f\x95\x38\x25\xeb\x54" +
+	"\x5a\xeb\xa2\x9d\x88\x4c\x66\xbe\x3a\x28\xb3\x53\x55\x7e\x4c\xdb\xae\x6e\xfc\x9b\x15\x4e\x2e\x55\x66\xd2\x76\xdf\x77\x45\xfd\x06" +
+	"\x8f\xaf\x67\xbe\x95\x12\x06\x33\xbf\x50\x9b\x9e\xc4\x66\x85\x57\x9b\x42\x19\x1c\xe4\x65\x45\x61\x58\x56\x18\x0e\x0c\x15\x1d\x16" +
+	"\x42\x6d\x6c\x4c\x79\xca\x53\x55\xb6\x29\x95\xd8\xba\x10\x7b\xba\xac\x7d\x81\xe0\xac\x83\x7b\xc2\xd8\xce\xc1\x7c\x23\x93\x1e\xcb" +
+	"\x95\x1d\x4b\x67\x72\x06\x3b\xeb\x5d\xaa\x2b\x0f\xe6\x90\xf8\x46\x57\x2c\x3d\x82\x3d\xbf\xf4\xca\x1c\x2f\x59\xd8\x8d\xe4\xef\x36" +
+	"\x3b\x34\xa5\x82\x90\xfc\xa5\x9d\x8c\x07\x9f\x90\xc4\x6e\x5c\x3d\xe8\x2a\x7d\xcd\xca\x1e\x5a\xef\x31\xca\xbe\x4d\x46\x26\xab\x76" +
+	"\xd8\xb8\x57\xf9\x4b\x3a\xba\x34\x5a\x39\x3d\x0b\xbd\xd3\x5d\x56\xa6\x75\xdf\x9d\x6a\xea\xd9\x43\x72\xaf\x50\xdb\xac\x2f\xbb\xd4" +
+	"\x4d\x90\x88\xa2\x37\x59\x87\x60\x66\x9b\xe6\x01\xdb\xd4\xab\x6b\xc7\x39\xab\xea\xca\xe9\x8c\x2d\xb8\x84\xbe\x29\xe8\xbe\xaf\xec" +
+	"\x19\x44\x81\x2f\xb2\xb7\x33\x32\xa5\xcd\xdb\x21\xcd\x8f\x88\x00\x27\x82\x06\xd3\xc3\xe7\xce\x3e\xe2\xbd\xb4\xed\x74\x83\x37\xfa" +
+	"\xeb\xcc\x56\xeb\xcf\x53\x63\x17\x83\xb1\x67\x67\x3b\x43\xdd\x66\x30\xc7\xa2\xfe\x19\xeb\x94\x63\x8c\x99\xb6\xd1\xe7\x7a\xb6\x69" +
+	"\x96\x77\xfa\x55\xa5\x7b\xbd\xdb\x8b\x43\x92\x29\x7f\xfa\xa6\xbb\x3d\xf9\x24\x6f\xed\x56\x70\xe0\x76\x69\x89\xe4\x6e\xfa\x61\xde" +
+	"\xa3\x29\x0c\x39\x62\xea\x42\xd1\x3f\xac\x52\x62\xd3\xfa\xe4\xd0\xe1\x59\x4d\xb7\x0e\xa4\x5d\x4a\x0f\xed\xee\xd3\x87\x3f\xe2\x49" +
+	"\x2c\x02\x11\xd7\x21\xd6\xda\xad\x32\xc3\x26\xdc\x6d\x66\x39\xc2\x41\xa1\xaa\xb8\xb2\x1a\x39\xd9\x9d\x69\x8f\x55\xee\x0c\x59\xc0" +
+	"\xd3\x32\x45\x2f\xcd\x38\xef\x19\xd5\xd4\xc6\xa2\x0e\x9b\x21\x63\x77\x9d\xea\x5b\xa3\x8d\xa2\xe7\xdf\xd2\x9d\xd1\x49\xf1\x78\x92" +
+	"\x7d\xbd\x57\x2e\x0e\x7c\x4b\xc7\xd7\x19\xbd\xdb\x8d\xd6\x4c\x0f\x1b\x6f\x40\x47\x13\x6d\xe1\x43\x8c\xcf\xdd\x4e\x53\xd6\xed\xd6" +
+	"\xdd\x8c\x44\xaa\x95\x50\x8d\x03\xd9\xf5\x66\x74\xa7\x2e\x9d\x13\x87\xb2\x2c\x50\x36\xa8\xc2\x9e\x27\x95\x8a\xb4\x54\x12\x95\xf1" +
+	"\xe8\x45\x78\x99\x60\xf2\x2c\x94\x9a\xbe\x2c\x81\xdb\xac\x6a\x0c\xc7\x5a\xae\x74\x5f\x1f\xd4\x7f\x09\x40\xcd\x08\x40\xb9\x67\xdd" +
+	"\x67\x4f\xb4\x5e\x9c\xde\x45\x1c\x8f\xc2\x05\x08\x09\x46\x95\xf3\x63\x7c\x01\xa2\x67\x06\x65\xc5\x78\xfc\x1e\x9a\xec\xeb\xb2\x20" +
+	"\x35\x06\x59\xd9\xa6\x7e\x65\x55\xf6\xc7\xb6\x53\x60\xd0\xd6\xd5\x78\x17\xa7\x27\xfe\x2f\x8c\xff\x6d\x7b\xd7\x17\x62\xaf\x99\xbd" +
+	"\x0c\xa6\x51\x75\x6e\x33\x4d\x39\xf3\x0b\xce\x67\x78\x4d\x6d\x6d\xd2\xee\xd8\x08\x4a\x6b\x9c\x57\xe5\xd0\xfb\x9a\x4f\x36\xaa\xac" +
+	"\xdf\xae\xf8\x64\x19\x49\x7c\xfd\x3f\x1d\xb2\x9c\x9f\xca\xbc\xea\x8d\xb1\x78\x80\xbe\x54\x4b\x39\x2c\xc2\x30\xe5\x98\x26\x9b\xcd" +
+	"\x40\xea\x0a\xd5\x55\xc7\xcc\x23\x57\x5f\xb6\xd3\xb4\xb0\x5c\x0e\xc8\x4d\xcb\xce\xb5\x15\x1c\x82\xf0\xfd\x34\x16\x3a\x7b\x7e\xa3" +
+	"\xf8\xd7\xd8\x94\x08\x82\x57\xea\x9b\x1c\x8f\x54\x34\x62\x9c\x36\xa2\xee\xca\x96\x1f\xc2\xc1\x9e\xbb\x44\x97\x25\x22\xc1\x5a\x93" +
+	"\x52\x11\xd1\xd4\xad\xa6\xb4\xe2\xac\x4e\x82\x53\x06\x5d\x6d\xeb\x71\x31\x1c\x17\xd9\x6f\x94\x4f\x4f\x41\xea\xc4\xf5\xd8\x31\x62" +
+	"\x42\x61\x90\x44\xcc\x78\x16\x3c\x21\x53\x27\xc8\xd2\x64\x26\x3b\xb4\x82\x3c\x49\xe2\x58\xbe\x83\x4d\xc9\xca\x71\x30\x3c\xc3\x9e" +
+	"\xb2\x74\x47\x81\x9e\xb8\x3e\x59\x4f\x78\xa1\xfb\x84\x15\xe5\x5c\xe0\x16\xaf\xc5\xc2\x2a\x74\xcb\x7d\x05\xf0\xd3\x14\xc1\xe3\x6a" +
+	"\xf4\xce\xbe\x6f\x50\x58\xab\x93\x02\x36\x1d\x66\x27\x95\xec\xa8\xfd\xa4\x4a\x6c\x91\xf1\x3d\x89\x00\xd4\x70\xe4\x34\xbe\xbf\xf1" +
+	"\xe2\xc2\x84\x8a\x15\xca\x1a\x9e\xe4\xe1\x7e\xba\xe8\x8a\x29\x4f\xb7\xb6\xae\xe5\x7b\xe7\xd2\x96\xe6\x86\x9c\x49\xb3\x07\x60\x53" +
+	"\xea\xc2\x0c\xbb\x29\x26\x86\x74\x3b\xbe\x38\x38\x40\x53\xd6\x33\xba\x02\x1e\x14\xc2\x1b\x51\xae\x18\x8f\xfb\x1e\x17\xc7\x09\x15" +
+	"\xa6\x56\x0c\x8e\xeb\x0f\xf6\xaf\xfd\x85\x75\x8e\x60\xe4\x58\xd6\xe2\x09\x14\xea\x1b\x69\x57\x65\x07\x25\xb9\xa5\xaf\xda\xc9\x4e" +
+	"\x14\x41\xb2\x0f\x4f\x77\x5a\xfa\x0a\x0d\x5d\xa4\xc4\x76\x02\x85\xdf\xeb\xea\x9a\xde\x42\xcb\x59\x6f\x13\xf0\x37\xe4\x6f\xc4\xdf" +
+	"\x39\x7f\x17\xfc\x8d\xf9\xbb\xe4\x6f\x22\xc2\x18\x03\x90\xc8\xc9\x2b\xe9\x60\x92\x51\x27\x92\xe0\xef\x0e\x40\xa2\x8a\x6b\xda\xc6" +
+	"\x27\xda\x12\xe0\x20\xc4\x81\x55\xca\x98\xda\xb0\x7d\x65\x8d\x60\x74\xfc\x4b\x87\xd4\xc8\x68\xd3\x20\xf4\xf8\xf5\x5f\x2b\xf0\xa2" +
+	"\xf5\x69\xf5\x33\x09\x3a\xd9\x39\x8c\x6d\xb1\x33\x9f\x96\x34\xe3\xf9\x79\xe6\x1e\xf3\x55\xd4\x9c\xd6\x28\xab\xb1\x24\xf8\x0d\x69" +
+	"\xf1\x7c\x4c\xb5\x27\xe2\x00\xf3\x08\x99\x4b\xc3\xa6\x99\x1c\xdb\x93\x8b\xcc\xf5\xbb\x4e\xb1\x27\x10\xe2\x85\xa7\x50\xff\xbb\xb6" +
+	"\x0f\x99\x4c\x4e\x88\x47\xd4\x3b\xc3\x4b\x60\x0c\xee\x10\x10\x9d\xcc\x47\x9e\x33\x44\x14\x96\x89\xf7\x92\xc5\xc8\x3b\x81\x57\x6f" +
+	"\x93\xe5\x2f\xd0\xf2\xd3\x87\x8f\x88\x7e\xaa\xf9\x19\xc8\x87\x8a\x8d\x5a\x2c\xc9\x26\xf2\x2c\xfe\xa5\x3b\x60\x90\x1d\xe4\x4d\x9f" +
+	"\xe2\x55\x9b\x3d\x2e\x44\xd0\x35\x76\x80\x45\x78\x73\x89\x9c\xab\xf9\x14\x39\x27\x51\xc0\xe0\xd1\x1b\xc5\x23\xa9\xfc\x89\xe2\x78" +
+	"\x05\x6a\x14\x72\x2f\xab\x85\xdb\xce\x30\xfb\x1d\x21\xf1\x3b\xdd\x7e\x8f\xf8\xe7\xe6\x85\xb1\x11\x17\x4c\x7f\xbb\x46\xd7\x01\x63" +
+	"\x20\x51\xa1\xf4\xf5\xa0\x22\x69\xe9\x41\xcd\xa5\x9d\x07\xb5\xe0\x4e\x9e\xa8\x98\x5b\x78\xa2\x96\xdc\xb1\x13\x95\x70\x83\x4e\xd4" +
+	"\x8a\xfb\x72\xa2\xd6\xdc\x8e\xf3\xc9\x81\xf4\xe3\x4c\x87\xd2\x7a\x33\x1d\x09\xd0\x32\x3d\x97\x1e\x9c\xe9\x85\x6d\xbb\x89\x8e\x6d" +
+	"\xbb\x4d\xf4\x52\x9a\x6b\xa6\x13\x01\x64\xa6\x57\x82\xbf\x4c\xaf\x05\x4d\xd9\x8e\x40\xd0\x92\xe9\x50\x30\x91\xe9\x48\xb0\x8f\xe9" +
+	"\xb9\xe0\x19\xd3\x0b\x81\x1b\xa6\x63\x41\x0e\xa6\x97\x82\x0a\x4c\x27\xd2\xbc\x33\xbd\x92\x26\x9a\xe9\xb5\xa0\x00\x7b\x2d\x90\x66" +
+	"\x98\xe9\x50\xba\x5c\xa6\x23\xe9\x64\x99\x9e\x4b\x83\xca\xf4\x42\xfa\x49\xa6\x63\x69\x17\x99\x5e\x4a\x63\xc8\x74\x22\x4d\x1f\xd3" +
+	"\x2b\x69\xef\x98\x5e\x4b\xdf\x46\xf4\x22\x90\x3e\x8c\xe9\x50\x3a\x2e\xa6\x23\xe9\xaf\x98\x9e\x0b\xfc\x30\xbd\x90\xee\x8a\xe9\x58" +
+	"\xfa\x23\xa6\x97\xd2\x03\x31\x9d\x48\xab\x73\xfb\xf9\x2e\x10\xd4\x01\x15\x4a\x9f\x03\x2a\x92\xde\x05\xd4\x5c\xda\x14\x50\xe9\xf3" +
+	"\xfd\xc3\x97\xfb\xc7\xdb\xe7\xaf\x8f\xf7\xd4\x92\xbc\x0f\xf8\xcb\x19\x82\x02\xaf\xee\xf6\x44\x8c\x75\x0e\x87\xde\xa4\xb9\xe7\x00" +
+	"\x44\xb7\xcc\xe1\xe7\xc0\x98\x43\xd0\x82\x08\x07\xa1\x60\x28\x47\xa1\xbc\x04\x84\xe1\xfb\xbb\x24\x3e\x97\x12\x39\xe2\xa1\xbb\xff" +
+	"\xa8\xda\x7c\xaf\x8a\xbe\x54\x85\xa4\x2c\x64\x3c\xf4\x0e\x8a\xb3\x81\x3f\xf3\x61\x15\xa9\xef\x71\x4f\xb8\x45\x9f\x56\xed\x14\xa6" +
+	"\x61\xa2\x7f\x0f\xee\x9d\xaa\xf2\xa3\xc7\xb2\x67\x3e\xac\xf5\xff\x1a\xdd\x79\x52\x14\xf1\xcb\xc4\xec\xc2\xce\x72\x35\x35\x4c\xc2" +
+	"\xb1\x3e\x9e\x65\xeb\x65\x25\xcd\x1f\xf1\x0f\x1c\xc2\x7b\x2f\xb0\x08\x4f\xfb\x77\x59\xf5\x87\xce\xcb\xda\x56\xef\x18\xd4\x30\x9d" +
+	"\xd0\x41\x15\x10\x54\x73\x55\xe6\x51\x79\x8f\x69\xdc\xbb\xff\xb5\x7a\xa9\x28\xed\x5b\x83\x67\x3e\x02\xc0\x7f\x00\xf2\x78\x5c\xd4" +
+	"\x7a\x84\x41\x5b\x94\xf9\x64\x10\x59\x6d\x4b\x3f\xae\x4b\xbd\xba\x2a\x21\xff\x35\xd3\x65\xb6\x29\x95\xf7\xb6\x57\x95\xeb\xe5\x69" +
+	"\x03\xb9\xe0\x99\x5d\x03\x18\x6b\xbc\x2d\xba\x45\x9a\x8e\x26\x72\x5d\xdd\x21\x59\xc9\x7f\x7f\xff\x0f\x31\xd4\xef\x15"
+
+// dictionaryHash is the fingerprint of the registry the blob was built from
+const dictionaryHash = 0x2ee6de1e
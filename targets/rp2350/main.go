@@ -2,9 +2,13 @@
 
 package main
 
+//go:generate go run ../../cmd/gopper-dictgen -target rp2350
+
 import (
 	"gopper/core"
 	"gopper/protocol"
+	"gopper/targets/chip"
+	piostepper "gopper/targets/pio"
 	"gopper/tinycompress"
 	"machine"
 	"time"
@@ -81,65 +85,32 @@ func main() {
 	// Must be done before TimerInit() and any timer operations
 	DebugPrintln("[MAIN] Registering hardware timer function...")
 	core.SetHardwareTimerFunc(GetHardwareTime)
+	core.SetHardwareUptimeFunc(GetHardwareUptime)
 	DebugPrintln("[MAIN] Hardware timer function registered")
 
 	DebugPrintln("[MAIN] Initializing timer...")
 	core.TimerInit()
 	DebugPrintln("[MAIN] Timer initialized")
 
-	// Initialize core commands
-	DebugPrintln("[MAIN] Initializing core commands...")
-	core.InitCoreCommands()
-	DebugPrintln("[MAIN] Core commands initialized")
-
-	// Step 1: GPIO and ADC (most basic peripherals)
-	DebugPrintln("[MAIN] Initializing ADC commands...")
-	core.InitADCCommands()
-	DebugPrintln("[MAIN] Initializing GPIO commands...")
-	core.InitGPIOCommands()
-	DebugPrintln("[MAIN] GPIO/ADC initialized")
-
-	// Step 2: PWM and SPI
-	DebugPrintln("[MAIN] Initializing PWM commands...")
-	core.InitPWMCommands()
-	DebugPrintln("[MAIN] Initializing SPI commands...")
-	core.InitSPICommands()
-	DebugPrintln("[MAIN] PWM/SPI initialized")
-
-	// Step 3: Trigger sync BEFORE endstops
-	DebugPrintln("[MAIN] Initializing trigger sync commands...")
-	core.InitTriggerSyncCommands()
-	DebugPrintln("[MAIN] Trigger sync initialized")
-
-	// Step 4: I2C
-	DebugPrintln("[MAIN] Initializing I2C commands...")
-	core.InitI2CCommands()
-	DebugPrintln("[MAIN] I2C initialized")
-
-	// Step 5: ALL endstop types
-	DebugPrintln("[MAIN] Initializing endstop commands...")
-	core.InitEndstopCommands()
-	DebugPrintln("[MAIN] Initializing analog endstop commands...")
-	core.InitAnalogEndstopCommands()
-	DebugPrintln("[MAIN] Initializing I2C endstop commands...")
-	core.InitI2CEndstopCommands()
-	DebugPrintln("[MAIN] Endstops initialized")
-
-	// Step 6: GPIO stepper support (simpler than PIO, more reliable for testing)
-	DebugPrintln("[MAIN] Initializing GPIO steppers...")
-	InitGPIOSteppers()
-	DebugPrintln("[MAIN] GPIO steppers initialized")
-
-	// Step 7: Driver commands (TMC drivers, etc.)
-	DebugPrintln("[MAIN] Initializing driver commands...")
-	core.InitDriverCommands()
-	DebugPrintln("[MAIN] Driver commands initialized")
-
-	// Register combined pin enumeration for RP2350
-	// This must happen before BuildDictionary()
+	// Timers are dispatched from the alarm interrupt from here on, on
+	// core 1 in dual-core builds
+	startTimerCore()
+	DebugPrintln("[MAIN] Timer alarm enabled")
+
+	// Register all commands (same order as cmd/gopper-dictgen)
+	DebugPrintln("[MAIN] Registering commands...")
+	core.RegisterFirmwareCommands()
+	DebugPrintln("[MAIN] Commands registered")
+
+	// Stepper backends: PIO state machines, then GPIO
+	DebugPrintln("[MAIN] Initializing steppers...")
+	piostepper.InitSteppers()
+	DebugPrintln("[MAIN] Steppers initialized")
+
+	// Register MCU constants and the combined pin enumeration
 	// Indices 0-47: GPIO pins (gpio0-gpio47)
 	// Indices 48-52: ADC channels (ADC0-ADC3, ADC_TEMPERATURE)
-	registerRP2350Pins()
+	chip.RP2350.Register()
 
 	// Step 1: GPIO and ADC drivers - WORKING ✓
 	adcDriver := NewRPAdcDriver()
@@ -155,12 +126,12 @@ func main() {
 	softwareSPIDriver := NewRP2040SoftwareSPIDriver()
 	core.SetSoftwareSPIDriver(softwareSPIDriver)
 
-	// Build and cache dictionary after all commands registered
-	// This compresses the dictionary with zlib
-	DebugPrintln("[MAIN] Building dictionary...")
+	// Serve the dictionary generated at build time (see dictionary_gen.go)
+	// Falls back to building it here if the registry no longer matches
+	DebugPrintln("[MAIN] Loading dictionary...")
 	dict := core.GetGlobalDictionary()
-	dict.BuildDictionary()
-	DebugPrintln("[MAIN] Dictionary build complete!")
+	dict.SetPrecompressed(dictionaryBlob, dictionaryHash)
+	DebugPrintln("[MAIN] Dictionary ready!")
 
 	// Log all registered commands for debugging
 	core.LogRegisteredCommands()
@@ -183,11 +154,11 @@ func main() {
 	transport = protocol.NewTransport(outputBuffer, handleCommand)
 	DebugPrintln("[MAIN] Transport created")
 	transport.SetResetCallback(func() {
-		// Clear buffers on host reset
+		// Clear buffers on host reset. The sequence restarting is only a
+		// guess at a reset (a retransmit after a lost ACK looks the same),
+		// so the configuration is kept; config_reset releases it.
 		inputBuffer.Reset()
 		outputBuffer.Reset()
-
-		core.ResetFirmwareState() // Clear the shutdown flag and config state
 	})
 	// Set flush callback to immediately send ACKs to USB
 	// This is critical - serialqueue expects ACK before response
@@ -231,6 +202,9 @@ func main() {
 				}
 			}()
 
+			// Start of this iteration, for the load statistics
+			loopStart := GetHardwareTime()
+
 			// Read incoming USB data into input buffer
 			available := USBAvailable()
 			if available > 0 {
@@ -273,10 +247,6 @@ func main() {
 				transport.Receive(inputBuf)
 				messagesReceived++
 
-				// CRITICAL: Process timers immediately after receiving commands
-				// This ensures step timers fire promptly even during command bursts
-				core.ProcessTimers()
-
 				// Remove consumed bytes from FIFO
 				consumed := originalLen - inputBuf.Available()
 				if consumed > 0 {
@@ -292,15 +262,12 @@ func main() {
 				messagesSent++
 			}
 
-			// Check for pending reset after all messages sent
-			// This ensures the ACK has been transmitted before reset
-			core.CheckPendingReset()
-
-			// Process scheduled timers
-			core.ProcessTimers()
+			// Run the tasks after all messages are sent, so a pending
+			// reset happens once the ACK has been transmitted
+			core.RunTasks()
 
-			// Run an analog-in task to send any pending analog_in_state reports.
-			core.AnalogInTask()
+			// Record the iteration's run time and send stats when due
+			core.StatsUpdate(loopStart, GetHardwareTime())
 		}()
 
 		// Yield briefly to avoid busy loop
@@ -365,28 +332,6 @@ func handleCommand(cmdID uint16, data *[]byte) error {
 	return core.DispatchCommand(cmdID, data)
 }
 
-// registerRP2350Pins registers all pin names for the RP2350
-// Combines GPIO pins (0-47) and ADC channels (48-52) into a single enumeration
-func registerRP2350Pins() {
-	// Total: 48 GPIO pins + 5 ADC channels = 53 total pins
-	pinNames := make([]string, 53)
-
-	// Indices 0-47: GPIO pins (gpio0-gpio47)
-	for i := 0; i < 48; i++ {
-		pinNames[i] = "gpio" + itoa(i)
-	}
-
-	// Indices 48-52: ADC channels
-	pinNames[48] = "ADC0"
-	pinNames[49] = "ADC1"
-	pinNames[50] = "ADC2"
-	pinNames[51] = "ADC3"
-	pinNames[52] = "ADC_TEMPERATURE"
-
-	// Register the combined enumeration
-	core.RegisterEnumeration("pin", pinNames)
-}
-
 // itoa converts int to string without importing strconv (for embedded)
 func itoa(i int) string {
 	if i == 0 {
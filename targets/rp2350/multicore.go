@@ -0,0 +1,116 @@
+//go:build rp2350 && dualcore
+
+package main
+
+import (
+	"device/arm"
+	"gopper/core"
+	"runtime/volatile"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Dual-core build (-tags dualcore): core 1 takes the timer alarm interrupt
+// and runs every timer handler, core 0 keeps USB, the transport, commands
+// and tasks. See core/multicore.go for what each core may call.
+
+// SIO registers shared by both cores
+const (
+	sioBase   = 0xd0000000
+	sioCPUID  = sioBase + 0x000 // Number of the core reading it
+	sioFIFOST = sioBase + 0x050 // Inter-core FIFO status
+	sioFIFOWR = sioBase + 0x054 // Write to the other core's FIFO
+	sioFIFORD = sioBase + 0x058 // Read from this core's FIFO
+
+	sioFIFOVLD = 1 << 0 // This core's FIFO holds data
+	sioFIFORDY = 1 << 1 // The other core's FIFO has room
+
+	ppbVTOR = 0xe000ed08 // Vector table offset, handed to core 1 at launch
+)
+
+var (
+	sioCPUIDReg  = (*volatile.Register32)(unsafe.Pointer(uintptr(sioCPUID)))
+	sioFIFOSTReg = (*volatile.Register32)(unsafe.Pointer(uintptr(sioFIFOST)))
+	sioFIFOWRReg = (*volatile.Register32)(unsafe.Pointer(uintptr(sioFIFOWR)))
+	sioFIFORDReg = (*volatile.Register32)(unsafe.Pointer(uintptr(sioFIFORD)))
+	vtorReg      = (*volatile.Register32)(unsafe.Pointer(uintptr(ppbVTOR)))
+
+	// Core 1 only runs timer handlers and never allocates, so a small
+	// static stack is enough (uint64 keeps it 8-byte aligned). The garbage
+	// collector does not scan it; see core/multicore.go for what that
+	// requires of the timer handlers.
+	core1Stack [512]uint64
+
+	coreLockWord uint32 // Held by the core lock when 1
+)
+
+// rpCoreLock is the core lock. The SIO hardware spinlocks can be released
+// by unrelated writes on the RP2350 (erratum RP2350-E2), so it uses the
+// Cortex-M33 exclusive accesses instead.
+type rpCoreLock struct{}
+
+// TryLock claims the lock word if it is free
+func (rpCoreLock) TryLock() bool {
+	return atomic.CompareAndSwapUint32(&coreLockWord, 0, 1)
+}
+
+// Unlock releases the lock word
+func (rpCoreLock) Unlock() {
+	atomic.StoreUint32(&coreLockWord, 0)
+}
+
+// CurrentCore returns the number of the calling core
+func (rpCoreLock) CurrentCore() int {
+	return int(sioCPUIDReg.Get())
+}
+
+// startTimerCore shares the scheduler's critical sections between the cores
+// and starts core 1, which enables the timer alarm interrupt for itself
+func startTimerCore() {
+	core.SetCoreLock(rpCoreLock{})
+	launchCore1(core1Main)
+}
+
+// core1Main is where core 1 starts: it takes the alarm interrupt, then
+// sleeps between timers
+func core1Main() {
+	InitTimerAlarm()
+	for {
+		arm.Asm("wfi")
+	}
+}
+
+// launchCore1 starts core 1 at entry using the bootrom's FIFO handshake,
+// as the Pico SDK's multicore_launch_core1 does. Every word sent must be
+// echoed back; a wrong echo restarts the sequence.
+func launchCore1(entry func()) {
+	// A func value is a context word followed by the function address;
+	// the bootrom needs the Thumb bit set on the address
+	fn := *(*[2]uintptr)(unsafe.Pointer(&entry))
+	stackTop := uintptr(unsafe.Pointer(&core1Stack[0])) + unsafe.Sizeof(core1Stack)
+	seq := [...]uint32{0, 0, 1, vtorReg.Get(), uint32(stackTop), uint32(fn[1]) | 1}
+
+	for i := 0; i < len(seq); {
+		cmd := seq[i]
+		if cmd == 0 {
+			// Core 1 may have left stale words; drain them and wake it
+			for sioFIFOSTReg.HasBits(sioFIFOVLD) {
+				sioFIFORDReg.Get()
+			}
+			arm.Asm("sev")
+		}
+		for !sioFIFOSTReg.HasBits(sioFIFORDY) {
+		}
+		sioFIFOWRReg.Set(cmd)
+		arm.Asm("sev")
+
+		for !sioFIFOSTReg.HasBits(sioFIFOVLD) {
+			arm.Asm("wfe")
+		}
+		if sioFIFORDReg.Get() == cmd {
+			i++
+		} else {
+			i = 0
+		}
+	}
+}
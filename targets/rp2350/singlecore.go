@@ -0,0 +1,9 @@
+//go:build rp2350 && !dualcore
+
+package main
+
+// startTimerCore dispatches timers from the alarm interrupt on this core
+// (build with -tags dualcore to move them to core 1)
+func startTimerCore() {
+	InitTimerAlarm()
+}
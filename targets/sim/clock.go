@@ -0,0 +1,32 @@
+//go:build linux && !tinygo
+
+package main
+
+import (
+	"gopper/core"
+	"time"
+)
+
+// The simulator clock counts microseconds since start, like the RP2040 timer
+// (chip.Sim reports CLOCK_FREQ=1000000)
+var startTime time.Time
+
+// InitClock starts the simulated timer
+func InitClock() {
+	startTime = time.Now()
+}
+
+// GetHardwareTime returns the low 32 bits of the microsecond counter
+func GetHardwareTime() uint32 {
+	return uint32(GetHardwareUptime())
+}
+
+// GetHardwareUptime returns the full 64-bit microsecond counter
+func GetHardwareUptime() uint64 {
+	return uint64(time.Since(startTime) / time.Microsecond)
+}
+
+// UpdateSystemTime updates the core timer with the host time
+func UpdateSystemTime() {
+	core.SetTime(GetHardwareTime())
+}
@@ -0,0 +1,48 @@
+package fake
+
+import (
+	"gopper/core"
+	"sync"
+)
+
+// ADC implements core.ADCDriver returning programmable readings
+type ADC struct {
+	mu       sync.Mutex
+	defValue core.ADCValue
+	values   map[core.ADCChannelID]core.ADCValue
+}
+
+// NewADC creates a fake ADC that reads defValue on every channel
+func NewADC(defValue core.ADCValue) *ADC {
+	return &ADC{
+		defValue: defValue,
+		values:   make(map[core.ADCChannelID]core.ADCValue),
+	}
+}
+
+// Init powers up the fake ADC (no-op)
+func (a *ADC) Init(cfg core.ADCConfig) error {
+	return nil
+}
+
+// ConfigureChannel prepares a channel (no-op)
+func (a *ADC) ConfigureChannel(ch core.ADCChannelID) error {
+	return nil
+}
+
+// ReadRaw returns the programmed value for a channel
+func (a *ADC) ReadRaw(ch core.ADCChannelID) (core.ADCValue, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if v, ok := a.values[ch]; ok {
+		return v, nil
+	}
+	return a.defValue, nil
+}
+
+// SetValue programs the reading returned for a channel
+func (a *ADC) SetValue(ch core.ADCChannelID, value core.ADCValue) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.values[ch] = value
+}
@@ -0,0 +1,56 @@
+package fake
+
+import (
+	"gopper/core"
+	"sync"
+)
+
+// Board bundles one instance of every fake driver
+type Board struct {
+	GPIO *GPIO
+	ADC  *ADC
+	PWM  *PWM
+	SPI  *SPI
+	I2C  *I2C
+
+	mu       sync.Mutex
+	steppers []*Stepper
+}
+
+// NewBoard creates fake drivers for a board with numPins GPIO pins
+func NewBoard(numPins uint32) *Board {
+	return &Board{
+		GPIO: NewGPIO(numPins),
+		ADC:  NewADC(2048),
+		PWM:  NewPWM(255),
+		SPI:  NewSPI(),
+		I2C:  NewI2C(),
+	}
+}
+
+// Install registers the fake drivers and stepper backend factory with core
+func (b *Board) Install() {
+	core.SetGPIODriver(b.GPIO)
+	core.SetADCDriver(b.ADC)
+	core.SetPWMDriver(b.PWM)
+	core.SetSPIDriver(b.SPI)
+	core.SetSoftwareSPIDriver(b.SPI)
+	core.SetI2CDriver(b.I2C)
+	core.SetStepperBackendFactory(func(cfg core.StepperConfig) (core.StepperBackend, error) {
+		s := NewStepper()
+		if err := s.Init(cfg); err != nil {
+			return nil, err
+		}
+		b.mu.Lock()
+		b.steppers = append(b.steppers, s)
+		b.mu.Unlock()
+		return s, nil
+	})
+}
+
+// Steppers returns the stepper backends created so far, in creation order
+func (b *Board) Steppers() []*Stepper {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Stepper(nil), b.steppers...)
+}
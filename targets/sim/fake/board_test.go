@@ -0,0 +1,114 @@
+package fake_test
+
+import (
+	"testing"
+
+	"gopper/core"
+	"gopper/protocol"
+	"gopper/protocol/host"
+	"gopper/targets/chip"
+	"gopper/targets/sim/fake"
+)
+
+// TestBoardStepperRoundTrip configures a stepper on the simulator's board
+// through the protocol, queues a move, stops it partway with a trsync and
+// reads the latched position and clock back
+func TestBoardStepperRoundTrip(t *testing.T) {
+	// Same registration order as the simulator's main()
+	core.TimerInit()
+	core.RegisterFirmwareCommands()
+	chip.Sim.Register()
+	board := fake.NewBoard(uint32(chip.Sim.NumGPIO))
+	board.Install()
+
+	gd := core.GetGlobalDictionary()
+	gd.BuildDictionary()
+	dict, err := host.ParseDictionary(gd.Generate())
+	if err != nil {
+		t.Fatalf("dictionary: %v", err)
+	}
+
+	output := protocol.NewScratchOutput()
+	transport := protocol.NewTransport(output, core.DispatchCommand)
+	core.SetGlobalTransport(transport)
+
+	seq := uint8(0)
+	send := func(name string, params host.Params) {
+		t.Helper()
+		payload, err := dict.EncodeCommand(name, params)
+		if err != nil {
+			t.Fatalf("encode %s: %v", name, err)
+		}
+		transport.Receive(protocol.NewSliceInputBuffer(host.EncodeFrame(seq, payload)))
+		seq++
+	}
+
+	core.SetTime(1000)
+	send("allocate_oids", host.Params{"count": 2})
+	send("config_stepper", host.Params{"oid": 0, "step_pin": 2, "dir_pin": 3,
+		"invert_step": 0, "step_pulse_ticks": 0})
+	send("config_trsync", host.Params{"oid": 1})
+	send("stepper_stop_on_trigger", host.Params{"oid": 0, "trsync_oid": 1})
+	send("finalize_config", host.Params{"crc": 1})
+	send("trsync_start", host.Params{"oid": 1, "report_clock": 0, "report_ticks": 0,
+		"expire_reason": 4})
+	send("set_next_step_dir", host.Params{"oid": 0, "dir": 1})
+	send("reset_step_clock", host.Params{"oid": 0, "clock": 2000})
+	send("queue_step", host.Params{"oid": 0, "interval": 100, "count": 10, "add": 0})
+	if core.IsShutdown() {
+		t.Fatal("shutdown while configuring the stepper")
+	}
+
+	steppers := board.Steppers()
+	if len(steppers) != 1 {
+		t.Fatalf("board created %d stepper backends, want 1", len(steppers))
+	}
+	for clock := uint32(2000); clock <= 2550; clock += 50 {
+		core.SetTime(clock)
+		core.ProcessTimers()
+	}
+	send("trsync_trigger", host.Params{"oid": 1, "reason": 1})
+	for clock := uint32(2600); clock <= 4000; clock += 50 {
+		core.SetTime(clock)
+		core.ProcessTimers()
+	}
+	if n := steppers[0].Steps(); n != 5 {
+		t.Errorf("backend generated %d steps, want 5", n)
+	}
+
+	// The position comes back in stepper_position, followed by the
+	// latched trigger in stepper_trigger
+	output.Reset()
+	send("stepper_get_position", host.Params{"oid": 0})
+	var names []string
+	for _, f := range new(host.FrameDecoder).Feed(output.Result()) {
+		msgs, err := dict.DecodeResponses(f.Payload)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, m := range msgs {
+			switch m.Name {
+			case "stepper_position":
+				if pos := m.Int("pos"); pos != -5 {
+					t.Errorf("stepper_position pos=%d, want -5", pos)
+				}
+			case "stepper_trigger":
+				if pos := m.Int("pos"); pos != -5 {
+					t.Errorf("stepper_trigger pos=%d, want -5", pos)
+				}
+				if clock := m.Int("clock"); clock != 2550 {
+					t.Errorf("stepper_trigger clock=%d, want 2550", clock)
+				}
+			default:
+				continue
+			}
+			names = append(names, m.Name)
+		}
+	}
+	if len(names) != 2 || names[0] != "stepper_position" || names[1] != "stepper_trigger" {
+		t.Fatalf("responses %v, want [stepper_position stepper_trigger]", names)
+	}
+	if pos := steppers[0].Position(); pos != -5 {
+		t.Errorf("backend position %d, want -5", pos)
+	}
+}
@@ -0,0 +1,148 @@
+// Package fake provides in-memory hardware drivers for running the Gopper
+// core on a regular Go host (simulator, replay and tests)
+package fake
+
+import (
+	"errors"
+	"gopper/core"
+	"sync"
+)
+
+// PinMode describes how a fake pin is configured
+type PinMode uint8
+
+const (
+	PinUnconfigured PinMode = iota
+	PinOutput
+	PinInputPullUp
+	PinInputPullDown
+)
+
+// pinState holds the simulated state of a single pin
+type pinState struct {
+	mode     PinMode
+	value    bool
+	forced   bool // input level driven by SetInput instead of the pull resistor
+	forcedTo bool
+}
+
+// GPIO implements core.GPIODriver with in-memory pin state
+type GPIO struct {
+	mu      sync.Mutex
+	numPins uint32
+	pins    map[core.GPIOPin]*pinState
+}
+
+// NewGPIO creates a fake GPIO driver with numPins pins
+func NewGPIO(numPins uint32) *GPIO {
+	return &GPIO{
+		numPins: numPins,
+		pins:    make(map[core.GPIOPin]*pinState),
+	}
+}
+
+// state returns the pin state, creating it on first use
+func (g *GPIO) state(pin core.GPIOPin) (*pinState, error) {
+	if uint32(pin) >= g.numPins {
+		return nil, errors.New("invalid pin")
+	}
+	ps, ok := g.pins[pin]
+	if !ok {
+		ps = &pinState{}
+		g.pins[pin] = ps
+	}
+	return ps, nil
+}
+
+func (g *GPIO) configure(pin core.GPIOPin, mode PinMode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ps, err := g.state(pin)
+	if err != nil {
+		return err
+	}
+	ps.mode = mode
+	return nil
+}
+
+// ConfigureOutput configures a pin as a digital output
+func (g *GPIO) ConfigureOutput(pin core.GPIOPin) error {
+	return g.configure(pin, PinOutput)
+}
+
+// ConfigureInputPullUp configures a pin as an input with pull-up
+func (g *GPIO) ConfigureInputPullUp(pin core.GPIOPin) error {
+	return g.configure(pin, PinInputPullUp)
+}
+
+// ConfigureInputPullDown configures a pin as an input with pull-down
+func (g *GPIO) ConfigureInputPullDown(pin core.GPIOPin) error {
+	return g.configure(pin, PinInputPullDown)
+}
+
+// SetPin sets an output pin high (true) or low (false)
+func (g *GPIO) SetPin(pin core.GPIOPin, value bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ps, err := g.state(pin)
+	if err != nil {
+		return err
+	}
+	ps.value = value
+	return nil
+}
+
+// GetPin reads the pin level
+// Inputs follow their pull resistor unless driven with SetInput
+func (g *GPIO) GetPin(pin core.GPIOPin) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ps, err := g.state(pin)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case ps.forced:
+		return ps.forcedTo, nil
+	case ps.mode == PinInputPullUp:
+		return true, nil
+	case ps.mode == PinInputPullDown:
+		return false, nil
+	}
+	return ps.value, nil
+}
+
+// ReadPin reads the pin level, ignoring errors
+func (g *GPIO) ReadPin(pin core.GPIOPin) bool {
+	value, _ := g.GetPin(pin)
+	return value
+}
+
+// SetInput drives the level seen on an input pin (e.g. an endstop switch)
+func (g *GPIO) SetInput(pin core.GPIOPin, value bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ps, err := g.state(pin); err == nil {
+		ps.forced = true
+		ps.forcedTo = value
+	}
+}
+
+// ReleaseInput returns an input pin to its pull resistor level
+func (g *GPIO) ReleaseInput(pin core.GPIOPin) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ps, err := g.state(pin); err == nil {
+		ps.forced = false
+	}
+}
+
+// Mode returns how a pin is currently configured
+func (g *GPIO) Mode(pin core.GPIOPin) PinMode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ps, ok := g.pins[pin]; ok {
+		return ps.mode
+	}
+	return PinUnconfigured
+}
@@ -0,0 +1,93 @@
+package fake
+
+import (
+	"errors"
+	"gopper/core"
+	"sync"
+)
+
+// i2cDevice is a simulated device with a 256-byte register file
+type i2cDevice struct {
+	regs [256]byte
+	ptr  uint8
+}
+
+// I2C implements core.I2CDriver with register-file devices at every address
+// A write sets the register pointer from its first byte and stores the rest
+type I2C struct {
+	mu      sync.Mutex
+	buses   map[core.I2CBusID]uint32
+	devices map[uint16]*i2cDevice
+}
+
+// NewI2C creates a fake I2C driver
+func NewI2C() *I2C {
+	return &I2C{
+		buses:   make(map[core.I2CBusID]uint32),
+		devices: make(map[uint16]*i2cDevice),
+	}
+}
+
+func (d *I2C) device(bus core.I2CBusID, addr core.I2CAddress) (*i2cDevice, error) {
+	if _, ok := d.buses[bus]; !ok {
+		return nil, errors.New("i2c bus not configured")
+	}
+	key := uint16(bus)<<8 | uint16(addr)
+	dev, ok := d.devices[key]
+	if !ok {
+		dev = &i2cDevice{}
+		d.devices[key] = dev
+	}
+	return dev, nil
+}
+
+// ConfigureBus records the bus frequency
+func (d *I2C) ConfigureBus(bus core.I2CBusID, frequencyHz uint32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.buses[bus] = frequencyHz
+	return nil
+}
+
+// Write sets the register pointer and stores any following bytes
+func (d *I2C) Write(bus core.I2CBusID, addr core.I2CAddress, data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dev, err := d.device(bus, addr)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	dev.ptr = data[0]
+	for _, b := range data[1:] {
+		dev.regs[dev.ptr] = b
+		dev.ptr++
+	}
+	return nil
+}
+
+// Read optionally sets the register pointer, then reads readLen bytes
+func (d *I2C) Read(bus core.I2CBusID, addr core.I2CAddress, regData []byte, readLen uint8) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dev, err := d.device(bus, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(regData) > 0 {
+		dev.ptr = regData[0]
+	}
+	out := make([]byte, readLen)
+	for i := range out {
+		out[i] = dev.regs[dev.ptr]
+		dev.ptr++
+	}
+	return out, nil
+}
+
+// GetMachineBus is not supported on the host
+func (d *I2C) GetMachineBus(bus core.I2CBusID) (interface{}, error) {
+	return nil, errors.New("no machine.I2C on host")
+}
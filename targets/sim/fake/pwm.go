@@ -0,0 +1,64 @@
+package fake
+
+import (
+	"errors"
+	"gopper/core"
+	"sync"
+)
+
+// PWM implements core.PWMDriver by recording duty cycles
+type PWM struct {
+	mu     sync.Mutex
+	max    uint32
+	cycles map[core.PWMPin]uint32
+	duty   map[core.PWMPin]core.PWMValue
+}
+
+// NewPWM creates a fake PWM driver with the given maximum value
+func NewPWM(max uint32) *PWM {
+	return &PWM{
+		max:    max,
+		cycles: make(map[core.PWMPin]uint32),
+		duty:   make(map[core.PWMPin]core.PWMValue),
+	}
+}
+
+// ConfigureHardwarePWM records the requested cycle time
+func (p *PWM) ConfigureHardwarePWM(pin core.PWMPin, cycleTicks uint32) (uint32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cycles[pin] = cycleTicks
+	return cycleTicks, nil
+}
+
+// SetDutyCycle records the duty cycle of a configured pin
+func (p *PWM) SetDutyCycle(pin core.PWMPin, value core.PWMValue) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cycles[pin]; !ok {
+		return errors.New("pwm pin not configured")
+	}
+	p.duty[pin] = value
+	return nil
+}
+
+// GetMaxValue returns the maximum PWM value
+func (p *PWM) GetMaxValue() uint32 {
+	return p.max
+}
+
+// DisablePWM forgets a pin's configuration
+func (p *PWM) DisablePWM(pin core.PWMPin) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cycles, pin)
+	delete(p.duty, pin)
+	return nil
+}
+
+// Duty returns the last duty cycle set on a pin
+func (p *PWM) Duty(pin core.PWMPin) core.PWMValue {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.duty[pin]
+}
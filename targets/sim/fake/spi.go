@@ -0,0 +1,52 @@
+package fake
+
+import (
+	"errors"
+	"gopper/core"
+)
+
+// spiBus is the handle returned for a configured fake SPI bus
+type spiBus struct {
+	config core.SPIConfig
+}
+
+// SPI implements core.SPIDriver and core.SoftwareSPIDriver as a loopback:
+// every transfer receives the bytes it sent
+type SPI struct{}
+
+// NewSPI creates a loopback SPI driver
+func NewSPI() *SPI {
+	return &SPI{}
+}
+
+// ConfigureBus returns a handle for the requested bus
+func (s *SPI) ConfigureBus(config core.SPIConfig) (interface{}, error) {
+	return &spiBus{config: config}, nil
+}
+
+// Transfer copies txData into rxData
+func (s *SPI) Transfer(busHandle interface{}, txData []byte, rxData []byte) error {
+	if busHandle == nil {
+		return errors.New("invalid bus handle")
+	}
+	copy(rxData, txData)
+	return nil
+}
+
+// GetBusInfo describes the simulated buses
+func (s *SPI) GetBusInfo() map[core.SPIBusID]string {
+	return map[core.SPIBusID]string{
+		0: "spi0 (loopback)",
+		1: "spi1 (loopback)",
+	}
+}
+
+// GetMachineBus is not supported on the host
+func (s *SPI) GetMachineBus(busHandle interface{}) (interface{}, error) {
+	return nil, errors.New("no machine.SPI on host")
+}
+
+// ConfigureSoftwareSPI returns a handle for a bit-banged bus
+func (s *SPI) ConfigureSoftwareSPI(sclk, mosi, miso uint32, mode core.SPIMode, rate uint32) (interface{}, error) {
+	return &spiBus{config: core.SPIConfig{Mode: mode, Rate: rate}}, nil
+}
@@ -0,0 +1,78 @@
+package fake
+
+import (
+	"gopper/core"
+	"sync/atomic"
+)
+
+// Stepper implements core.StepperBackend by counting steps
+type Stepper struct {
+	Config core.StepperConfig // As passed to Init
+
+	dir      uint32 // 1 while stepping in reverse
+	steps    uint32 // total steps generated
+	position int64  // net position (reverse steps count negative)
+	interval uint32
+}
+
+// NewStepper creates a step-counting backend
+func NewStepper() *Stepper {
+	return &Stepper{}
+}
+
+// Init records the configuration
+func (s *Stepper) Init(cfg core.StepperConfig) error {
+	s.Config = cfg
+	return nil
+}
+
+// Step counts a single step in the current direction
+func (s *Stepper) Step() {
+	atomic.AddUint32(&s.steps, 1)
+	if atomic.LoadUint32(&s.dir) != 0 {
+		atomic.AddInt64(&s.position, -1)
+	} else {
+		atomic.AddInt64(&s.position, 1)
+	}
+}
+
+// SetDirection sets the direction for following steps
+func (s *Stepper) SetDirection(dir bool) {
+	var v uint32
+	if dir {
+		v = 1
+	}
+	atomic.StoreUint32(&s.dir, v)
+}
+
+// Stop halts stepping (no-op)
+func (s *Stepper) Stop() {}
+
+// GetName returns the backend name
+func (s *Stepper) GetName() string {
+	return "fake"
+}
+
+// GetInfo returns the backend's performance, which only the host's
+// timer dispatch limits
+func (s *Stepper) GetInfo() core.StepperBackendInfo {
+	return core.StepperBackendInfo{Name: s.GetName()}
+}
+
+// SetStepInterval records the current step interval
+func (s *Stepper) SetStepInterval(intervalTicks uint32) {
+	atomic.StoreUint32(&s.interval, intervalTicks)
+}
+
+// Steps returns the total number of steps generated
+func (s *Stepper) Steps() uint32 {
+	return atomic.LoadUint32(&s.steps)
+}
+
+// Position returns the net number of steps generated
+func (s *Stepper) Position() int64 {
+	return atomic.LoadInt64(&s.position)
+}
+
+// Check interface implementation at compile time
+var _ core.StepperBackend = (*Stepper)(nil)
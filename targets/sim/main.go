@@ -0,0 +1,239 @@
+//go:build linux && !tinygo
+
+// Command sim runs the Gopper firmware core as a Linux process.
+// Klipper (or any protocol tool) talks to it through a pseudo-terminal, and
+// all peripherals are backed by the in-memory drivers from targets/sim/fake.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gopper/core"
+	"gopper/protocol"
+	"gopper/protocol/host"
+	"gopper/targets/chip"
+	"gopper/targets/sim/fake"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// captureSize is the capture ring size used with -capture
+const captureSize = 256 * 1024
+
+var (
+	linkPath = flag.String("link", "/tmp/gopper-sim", "symlink to create for the pseudo-terminal (empty to disable)")
+	debug    = flag.Bool("debug", false, "print core debug output to stderr")
+	capPath  = flag.String("capture", "", "write a protocol capture to this file on exit or reset")
+
+	// Buffers for communication
+	inputBuffer  *protocol.FifoBuffer
+	outputBuffer *protocol.ScratchOutput
+	transport    *protocol.Transport
+
+	// Pseudo-terminal master side
+	ptyMaster *os.File
+
+	// Simulated hardware
+	board *fake.Board
+
+	// Protocol capture ring (nil unless -capture is given)
+	capture *protocol.Capture
+)
+
+func main() {
+	flag.Parse()
+
+	if *debug {
+		core.SetDebugWriter(func(s string) {
+			fmt.Fprintln(os.Stderr, s)
+		})
+		core.SetDebugEnabled(true)
+	}
+
+	// Initialize clock
+	InitClock()
+	core.TimerInit()
+
+	// Initialize commands (same set as the hardware targets)
+	core.RegisterFirmwareCommands()
+
+	// Register MCU constants and pin enumeration before building the dictionary
+	chip.Sim.Register()
+
+	// Install simulated hardware drivers and stepper backend
+	board = fake.NewBoard(uint32(chip.Sim.NumGPIO))
+	board.Install()
+
+	// Build and cache dictionary after all commands registered
+	core.GetGlobalDictionary().BuildDictionary()
+
+	// Create buffers
+	inputBuffer = protocol.NewFifoBuffer(4096)
+	outputBuffer = protocol.NewScratchOutput()
+
+	// Create transport with a command handler and reset callback
+	transport = protocol.NewTransport(outputBuffer, handleCommand)
+	transport.SetResetCallback(func() {
+		// Clear buffers on host reset. The sequence restarting is only a
+		// guess at a reset (a retransmit after a lost ACK looks the same),
+		// so the configuration is kept; config_reset releases it.
+		inputBuffer.Reset()
+		outputBuffer.Reset()
+	})
+	transport.SetFlushCallback(writeOutput)
+	core.SetGlobalTransport(transport)
+
+	if *capPath != "" {
+		capture = protocol.NewCapture(captureSize, core.GetTime)
+		transport.SetCapture(capture)
+	}
+
+	// A firmware reset re-executes the simulator
+	core.SetResetHandler(func() {
+		saveCapture()
+		removeLink()
+		syscall.Exec("/proc/self/exe", os.Args, os.Environ())
+	})
+
+	// Open the pseudo-terminal
+	master, slave, name, err := host.OpenPTY()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sim: cannot open pseudo-terminal:", err)
+		os.Exit(1)
+	}
+	defer slave.Close()
+	ptyMaster = master
+
+	if *linkPath != "" {
+		os.Remove(*linkPath)
+		if err := os.Symlink(name, *linkPath); err != nil {
+			fmt.Fprintln(os.Stderr, "sim: cannot create symlink:", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Fprintln(os.Stderr, "sim: serial port", name)
+	if *linkPath != "" {
+		fmt.Fprintln(os.Stderr, "sim: linked as", *linkPath)
+	}
+
+	// Clean up the symlink on exit
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		saveCapture()
+		removeLink()
+		os.Exit(0)
+	}()
+
+	// Read the pseudo-terminal in the background
+	rx := make(chan []byte, 64)
+	go ptyReaderLoop(master, rx)
+
+	var pending []byte
+	for {
+		// Start of this iteration, for the load statistics
+		loopStart := GetHardwareTime()
+
+		// Update system time from the host clock
+		UpdateSystemTime()
+
+		// Move received data into the input FIFO
+		select {
+		case data := <-rx:
+			pending = append(pending, data...)
+		default:
+		}
+		if len(pending) > 0 {
+			written := inputBuffer.Write(pending)
+			pending = pending[written:]
+		}
+
+		// Process incoming messages
+		if inputBuffer.Available() > 0 {
+			data := inputBuffer.Data()
+			originalLen := len(data)
+			inputBuf := protocol.NewSliceInputBuffer(data)
+
+			transport.Receive(inputBuf)
+
+			// Remove consumed bytes from FIFO
+			consumed := originalLen - inputBuf.Available()
+			if consumed > 0 {
+				inputBuffer.Pop(consumed)
+			}
+		}
+
+		// Write outgoing data
+		writeOutput()
+
+		// Process scheduled timers
+		core.ProcessTimers()
+
+		// Send reports and run work that timers handed to task context,
+		// including a pending reset now that its ACK is written
+		core.RunTasks()
+
+		// Record the iteration's run time and send stats when due
+		core.StatsUpdate(loopStart, GetHardwareTime())
+
+		// Flush responses generated by timers and tasks
+		writeOutput()
+
+		time.Sleep(20 * time.Microsecond)
+	}
+}
+
+// ptyReaderLoop forwards data read from the pseudo-terminal to rx
+func ptyReaderLoop(master *os.File, rx chan<- []byte) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := master.Read(buf)
+		if err != nil {
+			// EIO is returned while no host holds the slave side open
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		rx <- data
+	}
+}
+
+// handleCommand dispatches received commands to the command registry
+func handleCommand(cmdID uint16, data *[]byte) error {
+	return core.DispatchCommand(cmdID, data)
+}
+
+// writeOutput writes available data from the output buffer to the pseudo-terminal
+func writeOutput() {
+	result := outputBuffer.Result()
+	if len(result) == 0 {
+		return
+	}
+	if _, err := ptyMaster.Write(result); err != nil {
+		fmt.Fprintln(os.Stderr, "sim: write error:", err)
+	}
+	outputBuffer.Reset()
+}
+
+// removeLink removes the pseudo-terminal symlink
+func removeLink() {
+	if *linkPath != "" {
+		os.Remove(*linkPath)
+	}
+}
+
+// saveCapture writes the capture ring to the -capture file
+func saveCapture() {
+	if capture == nil {
+		return
+	}
+	if err := os.WriteFile(*capPath, capture.AppendSnapshot(nil), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "sim: cannot write capture:", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "sim: capture written to", *capPath)
+}
@@ -6,6 +6,7 @@ package main
 // Watch on oscilloscope to see frequency changes
 
 import (
+	"gopper/core"
 	piostepper "gopper/targets/pio"
 	"machine"
 	"time"
@@ -16,23 +17,16 @@ const (
 	dirPin  = machine.DIR7
 )
 
-// Speed test configurations: clock divider and expected approximate frequency
+// Speed test configurations: step interval in 1MHz timer ticks
 var speedTests = []struct {
-	divider uint16
-	name    string
+	interval uint32
+	name     string
 }{
-	//{10000, "Very Slow (~1.2 kHz)"},
-	//{5000, "Slow (~2.4 kHz)"},
-	//{2000, "Medium-Slow (~6 kHz)"},
-	//{1000, "Medium (~12 kHz)"},
-	//{500, "Medium-Fast (~24 kHz)"},
-	//{200, "Fast (~60 kHz)"},
-	{100, "Very Fast (~120 kHz)"},
-	{50, "Ultra Fast (~240 kHz)"},
-	{25, "~500 Khz"},
-	//{12, "~1Mhz"},
-	//{6, "~2Mhz"},
-	//{2, "Guess"},
+	//{1000, "Slow (1 kHz)"},
+	//{100, "Medium (10 kHz)"},
+	{20, "Fast (50 kHz)"},
+	{10, "Very Fast (100 kHz)"},
+	{5, "Ultra Fast (200 kHz)"},
 }
 
 func main() {
@@ -55,7 +49,12 @@ func main() {
 
 	// Create and init stepper
 	stepper := piostepper.NewStepperPIO(0, 0)
-	err := stepper.Init(uint8(stepPin), uint8(dirPin), false, false)
+	err := stepper.Init(core.StepperConfig{
+		StepPin:    uint8(stepPin),
+		DirPin:     uint8(dirPin),
+		PulseTicks: 2,
+		SetupTicks: 2,
+	})
 	if err != nil {
 		println("Init error:", err.Error())
 		for {
@@ -80,8 +79,8 @@ func main() {
 			stepper.Stop()
 
 			// Set new speed
-			stepper.SetClockDiv(test.divider, 0)
-			println("Speed:", test.name, "- Divider:", test.divider)
+			stepper.SetStepInterval(test.interval)
+			println("Speed:", test.name, "- Interval:", test.interval)
 
 			led.High()
 
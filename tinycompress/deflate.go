@@ -0,0 +1,624 @@
+package tinycompress
+
+import "io"
+
+// DEFLATE encoder (RFC 1951) with LZ77 matching and fixed or dynamic Huffman
+// coding. All working memory lives in the deflater struct (about 16KB), so
+// compressing never allocates beyond what the output writer does.
+//
+// Each block is encoded in two passes over the same input: the first pass
+// runs the match finder only to count symbol frequencies, the second runs it
+// again (with identical results) and emits the codes. This avoids buffering
+// a token list at the cost of doing the matching twice.
+
+const (
+	windowBits = 12 // 4KB match window - small, but plenty for JSON
+	windowSize = 1 << windowBits
+	windowMask = windowSize - 1
+
+	hashBits = 10
+	hashSize = 1 << hashBits
+
+	minMatch  = 3
+	maxMatch  = 258
+	maxChain  = 32 // Candidates examined per position
+	lazyMatch = 32 // Matches this long are taken without trying the next position
+
+	numLitCodes  = 286
+	numFixedLit  = 288 // The fixed code also covers the two unused symbols
+	numDistCodes = 30
+	numCLCodes   = 19
+	endOfBlock   = 256
+
+	maxCodeBits   = 15
+	maxCLCodeBits = 7
+
+	maxStoredBlock = 65535
+)
+
+var lengthBase = [29]uint16{
+	3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+	35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+}
+
+var lengthExtra = [29]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+	3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+}
+
+var distBase = [numDistCodes]uint16{
+	1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+	257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577,
+}
+
+var distExtra = [numDistCodes]uint8{
+	0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+	7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+}
+
+// Order in which code length code lengths are sent
+var clOrder = [numCLCodes]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// Fixed Huffman tables (RFC 1951 section 3.2.6)
+var (
+	fixedLitLen   [numFixedLit]uint8
+	fixedLitCode  [numFixedLit]uint16
+	fixedDistLen  [numDistCodes]uint8
+	fixedDistCode [numDistCodes]uint16
+)
+
+func init() {
+	for i := range fixedLitLen {
+		switch {
+		case i < 144:
+			fixedLitLen[i] = 8
+		case i < 256:
+			fixedLitLen[i] = 9
+		case i < 280:
+			fixedLitLen[i] = 7
+		default:
+			fixedLitLen[i] = 8
+		}
+	}
+	for i := range fixedDistLen {
+		fixedDistLen[i] = 5
+	}
+	canonicalCodes(fixedLitLen[:], fixedLitCode[:])
+	canonicalCodes(fixedDistLen[:], fixedDistCode[:])
+}
+
+// bitWriter packs LSB-first bit fields into bytes
+type bitWriter struct {
+	w     io.Writer
+	bits  uint64
+	nbits uint
+	buf   [256]byte
+	n     int
+	err   error
+}
+
+func (b *bitWriter) reset(w io.Writer) {
+	b.w = w
+	b.bits = 0
+	b.nbits = 0
+	b.n = 0
+	b.err = nil
+}
+
+func (b *bitWriter) writeBits(v uint32, n uint) {
+	b.bits |= uint64(v) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf[b.n] = byte(b.bits)
+		b.n++
+		b.bits >>= 8
+		b.nbits -= 8
+		if b.n == len(b.buf) {
+			b.flush()
+		}
+	}
+}
+
+// alignByte pads with zero bits up to the next byte boundary
+func (b *bitWriter) alignByte() {
+	if b.nbits > 0 {
+		b.writeBits(0, 8-b.nbits)
+	}
+}
+
+// writeBytes writes whole bytes (the writer must be byte aligned)
+func (b *bitWriter) writeBytes(p []byte) {
+	b.flush()
+	if b.err == nil {
+		_, b.err = b.w.Write(p)
+	}
+}
+
+func (b *bitWriter) flush() {
+	if b.n > 0 && b.err == nil {
+		_, b.err = b.w.Write(b.buf[:b.n])
+	}
+	b.n = 0
+}
+
+// huffmanBuilder holds scratch space for computing code lengths
+type huffmanBuilder struct {
+	weight [numLitCodes]uint32
+	sym    [numLitCodes]uint16
+	node   [2 * numLitCodes]uint32
+	parent [2 * numLitCodes]uint16
+	depth  [2 * numLitCodes]uint8
+}
+
+// buildLengths computes Huffman code lengths no longer than maxBits
+// At least two symbols always get a code so the tree is complete.
+func (h *huffmanBuilder) buildLengths(freq []uint32, lens []uint8, maxBits uint8) {
+	n := len(freq)
+	copy(h.weight[:n], freq)
+	used := 0
+	for i := 0; i < n; i++ {
+		if h.weight[i] > 0 {
+			used++
+		}
+	}
+	for i := 0; used < 2; i++ {
+		if h.weight[i] == 0 {
+			h.weight[i] = 1
+			used++
+		}
+	}
+
+	for {
+		// Sort used symbols by weight (insertion sort - at most 286 symbols)
+		m := 0
+		for i := 0; i < n; i++ {
+			if h.weight[i] == 0 {
+				continue
+			}
+			j := m
+			for j > 0 && h.weight[h.sym[j-1]] > h.weight[i] {
+				h.sym[j] = h.sym[j-1]
+				j--
+			}
+			h.sym[j] = uint16(i)
+			m++
+		}
+
+		// Two-queue construction: leaves in node[0:m], internal nodes after
+		for i := 0; i < m; i++ {
+			h.node[i] = h.weight[h.sym[i]]
+		}
+		leaf, inner, next := 0, m, m
+		for next < 2*m-1 {
+			var pair [2]int
+			for k := range pair {
+				if leaf < m && (inner >= next || h.node[leaf] <= h.node[inner]) {
+					pair[k] = leaf
+					leaf++
+				} else {
+					pair[k] = inner
+					inner++
+				}
+			}
+			h.node[next] = h.node[pair[0]] + h.node[pair[1]]
+			h.parent[pair[0]] = uint16(next)
+			h.parent[pair[1]] = uint16(next)
+			next++
+		}
+
+		// Parents always come after their children
+		h.depth[2*m-2] = 0
+		longest := uint8(0)
+		for i := 2*m - 3; i >= 0; i-- {
+			h.depth[i] = h.depth[h.parent[i]] + 1
+			if i < m && h.depth[i] > longest {
+				longest = h.depth[i]
+			}
+		}
+
+		if longest <= maxBits {
+			for i := range lens {
+				lens[i] = 0
+			}
+			for i := 0; i < m; i++ {
+				lens[h.sym[i]] = h.depth[i]
+			}
+			return
+		}
+
+		// Too deep - flatten the weights and try again
+		for i := 0; i < n; i++ {
+			if h.weight[i] > 0 {
+				h.weight[i] = h.weight[i]>>1 | 1
+			}
+		}
+	}
+}
+
+// canonicalCodes assigns canonical codes for the given lengths, bit-reversed
+// for LSB-first output
+func canonicalCodes(lens []uint8, codes []uint16) {
+	var count [maxCodeBits + 1]uint16
+	for _, l := range lens {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	var next [maxCodeBits + 1]uint16
+	code := uint16(0)
+	for bits := 1; bits <= maxCodeBits; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+	for i, l := range lens {
+		if l == 0 {
+			codes[i] = 0
+			continue
+		}
+		codes[i] = reverseBits(next[l], l)
+		next[l]++
+	}
+}
+
+func reverseBits(v uint16, n uint8) uint16 {
+	r := uint16(0)
+	for i := uint8(0); i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+// deflater holds all encoder state
+type deflater struct {
+	// LZ77 match finder: head holds the newest position per hash, prev the
+	// distance from each position to the previous one with the same hash
+	head [hashSize]int32
+	prev [windowSize]uint16
+
+	// Statistics gathered by the counting pass
+	counting  bool
+	litFreq   [numLitCodes]uint32
+	distFreq  [numDistCodes]uint32
+	extraBits uint32
+
+	// Codes used by the emitting pass
+	litLen   [numLitCodes]uint8
+	litCode  [numLitCodes]uint16
+	distLen  [numDistCodes]uint8
+	distCode [numDistCodes]uint16
+
+	// Dynamic block header: run-length coded code lengths
+	lens     [numLitCodes + numDistCodes]uint8
+	rleSym   [numLitCodes + numDistCodes]uint8
+	rleExtra [numLitCodes + numDistCodes]uint8
+	nrle     int
+	clFreq   [numCLCodes]uint32
+	clLen    [numCLCodes]uint8
+	clCode   [numCLCodes]uint16
+
+	huff huffmanBuilder
+	bw   bitWriter
+}
+
+// writeBlock compresses data as one DEFLATE block (or a run of stored
+// blocks), picking whichever encoding is smallest
+func (d *deflater) writeBlock(data []byte, final bool) {
+	// Pass 1: count symbols
+	d.litFreq = [numLitCodes]uint32{}
+	d.distFreq = [numDistCodes]uint32{}
+	d.extraBits = 0
+	d.counting = true
+	d.lz77(data)
+	d.litFreq[endOfBlock]++
+
+	// Dynamic codes and header
+	d.huff.buildLengths(d.litFreq[:], d.litLen[:], maxCodeBits)
+	d.huff.buildLengths(d.distFreq[:], d.distLen[:], maxCodeBits)
+	numLit, numDist := d.buildCodeLengthCodes()
+	numCL := numCLCodes
+	for numCL > 4 && d.clLen[clOrder[numCL-1]] == 0 {
+		numCL--
+	}
+
+	dynamicBits := uint32(3+5+5+4) + 3*uint32(numCL)
+	for i := 0; i < d.nrle; i++ {
+		dynamicBits += uint32(d.clLen[d.rleSym[i]])
+		switch d.rleSym[i] {
+		case 16:
+			dynamicBits += 2
+		case 17:
+			dynamicBits += 3
+		case 18:
+			dynamicBits += 7
+		}
+	}
+	fixedBits := uint32(3)
+	for i, f := range d.litFreq {
+		dynamicBits += f * uint32(d.litLen[i])
+		fixedBits += f * uint32(fixedLitLen[i])
+	}
+	for i, f := range d.distFreq {
+		dynamicBits += f * uint32(d.distLen[i])
+		fixedBits += f * uint32(fixedDistLen[i])
+	}
+	dynamicBits += d.extraBits
+	fixedBits += d.extraBits
+
+	chunks := (len(data) + maxStoredBlock - 1) / maxStoredBlock
+	if chunks == 0 {
+		chunks = 1
+	}
+	storedBits := uint32(chunks)*(3+7+32) + 8*uint32(len(data))
+
+	if storedBits <= fixedBits && storedBits <= dynamicBits {
+		d.writeStored(data, final)
+		return
+	}
+
+	if fixedBits <= dynamicBits {
+		copy(d.litLen[:], fixedLitLen[:])
+		copy(d.litCode[:], fixedLitCode[:])
+		d.distLen = fixedDistLen
+		d.distCode = fixedDistCode
+		d.bw.writeBits(boolBit(final), 1)
+		d.bw.writeBits(1, 2)
+	} else {
+		canonicalCodes(d.litLen[:], d.litCode[:])
+		canonicalCodes(d.distLen[:], d.distCode[:])
+		d.writeDynamicHeader(final, numLit, numDist, numCL)
+	}
+
+	// Pass 2: emit codes
+	d.counting = false
+	d.lz77(data)
+	d.bw.writeBits(uint32(d.litCode[endOfBlock]), uint(d.litLen[endOfBlock]))
+}
+
+// writeStored writes data as uncompressed blocks of at most 64KB
+func (d *deflater) writeStored(data []byte, final bool) {
+	for {
+		n := len(data)
+		if n > maxStoredBlock {
+			n = maxStoredBlock
+		}
+		last := final && n == len(data)
+		d.bw.writeBits(boolBit(last), 1)
+		d.bw.writeBits(0, 2)
+		d.bw.alignByte()
+		d.bw.writeBits(uint32(n), 16)
+		d.bw.writeBits(uint32(^uint16(n)), 16)
+		d.bw.writeBytes(data[:n])
+		data = data[n:]
+		if len(data) == 0 {
+			return
+		}
+	}
+}
+
+// syncFlush ends the current byte with an empty stored block (like zlib's
+// Z_SYNC_FLUSH) so the output so far can be sent on its own
+func (d *deflater) syncFlush() {
+	if d.bw.nbits == 0 {
+		d.bw.flush()
+		return
+	}
+	d.bw.writeBits(0, 3)
+	d.bw.alignByte()
+	d.bw.writeBits(0xFFFF0000, 32)
+	d.bw.flush()
+}
+
+// buildCodeLengthCodes run-length codes the literal/length and distance code
+// lengths and builds the code length code
+func (d *deflater) buildCodeLengthCodes() (numLit, numDist int) {
+	numLit = numLitCodes
+	for numLit > 257 && d.litLen[numLit-1] == 0 {
+		numLit--
+	}
+	numDist = numDistCodes
+	for numDist > 1 && d.distLen[numDist-1] == 0 {
+		numDist--
+	}
+	n := copy(d.lens[:], d.litLen[:numLit])
+	n += copy(d.lens[n:], d.distLen[:numDist])
+
+	d.nrle = 0
+	d.clFreq = [numCLCodes]uint32{}
+	for i := 0; i < n; {
+		l := d.lens[i]
+		run := 1
+		for i+run < n && d.lens[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run >= 11 {
+				r := run
+				if r > 138 {
+					r = 138
+				}
+				d.addRLE(18, uint8(r-11))
+				run -= r
+			}
+			if run >= 3 {
+				d.addRLE(17, uint8(run-3))
+				run = 0
+			}
+		} else {
+			d.addRLE(l, 0)
+			run--
+			for run >= 3 {
+				r := run
+				if r > 6 {
+					r = 6
+				}
+				d.addRLE(16, uint8(r-3))
+				run -= r
+			}
+		}
+		for ; run > 0; run-- {
+			d.addRLE(l, 0)
+		}
+	}
+
+	d.huff.buildLengths(d.clFreq[:], d.clLen[:], maxCLCodeBits)
+	canonicalCodes(d.clLen[:], d.clCode[:])
+	return numLit, numDist
+}
+
+func (d *deflater) addRLE(sym, extra uint8) {
+	d.rleSym[d.nrle] = sym
+	d.rleExtra[d.nrle] = extra
+	d.nrle++
+	d.clFreq[sym]++
+}
+
+func (d *deflater) writeDynamicHeader(final bool, numLit, numDist, numCL int) {
+	d.bw.writeBits(boolBit(final), 1)
+	d.bw.writeBits(2, 2)
+	d.bw.writeBits(uint32(numLit-257), 5)
+	d.bw.writeBits(uint32(numDist-1), 5)
+	d.bw.writeBits(uint32(numCL-4), 4)
+	for i := 0; i < numCL; i++ {
+		d.bw.writeBits(uint32(d.clLen[clOrder[i]]), 3)
+	}
+	for i := 0; i < d.nrle; i++ {
+		sym := d.rleSym[i]
+		d.bw.writeBits(uint32(d.clCode[sym]), uint(d.clLen[sym]))
+		switch sym {
+		case 16:
+			d.bw.writeBits(uint32(d.rleExtra[i]), 2)
+		case 17:
+			d.bw.writeBits(uint32(d.rleExtra[i]), 3)
+		case 18:
+			d.bw.writeBits(uint32(d.rleExtra[i]), 7)
+		}
+	}
+}
+
+// lz77 runs the match finder over data, counting or emitting each token
+// Matching is greedy with one step of lazy evaluation.
+func (d *deflater) lz77(data []byte) {
+	for i := range d.head {
+		d.head[i] = -1
+	}
+
+	n := len(data)
+	pos := 0
+	for pos < n {
+		if pos+minMatch > n {
+			d.literal(data[pos])
+			pos++
+			continue
+		}
+
+		length, dist := d.findMatch(data, pos)
+		d.insert(data, pos)
+		if length >= minMatch && length < lazyMatch && pos+1+minMatch <= n {
+			if next, _ := d.findMatch(data, pos+1); next > length {
+				d.literal(data[pos])
+				pos++
+				continue
+			}
+		}
+		if length < minMatch {
+			d.literal(data[pos])
+			pos++
+			continue
+		}
+
+		d.match(length, dist)
+		for i := pos + 1; i < pos+length && i+minMatch <= n; i++ {
+			d.insert(data, i)
+		}
+		pos += length
+	}
+}
+
+func hash3(data []byte, pos int) uint32 {
+	v := uint32(data[pos])<<16 | uint32(data[pos+1])<<8 | uint32(data[pos+2])
+	return (v * 2654435761) >> (32 - hashBits)
+}
+
+// insert adds pos to the hash chains (needs minMatch bytes at pos)
+func (d *deflater) insert(data []byte, pos int) {
+	h := hash3(data, pos)
+	old := d.head[h]
+	if old >= 0 && pos-int(old) < windowSize {
+		d.prev[pos&windowMask] = uint16(pos - int(old))
+	} else {
+		d.prev[pos&windowMask] = 0
+	}
+	d.head[h] = int32(pos)
+}
+
+// findMatch returns the longest earlier match for the bytes at pos
+func (d *deflater) findMatch(data []byte, pos int) (length, dist int) {
+	limit := len(data) - pos
+	if limit > maxMatch {
+		limit = maxMatch
+	}
+	cand := int(d.head[hash3(data, pos)])
+	for chain := 0; chain < maxChain && cand >= 0 && pos-cand < windowSize; chain++ {
+		if data[cand+length] == data[pos+length] {
+			l := 0
+			for l < limit && data[cand+l] == data[pos+l] {
+				l++
+			}
+			if l > length {
+				length, dist = l, pos-cand
+				if l == limit {
+					break
+				}
+			}
+		}
+		step := int(d.prev[cand&windowMask])
+		if step == 0 {
+			break
+		}
+		cand -= step
+	}
+	if length < minMatch {
+		return 0, 0
+	}
+	return length, dist
+}
+
+func (d *deflater) literal(b byte) {
+	if d.counting {
+		d.litFreq[b]++
+		return
+	}
+	d.bw.writeBits(uint32(d.litCode[b]), uint(d.litLen[b]))
+}
+
+func (d *deflater) match(length, dist int) {
+	lc := len(lengthBase) - 1
+	for int(lengthBase[lc]) > length {
+		lc--
+	}
+	dc := numDistCodes - 1
+	for int(distBase[dc]) > dist {
+		dc--
+	}
+
+	if d.counting {
+		d.litFreq[257+lc]++
+		d.distFreq[dc]++
+		d.extraBits += uint32(lengthExtra[lc]) + uint32(distExtra[dc])
+		return
+	}
+	d.bw.writeBits(uint32(d.litCode[257+lc]), uint(d.litLen[257+lc]))
+	d.bw.writeBits(uint32(length-int(lengthBase[lc])), uint(lengthExtra[lc]))
+	d.bw.writeBits(uint32(d.distCode[dc]), uint(d.distLen[dc]))
+	d.bw.writeBits(uint32(dist-int(distBase[dc])), uint(distExtra[dc]))
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,295 @@
+package tinycompress
+
+import "errors"
+
+// DEFLATE decoder (RFC 1951) for stored, fixed and dynamic Huffman blocks.
+// Decoding walks the canonical code one bit at a time (like zlib's puff),
+// which is slow but needs only small fixed tables.
+
+var errCorrupt = errors.New("tinycompress: corrupt deflate data")
+
+// bitReader reads LSB-first bit fields
+type bitReader struct {
+	data  []byte
+	pos   int
+	bits  uint32
+	nbits uint
+}
+
+func (b *bitReader) readBits(n uint) (uint32, error) {
+	for b.nbits < n {
+		if b.pos >= len(b.data) {
+			return 0, errCorrupt
+		}
+		b.bits |= uint32(b.data[b.pos]) << b.nbits
+		b.pos++
+		b.nbits += 8
+	}
+	v := b.bits & (1<<n - 1)
+	b.bits >>= n
+	b.nbits -= n
+	return v, nil
+}
+
+// alignByte drops bits up to the next byte boundary
+func (b *bitReader) alignByte() {
+	b.bits = 0
+	b.nbits = 0
+}
+
+// huffmanDecoder is a canonical code: symbol counts per length and the
+// symbols in code order
+type huffmanDecoder struct {
+	count  [maxCodeBits + 1]uint16
+	symbol [numFixedLit]uint16
+}
+
+func (h *huffmanDecoder) init(lens []uint8) error {
+	h.count = [maxCodeBits + 1]uint16{}
+	for _, l := range lens {
+		h.count[l]++
+	}
+	// Reject over-subscribed codes; incomplete codes are allowed
+	left := 1
+	for l := 1; l <= maxCodeBits; l++ {
+		left <<= 1
+		left -= int(h.count[l])
+		if left < 0 {
+			return errCorrupt
+		}
+	}
+	var offs [maxCodeBits + 1]uint16
+	for l := 1; l < maxCodeBits; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	for sym, l := range lens {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+func (h *huffmanDecoder) decode(br *bitReader) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxCodeBits; l++ {
+		bit, err := br.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+(code-first)]), nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return 0, errCorrupt
+}
+
+// inflater holds all decoder state
+type inflater struct {
+	br      bitReader
+	lit     huffmanDecoder
+	dist    huffmanDecoder
+	lens    [numLitCodes + numDistCodes + 2]uint8
+	fixedOK bool
+	fixLit  huffmanDecoder
+	fixDist huffmanDecoder
+}
+
+// inflate decodes a raw DEFLATE stream into out and returns the number of
+// bytes written and of input bytes consumed
+func (f *inflater) inflate(in []byte, out []byte) (int, int, error) {
+	f.br = bitReader{data: in}
+	n := 0
+	for {
+		final, err := f.br.readBits(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		btype, err := f.br.readBits(2)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		switch btype {
+		case 0:
+			n, err = f.stored(out, n)
+		case 1:
+			f.initFixed()
+			n, err = f.codes(&f.fixLit, &f.fixDist, out, n)
+		case 2:
+			if err = f.dynamic(); err == nil {
+				n, err = f.codes(&f.lit, &f.dist, out, n)
+			}
+		default:
+			err = errCorrupt
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if final == 1 {
+			return n, f.br.pos, nil
+		}
+	}
+}
+
+func (f *inflater) stored(out []byte, n int) (int, error) {
+	f.br.alignByte()
+	hdr, err := f.br.readBits(32)
+	if err != nil {
+		return 0, err
+	}
+	length := int(hdr & 0xFFFF)
+	if uint16(hdr>>16) != ^uint16(length) {
+		return 0, errCorrupt
+	}
+	if f.br.pos+length > len(f.br.data) || n+length > len(out) {
+		return 0, errCorrupt
+	}
+	copy(out[n:], f.br.data[f.br.pos:f.br.pos+length])
+	f.br.pos += length
+	return n + length, nil
+}
+
+func (f *inflater) initFixed() {
+	if f.fixedOK {
+		return
+	}
+	f.fixLit.init(fixedLitLen[:])
+	f.fixDist.init(fixedDistLen[:])
+	f.fixedOK = true
+}
+
+func (f *inflater) dynamic() error {
+	hlit, err := f.br.readBits(5)
+	if err != nil {
+		return err
+	}
+	hdist, err := f.br.readBits(5)
+	if err != nil {
+		return err
+	}
+	hclen, err := f.br.readBits(4)
+	if err != nil {
+		return err
+	}
+	numLit, numDist := int(hlit)+257, int(hdist)+1
+	if numLit > numLitCodes || numDist > numDistCodes {
+		return errCorrupt
+	}
+
+	var clLens [numCLCodes]uint8
+	for i := 0; i < int(hclen)+4; i++ {
+		v, err := f.br.readBits(3)
+		if err != nil {
+			return err
+		}
+		clLens[clOrder[i]] = uint8(v)
+	}
+	// The code length code reuses the literal decoder's tables
+	if err := f.lit.init(clLens[:]); err != nil {
+		return err
+	}
+
+	total := numLit + numDist
+	for i := 0; i < total; {
+		sym, err := f.lit.decode(&f.br)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			f.lens[i] = uint8(sym)
+			i++
+			continue
+		}
+		var value uint8
+		var repeat uint32
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errCorrupt
+			}
+			value = f.lens[i-1]
+			repeat, err = f.br.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = f.br.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = f.br.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(repeat) > total {
+			return errCorrupt
+		}
+		for ; repeat > 0; repeat-- {
+			f.lens[i] = value
+			i++
+		}
+	}
+
+	if err := f.lit.init(f.lens[:numLit]); err != nil {
+		return err
+	}
+	return f.dist.init(f.lens[numLit:total])
+}
+
+func (f *inflater) codes(lit, dist *huffmanDecoder, out []byte, n int) (int, error) {
+	for {
+		sym, err := lit.decode(&f.br)
+		if err != nil {
+			return 0, err
+		}
+		if sym < endOfBlock {
+			if n >= len(out) {
+				return 0, errCorrupt
+			}
+			out[n] = byte(sym)
+			n++
+			continue
+		}
+		if sym == endOfBlock {
+			return n, nil
+		}
+
+		sym -= 257
+		if sym >= len(lengthBase) {
+			return 0, errCorrupt
+		}
+		extra, err := f.br.readBits(uint(lengthExtra[sym]))
+		if err != nil {
+			return 0, err
+		}
+		length := int(lengthBase[sym]) + int(extra)
+
+		dsym, err := dist.decode(&f.br)
+		if err != nil {
+			return 0, err
+		}
+		if dsym >= numDistCodes {
+			return 0, errCorrupt
+		}
+		extra, err = f.br.readBits(uint(distExtra[dsym]))
+		if err != nil {
+			return 0, err
+		}
+		d := int(distBase[dsym]) + int(extra)
+
+		if d > n || n+length > len(out) {
+			return 0, errCorrupt
+		}
+		for i := 0; i < length; i++ {
+			out[n] = out[n-d]
+			n++
+		}
+	}
+}
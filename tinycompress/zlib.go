@@ -10,6 +10,9 @@ import (
 type ZlibEncoder struct {
 	buf    []byte
 	output []byte
+	sw     sliceWriter
+	def    *deflater // Allocate on demand
+	inf    *inflater // Allocate on demand
 }
 
 // ZlibStream handles streaming compression for multiple small messages
@@ -20,6 +23,27 @@ type ZlibStream struct {
 	totalOut int
 }
 
+// Zlib framing: CMF/FLG header for a 32KB window with the default
+// compression level, and the Adler-32 trailer
+const (
+	zlibHeaderSize  = 2
+	zlibTrailerSize = 4
+)
+
+func writeZlibHeader(bw *bitWriter) {
+	bw.writeBits(0x78, 8)
+	bw.writeBits(0x9C, 8)
+}
+
+// writeZlibTrailer ends the DEFLATE data and writes the checksum big-endian
+func writeZlibTrailer(bw *bitWriter, checksum uint32) {
+	bw.alignByte()
+	for shift := 24; shift >= 0; shift -= 8 {
+		bw.writeBits(uint32(byte(checksum>>uint(shift))), 8)
+	}
+	bw.flush()
+}
+
 // NewZlib creates a new zlib-compatible encoder
 func NewZlib(bufferSize int) *ZlibEncoder {
 	return &ZlibEncoder{
@@ -36,57 +60,64 @@ func (z *ZlibEncoder) NewStream() *ZlibStream {
 	}
 }
 
-// Compress implements minimal DEFLATE compression in zlib format
+// sliceWriter appends to a byte slice
+type sliceWriter struct {
+	buf []byte
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// storedSize is the size of data as uncompressed DEFLATE blocks, which
+// bounds the size of any block the deflater chooses to emit
+func storedSize(n int) int {
+	chunks := (n + maxStoredBlock - 1) / maxStoredBlock
+	if chunks == 0 {
+		chunks = 1
+	}
+	return n + 5*chunks
+}
+
+// prepare sizes the output buffer for n input bytes plus extra framing
+// and points the deflater at it
+func (z *ZlibEncoder) prepare(n, extra int) *sliceWriter {
+	if z.def == nil {
+		z.def = &deflater{}
+	}
+	requiredSize := storedSize(n) + extra
+	if cap(z.output) < requiredSize {
+		z.output = make([]byte, 0, requiredSize)
+	}
+	z.sw.buf = z.output[:0]
+	z.def.bw.reset(&z.sw)
+	return &z.sw
+}
+
+// Compress compresses input in zlib format
+// The output buffer is reused by the next call.
 func (z *ZlibEncoder) Compress(input []byte) ([]byte, int, error) {
 	if len(input) == 0 {
 		return nil, 0, nil
 	}
 
-	requiredSize := len(input) + 7 // 2 (zlib) + 1 (deflate) + 4 (len+nlen) + 4 (adler32) = 11, but data starts at 7
-	if cap(z.output) < requiredSize+4 {
-		z.output = make([]byte, requiredSize+4)
+	sw := z.prepare(len(input), zlibHeaderSize+zlibTrailerSize)
+	d := z.def
+	writeZlibHeader(&d.bw)
+	d.writeBlock(input, true)
+	writeZlibTrailer(&d.bw, adler32.Checksum(input))
+	if d.bw.err != nil {
+		return nil, 0, d.bw.err
 	}
-	z.output = z.output[:requiredSize+4]
-
-	pos := 0
-
-	// Zlib header
-	z.output[pos] = 0x78
-	z.output[pos+1] = 0x9C
-	pos += 2
-
-	// DEFLATE block header (final block, no compression)
-	z.output[pos] = 0x01
-	pos++
-
-	// Length of data (16-bit little endian)
-	length := uint16(len(input))
-	z.output[pos] = byte(length)
-	z.output[pos+1] = byte(length >> 8)
-	pos += 2
-
-	// NLEN (one's complement of length)
-	nlength := uint16(^length)
-	z.output[pos] = byte(nlength)
-	z.output[pos+1] = byte(nlength >> 8)
-	pos += 2
-
-	// Copy raw data
-	copy(z.output[pos:], input)
-	pos += len(input)
-
-	// Calculate and append Adler-32 checksum (big-endian)
-	checksum := adler32.Checksum(input)
-	z.output[pos] = byte(checksum >> 24)
-	z.output[pos+1] = byte(checksum >> 16)
-	z.output[pos+2] = byte(checksum >> 8)
-	z.output[pos+3] = byte(checksum)
-	pos += 4
-
-	return z.output[:pos], pos, nil
+
+	z.output = sw.buf
+	return z.output, len(z.output), nil
 }
 
 // WriteBlock writes a block to the stream (for batching multiple messages)
+// Each block is compressed on its own and ends on a byte boundary, so the
+// returned bytes can be sent as soon as they are produced.
 func (s *ZlibStream) WriteBlock(input []byte, isFinal bool) ([]byte, int, error) {
 	if len(input) == 0 {
 		return nil, 0, nil
@@ -96,65 +127,36 @@ func (s *ZlibStream) WriteBlock(input []byte, isFinal bool) ([]byte, int, error)
 	s.adler.Write(input)
 	s.totalIn += len(input)
 
-	requiredSize := len(input) + 5 // 1 (block header) + 4 (len+nlen)
+	extra := 5 // Sync flush after a non-final block
 	if s.totalOut == 0 {
-		requiredSize += 2 // Add zlib header for first block
+		extra += zlibHeaderSize
 	}
 	if isFinal {
-		requiredSize += 4 // Add checksum for final block
+		extra += zlibTrailerSize
 	}
 
-	if cap(s.encoder.output) < requiredSize {
-		s.encoder.output = make([]byte, requiredSize)
-	}
-	s.encoder.output = s.encoder.output[:requiredSize]
-
-	pos := 0
+	z := s.encoder
+	sw := z.prepare(len(input), extra)
+	d := z.def
 
 	// Zlib header (only on first block)
 	if s.totalOut == 0 {
-		s.encoder.output[pos] = 0x78
-		s.encoder.output[pos+1] = 0x9C
-		pos += 2
+		writeZlibHeader(&d.bw)
 	}
 
-	// DEFLATE block header
+	d.writeBlock(input, isFinal)
 	if isFinal {
-		s.encoder.output[pos] = 0x01 // Final block, no compression
+		writeZlibTrailer(&d.bw, s.adler.Sum32())
 	} else {
-		s.encoder.output[pos] = 0x00 // Non-final block, no compression
+		d.syncFlush()
 	}
-	pos++
-
-	// Length of data (16-bit little endian)
-	length := uint16(len(input))
-	s.encoder.output[pos] = byte(length)
-	s.encoder.output[pos+1] = byte(length >> 8)
-	pos += 2
-
-	// NLEN (one's complement of length)
-	nlength := uint16(^length)
-	s.encoder.output[pos] = byte(nlength)
-	s.encoder.output[pos+1] = byte(nlength >> 8)
-	pos += 2
-
-	// Copy raw data
-	copy(s.encoder.output[pos:], input)
-	pos += len(input)
-
-	// Add checksum if final block
-	if isFinal {
-		checksum := s.adler.Sum32()
-		s.encoder.output[pos] = byte(checksum >> 24)
-		s.encoder.output[pos+1] = byte(checksum >> 16)
-		s.encoder.output[pos+2] = byte(checksum >> 8)
-		s.encoder.output[pos+3] = byte(checksum)
-		pos += 4
+	if d.bw.err != nil {
+		return nil, 0, d.bw.err
 	}
 
-	s.totalOut += pos
-
-	return s.encoder.output[:pos], pos, nil
+	z.output = sw.buf
+	s.totalOut += len(z.output)
+	return z.output, len(z.output), nil
 }
 
 // Reset resets the stream for reuse
@@ -164,49 +166,15 @@ func (s *ZlibStream) Reset() {
 	s.totalOut = 0
 }
 
-// Decompress decompresses zlib-formatted data
+// Decompress decompresses zlib-formatted data into the encoder's buffer
+// Returns nil if the data is invalid or does not fit the buffer.
 func (z *ZlibEncoder) Decompress(compressed []byte, compressedSize int) ([]byte, int, error) {
-	if compressedSize < 7 {
-		return nil, 0, nil
-	}
-
-	// Verify zlib header
-	if compressed[0] != 0x78 {
-		return nil, 0, nil
-	}
-
-	dataStart := 7
-	dataLength := int(compressed[3]) | (int(compressed[4]) << 8)
-
-	if dataStart+dataLength+4 > compressedSize {
-		return nil, 0, nil
-	}
-
-	if dataLength > len(z.buf) {
-		dataLength = len(z.buf)
-	}
-
-	// Copy uncompressed data
-	copy(z.buf, compressed[dataStart:dataStart+dataLength])
-
-	// Verify Adler-32 checksum (big-endian)
-	checksumStart := compressedSize - 4
-	expectedChecksum := uint32(compressed[checksumStart])<<24 |
-		uint32(compressed[checksumStart+1])<<16 |
-		uint32(compressed[checksumStart+2])<<8 |
-		uint32(compressed[checksumStart+3])
-
-	actualChecksum := adler32.Checksum(z.buf[:dataLength])
-	if actualChecksum != expectedChecksum {
-		return nil, 0, nil // Checksum mismatch
-	}
-
-	return z.buf[:dataLength], dataLength, nil
+	return z.DecompressStream(compressed, compressedSize)
 }
 
 // DecompressStream decompresses a stream with multiple blocks
 func (z *ZlibEncoder) DecompressStream(compressed []byte, compressedSize int) ([]byte, int, error) {
-	if compressedSize < 7 {
+	if compressedSize < 7 || compressedSize > len(compressed) {
 		return nil, 0, nil
 	}
 
@@ -214,57 +182,17 @@ func (z *ZlibEncoder) DecompressStream(compressed []byte, compressedSize int) ([
 	if compressed[0] != 0x78 {
 		return nil, 0, nil
 	}
-	pos := 2
-	outPos := 0
-
-	adler := adler32.New()
-
-	// Process DEFLATE blocks
-	for pos < compressedSize-4 { // Leave room for final checksum
-		// Read block header
-		blockHeader := compressed[pos]
-		pos++
-
-		isFinal := (blockHeader & 0x01) != 0
-		blockType := (blockHeader >> 1) & 0x03
-
-		if blockType != 0 { // Only support uncompressed blocks
-			return nil, 0, nil
-		}
-
-		if pos+4 > compressedSize {
-			return nil, 0, nil
-		}
-
-		// Read length
-		length := int(compressed[pos]) | (int(compressed[pos+1]) << 8)
-		nlength := int(compressed[pos+2]) | (int(compressed[pos+3]) << 8)
-		pos += 4
-
-		// Verify one's complement
-		if length != (^nlength & 0xFFFF) {
-			return nil, 0, nil
-		}
-
-		if pos+length > compressedSize-4 {
-			return nil, 0, nil
-		}
-
-		// Copy data
-		if outPos+length > len(z.buf) {
-			return nil, 0, nil // Output buffer too small
-		}
-		copy(z.buf[outPos:], compressed[pos:pos+length])
-		adler.Write(z.buf[outPos : outPos+length])
-		outPos += length
-		pos += length
-
-		if isFinal {
-			break
-		}
+
+	if z.inf == nil {
+		z.inf = &inflater{}
+	}
+	outPos, used, err := z.inf.inflate(compressed[2:compressedSize], z.buf)
+	if err != nil {
+		return nil, 0, nil
 	}
 
 	// Verify final Adler-32 checksum
+	pos := 2 + used
 	if pos+4 != compressedSize {
 		return nil, 0, nil
 	}
@@ -274,7 +202,7 @@ func (z *ZlibEncoder) DecompressStream(compressed []byte, compressedSize int) ([
 		uint32(compressed[pos+2])<<8 |
 		uint32(compressed[pos+3])
 
-	if adler.Sum32() != expectedChecksum {
+	if adler32.Checksum(z.buf[:outPos]) != expectedChecksum {
 		return nil, 0, nil
 	}
 
@@ -288,6 +216,7 @@ type Writer struct {
 	inputPos   int
 	adler      hash.Hash32
 	headerDone bool
+	def        *deflater
 }
 
 // NewWriter creates a new zlib Writer compatible with io.WriteCloser
@@ -300,6 +229,7 @@ func NewWriter(w io.Writer) *Writer {
 		output:   w,
 		inputBuf: make([]byte, 0, 8192),
 		adler:    adler32.New(),
+		def:      &deflater{}, // Encoder tables too, so Close doesn't allocate
 	}
 	debugPrint("[ZLIB] NewWriter: Writer created")
 	return writer
@@ -333,67 +263,20 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 // Close implements io.Closer and writes the compressed data
 func (w *Writer) Close() error {
 	debugPrint("[ZLIB] Close: Starting...")
+	d := w.def
+	d.bw.reset(w.output)
 
-	// Write zlib header
 	debugPrint("[ZLIB] Close: Writing header...")
-	header := []byte{0x78, 0x9C}
-	_, err := w.output.Write(header)
-	if err != nil {
-		debugPrint("[ZLIB] Close: Header write FAILED")
-		return err
-	}
-
-	// Write DEFLATE block header (final block, no compression)
-	debugPrint("[ZLIB] Close: Writing block header...")
-	blockHeader := []byte{0x01}
-	_, err = w.output.Write(blockHeader)
-	if err != nil {
-		debugPrint("[ZLIB] Close: Block header write FAILED")
-		return err
-	}
-
-	// Write length (16-bit little endian)
-	debugPrint("[ZLIB] Close: Writing length...")
-	length := uint16(len(w.inputBuf))
-	lengthBytes := []byte{byte(length), byte(length >> 8)}
-	_, err = w.output.Write(lengthBytes)
-	if err != nil {
-		debugPrint("[ZLIB] Close: Length write FAILED")
-		return err
-	}
-
-	// Write NLEN (one's complement of length)
-	debugPrint("[ZLIB] Close: Writing NLEN...")
-	nlength := ^length
-	nlengthBytes := []byte{byte(nlength), byte(nlength >> 8)}
-	_, err = w.output.Write(nlengthBytes)
-	if err != nil {
-		debugPrint("[ZLIB] Close: NLEN write FAILED")
-		return err
-	}
+	writeZlibHeader(&d.bw)
 
-	// Write raw data
-	debugPrint("[ZLIB] Close: Writing raw data...")
-	_, err = w.output.Write(w.inputBuf)
-	if err != nil {
-		debugPrint("[ZLIB] Close: Raw data write FAILED")
-		return err
-	}
+	debugPrint("[ZLIB] Close: Compressing...")
+	d.writeBlock(w.inputBuf, true)
 
-	// Calculate and write Adler-32 checksum (big-endian)
-	debugPrint("[ZLIB] Close: Calculating checksum...")
-	checksum := adler32.Checksum(w.inputBuf)
 	debugPrint("[ZLIB] Close: Writing checksum...")
-	checksumBytes := []byte{
-		byte(checksum >> 24),
-		byte(checksum >> 16),
-		byte(checksum >> 8),
-		byte(checksum),
-	}
-	_, err = w.output.Write(checksumBytes)
-	if err != nil {
-		debugPrint("[ZLIB] Close: Checksum write FAILED")
-		return err
+	writeZlibTrailer(&d.bw, adler32.Checksum(w.inputBuf))
+	if d.bw.err != nil {
+		debugPrint("[ZLIB] Close: Write FAILED")
+		return d.bw.err
 	}
 
 	debugPrint("[ZLIB] Close: Complete")
@@ -0,0 +1,231 @@
+package tinycompress
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testDictionaryJSON resembles the firmware data dictionary
+func testDictionaryJSON() []byte {
+	var sb strings.Builder
+	sb.WriteString(`{"version":"gopper-0.1.0","build_versions":"go-tinygo","config":{"CLOCK_FREQ":"12000000","MCU":"rp2040"},"commands":{`)
+	for i := 0; i < 60; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `"command_%d oid=%%c clock=%%u value=%%hu":%d`, i, i)
+	}
+	sb.WriteString(`},"enumerations":{"pin":{`)
+	for i := 0; i < 30; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `"gpio%d":%d`, i, i)
+	}
+	sb.WriteString(`}}}`)
+	return []byte(sb.String())
+}
+
+func testInputs() map[string][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rnd.Read(random)
+	large := bytes.Repeat(testDictionaryJSON(), 40) // Over 64KB
+	lowEntropy := make([]byte, 20000)
+	for i := range lowEntropy {
+		lowEntropy[i] = "abcd"[rnd.Intn(4)]
+	}
+
+	return map[string][]byte{
+		"single":     []byte("x"),
+		"short":      []byte("hello"),
+		"repeated":   bytes.Repeat([]byte("a"), 1000),
+		"dictionary": testDictionaryJSON(),
+		"random":     random,
+		"lowEntropy": lowEntropy,
+		"large":      large,
+	}
+}
+
+func inflateWithStdlib(t *testing.T, data []byte) []byte {
+	t.Helper()
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("zlib.NewReader failed: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("zlib read failed: %v", err)
+	}
+	return out
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	z := NewZlib(1 << 17)
+	for name, input := range testInputs() {
+		compressed, n, err := z.Compress(input)
+		if err != nil {
+			t.Errorf("%s: Compress failed: %v", name, err)
+			continue
+		}
+		if n != len(compressed) {
+			t.Errorf("%s: Expected size %d, got %d", name, len(compressed), n)
+		}
+		if n > storedSize(len(input))+6 {
+			t.Errorf("%s: Output %d larger than stored bound", name, n)
+		}
+		if got := inflateWithStdlib(t, compressed); !bytes.Equal(got, input) {
+			t.Errorf("%s: compress/zlib round trip mismatch", name)
+		}
+		// Compress reuses its output buffer, so copy before decompressing
+		compressed = append([]byte(nil), compressed...)
+		if got, _, _ := z.Decompress(compressed, len(compressed)); !bytes.Equal(got, input) {
+			t.Errorf("%s: Decompress round trip mismatch", name)
+		}
+	}
+}
+
+// TestCompressMixed covers inputs where fixed Huffman blocks win
+func TestCompressMixed(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	z := NewZlib(1 << 16)
+	fixed := 0
+	for i := 0; i < 500; i++ {
+		input := make([]byte, 1+rnd.Intn(3000))
+		alphabet := 1 + rnd.Intn(255)
+		for j := range input {
+			if j > 10 && rnd.Intn(3) == 0 {
+				input[j] = input[j-1-rnd.Intn(10)]
+			} else {
+				input[j] = byte(rnd.Intn(alphabet))
+			}
+		}
+		compressed, _, err := z.Compress(input)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		if (compressed[2]>>1)&3 == 1 {
+			fixed++
+		}
+		if got := inflateWithStdlib(t, compressed); !bytes.Equal(got, input) {
+			t.Fatalf("Round trip mismatch for %d bytes", len(input))
+		}
+	}
+	if fixed == 0 {
+		t.Error("Expected some fixed Huffman blocks")
+	}
+}
+
+func TestCompressRatio(t *testing.T) {
+	input := testDictionaryJSON()
+	compressed, n, err := NewZlib(0).Compress(input)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if n*3 > len(input) {
+		t.Errorf("Expected at least 3x compression of %d bytes, got %d", len(input), n)
+	}
+
+	// Dynamic Huffman should be chosen for dictionary-like data
+	if btype := (compressed[2] >> 1) & 3; btype != 2 {
+		t.Errorf("Expected dynamic Huffman block, got type %d", btype)
+	}
+}
+
+func TestDecompressStdlib(t *testing.T) {
+	for name, input := range testInputs() {
+		for _, level := range []int{zlib.NoCompression, zlib.BestSpeed, zlib.BestCompression, zlib.HuffmanOnly} {
+			var buf bytes.Buffer
+			w, _ := zlib.NewWriterLevel(&buf, level)
+			w.Write(input)
+			w.Close()
+
+			z := NewZlib(len(input))
+			got, n, _ := z.Decompress(buf.Bytes(), buf.Len())
+			if n != len(input) || !bytes.Equal(got, input) {
+				t.Errorf("%s level %d: Decompress mismatch", name, level)
+			}
+		}
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	input := testDictionaryJSON()
+	z := NewZlib(len(input))
+	compressed, _, _ := z.Compress(input)
+	compressed = append([]byte(nil), compressed...)
+
+	compressed[len(compressed)/2] ^= 0x10
+	if got, _, _ := z.Decompress(compressed, len(compressed)); got != nil {
+		t.Error("Expected nil for corrupt data")
+	}
+	if got, _, _ := NewZlib(10).Decompress(compressed, len(compressed)); got != nil {
+		t.Error("Expected nil when output does not fit")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	for name, input := range testInputs() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		// Write in pieces like the dictionary builder might
+		for i := 0; i < len(input); i += 1000 {
+			end := min(i+1000, len(input))
+			w.Write(input[i:end])
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: Close failed: %v", name, err)
+		}
+		if got := inflateWithStdlib(t, buf.Bytes()); !bytes.Equal(got, input) {
+			t.Errorf("%s: Writer round trip mismatch", name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Close(); err != nil {
+		t.Fatalf("Close of empty writer failed: %v", err)
+	}
+	if got := inflateWithStdlib(t, buf.Bytes()); len(got) != 0 {
+		t.Errorf("Expected empty output, got %d bytes", len(got))
+	}
+}
+
+func TestStream(t *testing.T) {
+	parts := [][]byte{
+		[]byte(`{"version":"gopper",`),
+		bytes.Repeat([]byte(`"queue_step oid=%c interval=%u",`), 20),
+		testDictionaryJSON(),
+	}
+	s := NewZlib(0).NewStream()
+	var out []byte
+	for i, p := range parts {
+		block, _, err := s.WriteBlock(p, i == len(parts)-1)
+		if err != nil {
+			t.Fatalf("WriteBlock failed: %v", err)
+		}
+		out = append(out, block...)
+	}
+
+	want := bytes.Join(parts, nil)
+	if got := inflateWithStdlib(t, out); !bytes.Equal(got, want) {
+		t.Error("Stream round trip mismatch")
+	}
+}
+
+func TestCompressAllocations(t *testing.T) {
+	input := testDictionaryJSON()
+	z := NewZlib(0)
+	z.Compress(input) // Allocates the encoder tables and output buffer
+
+	allocs := testing.AllocsPerRun(10, func() {
+		z.Compress(input)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations after the first call, got %v", allocs)
+	}
+}